@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/prometheus/common/model"
+	"github.com/spf13/cobra"
+	"os"
+	"time"
+)
+
+var (
+	auditId    string
+	auditOwner string
+	auditSince string
+	auditUntil string
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Prints the audit log of mark, ignore, snooze and delete decisions as JSON",
+	Long: `'audit' reads every recorded decision about a candidate from the cache, oldest first.  Narrow it down
+            by resource id or candidate key, owner, or a time range.  --since and --until take an RFC3339
+            timestamp or a duration before now, eg: 1d or 12h.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, log := loadConfig()
+		since, err := parseAuditTime(auditSince)
+		if err != nil {
+			log.Fatalf("invalid --since: %v", err)
+		}
+		until, err := parseAuditTime(auditUntil)
+		if err != nil {
+			log.Fatalf("invalid --until: %v", err)
+		}
+		events, err := mark.ReadAudit(openCache(cfg, log), mark.AuditQuery{
+			Id:    auditId,
+			Owner: auditOwner,
+			Since: since,
+			Until: until,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(events); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// parseAuditTime reads an RFC3339 timestamp or a duration that far back from now
+func parseAuditTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := model.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither an RFC3339 time nor a duration", s)
+	}
+	return time.Now().Add(-time.Duration(d)), nil
+}
+
+func init() {
+	auditCmd.Flags().StringVar(&auditId, "id", "", "only show decisions about this resource id or candidate key")
+	auditCmd.Flags().StringVar(&auditOwner, "owner", "", "only show decisions about this owner's resources")
+	auditCmd.Flags().StringVar(&auditSince, "since", "", "only show decisions made at or after this time")
+	auditCmd.Flags().StringVar(&auditUntil, "until", "", "only show decisions made at or before this time")
+	rootCmd.AddCommand(auditCmd)
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"encoding/json"
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/spf13/cobra"
+	"os"
+	"os/user"
+)
+
+var holdsCmd = &cobra.Command{
+	Use:   "holds",
+	Short: "Prints the sweeps that went over their sweep limits and are waiting on approval as JSON",
+	Long: `'holds' lists every marker whose sweep was halted by its sweep_limits.  A halted marker deletes nothing
+            until its hold is approved with 'holds approve'.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, log := loadConfig()
+		holds, err := mark.ReadHolds(openCache(cfg, log))
+		if err != nil {
+			log.Fatal(err)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(holds); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+var holdsApproveCmd = &cobra.Command{
+	Use:   "approve <hold key>",
+	Short: "Lets a halted marker's next sweep delete everything that's due",
+	Long: `'holds approve' takes a key from 'holds', eg: AWS:my-account.  The approval is good for one sweep, which
+            goes ahead whatever the limits say.  It doesn't start the sweep.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, log := loadConfig()
+		bilgeCache := openCache(cfg, log)
+		defer bilgeCache.Close() //nolint
+		h, ok := mark.ReadHold(bilgeCache, args[0])
+		if !ok {
+			log.Fatalf("There is no hold %s", args[0])
+		}
+		if err := mark.ApproveHold(bilgeCache, h, cliActor()); err != nil {
+			log.Fatal(err)
+		}
+		log.Infof("Approved the next sweep of %s", h.Key)
+	},
+}
+
+// cliActor is who the audit log says acted from the command line
+func cliActor() string {
+	if u, err := user.Current(); err == nil {
+		return "cli:" + u.Username
+	}
+	return "cli"
+}
+
+func init() {
+	holdsCmd.AddCommand(holdsApproveCmd)
+	rootCmd.AddCommand(holdsCmd)
+}
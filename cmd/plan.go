@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// plan exits with this when the next sweep would delete something, so CI can tell it apart from a failure
+const PLAN_PENDING_EXIT_CODE = 2
+
+var planOutput string
+
+var planCmd = &cobra.Command{
+	Use:   "plan [marker name]",
+	Short: "Shows what the next sweep would delete, without touching the cache or any resources",
+	Long: `'plan' copies the cache, runs a mark and a dry run sweep for one or every configured marker against
+            the copy and lists what changed: candidates the next sweeps will delete and when, newly marked
+            resources, candidates that are no longer candidates and resources an ignore filter skipped.  It exits
+            2 when the next sweep would delete something.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, log := loadConfig()
+		write, ok := planWriters[planOutput]
+		if !ok {
+			log.Fatalf("invalid --output %s, must be one of table, json or csv", planOutput)
+		}
+		name := ""
+		if len(args) == 1 {
+			name = args[0]
+		}
+		planConfig(cfg, name)
+
+		bilgeCache := openCache(cfg, log)
+		pc, err := mark.NewPlanCache(bilgeCache)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := bilgeCache.Close(); err != nil {
+			log.Fatal(err)
+		}
+
+		markers := buildMarkers(context.Background(), cfg, log, pc)
+		if len(markers) == 0 && name != "" {
+			log.Fatalf("There are no markers named %s configured", name)
+		}
+		if len(markers) == 0 {
+			log.Fatal("There are no markers configured")
+		}
+		start := time.Now()
+		for _, m := range markers {
+			log.Infof("Planning %s marker %s", m.GetType(), m.GetName())
+			m.Mark()
+			m.Sweep()
+		}
+		entries, err := pc.Plan(markers, start)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := write(os.Stdout, entries); err != nil {
+			log.Fatal(err)
+		}
+		// the deletions are still listed, they happen once the sweep is approved
+		for _, h := range pc.Holds(markers) {
+			log.Warn(h.Summary())
+		}
+		if mark.Pending(entries) {
+			os.Exit(PLAN_PENDING_EXIT_CODE)
+		}
+	},
+}
+
+// planConfig keeps only the markers called name, or all of them if it's empty, and turns deletes off
+func planConfig(cfg *config.Config, name string) {
+	aws := []config.Aws{}
+	for _, a := range cfg.Aws {
+		if name == "" || a.Name == name {
+			a.DeleteEnabled = false
+			aws = append(aws, a)
+		}
+	}
+	gcp := []config.Gcp{}
+	for _, g := range cfg.Gcp {
+		if name == "" || g.Name == name {
+			g.DeleteEnabled = false
+			gcp = append(gcp, g)
+		}
+	}
+	k8s := []config.Kubernetes{}
+	for _, k := range cfg.Kubernetes {
+		if name == "" || k.Name == name {
+			k.DeleteEnabled = false
+			k8s = append(k8s, k)
+		}
+	}
+	cfg.Aws, cfg.Gcp, cfg.Kubernetes = aws, gcp, k8s
+}
+
+var planWriters = map[string]func(io.Writer, []*mark.PlanEntry) error{
+	"table": writePlanTable,
+	"json":  writePlanJSON,
+	"csv":   writePlanCSV,
+}
+
+var planHeadings = map[string]string{
+	mark.PLAN_MARK:   "Newly marked",
+	mark.PLAN_DROP:   "No longer a candidate",
+	mark.PLAN_IGNORE: "Ignored",
+}
+
+func planHeading(e *mark.PlanEntry) string {
+	if e.Action == mark.PLAN_DELETE {
+		return fmt.Sprintf("Will delete at %s", e.DeleteAt.Format(time.RFC3339))
+	}
+	return planHeadings[e.Action]
+}
+
+// writePlanTable groups entries under a heading per action, and per sweep for deletions.  entries come
+// sorted that way from the plan.
+func writePlanTable(w io.Writer, entries []*mark.PlanEntry) error {
+	if len(entries) == 0 {
+		_, err := fmt.Fprintln(w, "No changes.")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	heading := ""
+	for _, e := range entries {
+		if h := planHeading(e); h != heading {
+			if heading != "" {
+				fmt.Fprintln(tw)
+			}
+			heading = h
+			fmt.Fprintf(tw, "%s:\n", h)
+		}
+		reason := ""
+		if e.Reason != "" && (e.Action == mark.PLAN_DROP || e.Action == mark.PLAN_IGNORE) {
+			reason = fmt.Sprintf("(%s)", e.Reason)
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.MarkerType, e.Account, e.Region, e.CandidateType, e.Id, e.Owner, reason)
+	}
+	return tw.Flush()
+}
+
+func writePlanJSON(w io.Writer, entries []*mark.PlanEntry) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
+
+func writePlanCSV(w io.Writer, entries []*mark.PlanEntry) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"action", "delete_at", "due", "marker", "account", "region", "type", "id", "owner", "reason"})
+	for _, e := range entries {
+		deleteAt := ""
+		if e.DeleteAt != nil {
+			deleteAt = e.DeleteAt.Format(time.RFC3339)
+		}
+		cw.Write([]string{e.Action, deleteAt, fmt.Sprint(e.Due), e.MarkerType.String(), e.Account, e.Region,
+			e.CandidateType, e.Id, e.Owner, e.Reason})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func init() {
+	planCmd.Flags().StringVarP(&planOutput, "output", "o", "table", "output format: table, json or csv")
+	rootCmd.AddCommand(planCmd)
+}
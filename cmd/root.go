@@ -3,15 +3,20 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"github.com/armory-io/bilgepump/pkg/api"
 	"github.com/armory-io/bilgepump/pkg/cache"
 	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/armory-io/bilgepump/pkg/leader"
 	"github.com/armory-io/bilgepump/pkg/mark"
 	awsmarker "github.com/armory-io/bilgepump/pkg/mark/aws"
+	gcpmarker "github.com/armory-io/bilgepump/pkg/mark/gcp"
 	k8smarker "github.com/armory-io/bilgepump/pkg/mark/k8s"
+	"github.com/armory-io/bilgepump/pkg/metrics"
 	"github.com/armory-io/bilgepump/pkg/notify"
 	"github.com/robfig/cron"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -34,84 +39,158 @@ var rootCmd = &cobra.Command{
 		cfg, log := loadConfig()
 
 		ctx, cancel := context.WithCancel(context.Background())
-		stop := make(chan os.Signal, 1)
+		stop := make(chan os.Signal, 2)
 		signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
 
-		go func() {
-			<-stop
-			cancel()
-			log.Warn("Received signal, stopping processes...")
-			os.Exit(1)
-		}()
-
-		// start a "cache" client
-		redisCache, err := cache.NewRedisCache(cfg, log)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		markers := []mark.Marker{}
-
-		// Each marker interface is added individually because in theory, each account is unique with its own
-		// api limits
-		if cfg.Aws != nil {
-			for _, a := range cfg.Aws {
-				aws := a
-				m := awsmarker.NewAwsMarker(ctx, &aws, log, redisCache)
-				markers = append(markers, m)
-			}
-		}
-
-		if cfg.Kubernetes != nil {
-			for _, k := range cfg.Kubernetes {
-				k8s := k
-				m, err := k8smarker.NewK8SMarker(ctx, &k8s, log, redisCache)
-				if err != nil {
-					log.Error(err)
-					continue
-				}
-				markers = append(markers, m)
-			}
-		}
-
+		bilgeCache := openCache(cfg, log)
+		jobs := mark.NewJobs()
+		markers := trackMarkers(jobs, buildMarkers(ctx, cfg, log, bilgeCache))
 		if len(markers) == 0 {
 			log.Fatal("There are no markers configured")
 		}
 
-		var sla *notify.SlackNotifier
-		// check to make sure slack works
-		if cfg.Slack.Token != "" {
-			sla = notify.NewSlackNotifier(ctx, cfg, log, redisCache)
-			if !sla.IsValid() {
-				log.Fatal("Slack isn't configured with proper default account")
-			}
+		// every configured notifier gets the same digests on each marker's notify schedule
+		notifiers, err := notify.NewRegistry(ctx, cfg, log, bilgeCache)
+		if err != nil {
+			log.Fatal(err)
 		}
 		c := cron.New()
 		for _, m := range markers {
 			log.Infof("Adding %s marker %s with mark schedule %s, sweep schedule %s, notify schedule %v", m.GetType(),
 				m.GetName(), m.GetMarkSchedule(), m.GetSweepSchedule(), m.GetNotifySchedule())
-			err = c.AddFunc(m.GetMarkSchedule(), m.Mark) // we don't bother checking for schedule parse because we did it in cfg
+			err := c.AddFunc(m.GetMarkSchedule(), m.Mark) // we don't bother checking for schedule parse because we did it in cfg
 			if err != nil {
 				log.Fatal(err)
 			}
 
-			err = c.AddFunc(m.GetSweepSchedule(), m.Sweep)
+			// a sweep that halts on its sweep limits tells the default owner as soon as it does
+			sweep := m.Sweep
+			if notifiers.Len() != 0 {
+				sweep = notifiers.Sweep(m)
+			}
+			err = c.AddFunc(m.GetSweepSchedule(), sweep)
 			if err != nil {
 				log.Fatal(err)
 			}
 
-			if sla != nil {
-				err = c.AddFunc(m.GetNotifySchedule(), sla.Collect)
+			if notifiers.Len() != 0 {
+				err = c.AddFunc(m.GetNotifySchedule(), jobs.Func(notifiers.Collect))
 				if err != nil {
 					log.Fatal(err)
 				}
 
 			}
 		}
-		c.Run()
+
+		// with leader election on, only the leader starts the scheduler
+		elector := newElector(cfg, log, bilgeCache, c.Start)
+		var srv *api.Server
+		if cfg.Api.Listen != "" {
+			srv = serveApi(cfg, log, bilgeCache, markers, elector)
+		} else if cfg.Slack.SigningSecret.IsSet() {
+			log.Warnf("slack buttons need api.listen set to receive interactions at %s", api.SLACK_INTERACTIONS_PATH)
+		}
+		if elector != nil {
+			elector.Run()
+		} else {
+			c.Start()
+		}
+		os.Exit(shutdown(cfg, log, stop, cancel, jobs, c.Stop, srv, elector, bilgeCache))
 	},
 }
 
+// openCache starts a "cache" client and brings any old layout up to date
+func openCache(cfg *config.Config, log *logrus.Logger) cache.Cache {
+	bilgeCache, err := cache.NewCache(cfg, log)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := mark.MigrateCandidates(bilgeCache, log); err != nil {
+		log.Fatal(err)
+	}
+	return bilgeCache
+}
+
+func buildMarkers(ctx context.Context, cfg *config.Config, log *logrus.Logger, bilgeCache cache.Cache) []mark.Marker {
+	markers := []mark.Marker{}
+
+	// Each marker interface is added individually because in theory, each account is unique with its own
+	// api limits
+	if cfg.Aws != nil {
+		for _, a := range cfg.Aws {
+			aws := a
+			m, err := awsmarker.NewAwsMarker(ctx, &aws, log, bilgeCache)
+			if err != nil {
+				log.Error(err)
+				continue
+			}
+			markers = append(markers, m)
+		}
+	}
+
+	if cfg.Gcp != nil {
+		for _, g := range cfg.Gcp {
+			gcp := g
+			m, err := gcpmarker.NewGcpMarker(ctx, &gcp, log, bilgeCache)
+			if err != nil {
+				log.Error(err)
+				continue
+			}
+			markers = append(markers, m)
+		}
+	}
+
+	if cfg.Kubernetes != nil {
+		for _, k := range cfg.Kubernetes {
+			k8s := k
+			m, err := k8smarker.NewK8SMarker(ctx, &k8s, log, bilgeCache)
+			if err != nil {
+				log.Error(err)
+				continue
+			}
+			markers = append(markers, m)
+		}
+	}
+	return markers
+}
+
+// newElector returns nil unless leader election is configured.  lead is called when we become the leader.
+func newElector(cfg *config.Config, log *logrus.Logger, bilgeCache cache.Cache, lead func()) *leader.Elector {
+	if !cfg.LeaderElection.Enabled() {
+		return nil
+	}
+	elector, err := leader.NewElector(cfg, log, bilgeCache, lead)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return elector
+}
+
+// serveApi starts the api in the background.  it's stopped by shutdown.  if there's an elector the api is
+// read only until we're the leader.
+func serveApi(cfg *config.Config, log *logrus.Logger, bilgeCache cache.Cache, markers []mark.Marker, elector *leader.Elector) *api.Server {
+	srv, err := api.NewServer(&cfg.Api, log, bilgeCache, markers)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if elector != nil {
+		srv.ReadOnly = func() bool { return !elector.IsLeader() }
+	}
+	if cfg.Slack.SigningSecret.IsSet() {
+		srv.Interactions, err = notify.NewSlackInteractionHandler(cfg, log, bilgeCache, markers)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	metrics.Registry.MustRegister(metrics.NewCacheCollector(bilgeCache))
+	go func() {
+		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+	return srv
+}
+
 func loadConfig() (*config.Config, *logrus.Logger) {
 	log = logrus.New()
 	var level logrus.Level
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"context"
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/spf13/cobra"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+const DEFAULT_API_LISTEN = ":8080"
+
+var ServeListen string
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serves the candidate api without scheduling mark, sweep or notify runs",
+	Long: `'serve' starts only the http api.  Owners can list candidates, extend grace periods and exempt
+            resources, and mark or sweep runs can be started by hand.  Set api.listen in the config to also
+            serve the api alongside the scheduler.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, log := loadConfig()
+		if cfg.Api.Listen == "" {
+			cfg.Api.Listen = ServeListen
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		stop := make(chan os.Signal, 2)
+		signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+
+		bilgeCache := openCache(cfg, log)
+		jobs := mark.NewJobs()
+		markers := trackMarkers(jobs, buildMarkers(ctx, cfg, log, bilgeCache))
+		srv := serveApi(cfg, log, bilgeCache, markers, nil)
+		os.Exit(shutdown(cfg, log, stop, cancel, jobs, nil, srv, nil, bilgeCache))
+	},
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&ServeListen, "listen", DEFAULT_API_LISTEN, "address to serve the api on when api.listen isn't configured")
+	rootCmd.AddCommand(serveCmd)
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"context"
+	"github.com/armory-io/bilgepump/pkg/api"
+	"github.com/armory-io/bilgepump/pkg/cache"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/armory-io/bilgepump/pkg/leader"
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/prometheus/common/model"
+	"github.com/sirupsen/logrus"
+	"os"
+	"time"
+)
+
+// once their context is canceled jobs only have to notice, so this doesn't need to be long
+const SHUTDOWN_CANCEL_WAIT = 10 * time.Second
+
+// trackMarkers counts every mark and sweep run, whether the scheduler, the api or slack started it
+func trackMarkers(jobs *mark.Jobs, markers []mark.Marker) []mark.Marker {
+	tracked := []mark.Marker{}
+	for _, m := range markers {
+		tracked = append(tracked, jobs.Track(m))
+	}
+	return tracked
+}
+
+// shutdown waits for a stop signal and then winds everything down in order: the scheduler and the api
+// stop taking on work, running jobs get up to shutdown_timeout to finish, anything still running after
+// that has its context canceled, the lease is given up and the cache is closed last.  A second signal
+// cancels running jobs straight away.  Losing leadership does too, since a standby may already be
+// running the same jobs.  It returns the exit code, 0 if every job finished on its own.
+func shutdown(cfg *config.Config, log *logrus.Logger, stop chan os.Signal, cancel context.CancelFunc, jobs *mark.Jobs,
+	stopScheduler func(), srv *api.Server, elector *leader.Elector, bilgeCache cache.Cache) int {
+	var lost <-chan struct{}
+	if elector != nil {
+		lost = elector.Lost()
+	}
+	// validated with the rest of the config
+	timeout, _ := model.ParseDuration(cfg.ShutdownTimeout)
+	select {
+	case sig := <-stop:
+		log.Warnf("Received %s, waiting up to %s for running jobs to finish...", sig, timeout)
+	case <-lost:
+		log.Error("Lost leadership, canceling running jobs")
+		cancel()
+		timeout = model.Duration(SHUTDOWN_CANCEL_WAIT)
+	}
+	go func() {
+		select {
+		case sig := <-stop:
+			log.Warnf("Received %s again, canceling running jobs", sig)
+		case <-lost:
+			log.Error("Lost leadership, canceling running jobs")
+		}
+		cancel()
+	}()
+
+	code := 0
+	if stopScheduler != nil {
+		stopScheduler()
+	}
+	if srv != nil {
+		ctx, done := context.WithTimeout(context.Background(), time.Duration(timeout))
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Error(err)
+			code = 1
+		}
+		done()
+	}
+	if !jobs.Stop(time.Duration(timeout)) {
+		log.Warnf("Jobs still running after %s, canceling them", timeout)
+		code = 1
+		cancel()
+		if !jobs.Stop(SHUTDOWN_CANCEL_WAIT) {
+			log.Errorf("Jobs still running %s after they were canceled, exiting anyway", SHUTDOWN_CANCEL_WAIT)
+		}
+	}
+	cancel()
+	if elector != nil {
+		select {
+		case <-lost:
+			code = 1
+		default:
+		}
+		// the lease lives in the cache with the redis backend, so give it up first
+		elector.Resign(SHUTDOWN_CANCEL_WAIT)
+	}
+	if err := bilgeCache.Close(); err != nil {
+		log.Error(err)
+		code = 1
+	}
+	if code == 0 {
+		log.Info("Stopped cleanly")
+	}
+	return code
+}
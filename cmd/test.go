@@ -5,6 +5,7 @@ import (
 	"github.com/armory-io/bilgepump/pkg/cache"
 	"github.com/armory-io/bilgepump/pkg/config"
 	"github.com/armory-io/bilgepump/pkg/mark/aws"
+	"github.com/armory-io/bilgepump/pkg/mark/gcp"
 	"github.com/armory-io/bilgepump/pkg/mark/k8s"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -41,7 +42,42 @@ var awsCmd = &cobra.Command{
 		mc := cache.NewMockCache()
 		ctx := context.Background()
 		account := accounts[args[0]]
-		m := aws.NewAwsMarker(ctx, &account, log, mc)
+		m, err := aws.NewAwsMarker(ctx, &account, log, mc)
+		if err != nil {
+			log.Fatal(err)
+		}
+		m.Mark()
+	},
+}
+
+var gcpCmd = &cobra.Command{
+	Use:   "gcp",
+	Short: "Runs a single marker for gcp account name",
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, log := loadConfig()
+		log.SetLevel(logrus.DebugLevel)
+
+		if cfg.Gcp == nil {
+			log.Fatal("No GCP configuration present")
+		}
+		if len(args) <= 0 || len(args) >= 2 {
+			log.Fatal("No account specified")
+		}
+		accounts := map[string]config.Gcp{}
+		for _, g := range cfg.Gcp {
+			accounts[g.Name] = g
+		}
+		if _, ok := accounts[args[0]]; !ok {
+			log.Fatalf("Account %s is not in %s", args[0], ConfigLocation)
+		}
+		log.Infof("Doing a test mark run for %s", accounts[args[0]].Name)
+		mc := cache.NewMockCache()
+		ctx := context.Background()
+		account := accounts[args[0]]
+		m, err := gcp.NewGcpMarker(ctx, &account, log, mc)
+		if err != nil {
+			log.Fatal(err)
+		}
 		m.Mark()
 	},
 }
@@ -81,5 +117,6 @@ var k8sCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(testCmd)
 	testCmd.AddCommand(awsCmd)
+	testCmd.AddCommand(gcpCmd)
 	testCmd.AddCommand(k8sCmd)
 }
@@ -0,0 +1,425 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/armory-io/bilgepump/pkg/cache"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/armory-io/bilgepump/pkg/metrics"
+	"github.com/prometheus/common/model"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	API_PREFIX = "/api/v1/"
+	// slack can't send our token, it signs its requests instead
+	SLACK_INTERACTIONS_PATH = "/slack/interactions"
+	// scrapers don't send the token either
+	METRICS_PATH = "/metrics"
+	// who the audit log says acted on a candidate through the api
+	API_ACTOR = "api"
+)
+
+// Server exposes the cache and the configured markers over http so owners can see what is about to be
+// deleted and do something about it without waiting on a notification.
+type Server struct {
+	Config  *config.Api
+	Logger  *logrus.Logger
+	Cache   cache.Cache
+	Markers []mark.Marker
+	// Interactions handles slack button presses when slack interactivity is configured
+	Interactions http.Handler
+	// ReadOnly says whether to turn away anything but reads, eg: on a replica that isn't the leader
+	ReadOnly func() bool
+	token    string
+	mux      sync.Mutex
+	srv      *http.Server
+}
+
+// Candidate is a marked candidate along with its key and grace period deadline.  DeleteAt is empty once
+// the grace period has run out and the candidate is waiting on the next sweep.
+type Candidate struct {
+	*mark.MarkedCandidate
+	Key       string     `json:"key"`
+	DeleteAt  *time.Time `json:"delete_at,omitempty"`
+	Remaining string     `json:"remaining"`
+}
+
+type extendRequest struct {
+	Duration string `json:"duration"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func NewServer(cfg *config.Api, logger *logrus.Logger, c cache.Cache, markers []mark.Marker) (*Server, error) {
+	token, err := cfg.Token.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	return &Server{
+		Config:  cfg,
+		Logger:  logger,
+		Cache:   c,
+		Markers: markers,
+		token:   token,
+	}, nil
+}
+
+// ListenAndServe serves the api until Shutdown is called, when it returns http.ErrServerClosed
+func (s *Server) ListenAndServe() error {
+	s.Logger.Infof("Serving api on %s", s.Config.Listen)
+	srv := &http.Server{Addr: s.Config.Listen, Handler: s.Handler()}
+	s.mux.Lock()
+	s.srv = srv
+	s.mux.Unlock()
+	return srv.ListenAndServe()
+}
+
+// Shutdown stops accepting requests and waits for the ones in flight until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.srv == nil {
+		return nil
+	}
+	return s.srv.Shutdown(ctx)
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(API_PREFIX+"candidates", s.listCandidates)
+	mux.HandleFunc(API_PREFIX+"candidates/", s.candidate)
+	mux.HandleFunc(API_PREFIX+"exemptions", s.listExemptions)
+	mux.HandleFunc(API_PREFIX+"exemptions/", s.exemption)
+	mux.HandleFunc(API_PREFIX+"holds", s.listHolds)
+	mux.HandleFunc(API_PREFIX+"holds/", s.hold)
+	mux.HandleFunc(API_PREFIX+"markers", s.listMarkers)
+	mux.HandleFunc(API_PREFIX+"markers/", s.marker)
+
+	root := http.NewServeMux()
+	root.Handle(API_PREFIX, s.authenticate(s.readOnly(mux)))
+	root.Handle(METRICS_PATH, metrics.Handler())
+	if s.Interactions != nil {
+		root.Handle(SLACK_INTERACTIONS_PATH, s.readOnly(s.Interactions))
+	}
+	return root
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" {
+			given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(given), []byte(s.token)) != 1 {
+				s.writeError(w, http.StatusUnauthorized, "missing or invalid token")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) readOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.ReadOnly != nil && r.Method != http.MethodGet && r.Method != http.MethodHead && s.ReadOnly() {
+			s.writeError(w, http.StatusServiceUnavailable, "this replica is read only, send changes to the leader")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// pathParts splits the escaped path after prefix.  candidate keys contain colons and slashes so clients
+// must escape them, and we only unescape each part after splitting.
+func pathParts(r *http.Request, prefix string) ([]string, error) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), prefix), "/")
+	for i, p := range parts {
+		unescaped, err := url.PathUnescape(p)
+		if err != nil {
+			return nil, err
+		}
+		parts[i] = unescaped
+	}
+	return parts, nil
+}
+
+func (s *Server) listCandidates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	q := r.URL.Query()
+	owners := []string{q.Get("owner")}
+	if q.Get("owner") == "" {
+		var err error
+		owners, err = s.Cache.ReadOwners()
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	answer := []*Candidate{}
+	for _, o := range owners {
+		mcs, err := mark.BuildCandidates(o, s.Cache)
+		if err != nil {
+			continue
+		}
+		for _, m := range mcs {
+			if !matches(m, q) {
+				continue
+			}
+			answer = append(answer, s.newCandidate(m))
+		}
+	}
+	sort.Slice(answer, func(i, j int) bool { return answer[i].Key < answer[j].Key })
+	s.writeJSON(w, http.StatusOK, answer)
+}
+
+func matches(m *mark.MarkedCandidate, q url.Values) bool {
+	if a := q.Get("account"); a != "" && a != m.Account {
+		return false
+	}
+	if t := q.Get("type"); t != "" && t != m.CandidateType {
+		return false
+	}
+	if mt := q.Get("marker"); mt != "" && !strings.EqualFold(mt, m.MarkerType.String()) {
+		return false
+	}
+	return true
+}
+
+func (s *Server) newCandidate(m *mark.MarkedCandidate) *Candidate {
+	c := &Candidate{
+		MarkedCandidate: m,
+		Key:             m.Key(),
+		Remaining:       "0s",
+	}
+	if deadline, ok := s.Cache.ReadTimer(mark.TimerKey(c.Key)); ok {
+		c.DeleteAt = &deadline
+		c.Remaining = time.Until(deadline).Round(time.Second).String()
+	}
+	return c
+}
+
+// candidate handles /candidates/{key}, /candidates/{key}/extend and /candidates/{key}/exempt
+func (s *Server) candidate(w http.ResponseWriter, r *http.Request) {
+	parts, err := pathParts(r, API_PREFIX+"candidates/")
+	if err != nil || parts[0] == "" || len(parts) > 2 {
+		s.writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	key := parts[0]
+	m, ok := mark.ReadCandidate(s.Cache, key)
+	if !ok {
+		s.writeError(w, http.StatusNotFound, fmt.Sprintf("no candidate %s", key))
+		return
+	}
+
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		s.writeJSON(w, http.StatusOK, s.newCandidate(m))
+	case action == "extend" && r.Method == http.MethodPost:
+		var req extendRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		d, err := model.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			s.writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid duration %q", req.Duration))
+			return
+		}
+		deadline, err := mark.ExtendGracePeriod(s.Cache, key, time.Duration(d), API_ACTOR)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.Logger.Infof("Extended grace period for %s until %s", key, deadline)
+		s.writeJSON(w, http.StatusOK, s.newCandidate(m))
+	case action == "exempt" && r.Method == http.MethodPost:
+		if err := mark.Exempt(s.Cache, key, API_ACTOR); err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.Logger.Infof("Exempted %s", key)
+		w.WriteHeader(http.StatusNoContent)
+	case action == "" || action == "extend" || action == "exempt":
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	default:
+		s.writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) listExemptions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	exemptions, err := s.Cache.ReadExemptions()
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	sort.Strings(exemptions)
+	s.writeJSON(w, http.StatusOK, exemptions)
+}
+
+// exemption handles DELETE /exemptions/{key}.  the candidate comes back on the next mark run if it still
+// doesn't comply.
+func (s *Server) exemption(w http.ResponseWriter, r *http.Request) {
+	parts, err := pathParts(r, API_PREFIX+"exemptions/")
+	if err != nil || parts[0] == "" || len(parts) != 1 {
+		s.writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if r.Method != http.MethodDelete {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !s.Cache.ExemptionExists(parts[0]) {
+		s.writeError(w, http.StatusNotFound, fmt.Sprintf("no exemption %s", parts[0]))
+		return
+	}
+	if err := s.Cache.DeleteExemption(parts[0]); err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listHolds(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	holds, err := mark.ReadHolds(s.Cache)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, holds)
+}
+
+// hold handles /holds/{key} and /holds/{key}/approve.  approving doesn't start a sweep, the marker's next
+// one deletes everything that's due.
+func (s *Server) hold(w http.ResponseWriter, r *http.Request) {
+	parts, err := pathParts(r, API_PREFIX+"holds/")
+	if err != nil || parts[0] == "" || len(parts) > 2 {
+		s.writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	key := parts[0]
+	h, ok := mark.ReadHold(s.Cache, key)
+	if !ok {
+		s.writeError(w, http.StatusNotFound, fmt.Sprintf("no hold %s", key))
+		return
+	}
+
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		s.writeJSON(w, http.StatusOK, h)
+	case action == "approve" && r.Method == http.MethodPost:
+		if err := mark.ApproveHold(s.Cache, h, API_ACTOR); err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.Logger.Infof("Approved the next sweep of %s", key)
+		s.writeJSON(w, http.StatusOK, h)
+	case action == "" || action == "approve":
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	default:
+		s.writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+type markerResponse struct {
+	Name           string `json:"name"`
+	Type           string `json:"type"`
+	MarkSchedule   string `json:"mark_schedule"`
+	SweepSchedule  string `json:"sweep_schedule"`
+	NotifySchedule string `json:"notify_schedule"`
+}
+
+func (s *Server) listMarkers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	answer := []markerResponse{}
+	for _, m := range s.Markers {
+		answer = append(answer, markerResponse{
+			Name:           m.GetName(),
+			Type:           m.GetType().String(),
+			MarkSchedule:   m.GetMarkSchedule(),
+			SweepSchedule:  m.GetSweepSchedule(),
+			NotifySchedule: m.GetNotifySchedule(),
+		})
+	}
+	s.writeJSON(w, http.StatusOK, answer)
+}
+
+// marker handles POST /markers/{name}/mark and /markers/{name}/sweep.  runs happen in the background
+// since they can take a long time, and markers serialize their own runs so this can't overlap a
+// scheduled one.
+func (s *Server) marker(w http.ResponseWriter, r *http.Request) {
+	parts, err := pathParts(r, API_PREFIX+"markers/")
+	if err != nil || len(parts) != 2 || (parts[1] != "mark" && parts[1] != "sweep") {
+		s.writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	name, action := parts[0], parts[1]
+	found := []mark.Marker{}
+	for _, m := range s.Markers {
+		if m.GetName() == name && (r.URL.Query().Get("type") == "" || strings.EqualFold(r.URL.Query().Get("type"), m.GetType().String())) {
+			found = append(found, m)
+		}
+	}
+	if len(found) == 0 {
+		s.writeError(w, http.StatusNotFound, fmt.Sprintf("no marker %s", name))
+		return
+	}
+	for _, m := range found {
+		s.Logger.Infof("Starting %s run for %s marker %s from the api", action, m.GetType(), name)
+		if action == "mark" {
+			go m.Mark()
+		} else {
+			go m.Sweep()
+		}
+	}
+	s.writeJSON(w, http.StatusAccepted, map[string]string{"marker": name, "action": action})
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.Logger.Error(err)
+	}
+}
+
+func (s *Server) writeError(w http.ResponseWriter, status int, msg string) {
+	s.writeJSON(w, status, errorResponse{Error: msg})
+}
@@ -0,0 +1,245 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/armory-io/bilgepump/pkg/cache"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeMarker struct {
+	name   string
+	marked chan bool
+	swept  chan bool
+}
+
+func (fm *fakeMarker) Mark()                     { fm.marked <- true }
+func (fm *fakeMarker) Sweep()                    { fm.swept <- true }
+func (fm *fakeMarker) GetMarkSchedule() string   { return "@hourly" }
+func (fm *fakeMarker) GetSweepSchedule() string  { return "@daily" }
+func (fm *fakeMarker) GetNotifySchedule() string { return "@every 12h" }
+func (fm *fakeMarker) GetName() string           { return fm.name }
+func (fm *fakeMarker) GetType() mark.MarkerType  { return mark.AWS }
+
+var testCandidates = []*mark.MarkedCandidate{
+	{MarkerType: mark.AWS, CandidateType: "ec2", Id: "i-1", Owner: "alice", Account: "dev", Region: "us-west-2"},
+	{MarkerType: mark.AWS, CandidateType: "ebs", Id: "vol-1", Owner: "alice", Account: "prod", Region: "us-west-2"},
+	{MarkerType: mark.K8S, CandidateType: "namespace", Id: "ns-1", Owner: "bob", Account: "cluster"},
+}
+
+func newTestServer(t *testing.T, token string) (*httptest.Server, *cache.MemoryCache, *fakeMarker) {
+	mc := cache.NewMemoryCache()
+	for _, c := range testCandidates {
+		_, err := mark.WriteCandidate(mc, c, "24h")
+		assert.Nil(t, err)
+	}
+	fm := &fakeMarker{name: "dev", marked: make(chan bool, 1), swept: make(chan bool, 1)}
+	s, err := NewServer(&config.Api{Token: config.Secret{Value: token}}, logrus.New(), mc, []mark.Marker{fm})
+	assert.Nil(t, err)
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(srv.Close)
+	return srv, mc, fm
+}
+
+func do(t *testing.T, method, u, body, token string) *http.Response {
+	req, err := http.NewRequest(method, u, strings.NewReader(body))
+	assert.Nil(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func candidateUrl(srv *httptest.Server, key string) string {
+	return srv.URL + API_PREFIX + "candidates/" + url.PathEscape(key)
+}
+
+func TestListCandidates(t *testing.T) {
+	srv, _, _ := newTestServer(t, "")
+	cases := map[string]struct {
+		query    string
+		expected []string
+	}{
+		"all":     {"", []string{"AWS:dev:us-west-2:i-1", "AWS:prod:us-west-2:vol-1", "K8S:cluster::ns-1"}},
+		"owner":   {"owner=alice", []string{"AWS:dev:us-west-2:i-1", "AWS:prod:us-west-2:vol-1"}},
+		"account": {"account=prod", []string{"AWS:prod:us-west-2:vol-1"}},
+		"type":    {"type=namespace", []string{"K8S:cluster::ns-1"}},
+		"marker":  {"marker=aws&type=ec2", []string{"AWS:dev:us-west-2:i-1"}},
+		"none":    {"owner=nobody", []string{}},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			resp := do(t, http.MethodGet, srv.URL+API_PREFIX+"candidates?"+c.query, "", "")
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			var got []*Candidate
+			assert.Nil(t, json.NewDecoder(resp.Body).Decode(&got))
+			keys := []string{}
+			for _, g := range got {
+				keys = append(keys, g.Key)
+				assert.NotNil(t, g.DeleteAt)
+			}
+			assert.Equal(t, c.expected, keys)
+		})
+	}
+}
+
+func TestExtendCandidate(t *testing.T) {
+	srv, mc, _ := newTestServer(t, "")
+	key := testCandidates[0].Key()
+	before, ok := mc.ReadTimer(mark.TimerKey(key))
+	assert.True(t, ok)
+
+	resp := do(t, http.MethodPost, candidateUrl(srv, key)+"/extend", `{"duration":"2d"}`, "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var got Candidate
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&got))
+	assert.WithinDuration(t, before.Add(48*time.Hour), *got.DeleteAt, time.Second)
+
+	// an expired timer is extended from now
+	assert.Nil(t, mc.ResetTimer(mark.TimerKey(key), "24h", time.Now().Add(-time.Hour)))
+	resp = do(t, http.MethodPost, candidateUrl(srv, key)+"/extend", `{"duration":"1h"}`, "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	deadline, ok := mc.ReadTimer(mark.TimerKey(key))
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), deadline, time.Second)
+
+	resp = do(t, http.MethodPost, candidateUrl(srv, key)+"/extend", `{"duration":"soon"}`, "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = do(t, http.MethodPost, candidateUrl(srv, "AWS:dev:us-west-2:i-404")+"/extend", `{"duration":"1h"}`, "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestExemptCandidate(t *testing.T) {
+	srv, mc, _ := newTestServer(t, "")
+	key := testCandidates[0].Key()
+
+	resp := do(t, http.MethodPost, candidateUrl(srv, key)+"/exempt", "", "")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.False(t, mc.CandidateExists(key))
+
+	// marking it again doesn't bring it back
+	_, err := mark.WriteCandidate(mc, testCandidates[0], "24h")
+	assert.Nil(t, err)
+	assert.False(t, mc.CandidateExists(key))
+
+	resp = do(t, http.MethodGet, srv.URL+API_PREFIX+"exemptions", "", "")
+	var exemptions []string
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&exemptions))
+	assert.Equal(t, []string{key}, exemptions)
+
+	resp = do(t, http.MethodDelete, srv.URL+API_PREFIX+"exemptions/"+url.PathEscape(key), "", "")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	_, err = mark.WriteCandidate(mc, testCandidates[0], "24h")
+	assert.Nil(t, err)
+	assert.True(t, mc.CandidateExists(key))
+}
+
+func TestTriggerMarker(t *testing.T) {
+	srv, _, fm := newTestServer(t, "")
+
+	resp := do(t, http.MethodPost, srv.URL+API_PREFIX+"markers/dev/mark", "", "")
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.True(t, <-fm.marked)
+
+	resp = do(t, http.MethodPost, srv.URL+API_PREFIX+"markers/dev/sweep", "", "")
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.True(t, <-fm.swept)
+
+	resp = do(t, http.MethodPost, srv.URL+API_PREFIX+"markers/prod/mark", "", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp = do(t, http.MethodGet, srv.URL+API_PREFIX+"markers/dev/mark", "", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestHolds(t *testing.T) {
+	srv, mc, _ := newTestServer(t, "")
+	resp := do(t, http.MethodGet, srv.URL+API_PREFIX+"holds", "", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var holds []*mark.SweepHold
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&holds))
+	assert.Empty(t, holds)
+
+	for _, id := range []string{"i-2", "i-3"} {
+		expired := &mark.MarkedCandidate{MarkerType: mark.AWS, CandidateType: "ec2", Id: id, Owner: "alice", Account: "dev"}
+		_, err := mark.WriteCandidate(mc, expired, "0s")
+		assert.Nil(t, err)
+	}
+	h, err := mark.CheckSweep(mc, mark.AWS, "dev", config.SweepLimits{MaxDeletions: 1}, mark.NewInventory())
+	assert.Nil(t, err)
+	assert.NotNil(t, h)
+	holdUrl := srv.URL + API_PREFIX + "holds/" + url.PathEscape(h.Key)
+
+	resp = do(t, http.MethodGet, holdUrl, "", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var got *mark.SweepHold
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&got))
+	assert.Equal(t, mark.HOLD_PENDING, got.Status)
+	assert.Equal(t, 2, got.Due)
+
+	resp = do(t, http.MethodGet, holdUrl+"/approve", "", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	resp = do(t, http.MethodPost, srv.URL+API_PREFIX+"holds/AWS:prod/approve", "", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp = do(t, http.MethodPost, holdUrl+"/approve", "", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	approved, ok := mark.ReadHold(mc, h.Key)
+	assert.True(t, ok)
+	assert.Equal(t, mark.HOLD_APPROVED, approved.Status)
+	assert.Equal(t, API_ACTOR, approved.ApprovedBy)
+}
+
+func TestAuthentication(t *testing.T) {
+	srv, _, _ := newTestServer(t, "sekrit")
+	for token, status := range map[string]int{"": http.StatusUnauthorized, "wrong": http.StatusUnauthorized, "sekrit": http.StatusOK} {
+		resp := do(t, http.MethodGet, srv.URL+API_PREFIX+"candidates", "", token)
+		assert.Equal(t, status, resp.StatusCode, token)
+	}
+}
+
+func TestMetricsSkipAuthentication(t *testing.T) {
+	srv, _, _ := newTestServer(t, "sekrit")
+	resp := do(t, http.MethodGet, srv.URL+METRICS_PATH, "", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Contains(t, string(body), "go_goroutines")
+}
+
+func TestReadOnlyFollower(t *testing.T) {
+	mc := cache.NewMemoryCache()
+	_, err := mark.WriteCandidate(mc, testCandidates[0], "24h")
+	assert.Nil(t, err)
+	s, err := NewServer(&config.Api{}, logrus.New(), mc, []mark.Marker{})
+	assert.Nil(t, err)
+	leader := false
+	s.ReadOnly = func() bool { return !leader }
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(srv.Close)
+	key := testCandidates[0].Key()
+
+	resp := do(t, http.MethodGet, srv.URL+API_PREFIX+"candidates", "", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = do(t, http.MethodGet, srv.URL+METRICS_PATH, "", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = do(t, http.MethodPost, candidateUrl(srv, key)+"/exempt", "", "")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.True(t, mc.CandidateExists(key))
+
+	leader = true
+	resp = do(t, http.MethodPost, candidateUrl(srv, key)+"/exempt", "", "")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.False(t, mc.CandidateExists(key))
+}
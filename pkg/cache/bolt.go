@@ -0,0 +1,419 @@
+package cache
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+	"time"
+)
+
+var (
+	boltCandidatesBucket = []byte("candidates")
+	boltOwnersBucket     = []byte("owners")
+	boltTimersBucket     = []byte("timers")
+	boltExemptionsBucket = []byte("exemptions")
+	boltAuditBucket      = []byte("audit")
+	boltHoldsBucket      = []byte("holds")
+	boltInventoryBucket  = []byte("inventory")
+)
+
+// BoltCache is an embedded, file backed cache for single replica installs that don't want to run redis.
+// Candidates are json records keyed by candidate key, owners are nested buckets whose keys are candidate
+// keys and timers are json records with an expiry.
+type BoltCache struct {
+	Config *config.Config
+	Logger *logrus.Logger
+	DB     *bolt.DB
+}
+
+type boltCandidate struct {
+	Owner string `json:"owner"`
+	Data  string `json:"data"`
+}
+
+type boltTimer struct {
+	Value    string    `json:"value"`
+	ExpireAt time.Time `json:"expire_at"`
+}
+
+func NewBoltCache(cfg *config.Config, logger *logrus.Logger) (*BoltCache, error) {
+	logger.Debugf("opening bolt cache at %s...", cfg.Cache.Path)
+	db, err := bolt.Open(cfg.Cache.Path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{boltCandidatesBucket, boltOwnersBucket, boltTimersBucket, boltExemptionsBucket, boltAuditBucket, boltHoldsBucket, boltInventoryBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close() //nolint
+		return nil, err
+	}
+	bc := &BoltCache{
+		Config: cfg,
+		Logger: logger,
+		DB:     db,
+	}
+	if err := bc.purgeTimers(); err != nil {
+		logger.Warnf("unable to purge expired timers: %v", err)
+	}
+	return bc, nil
+}
+
+func (bc *BoltCache) Close() error {
+	return bc.DB.Close()
+}
+
+func (bc *BoltCache) WriteCandidate(key, owner, candidate string) error {
+	bc.Logger.Debugf("bolt write candidate: %s for owner: %s", key, owner)
+	record, err := json.Marshal(&boltCandidate{Owner: owner, Data: candidate})
+	if err != nil {
+		return err
+	}
+	return bc.DB.Update(func(tx *bolt.Tx) error {
+		candidates := tx.Bucket(boltCandidatesBucket)
+		if prev := readBoltCandidate(candidates, key); prev != nil && prev.Owner != owner {
+			if err := unindexBoltOwner(tx, prev.Owner, key); err != nil {
+				return err
+			}
+		}
+		if err := candidates.Put([]byte(key), record); err != nil {
+			return err
+		}
+		index, err := tx.Bucket(boltOwnersBucket).CreateBucketIfNotExists([]byte(owner))
+		if err != nil {
+			return err
+		}
+		return index.Put([]byte(key), []byte{})
+	})
+}
+
+func (bc *BoltCache) ReadCandidate(key string) (string, error) {
+	var data string
+	err := bc.DB.View(func(tx *bolt.Tx) error {
+		if c := readBoltCandidate(tx.Bucket(boltCandidatesBucket), key); c != nil {
+			data = c.Data
+		}
+		return nil
+	})
+	return data, err
+}
+
+func (bc *BoltCache) CandidateExists(key string) bool {
+	var exists bool
+	err := bc.DB.View(func(tx *bolt.Tx) error {
+		exists = tx.Bucket(boltCandidatesBucket).Get([]byte(key)) != nil
+		return nil
+	})
+	if err != nil {
+		bc.Logger.Error(err)
+		return false
+	}
+	return exists
+}
+
+func (bc *BoltCache) DeleteCandidate(key string) error {
+	bc.Logger.Debugf("bolt delete candidate: %s", key)
+	return bc.DB.Update(func(tx *bolt.Tx) error {
+		candidates := tx.Bucket(boltCandidatesBucket)
+		prev := readBoltCandidate(candidates, key)
+		if prev == nil {
+			return nil
+		}
+		if err := unindexBoltOwner(tx, prev.Owner, key); err != nil {
+			return err
+		}
+		return candidates.Delete([]byte(key))
+	})
+}
+
+func readBoltCandidate(candidates *bolt.Bucket, key string) *boltCandidate {
+	raw := candidates.Get([]byte(key))
+	if raw == nil {
+		return nil
+	}
+	var c boltCandidate
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil
+	}
+	return &c
+}
+
+// unindexBoltOwner removes a key from an owner's index, and the owner once their index is empty
+func unindexBoltOwner(tx *bolt.Tx, owner, key string) error {
+	owners := tx.Bucket(boltOwnersBucket)
+	index := owners.Bucket([]byte(owner))
+	if index == nil {
+		return nil
+	}
+	if err := index.Delete([]byte(key)); err != nil {
+		return err
+	}
+	if k, _ := index.Cursor().First(); k == nil {
+		return owners.DeleteBucket([]byte(owner))
+	}
+	return nil
+}
+
+func (bc *BoltCache) ReadOwners() ([]string, error) {
+	bc.Logger.Debug("bolt read owners")
+	answer := []string{}
+	err := bc.DB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltOwnersBucket).ForEach(func(k, _ []byte) error {
+			answer = append(answer, string(k))
+			return nil
+		})
+	})
+	return answer, err
+}
+
+func (bc *BoltCache) ReadCandidates(owner string) []string {
+	bc.Logger.Debugf("bolt read candidates for owner: %s", owner)
+	answer := []string{}
+	err := bc.DB.View(func(tx *bolt.Tx) error {
+		index := tx.Bucket(boltOwnersBucket).Bucket([]byte(owner))
+		if index == nil {
+			return nil
+		}
+		candidates := tx.Bucket(boltCandidatesBucket)
+		return index.ForEach(func(k, _ []byte) error {
+			if c := readBoltCandidate(candidates, string(k)); c != nil {
+				answer = append(answer, c.Data)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		bc.Logger.Error(err)
+	}
+	return answer
+}
+
+func (bc *BoltCache) WriteTimer(key, value string, ttl time.Time) error {
+	bc.Logger.Debugf("bolt write ttl key %s:%s with ttl %+v", key, value, ttl)
+	if bc.TimerExists(key) {
+		return nil
+	}
+	t, err := json.Marshal(&boltTimer{Value: value, ExpireAt: ttl})
+	if err != nil {
+		return err
+	}
+	return bc.DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltTimersBucket).Put([]byte(key), t)
+	})
+}
+
+// ResetTimer replaces a timer and its expiry whether or not it already exists
+func (bc *BoltCache) ResetTimer(key, value string, ttl time.Time) error {
+	bc.Logger.Debugf("bolt reset ttl key %s:%s with ttl %+v", key, value, ttl)
+	t, err := json.Marshal(&boltTimer{Value: value, ExpireAt: ttl})
+	if err != nil {
+		return err
+	}
+	return bc.DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltTimersBucket).Put([]byte(key), t)
+	})
+}
+
+func (bc *BoltCache) ReadTimer(key string) (time.Time, bool) {
+	var t boltTimer
+	err := bc.DB.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(boltTimersBucket).Get([]byte(key))
+		if raw == nil {
+			return nil
+		}
+		return json.Unmarshal(raw, &t)
+	})
+	if err != nil || !time.Now().Before(t.ExpireAt) {
+		return time.Time{}, false
+	}
+	return t.ExpireAt, true
+}
+
+// TimerExists mimics redis EXPIREAT semantics: a timer past its expiry reads as missing and is removed.
+func (bc *BoltCache) TimerExists(key string) bool {
+	var expired bool
+	var exists bool
+	err := bc.DB.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(boltTimersBucket).Get([]byte(key))
+		if raw == nil {
+			return nil
+		}
+		var t boltTimer
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return err
+		}
+		expired = !time.Now().Before(t.ExpireAt)
+		exists = !expired
+		return nil
+	})
+	if err != nil {
+		bc.Logger.Error(err)
+		return false
+	}
+	if expired {
+		err = bc.DB.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket(boltTimersBucket).Delete([]byte(key))
+		})
+		if err != nil {
+			bc.Logger.Error(err)
+		}
+	}
+	return exists
+}
+
+func (bc *BoltCache) WriteExemption(key string) error {
+	bc.Logger.Debugf("bolt write exemption: %s", key)
+	return bc.DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltExemptionsBucket).Put([]byte(key), []byte{})
+	})
+}
+
+func (bc *BoltCache) DeleteExemption(key string) error {
+	bc.Logger.Debugf("bolt delete exemption: %s", key)
+	return bc.DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltExemptionsBucket).Delete([]byte(key))
+	})
+}
+
+func (bc *BoltCache) ExemptionExists(key string) bool {
+	var exists bool
+	err := bc.DB.View(func(tx *bolt.Tx) error {
+		exists = tx.Bucket(boltExemptionsBucket).Get([]byte(key)) != nil
+		return nil
+	})
+	if err != nil {
+		bc.Logger.Error(err)
+		return false
+	}
+	return exists
+}
+
+func (bc *BoltCache) ReadExemptions() ([]string, error) {
+	answer := []string{}
+	err := bc.DB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltExemptionsBucket).ForEach(func(k, _ []byte) error {
+			answer = append(answer, string(k))
+			return nil
+		})
+	})
+	return answer, err
+}
+
+func (bc *BoltCache) WriteHold(key, hold string) error {
+	bc.Logger.Debugf("bolt write hold: %s", key)
+	return bc.DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltHoldsBucket).Put([]byte(key), []byte(hold))
+	})
+}
+
+func (bc *BoltCache) ReadHold(key string) (string, bool) {
+	var hold []byte
+	err := bc.DB.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(boltHoldsBucket).Get([]byte(key)); v != nil {
+			hold = append([]byte{}, v...)
+		}
+		return nil
+	})
+	if err != nil {
+		bc.Logger.Error(err)
+		return "", false
+	}
+	return string(hold), hold != nil
+}
+
+func (bc *BoltCache) DeleteHold(key string) error {
+	bc.Logger.Debugf("bolt delete hold: %s", key)
+	return bc.DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltHoldsBucket).Delete([]byte(key))
+	})
+}
+
+func (bc *BoltCache) ReadHolds() ([]string, error) {
+	answer := []string{}
+	err := bc.DB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltHoldsBucket).ForEach(func(_, v []byte) error {
+			answer = append(answer, string(v))
+			return nil
+		})
+	})
+	return answer, err
+}
+
+func (bc *BoltCache) WriteInventory(key, inventory string) error {
+	bc.Logger.Debugf("bolt write inventory: %s", key)
+	return bc.DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltInventoryBucket).Put([]byte(key), []byte(inventory))
+	})
+}
+
+func (bc *BoltCache) ReadInventory(key string) (string, bool) {
+	var inventory []byte
+	err := bc.DB.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(boltInventoryBucket).Get([]byte(key)); v != nil {
+			inventory = append([]byte{}, v...)
+		}
+		return nil
+	})
+	if err != nil {
+		bc.Logger.Error(err)
+		return "", false
+	}
+	return string(inventory), inventory != nil
+}
+
+// audit records are keyed by the bucket's sequence, big endian so they iterate in write order
+func (bc *BoltCache) AppendAudit(record string) error {
+	return bc.DB.Update(func(tx *bolt.Tx) error {
+		audit := tx.Bucket(boltAuditBucket)
+		seq, err := audit.NextSequence()
+		if err != nil {
+			return err
+		}
+		k := make([]byte, 8)
+		binary.BigEndian.PutUint64(k, seq)
+		return audit.Put(k, []byte(record))
+	})
+}
+
+func (bc *BoltCache) ReadAudit() ([]string, error) {
+	answer := []string{}
+	err := bc.DB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltAuditBucket).ForEach(func(_, v []byte) error {
+			answer = append(answer, string(v))
+			return nil
+		})
+	})
+	return answer, err
+}
+
+// purgeTimers drops timers that expired while bilgepump wasn't running
+func (bc *BoltCache) purgeTimers() error {
+	return bc.DB.Update(func(tx *bolt.Tx) error {
+		timers := tx.Bucket(boltTimersBucket)
+		expired := [][]byte{}
+		err := timers.ForEach(func(k, v []byte) error {
+			var t boltTimer
+			if err := json.Unmarshal(v, &t); err != nil || !time.Now().Before(t.ExpireAt) {
+				expired = append(expired, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expired {
+			if err := timers.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
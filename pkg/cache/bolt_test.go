@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestBoltCache(t *testing.T, path string) *BoltCache {
+	cfg := &config.Config{Cache: config.Cache{Backend: "bolt", Path: path}}
+	bc, err := NewBoltCache(cfg, logrus.New())
+	assert.Nil(t, err)
+	return bc
+}
+
+func TestBoltCacheCandidates(t *testing.T) {
+	bc := newTestBoltCache(t, filepath.Join(t.TempDir(), "bilge.db"))
+	defer bc.Close() //nolint
+
+	assert.Nil(t, bc.WriteCandidate("AWS:test:us-west-2:i-123", "some-jerk", `{"id":"i-123"}`))
+	assert.Nil(t, bc.WriteCandidate("AWS:test:us-west-2:i-123", "some-jerk", `{"id":"i-123","ttl":"1d"}`))
+	assert.Nil(t, bc.WriteCandidate("AWS:test:us-west-2:i-456", "some-jerk", `{"id":"i-456"}`))
+
+	owners, err := bc.ReadOwners()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"some-jerk"}, owners)
+	assert.Len(t, bc.ReadCandidates("some-jerk"), 2)
+	assert.True(t, bc.CandidateExists("AWS:test:us-west-2:i-123"))
+	assert.False(t, bc.CandidateExists("AWS:test:us-west-2:i-789"))
+
+	data, err := bc.ReadCandidate("AWS:test:us-west-2:i-123")
+	assert.Nil(t, err)
+	assert.Equal(t, `{"id":"i-123","ttl":"1d"}`, data)
+
+	// an owner change moves the candidate rather than duplicating it
+	assert.Nil(t, bc.WriteCandidate("AWS:test:us-west-2:i-123", "someone-else", `{"id":"i-123"}`))
+	assert.Len(t, bc.ReadCandidates("some-jerk"), 1)
+	assert.Len(t, bc.ReadCandidates("someone-else"), 1)
+
+	assert.Nil(t, bc.DeleteCandidate("AWS:test:us-west-2:i-456"))
+	assert.Nil(t, bc.DeleteCandidate("AWS:test:us-west-2:i-456"))
+	assert.Empty(t, bc.ReadCandidates("some-jerk"))
+	owners, err = bc.ReadOwners()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"someone-else"}, owners)
+}
+
+func TestBoltCacheTimers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bilge.db")
+	bc := newTestBoltCache(t, path)
+
+	assert.Nil(t, bc.WriteTimer("bilge:timers:i-live", "24h", time.Now().Add(time.Hour)))
+	assert.Nil(t, bc.WriteTimer("bilge:timers:i-dead", "1s", time.Now().Add(-time.Second)))
+	assert.True(t, bc.TimerExists("bilge:timers:i-live"))
+	assert.False(t, bc.TimerExists("bilge:timers:i-dead"))
+	assert.False(t, bc.TimerExists("bilge:timers:i-missing"))
+
+	// an existing timer is not extended
+	assert.Nil(t, bc.WriteTimer("bilge:timers:i-live", "24h", time.Now().Add(-time.Second)))
+	assert.True(t, bc.TimerExists("bilge:timers:i-live"))
+
+	// timers and candidates survive a restart
+	assert.Nil(t, bc.WriteCandidate("AWS:test:us-west-2:i-live", "some-jerk", `{}`))
+	assert.Nil(t, bc.Close())
+	bc = newTestBoltCache(t, path)
+	defer bc.Close() //nolint
+	assert.True(t, bc.TimerExists("bilge:timers:i-live"))
+	owners, err := bc.ReadOwners()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"some-jerk"}, owners)
+}
+
+func TestBoltCacheResetTimerAndExemptions(t *testing.T) {
+	bc := newTestBoltCache(t, filepath.Join(t.TempDir(), "bilge.db"))
+	defer bc.Close() //nolint
+
+	deadline := time.Now().Add(time.Hour).Truncate(time.Second)
+	assert.Nil(t, bc.WriteTimer("bilge:timers:i-123", "24h", deadline))
+	assert.Nil(t, bc.ResetTimer("bilge:timers:i-123", "48h", deadline.Add(24*time.Hour)))
+	got, ok := bc.ReadTimer("bilge:timers:i-123")
+	assert.True(t, ok)
+	assert.WithinDuration(t, deadline.Add(24*time.Hour), got, time.Second)
+	_, ok = bc.ReadTimer("bilge:timers:i-missing")
+	assert.False(t, ok)
+
+	assert.Nil(t, bc.WriteExemption("AWS:test:us-west-2:i-123"))
+	assert.True(t, bc.ExemptionExists("AWS:test:us-west-2:i-123"))
+	exemptions, err := bc.ReadExemptions()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"AWS:test:us-west-2:i-123"}, exemptions)
+	assert.Nil(t, bc.DeleteExemption("AWS:test:us-west-2:i-123"))
+	assert.False(t, bc.ExemptionExists("AWS:test:us-west-2:i-123"))
+}
+
+func TestBoltCacheAudit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bilge.db")
+	bc := newTestBoltCache(t, path)
+
+	records := []string{`{"action":"mark"}`, `{"action":"snooze"}`, `{"action":"delete"}`}
+	for _, r := range records[:2] {
+		assert.Nil(t, bc.AppendAudit(r))
+	}
+	assert.Nil(t, bc.Close())
+
+	// the log survives a restart and keeps appending after what was there
+	bc = newTestBoltCache(t, path)
+	defer bc.Close() //nolint
+	assert.Nil(t, bc.AppendAudit(records[2]))
+	got, err := bc.ReadAudit()
+	assert.Nil(t, err)
+	assert.Equal(t, records, got)
+}
+
+func TestBoltCacheHolds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bilge.db")
+	bc := newTestBoltCache(t, path)
+	assert.Nil(t, bc.WriteHold("AWS:dev", `{"status":"pending"}`))
+	assert.Nil(t, bc.WriteHold("GCP:prod", `{"status":"pending"}`))
+	assert.Nil(t, bc.Close())
+
+	bc = newTestBoltCache(t, path)
+	defer bc.Close() //nolint
+	assert.Nil(t, bc.WriteHold("AWS:dev", `{"status":"approved"}`))
+	hold, ok := bc.ReadHold("AWS:dev")
+	assert.True(t, ok)
+	assert.Equal(t, `{"status":"approved"}`, hold)
+	holds, err := bc.ReadHolds()
+	assert.Nil(t, err)
+	assert.Len(t, holds, 2)
+
+	assert.Nil(t, bc.DeleteHold("AWS:dev"))
+	_, ok = bc.ReadHold("AWS:dev")
+	assert.False(t, ok)
+}
+
+func TestBoltCacheInventory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bilge.db")
+	bc := newTestBoltCache(t, path)
+	_, ok := bc.ReadInventory("AWS:dev")
+	assert.False(t, ok)
+	assert.Nil(t, bc.WriteInventory("AWS:dev", "10"))
+	assert.Nil(t, bc.Close())
+
+	bc = newTestBoltCache(t, path)
+	defer bc.Close() //nolint
+	inventory, ok := bc.ReadInventory("AWS:dev")
+	assert.True(t, ok)
+	assert.Equal(t, "10", inventory)
+}
@@ -1,28 +1,94 @@
 package cache
 
 import (
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/sirupsen/logrus"
 	"time"
 )
 
+// Cache stores one record per candidate under a unique key.  Each record belongs to exactly one owner and
+// the cache keeps the owner indexes in step with the records, so re-writing a record with a new owner moves it.
 type Cache interface {
-	Write(key, value string) error
-	Read(key string, value interface{}) error
+	WriteCandidate(key, owner, candidate string) error
+	ReadCandidate(key string) (string, error)
+	CandidateExists(key string) bool
+	DeleteCandidate(key string) error
 	ReadOwners() ([]string, error)
 	ReadCandidates(owner string) []string
-	CandidateExists(owner, candidate string) bool
 	WriteTimer(key, value string, ttl time.Time) error
+	ResetTimer(key, value string, ttl time.Time) error
+	ReadTimer(key string) (time.Time, bool)
 	TimerExists(key string) bool
-	Delete(key, value string) error
+	WriteExemption(key string) error
+	DeleteExemption(key string) error
+	ExemptionExists(key string) bool
+	ReadExemptions() ([]string, error)
+	// a hold is a sweep waiting on approval, stored as a record per marker
+	WriteHold(key, hold string) error
+	ReadHold(key string) (string, bool)
+	DeleteHold(key string) error
+	ReadHolds() ([]string, error)
+	// an inventory is how many resources a marker's last mark run counted, stored so it outlives a restart
+	WriteInventory(key, inventory string) error
+	ReadInventory(key string) (string, bool)
+	// the audit log is append only, records come back in the order they were written
+	AppendAudit(record string) error
+	ReadAudit() ([]string, error)
+	// Close flushes anything pending and releases the backend.  the cache can't be used afterwards.
+	Close() error
+}
+
+// LegacyCache is implemented by backends that may still hold candidates in the old layout, where each
+// owner had a set of marshalled candidates under bilge:candidates:<owner> and timers were keyed by bare id.
+// Only redis predates keyed candidates, so it's the only one.
+type LegacyCache interface {
+	ReadLegacyOwners() []string
+	ReadLegacyCandidates(owner string) []string
+	DeleteLegacyCandidates(owner string) error
+	RenameTimer(from, to string) error
+}
+
+// NewCache builds the cache backend selected in config
+func NewCache(cfg *config.Config, logger *logrus.Logger) (Cache, error) {
+	switch cfg.Cache.Backend {
+	case "bolt":
+		bc, err := NewBoltCache(cfg, logger)
+		if err != nil {
+			return nil, err
+		}
+		return bc, nil
+	default:
+		rc, err := NewRedisCache(cfg, logger)
+		if err != nil {
+			return nil, err
+		}
+		return rc, nil
+	}
 }
 
 type MockCache struct{}
 
 func NewMockCache() *MockCache                                          { return &MockCache{} }
-func (mc *MockCache) Write(key, value string) error                     { return nil }
-func (mc *MockCache) Read(key string, value interface{}) error          { return nil }
+func (mc *MockCache) WriteCandidate(key, owner, candidate string) error { return nil }
+func (mc *MockCache) ReadCandidate(key string) (string, error)          { return "", nil }
+func (mc *MockCache) CandidateExists(key string) bool                   { return false }
+func (mc *MockCache) DeleteCandidate(key string) error                  { return nil }
 func (mc *MockCache) ReadOwners() ([]string, error)                     { return nil, nil }
 func (mc *MockCache) ReadCandidates(owner string) []string              { return nil }
-func (mc *MockCache) CandidateExists(owner, candidate string) bool      { return false }
 func (mc *MockCache) WriteTimer(key, value string, ttl time.Time) error { return nil }
+func (mc *MockCache) ResetTimer(key, value string, ttl time.Time) error { return nil }
+func (mc *MockCache) ReadTimer(key string) (time.Time, bool)            { return time.Time{}, false }
 func (mc *MockCache) TimerExists(key string) bool                       { return false }
-func (mc *MockCache) Delete(key, value string) error                    { return nil }
+func (mc *MockCache) WriteExemption(key string) error                   { return nil }
+func (mc *MockCache) DeleteExemption(key string) error                  { return nil }
+func (mc *MockCache) ExemptionExists(key string) bool                   { return false }
+func (mc *MockCache) ReadExemptions() ([]string, error)                 { return nil, nil }
+func (mc *MockCache) WriteHold(key, hold string) error                  { return nil }
+func (mc *MockCache) ReadHold(key string) (string, bool)                { return "", false }
+func (mc *MockCache) DeleteHold(key string) error                       { return nil }
+func (mc *MockCache) ReadHolds() ([]string, error)                      { return nil, nil }
+func (mc *MockCache) WriteInventory(key, inventory string) error        { return nil }
+func (mc *MockCache) ReadInventory(key string) (string, bool)           { return "", false }
+func (mc *MockCache) AppendAudit(record string) error                   { return nil }
+func (mc *MockCache) ReadAudit() ([]string, error)                      { return nil, nil }
+func (mc *MockCache) Close() error                                      { return nil }
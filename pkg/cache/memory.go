@@ -0,0 +1,225 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryCache keeps everything in process.  Nothing survives a restart, so it is only used for tests
+// and for throwaway runs that shouldn't touch the real cache.
+type MemoryCache struct {
+	mux        sync.Mutex
+	candidates map[string]memoryCandidate
+	owners     map[string]map[string]bool
+	timers     map[string]memoryTimer
+	exemptions map[string]bool
+	holds      map[string]string
+	inventory  map[string]string
+	audit      []string
+}
+
+type memoryCandidate struct {
+	owner string
+	data  string
+}
+
+type memoryTimer struct {
+	value    string
+	expireAt time.Time
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		candidates: map[string]memoryCandidate{},
+		owners:     map[string]map[string]bool{},
+		timers:     map[string]memoryTimer{},
+		exemptions: map[string]bool{},
+		holds:      map[string]string{},
+		inventory:  map[string]string{},
+	}
+}
+
+func (mc *MemoryCache) WriteCandidate(key, owner, candidate string) error {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	if prev, ok := mc.candidates[key]; ok && prev.owner != owner {
+		mc.unindexOwner(prev.owner, key)
+	}
+	mc.candidates[key] = memoryCandidate{owner: owner, data: candidate}
+	if mc.owners[owner] == nil {
+		mc.owners[owner] = map[string]bool{}
+	}
+	mc.owners[owner][key] = true
+	return nil
+}
+
+func (mc *MemoryCache) ReadCandidate(key string) (string, error) {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	return mc.candidates[key].data, nil
+}
+
+func (mc *MemoryCache) CandidateExists(key string) bool {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	_, ok := mc.candidates[key]
+	return ok
+}
+
+func (mc *MemoryCache) DeleteCandidate(key string) error {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	if prev, ok := mc.candidates[key]; ok {
+		mc.unindexOwner(prev.owner, key)
+		delete(mc.candidates, key)
+	}
+	return nil
+}
+
+func (mc *MemoryCache) unindexOwner(owner, key string) {
+	delete(mc.owners[owner], key)
+	if len(mc.owners[owner]) == 0 {
+		delete(mc.owners, owner)
+	}
+}
+
+func (mc *MemoryCache) ReadOwners() ([]string, error) {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	owners := []string{}
+	for o := range mc.owners {
+		owners = append(owners, o)
+	}
+	return owners, nil
+}
+
+func (mc *MemoryCache) ReadCandidates(owner string) []string {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	cans := []string{}
+	for k := range mc.owners[owner] {
+		cans = append(cans, mc.candidates[k].data)
+	}
+	return cans
+}
+
+func (mc *MemoryCache) WriteTimer(key, value string, ttl time.Time) error {
+	if mc.TimerExists(key) {
+		return nil
+	}
+	return mc.ResetTimer(key, value, ttl)
+}
+
+func (mc *MemoryCache) ResetTimer(key, value string, ttl time.Time) error {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	mc.timers[key] = memoryTimer{value: value, expireAt: ttl}
+	return nil
+}
+
+func (mc *MemoryCache) ReadTimer(key string) (time.Time, bool) {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	t, ok := mc.timers[key]
+	if !ok || !time.Now().Before(t.expireAt) {
+		return time.Time{}, false
+	}
+	return t.expireAt, true
+}
+
+func (mc *MemoryCache) TimerExists(key string) bool {
+	_, ok := mc.ReadTimer(key)
+	return ok
+}
+
+func (mc *MemoryCache) WriteExemption(key string) error {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	mc.exemptions[key] = true
+	return nil
+}
+
+func (mc *MemoryCache) DeleteExemption(key string) error {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	delete(mc.exemptions, key)
+	return nil
+}
+
+func (mc *MemoryCache) ExemptionExists(key string) bool {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	return mc.exemptions[key]
+}
+
+func (mc *MemoryCache) WriteHold(key, hold string) error {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	mc.holds[key] = hold
+	return nil
+}
+
+func (mc *MemoryCache) ReadHold(key string) (string, bool) {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	hold, ok := mc.holds[key]
+	return hold, ok
+}
+
+func (mc *MemoryCache) DeleteHold(key string) error {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	delete(mc.holds, key)
+	return nil
+}
+
+func (mc *MemoryCache) ReadHolds() ([]string, error) {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	holds := []string{}
+	for _, h := range mc.holds {
+		holds = append(holds, h)
+	}
+	return holds, nil
+}
+
+func (mc *MemoryCache) WriteInventory(key, inventory string) error {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	mc.inventory[key] = inventory
+	return nil
+}
+
+func (mc *MemoryCache) ReadInventory(key string) (string, bool) {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	inventory, ok := mc.inventory[key]
+	return inventory, ok
+}
+
+func (mc *MemoryCache) AppendAudit(record string) error {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	mc.audit = append(mc.audit, record)
+	return nil
+}
+
+func (mc *MemoryCache) ReadAudit() ([]string, error) {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	return append([]string{}, mc.audit...), nil
+}
+
+func (mc *MemoryCache) Close() error {
+	return nil
+}
+
+func (mc *MemoryCache) ReadExemptions() ([]string, error) {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	exemptions := []string{}
+	for k := range mc.exemptions {
+		exemptions = append(exemptions, k)
+	}
+	return exemptions, nil
+}
@@ -1,27 +1,42 @@
 package cache
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"github.com/armory-io/bilgepump/pkg/config"
-	"github.com/go-redis/redis"
+	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
+	"os"
 	"time"
 )
 
+const (
+	REDIS_OWNERS_KEY     = "bilge:owners"
+	REDIS_EXEMPTIONS_KEY = "bilge:exemptions"
+	REDIS_AUDIT_KEY      = "bilge:audit"
+	REDIS_HOLDS_KEY      = "bilge:holds"
+	REDIS_INVENTORY_KEY  = "bilge:inventory"
+)
+
 type RedisCache struct {
 	Config *config.Config
 	Logger *logrus.Logger
-	Client *redis.Client
+	Client redis.UniversalClient
+	ctx    context.Context
+	prefix string
 }
 
 func NewRedisCache(cfg *config.Config, logger *logrus.Logger) (*RedisCache, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%d", cfg.RedisHost, cfg.RedisPort),
-		Password: "",
-		DB:       0,
-	})
-	logger.Debug("connecting to redis...")
-	_, err := client.Ping().Result()
+	client, err := newRedisClient(&cfg.Redis)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	logger.Debugf("connecting to redis (%s) at %v...", cfg.Redis.Mode, cfg.Redis.Addresses)
+	_, err = client.Ping(ctx).Result()
 	if err != nil {
 		return nil, err
 	}
@@ -29,26 +44,191 @@ func NewRedisCache(cfg *config.Config, logger *logrus.Logger) (*RedisCache, erro
 		Config: cfg,
 		Logger: logger,
 		Client: client,
+		ctx:    ctx,
+		prefix: cfg.Redis.KeyPrefix,
 	}, nil
 }
 
-func (rc *RedisCache) Write(key, value string) error {
-	rc.Logger.Debugf("redis write key: %s with value: %s", key, value)
-	_, err := rc.Client.SAdd(key, value).Result()
+func (rc *RedisCache) Close() error {
+	return rc.Client.Close()
+}
+
+func newRedisClient(cfg *config.Redis) (redis.UniversalClient, error) {
+	password, err := cfg.Password.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	sentinelPassword, err := cfg.SentinelPassword.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := newRedisTLSConfig(&cfg.TLS)
 	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.Mode {
+	case "sentinel":
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       cfg.MasterName,
+			SentinelAddrs:    cfg.Addresses,
+			SentinelPassword: sentinelPassword,
+			Username:         cfg.Username,
+			Password:         password,
+			DB:               cfg.DB,
+			TLSConfig:        tlsConfig,
+		}), nil
+	case "cluster":
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     cfg.Addresses,
+			Username:  cfg.Username,
+			Password:  password,
+			TLSConfig: tlsConfig,
+		}), nil
+	default:
+		if len(cfg.Addresses) != 1 {
+			return nil, errors.New("standalone redis takes exactly one address")
+		}
+		return redis.NewClient(&redis.Options{
+			Addr:      cfg.Addresses[0],
+			Username:  cfg.Username,
+			Password:  password,
+			DB:        cfg.DB,
+			TLSConfig: tlsConfig,
+		}), nil
+	}
+}
+
+func newRedisTLSConfig(cfg *config.RedisTLS) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify, //nolint - opt in for self signed test setups
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// key namespaces every key we touch under the configured prefix
+func (rc *RedisCache) key(k string) string {
+	return rc.prefix + k
+}
+
+// candidates are stored as a hash holding the owning index and the record itself
+func (rc *RedisCache) candidateKey(key string) string {
+	return rc.key(fmt.Sprintf("bilge:candidate:%s", key))
+}
+
+func (rc *RedisCache) ownerKey(owner string) string {
+	return rc.key(fmt.Sprintf("bilge:owner:%s", owner))
+}
+
+func (rc *RedisCache) legacyCandidatesKey(owner string) string {
+	return rc.key(fmt.Sprintf("bilge:candidates:%s", owner))
+}
+
+func (rc *RedisCache) WriteCandidate(key, owner, candidate string) error {
+	rc.Logger.Debugf("redis write candidate: %s for owner: %s", key, owner)
+	prevOwner, err := rc.Client.HGet(rc.ctx, rc.candidateKey(key), "owner").Result()
+	moved := err == nil && prevOwner != owner
+	if err != nil && err != redis.Nil {
 		return err
 	}
+	_, err = rc.Client.TxPipelined(rc.ctx, func(pipe redis.Pipeliner) error {
+		if moved {
+			pipe.SRem(rc.ctx, rc.ownerKey(prevOwner), key)
+		}
+		pipe.HSet(rc.ctx, rc.candidateKey(key), map[string]interface{}{
+			"owner": owner,
+			"data":  candidate,
+		})
+		pipe.SAdd(rc.ctx, rc.ownerKey(owner), key)
+		pipe.SAdd(rc.ctx, rc.key(REDIS_OWNERS_KEY), owner)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if moved {
+		return rc.pruneOwner(prevOwner)
+	}
 	return nil
 }
 
+func (rc *RedisCache) ReadCandidate(key string) (string, error) {
+	rc.Logger.Debugf("redis read candidate: %s", key)
+	return rc.Client.HGet(rc.ctx, rc.candidateKey(key), "data").Result()
+}
+
+func (rc *RedisCache) CandidateExists(key string) bool {
+	exists, err := rc.Client.Exists(rc.ctx, rc.candidateKey(key)).Result()
+	if err != nil {
+		rc.Logger.Error(err)
+		return false
+	}
+	return exists == 1
+}
+
+func (rc *RedisCache) DeleteCandidate(key string) error {
+	rc.Logger.Debugf("redis delete candidate: %s", key)
+	owner, err := rc.Client.HGet(rc.ctx, rc.candidateKey(key), "owner").Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = rc.Client.TxPipelined(rc.ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(rc.ctx, rc.candidateKey(key))
+		pipe.SRem(rc.ctx, rc.ownerKey(owner), key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return rc.pruneOwner(owner)
+}
+
+// pruneOwner drops an owner from the owner index once they have nothing left to be notified about
+func (rc *RedisCache) pruneOwner(owner string) error {
+	count, err := rc.Client.SCard(rc.ctx, rc.ownerKey(owner)).Result()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		_, err = rc.Client.SRem(rc.ctx, rc.key(REDIS_OWNERS_KEY), owner).Result()
+	}
+	return err
+}
+
 func (rc *RedisCache) WriteTimer(key, value string, ttl time.Time) error {
 	rc.Logger.Debugf("redis write ttl key %s:%s with ttl %+v", key, value, ttl)
 	if !rc.TimerExists(key) {
-		_, err := rc.Client.Set(key, value, 0).Result()
+		_, err := rc.Client.Set(rc.ctx, rc.key(key), value, 0).Result()
 		if err != nil {
 			return err
 		}
-		_, err = rc.Client.ExpireAt(key, ttl).Result()
+		_, err = rc.Client.ExpireAt(rc.ctx, rc.key(key), ttl).Result()
 		if err != nil {
 			return err
 		}
@@ -56,8 +236,28 @@ func (rc *RedisCache) WriteTimer(key, value string, ttl time.Time) error {
 	return nil
 }
 
+// ResetTimer replaces a timer and its expiry whether or not it already exists
+func (rc *RedisCache) ResetTimer(key, value string, ttl time.Time) error {
+	rc.Logger.Debugf("redis reset ttl key %s:%s with ttl %+v", key, value, ttl)
+	_, err := rc.Client.TxPipelined(rc.ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(rc.ctx, rc.key(key), value, 0)
+		pipe.ExpireAt(rc.ctx, rc.key(key), ttl)
+		return nil
+	})
+	return err
+}
+
+func (rc *RedisCache) ReadTimer(key string) (time.Time, bool) {
+	ttl, err := rc.Client.PTTL(rc.ctx, rc.key(key)).Result()
+	// negative durations mean the key is missing or never expires
+	if err != nil || ttl < 0 {
+		return time.Time{}, false
+	}
+	return time.Now().Add(ttl), true
+}
+
 func (rc *RedisCache) TimerExists(key string) bool {
-	exists, err := rc.Client.Exists(key).Result()
+	exists, err := rc.Client.Exists(rc.ctx, rc.key(key)).Result()
 	if err != nil {
 		return false
 	}
@@ -67,14 +267,87 @@ func (rc *RedisCache) TimerExists(key string) bool {
 	return false
 }
 
-func (rc *RedisCache) Read(key string, value interface{}) error {
-	rc.Logger.Debugf("redis read key: %s", key)
-	return nil
+func (rc *RedisCache) WriteExemption(key string) error {
+	rc.Logger.Debugf("redis write exemption: %s", key)
+	_, err := rc.Client.SAdd(rc.ctx, rc.key(REDIS_EXEMPTIONS_KEY), key).Result()
+	return err
+}
+
+func (rc *RedisCache) DeleteExemption(key string) error {
+	rc.Logger.Debugf("redis delete exemption: %s", key)
+	_, err := rc.Client.SRem(rc.ctx, rc.key(REDIS_EXEMPTIONS_KEY), key).Result()
+	return err
+}
+
+func (rc *RedisCache) ExemptionExists(key string) bool {
+	exists, err := rc.Client.SIsMember(rc.ctx, rc.key(REDIS_EXEMPTIONS_KEY), key).Result()
+	if err != nil {
+		rc.Logger.Error(err)
+		return false
+	}
+	return exists
+}
+
+func (rc *RedisCache) ReadExemptions() ([]string, error) {
+	return rc.Client.SMembers(rc.ctx, rc.key(REDIS_EXEMPTIONS_KEY)).Result()
+}
+
+func (rc *RedisCache) WriteHold(key, hold string) error {
+	rc.Logger.Debugf("redis write hold: %s", key)
+	_, err := rc.Client.HSet(rc.ctx, rc.key(REDIS_HOLDS_KEY), key, hold).Result()
+	return err
+}
+
+func (rc *RedisCache) ReadHold(key string) (string, bool) {
+	hold, err := rc.Client.HGet(rc.ctx, rc.key(REDIS_HOLDS_KEY), key).Result()
+	if err != nil {
+		if err != redis.Nil {
+			rc.Logger.Error(err)
+		}
+		return "", false
+	}
+	return hold, true
+}
+
+func (rc *RedisCache) DeleteHold(key string) error {
+	rc.Logger.Debugf("redis delete hold: %s", key)
+	_, err := rc.Client.HDel(rc.ctx, rc.key(REDIS_HOLDS_KEY), key).Result()
+	return err
+}
+
+func (rc *RedisCache) ReadHolds() ([]string, error) {
+	return rc.Client.HVals(rc.ctx, rc.key(REDIS_HOLDS_KEY)).Result()
+}
+
+func (rc *RedisCache) WriteInventory(key, inventory string) error {
+	rc.Logger.Debugf("redis write inventory: %s", key)
+	_, err := rc.Client.HSet(rc.ctx, rc.key(REDIS_INVENTORY_KEY), key, inventory).Result()
+	return err
+}
+
+func (rc *RedisCache) ReadInventory(key string) (string, bool) {
+	inventory, err := rc.Client.HGet(rc.ctx, rc.key(REDIS_INVENTORY_KEY), key).Result()
+	if err != nil {
+		if err != redis.Nil {
+			rc.Logger.Error(err)
+		}
+		return "", false
+	}
+	return inventory, true
+}
+
+func (rc *RedisCache) AppendAudit(record string) error {
+	_, err := rc.Client.RPush(rc.ctx, rc.key(REDIS_AUDIT_KEY), record).Result()
+	return err
+}
+
+func (rc *RedisCache) ReadAudit() ([]string, error) {
+	return rc.Client.LRange(rc.ctx, rc.key(REDIS_AUDIT_KEY), 0, -1).Result()
 }
 
 func (rc *RedisCache) ReadOwners() ([]string, error) {
 	rc.Logger.Debug("redis read bilge:owners")
-	result, err := rc.Client.SMembers("bilge:owners").Result()
+	result, err := rc.Client.SMembers(rc.ctx, rc.key(REDIS_OWNERS_KEY)).Result()
 	if err != nil {
 		return nil, err
 	}
@@ -82,35 +355,68 @@ func (rc *RedisCache) ReadOwners() ([]string, error) {
 }
 
 func (rc *RedisCache) ReadCandidates(owner string) []string {
-	rc.Logger.Debugf("redis read: bilge:candidates:%s", owner)
+	rc.Logger.Debugf("redis read: %s", rc.ownerKey(owner))
 	answer := []string{}
-	var cursor uint64
-	iter := rc.Client.SScan(fmt.Sprintf("bilge:candidates:%s", owner), cursor, "", 10).Iterator()
-	for iter.Next() {
-		answer = append(answer, iter.Val())
-	}
-	if err := iter.Err(); err != nil {
+	keys, err := rc.Client.SMembers(rc.ctx, rc.ownerKey(owner)).Result()
+	if err != nil {
 		rc.Logger.Error(err)
 		return answer
 	}
+	if len(keys) == 0 {
+		return answer
+	}
+	cmds, err := rc.Client.Pipelined(rc.ctx, func(pipe redis.Pipeliner) error {
+		for _, k := range keys {
+			pipe.HGet(rc.ctx, rc.candidateKey(k), "data")
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		rc.Logger.Error(err)
+	}
+	for _, cmd := range cmds {
+		if data, err := cmd.(*redis.StringCmd).Result(); err == nil {
+			answer = append(answer, data)
+		}
+	}
 	return answer
 }
 
-func (rc *RedisCache) CandidateExists(owner, candidate string) bool {
-	rc.Logger.Debug("redis set check exists")
-	result, err := rc.Client.SIsMember(fmt.Sprintf("bilge:candidates:%s", owner), candidate).Result()
+// ReadLegacyOwners lists owners that may still have a candidate set.  both layouts share bilge:owners.
+func (rc *RedisCache) ReadLegacyOwners() []string {
+	owners, err := rc.ReadOwners()
 	if err != nil {
 		rc.Logger.Error(err)
-		return false
 	}
-	return result
+	return owners
 }
 
-func (rc *RedisCache) Delete(key, value string) error {
-	rc.Logger.Debugf("redis delete key: %s", key)
-	_, err := rc.Client.SRem(key, value).Result()
+func (rc *RedisCache) ReadLegacyCandidates(owner string) []string {
+	answer := []string{}
+	var cursor uint64
+	iter := rc.Client.SScan(rc.ctx, rc.legacyCandidatesKey(owner), cursor, "", 10).Iterator()
+	for iter.Next(rc.ctx) {
+		answer = append(answer, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		rc.Logger.Error(err)
+	}
+	return answer
+}
+
+func (rc *RedisCache) DeleteLegacyCandidates(owner string) error {
+	_, err := rc.Client.Del(rc.ctx, rc.legacyCandidatesKey(owner)).Result()
 	if err != nil {
 		return err
 	}
-	return nil
+	return rc.pruneOwner(owner)
+}
+
+// RenameTimer moves a timer to a new key.  redis carries the expiry along with the key.
+func (rc *RedisCache) RenameTimer(from, to string) error {
+	if !rc.TimerExists(from) {
+		return nil
+	}
+	_, err := rc.Client.Rename(rc.ctx, rc.key(from), rc.key(to)).Result()
+	return err
 }
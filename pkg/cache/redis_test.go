@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newTestRedisCache(t *testing.T, mr *miniredis.Miniredis, r config.Redis) *RedisCache {
+	r.Mode = "standalone"
+	r.Addresses = []string{mr.Addr()}
+	rc, err := NewRedisCache(&config.Config{Redis: r}, logrus.New())
+	assert.Nil(t, err)
+	return rc
+}
+
+func TestRedisCacheCandidates(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rc := newTestRedisCache(t, mr, config.Redis{})
+
+	assert.Nil(t, rc.WriteCandidate("AWS:test:us-west-2:i-123", "some-jerk", `{"id":"i-123"}`))
+	assert.Nil(t, rc.WriteCandidate("AWS:test:us-west-2:i-456", "some-jerk", `{"id":"i-456"}`))
+	assert.Len(t, rc.ReadCandidates("some-jerk"), 2)
+	assert.True(t, rc.CandidateExists("AWS:test:us-west-2:i-123"))
+
+	// an owner change moves the candidate rather than duplicating it
+	assert.Nil(t, rc.WriteCandidate("AWS:test:us-west-2:i-123", "someone-else", `{"id":"i-123","ttl":"1d"}`))
+	assert.Equal(t, []string{`{"id":"i-456"}`}, rc.ReadCandidates("some-jerk"))
+	assert.Equal(t, []string{`{"id":"i-123","ttl":"1d"}`}, rc.ReadCandidates("someone-else"))
+
+	assert.Nil(t, rc.DeleteCandidate("AWS:test:us-west-2:i-456"))
+	assert.Nil(t, rc.DeleteCandidate("AWS:test:us-west-2:i-456"))
+	owners, err := rc.ReadOwners()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"someone-else"}, owners)
+}
+
+func TestRedisCacheTimers(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rc := newTestRedisCache(t, mr, config.Redis{})
+
+	assert.Nil(t, rc.WriteTimer("bilge:timers:i-123", "24h", time.Now().Add(time.Hour)))
+	assert.True(t, rc.TimerExists("bilge:timers:i-123"))
+	mr.FastForward(2 * time.Hour)
+	assert.False(t, rc.TimerExists("bilge:timers:i-123"))
+
+	deadline := time.Now().Add(48 * time.Hour)
+	assert.Nil(t, rc.ResetTimer("bilge:timers:i-123", "48h", deadline))
+	got, ok := rc.ReadTimer("bilge:timers:i-123")
+	assert.True(t, ok)
+	assert.WithinDuration(t, deadline, got, time.Second)
+	_, ok = rc.ReadTimer("bilge:timers:i-missing")
+	assert.False(t, ok)
+}
+
+func TestRedisCacheExemptions(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rc := newTestRedisCache(t, mr, config.Redis{})
+
+	assert.Nil(t, rc.WriteExemption("AWS:test:us-west-2:i-123"))
+	assert.True(t, rc.ExemptionExists("AWS:test:us-west-2:i-123"))
+	assert.False(t, rc.ExemptionExists("AWS:test:us-west-2:i-456"))
+	exemptions, err := rc.ReadExemptions()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"AWS:test:us-west-2:i-123"}, exemptions)
+	assert.Nil(t, rc.DeleteExemption("AWS:test:us-west-2:i-123"))
+	assert.False(t, rc.ExemptionExists("AWS:test:us-west-2:i-123"))
+}
+
+func TestRedisCacheAuthAndPrefix(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.RequireUserAuth("bilge", "hunter2")
+	t.Setenv("BILGE_REDIS_PASSWORD", "hunter2")
+
+	rc := newTestRedisCache(t, mr, config.Redis{
+		Username:  "bilge",
+		Password:  config.Secret{Env: "BILGE_REDIS_PASSWORD"},
+		KeyPrefix: "team-a:",
+	})
+	assert.Nil(t, rc.WriteCandidate("AWS:test:us-west-2:i-123", "some-jerk", `{}`))
+	assert.Nil(t, rc.WriteTimer("bilge:timers:AWS:test:us-west-2:i-123", "24h", time.Now().Add(time.Hour)))
+	assert.True(t, mr.Exists("team-a:bilge:candidate:AWS:test:us-west-2:i-123"))
+	assert.True(t, mr.Exists("team-a:bilge:owners"))
+	assert.True(t, mr.Exists("team-a:bilge:timers:AWS:test:us-west-2:i-123"))
+
+	_, err := NewRedisCache(&config.Config{Redis: config.Redis{
+		Mode:      "standalone",
+		Addresses: []string{mr.Addr()},
+		Username:  "bilge",
+		Password:  config.Secret{Value: "wrong"},
+	}}, logrus.New())
+	assert.NotNil(t, err)
+}
+
+func TestRedisCacheAudit(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rc := newTestRedisCache(t, mr, config.Redis{KeyPrefix: "staging:"})
+
+	records := []string{`{"action":"mark"}`, `{"action":"snooze"}`, `{"action":"delete"}`}
+	for _, r := range records {
+		assert.Nil(t, rc.AppendAudit(r))
+	}
+	got, err := rc.ReadAudit()
+	assert.Nil(t, err)
+	assert.Equal(t, records, got)
+	assert.True(t, mr.Exists("staging:bilge:audit"))
+}
+
+func TestRedisCacheHolds(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rc := newTestRedisCache(t, mr, config.Redis{KeyPrefix: "staging:"})
+
+	assert.Nil(t, rc.WriteHold("AWS:dev", `{"status":"pending"}`))
+	assert.Nil(t, rc.WriteHold("AWS:dev", `{"status":"approved"}`))
+	hold, ok := rc.ReadHold("AWS:dev")
+	assert.True(t, ok)
+	assert.Equal(t, `{"status":"approved"}`, hold)
+	holds, err := rc.ReadHolds()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{`{"status":"approved"}`}, holds)
+	assert.True(t, mr.Exists("staging:bilge:holds"))
+
+	assert.Nil(t, rc.DeleteHold("AWS:dev"))
+	_, ok = rc.ReadHold("AWS:dev")
+	assert.False(t, ok)
+}
+
+func TestRedisCacheInventory(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rc := newTestRedisCache(t, mr, config.Redis{KeyPrefix: "staging:"})
+
+	_, ok := rc.ReadInventory("AWS:dev")
+	assert.False(t, ok)
+	assert.Nil(t, rc.WriteInventory("AWS:dev", "10"))
+	inventory, ok := rc.ReadInventory("AWS:dev")
+	assert.True(t, ok)
+	assert.Equal(t, "10", inventory)
+	assert.True(t, mr.Exists("staging:bilge:inventory"))
+}
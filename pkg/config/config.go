@@ -11,59 +11,392 @@ import (
 	"reflect"
 	"regexp"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 )
 
 const (
-	DEFAULT_REDIS_HOST      = "127.0.0.1"
-	DEFAULT_REDIS_PORT      = uint32(6379)
-	DEFAULT_SWEEP_SCHEDULE  = "@daily"
-	DEFAULT_MARK_SCHEDULE   = "@hourly"
-	DEFAULT_NOTIFY_SCHEDULE = "@every 12h"
-	DEFAULT_GRACEPERIOD     = "24h"
-	DEFAULT_MAX_RETRY       = 10
+	DEFAULT_REDIS_HOST       = "127.0.0.1"
+	DEFAULT_REDIS_PORT       = uint32(6379)
+	DEFAULT_SWEEP_SCHEDULE   = "@daily"
+	DEFAULT_MARK_SCHEDULE    = "@hourly"
+	DEFAULT_NOTIFY_SCHEDULE  = "@every 12h"
+	DEFAULT_GRACEPERIOD      = "24h"
+	DEFAULT_MAX_RETRY        = 10
+	DEFAULT_RATE_LIMIT       = 10.0
+	DEFAULT_RATE_BURST       = 20
+	DEFAULT_CACHE_BACKEND    = "redis"
+	DEFAULT_CACHE_PATH       = "./bilgepump.db"
+	DEFAULT_REDIS_MODE       = "standalone"
+	DEFAULT_SNOOZE_DURATIONS = "1d,3d,1w"
+	// how long shutdown waits on running mark, sweep and notify jobs before canceling them
+	DEFAULT_SHUTDOWN_TIMEOUT = "1m"
+	// AWS_ALL_REGIONS in regions marks every region enabled for the account
+	AWS_ALL_REGIONS = "all"
+	// names our sts sessions so they're easy to find in cloudtrail
+	DEFAULT_AWS_SESSION_NAME = "bilgepump"
+	// rds and aurora candidates are snapshotted before they're deleted, see AwsRds
+	DEFAULT_RDS_FINAL_SNAPSHOT = "bilge-final-{id}-{date}"
+	RDS_SNAPSHOT_DATE_FORMAT   = "20060102-150405"
+	// s3 candidates that hold more objects than this, every version and delete marker counted, aren't
+	// emptied.  see AwsS3
+	DEFAULT_S3_MAX_OBJECTS = 10000
+	// any bucket policy that mentions deleting the bucket, usually to deny it
+	DEFAULT_S3_PROTECTED_POLICY = `s3:DeleteBucket\b`
+	// loggroup candidates that haven't had an event in this long are flagged whatever their ttl.  see
+	// AwsLogGroups
+	DEFAULT_LOG_GROUP_IDLE_PERIOD = "30d"
+	// set in pods by the eks pod identity webhook when irsa is configured
+	AWS_ROLE_ARN_ENV                = "AWS_ROLE_ARN"
+	AWS_WEB_IDENTITY_TOKEN_FILE_ENV = "AWS_WEB_IDENTITY_TOKEN_FILE"
+	DEFAULT_SMTP_PORT               = 587
+	DEFAULT_EMAIL_SUBJECT           = "Resources that have expiring ttl"
+	DEFAULT_WEBHOOK_MODE            = "owner"
+	DEFAULT_WEBHOOK_CONTENT_TYPE    = "application/json"
+	DEFAULT_WEBHOOK_MAX_RETRIES     = 3
+	DEFAULT_WEBHOOK_RETRY_BACKOFF   = "1s"
+	DEFAULT_WEBHOOK_TIMEOUT         = "10s"
+	DEFAULT_WEBHOOK_WARN_BEFORE     = "24h"
+	DEFAULT_TTL_KEY                 = "ttl"
+	DEFAULT_EXPIRES_KEY             = "expires"
+	DEFAULT_OWNER_KEY               = "owner"
+	DEFAULT_PURPOSE_KEY             = "purpose"
+	// namespace annotations are the tag keys with this in front, unless they have a prefix of their own
+	DEFAULT_ANNOTATION_PREFIX = "armory.io/bilge."
+	// cluster transactions only work when every key hashes to the same slot
+	DEFAULT_CLUSTER_KEY_PREFIX = "{bilge}"
+	// a standby takes over within a lease duration of the leader going away
+	DEFAULT_LEADER_ELECTION_NAME   = "bilgepump"
+	DEFAULT_LEADER_LEASE_DURATION  = "15s"
+	DEFAULT_LEADER_RENEW_DEADLINE  = "10s"
+	DEFAULT_LEADER_RETRY_PERIOD    = "2s"
+	DEFAULT_LEADER_NAMESPACE       = "default"
+	POD_NAMESPACE_ENV              = "POD_NAMESPACE"
+	SERVICE_ACCOUNT_NAMESPACE_FILE = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
 )
 
 var validAwsCandidates = map[string]bool{
-	"elb": true,
-	"ec2": true,
-	"eks": true,
-	"alb": true,
-	"ebs": true,
-	"sg":  true,
-	"ec":  true,
-	"asg": true,
-	"lc":  true,
+	"elb":      true,
+	"ec2":      true,
+	"eks":      true,
+	"alb":      true,
+	"ebs":      true,
+	"sg":       true,
+	"ec":       true,
+	"asg":      true,
+	"lc":       true,
+	"rds":      true,
+	"aurora":   true,
+	"snapshot": true,
+	"ami":      true,
+	"eip":      true,
+	"natgw":    true,
+	"eni":      true,
+	"s3":       true,
+	"lambda":   true,
+	"ecr":      true,
+	"loggroup": true,
+}
+
+var validGcpCandidates = map[string]bool{
+	"gce":  true,
+	"disk": true,
+	"gke":  true,
+}
+
+// kubernetes only sweeps namespaces
+var validK8sCandidates = map[string]bool{
+	"namespace": true,
+}
+
+var validCacheBackends = map[string]bool{
+	"redis": true,
+	"bolt":  true,
+}
+
+var validLeaderElectionBackends = map[string]bool{
+	"redis":      true,
+	"kubernetes": true,
+}
+
+var validWebhookModes = map[string]bool{
+	"owner": true,
+	"event": true,
+}
+
+var validWebhookEvents = map[string]bool{
+	"marked":          true,
+	"about-to-delete": true,
+	"deleted":         true,
+	"sweep-halted":    true,
+	"refused":         true,
+}
+
+var validRedisModes = map[string]bool{
+	"standalone": true,
+	"sentinel":   true,
+	"cluster":    true,
 }
 
 type Config struct {
 	RedisHost  string       `yaml:"redis_host"`
 	RedisPort  uint32       `yaml:"redis_port"`
+	Redis      Redis        `yaml:"redis"`
+	Cache      Cache        `yaml:"cache"`
 	Aws        []Aws        `yaml:"aws"`
 	Kubernetes []Kubernetes `yaml:"kubernetes"`
+	Gcp        []Gcp        `yaml:"gcp"`
 	Slack      Slack        `yaml:"slack"`
+	Email      Email        `yaml:"email"`
+	Webhooks   []Webhook    `yaml:"webhooks"`
+	Api        Api          `yaml:"api"`
+	// TagKeys are the defaults for every account that doesn't set its own
+	TagKeys TagKeys `yaml:"tag_keys"`
+	// SweepLimits are the defaults for every account that doesn't set its own
+	SweepLimits SweepLimits `yaml:"sweep_limits"`
+	// ShutdownTimeout is how long a stop signal waits on running jobs
+	ShutdownTimeout string         `yaml:"shutdown_timeout"`
+	LeaderElection  LeaderElection `yaml:"leader_election"`
+}
+
+// LeaderElection lets several replicas share a cache with only one of them running jobs.  It's off
+// unless a backend is set.
+type LeaderElection struct {
+	Backend string `yaml:"backend"`
+	// Name is the redis lock key or the kubernetes lease name
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace"`
+	// KubeConfig is only needed outside a cluster
+	KubeConfig    string `yaml:"kubeconfig"`
+	Identity      string `yaml:"identity"`
+	LeaseDuration string `yaml:"lease_duration"`
+	RenewDeadline string `yaml:"renew_deadline"`
+	RetryPeriod   string `yaml:"retry_period"`
+}
+
+func (le *LeaderElection) Enabled() bool {
+	return le.Backend != ""
+}
+
+type Redis struct {
+	Mode             string   `yaml:"mode" validate:"isRedisMode"`
+	Addresses        []string `yaml:"addresses"`
+	MasterName       string   `yaml:"master_name"`
+	Username         string   `yaml:"username"`
+	Password         Secret   `yaml:"password"`
+	SentinelPassword Secret   `yaml:"sentinel_password"`
+	DB               int      `yaml:"db"`
+	KeyPrefix        string   `yaml:"key_prefix"`
+	TLS              RedisTLS `yaml:"tls"`
+}
+
+type RedisTLS struct {
+	Enabled            bool   `yaml:"enabled"`
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// Secret is a value that can be written inline, read from an environment variable or read from a file.
+// A plain string in yaml is treated as an inline value.
+type Secret struct {
+	Value string `yaml:"value"`
+	Env   string `yaml:"env"`
+	File  string `yaml:"file"`
+}
+
+func (s *Secret) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err == nil {
+		s.Value = value
+		return nil
+	}
+	type plain Secret
+	return unmarshal((*plain)(s))
+}
+
+func (s Secret) IsSet() bool {
+	return s.Value != "" || s.Env != "" || s.File != ""
+}
+
+// Resolve returns the secret, preferring the inline value, then the environment, then the file
+func (s Secret) Resolve() (string, error) {
+	switch {
+	case s.Value != "":
+		return s.Value, nil
+	case s.Env != "":
+		v, ok := os.LookupEnv(s.Env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", s.Env)
+		}
+		return v, nil
+	case s.File != "":
+		data, err := os.ReadFile(s.File)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return "", nil
+}
+
+type Cache struct {
+	Backend string `yaml:"backend" validate:"isCacheBackend"`
+	Path    string `yaml:"path"`
+}
+
+// Api serves the candidate API when Listen is set.  Requests must carry the token as a bearer token if
+// one is configured.
+type Api struct {
+	Listen string `yaml:"listen"`
+	Token  Secret `yaml:"token"`
 }
 
 type Slack struct {
 	Token        string `yaml:"token"`
 	DefaultOwner string `yaml:"default_owner"`
 	Channel      string `yaml:"channel"`
+	// SigningSecret turns on the snooze/keep/delete buttons.  Slack signs interaction requests with it.
+	SigningSecret   Secret   `yaml:"signing_secret"`
+	SnoozeDurations []string `yaml:"snooze_durations"`
+}
+
+// Email sends each owner a digest of their candidates over SMTP.  It's on when Host is set.  Owners that
+// aren't email addresses get theirs sent to DefaultTo.
+type Email struct {
+	Host      string `yaml:"host"`
+	Port      int    `yaml:"port"`
+	Username  string `yaml:"username"`
+	Password  Secret `yaml:"password"`
+	From      string `yaml:"from"`
+	DefaultTo string `yaml:"default_to"`
+	Subject   string `yaml:"subject"`
+	// STARTTLS is used whenever the server offers it.  this is only for test servers with self signed certificates.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+}
+
+func (e *Email) Enabled() bool {
+	return e.Host != ""
+}
+
+// Webhook posts json to a url, either a digest per owner or a document per event.  Body is a go template
+// over the same document that replaces the json when set.
+type Webhook struct {
+	Name   string   `yaml:"name"`
+	URL    string   `yaml:"url"`
+	Mode   string   `yaml:"mode"`
+	Events []string `yaml:"events"`
+	// WarnBefore is how close to its deadline a candidate has to be for an about-to-delete event
+	WarnBefore string `yaml:"warn_before"`
+	// Secret signs every request with an hmac-sha256 of the timestamp and body
+	Secret       Secret            `yaml:"secret"`
+	Headers      map[string]Secret `yaml:"headers"`
+	Body         string            `yaml:"body"`
+	ContentType  string            `yaml:"content_type"`
+	MaxRetries   int               `yaml:"max_retries"`
+	RetryBackoff string            `yaml:"retry_backoff"`
+	Timeout      string            `yaml:"timeout"`
 }
 
 type Aws struct {
 	Name           string     `yaml:"name" validate:"nonzero"`
 	MaxClientRetry int        `yaml:"max_retries"`
+	RateLimit      float64    `yaml:"rate_limit"`
+	RateBurst      int        `yaml:"rate_burst"`
 	Candidates     []string   `yaml:"candidates" validate:"isValidAwsCandidate"`
-	Region         string     `yaml:"region" validate:"nonzero"`
+	Region         string     `yaml:"region"`
+	Regions        []string   `yaml:"regions"`
 	MarkSchedule   string     `yaml:"mark_schedule" validate:"isCron"`
 	SweepSchedule  string     `yaml:"sweep_schedule" validate:"isCron"`
 	NotifySchedule string     `yaml:"notify_schedule" validate:"isCron"`
 	Not            []AwsTagKV `yaml:"not_tags"`
 	GracePeriod    string     `yaml:"grace_period" validate:"isDuration"`
 	DeleteEnabled  bool       `yaml:"delete_enabled"`
-	IamRole        string     `yaml:"iamRole" validate:"nonzero"`
+	// IamRole is assumed last, after any roles in Credentials.AssumeRoles
+	IamRole     string         `yaml:"iamRole"`
+	Credentials AwsCredentials `yaml:"credentials"`
+	TagKeys     TagKeys        `yaml:"tag_keys"`
+	SweepLimits SweepLimits    `yaml:"sweep_limits"`
+	Rds         AwsRds         `yaml:"rds"`
+	Ami         AwsAmi         `yaml:"ami"`
+	S3          AwsS3          `yaml:"s3"`
+	LogGroups   AwsLogGroups   `yaml:"loggroup"`
+}
+
+// AwsLogGroups is how cloudwatch log groups are marked.  A group that's been empty, or hasn't had an event,
+// for longer than IdlePeriod is a candidate even if its ttl hasn't expired.
+type AwsLogGroups struct {
+	IdlePeriod string `yaml:"idle_period"`
+}
+
+// AwsS3 is how s3 buckets are marked and swept.  A bucket whose policy matches the ProtectedPolicy regex
+// is never a candidate, and a sweep refuses to empty a bucket that holds more than MaxObjects objects.
+type AwsS3 struct {
+	ProtectedPolicy string `yaml:"protected_policy"`
+	MaxObjects      int    `yaml:"max_objects"`
+}
+
+// AwsAmi is how ami candidates are swept.  DeleteSnapshots deletes the snapshots behind an image once it's
+// deregistered, unless another image still uses them.
+type AwsAmi struct {
+	DeleteSnapshots bool `yaml:"delete_snapshots"`
+}
+
+// AwsRds is how rds instances and aurora clusters are swept.  FinalSnapshot names the snapshot taken
+// before each one is deleted, with {id} replaced by its identifier and {date} by when it was swept.
+type AwsRds struct {
+	FinalSnapshot string `yaml:"final_snapshot"`
+}
+
+// FinalSnapshotId is the final snapshot's identifier for the instance or cluster id
+func (ar AwsRds) FinalSnapshotId(id string, now time.Time) string {
+	return strings.NewReplacer("{id}", id, "{date}", now.UTC().Format(RDS_SNAPSHOT_DATE_FORMAT)).Replace(ar.FinalSnapshot)
+}
+
+// AwsCredentials picks where an account's credentials come from: static keys, a shared config profile,
+// irsa web identity or, when none of those are set, the sdk's default chain.  AssumeRoles are then
+// assumed in order, each with the credentials of the one before it.
+type AwsCredentials struct {
+	AccessKeyId     Secret          `yaml:"access_key_id"`
+	SecretAccessKey Secret          `yaml:"secret_access_key"`
+	SessionToken    Secret          `yaml:"session_token"`
+	Profile         string          `yaml:"profile"`
+	WebIdentity     *AwsWebIdentity `yaml:"web_identity"`
+	AssumeRoles     []AwsAssumeRole `yaml:"assume_roles"`
+}
+
+// AwsWebIdentity exchanges a token file for a role, the way eks service accounts (irsa) work.  RoleArn and
+// TokenFile default to what the eks pod identity webhook puts in the environment.
+type AwsWebIdentity struct {
+	RoleArn     string `yaml:"role_arn"`
+	TokenFile   string `yaml:"token_file"`
+	SessionName string `yaml:"session_name"`
+}
+
+type AwsAssumeRole struct {
+	RoleArn     string `yaml:"role_arn"`
+	ExternalId  Secret `yaml:"external_id"`
+	SessionName string `yaml:"session_name"`
+	Duration    string `yaml:"duration"`
+}
+
+type Gcp struct {
+	Name            string      `yaml:"name" validate:"nonzero"`
+	Project         string      `yaml:"project" validate:"nonzero"`
+	CredentialsFile string      `yaml:"credentials_file"`
+	Candidates      []string    `yaml:"candidates" validate:"isValidGcpCandidate"`
+	MarkSchedule    string      `yaml:"mark_schedule" validate:"isCron"`
+	SweepSchedule   string      `yaml:"sweep_schedule" validate:"isCron"`
+	NotifySchedule  string      `yaml:"notify_schedule" validate:"isCron"`
+	Not             []AwsTagKV  `yaml:"not_labels"`
+	GracePeriod     string      `yaml:"grace_period" validate:"isDuration"`
+	DeleteEnabled   bool        `yaml:"delete_enabled"`
+	TagKeys         TagKeys     `yaml:"label_keys"`
+	SweepLimits     SweepLimits `yaml:"sweep_limits"`
 }
 
 type Kubernetes struct {
@@ -77,6 +410,144 @@ type Kubernetes struct {
 	GracePeriod    string   `yaml:"grace_period" validate:"isDuration"`
 	Not            []string `yaml:"not_namespaces"`
 	NotRegex       []string `yaml:"not_regex" validate:"isRegex"`
+	// TagKeys are the namespace annotations, after AnnotationPrefix is applied
+	TagKeys          TagKeys     `yaml:"annotation_keys"`
+	AnnotationPrefix *string     `yaml:"annotation_prefix"`
+	SweepLimits      SweepLimits `yaml:"sweep_limits"`
+}
+
+// KeyList is a single key or a list of them, tried in order
+type KeyList []string
+
+func (kl *KeyList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var key string
+	if err := unmarshal(&key); err == nil {
+		*kl = KeyList{key}
+		return nil
+	}
+	var keys []string
+	if err := unmarshal(&keys); err != nil {
+		return err
+	}
+	*kl = keys
+	return nil
+}
+
+// TagKeys names the tags, labels or annotations each setting is read from.  The first key that's set wins,
+// so owner can fall back from owner to created-by to team.
+type TagKeys struct {
+	Ttl     KeyList `yaml:"ttl"`
+	Expires KeyList `yaml:"expires"`
+	Owner   KeyList `yaml:"owner"`
+	Purpose KeyList `yaml:"purpose"`
+}
+
+func DefaultTagKeys() TagKeys {
+	return TagKeys{
+		Ttl:     KeyList{DEFAULT_TTL_KEY},
+		Expires: KeyList{DEFAULT_EXPIRES_KEY},
+		Owner:   KeyList{DEFAULT_OWNER_KEY},
+		Purpose: KeyList{DEFAULT_PURPOSE_KEY},
+	}
+}
+
+// Or fills in each setting that isn't set from fallback
+func (tk TagKeys) Or(fallback TagKeys) TagKeys {
+	or := func(keys, fallback KeyList) KeyList {
+		if len(keys) == 0 {
+			return fallback
+		}
+		return keys
+	}
+	return TagKeys{
+		Ttl:     or(tk.Ttl, fallback.Ttl),
+		Expires: or(tk.Expires, fallback.Expires),
+		Owner:   or(tk.Owner, fallback.Owner),
+		Purpose: or(tk.Purpose, fallback.Purpose),
+	}
+}
+
+// WithPrefix puts prefix in front of every key that doesn't already have one, eg: owner becomes
+// armory.io/bilge.owner but example.com/team is left alone
+func (tk TagKeys) WithPrefix(prefix string) TagKeys {
+	with := func(keys KeyList) KeyList {
+		prefixed := KeyList{}
+		for _, k := range keys {
+			if !strings.Contains(k, "/") {
+				k = prefix + k
+			}
+			prefixed = append(prefixed, k)
+		}
+		return prefixed
+	}
+	return TagKeys{
+		Ttl:     with(tk.Ttl),
+		Expires: with(tk.Expires),
+		Owner:   with(tk.Owner),
+		Purpose: with(tk.Purpose),
+	}
+}
+
+func (tk TagKeys) validate(account string) []string {
+	errs := []string{}
+	for name, keys := range map[string]KeyList{"ttl": tk.Ttl, "expires": tk.Expires, "owner": tk.Owner, "purpose": tk.Purpose} {
+		for _, k := range keys {
+			if strings.TrimSpace(k) == "" {
+				errs = append(errs, fmt.Sprintf("(%s) tag_keys %s can't have an empty key", account, name))
+			}
+		}
+	}
+	return errs
+}
+
+// SweepLimits cap what a single sweep of an account may delete.  A sweep that would go over any of them deletes
+// nothing and waits for someone to approve it.  Zero means no limit.
+type SweepLimits struct {
+	MaxDeletions        int            `yaml:"max_deletions"`
+	MaxDeletionsPerType map[string]int `yaml:"max_deletions_per_type"`
+	// MaxPercent is of everything the last mark run looked at
+	MaxPercent float64 `yaml:"max_percent"`
+}
+
+// Or fills in each limit that isn't set from fallback.  Per type limits are filled in one type at a time.
+func (sl SweepLimits) Or(fallback SweepLimits) SweepLimits {
+	or := sl
+	if or.MaxDeletions == 0 {
+		or.MaxDeletions = fallback.MaxDeletions
+	}
+	if or.MaxPercent == 0 {
+		or.MaxPercent = fallback.MaxPercent
+	}
+	if len(fallback.MaxDeletionsPerType) != 0 {
+		or.MaxDeletionsPerType = map[string]int{}
+		for t, max := range fallback.MaxDeletionsPerType {
+			or.MaxDeletionsPerType[t] = max
+		}
+		for t, max := range sl.MaxDeletionsPerType {
+			or.MaxDeletionsPerType[t] = max
+		}
+	}
+	return or
+}
+
+// validate checks the per type limits against valid, the account's candidate types
+func (sl SweepLimits) validate(account string, valid map[string]bool) []string {
+	errs := []string{}
+	if sl.MaxDeletions < 0 {
+		errs = append(errs, fmt.Sprintf("(%s) sweep_limits max_deletions can't be negative", account))
+	}
+	if sl.MaxPercent < 0 || sl.MaxPercent > 100 {
+		errs = append(errs, fmt.Sprintf("(%s) sweep_limits max_percent must be between 0 and 100", account))
+	}
+	for t, max := range sl.MaxDeletionsPerType {
+		if !valid[t] {
+			errs = append(errs, fmt.Sprintf("(%s) sweep_limits max_deletions_per_type has invalid candidate %s", account, t))
+		}
+		if max < 0 {
+			errs = append(errs, fmt.Sprintf("(%s) sweep_limits max_deletions_per_type %s can't be negative", account, t))
+		}
+	}
+	return errs
 }
 
 type AwsTagKV struct {
@@ -118,11 +589,57 @@ func (c *Config) setDefaults() {
 	if c.RedisPort == 0 {
 		c.RedisPort = DEFAULT_REDIS_PORT
 	}
+
+	if c.Redis.Mode == "" {
+		c.Redis.Mode = DEFAULT_REDIS_MODE
+	}
+	// the top level host and port still work for a single standalone redis
+	if len(c.Redis.Addresses) == 0 {
+		c.Redis.Addresses = []string{fmt.Sprintf("%s:%d", c.RedisHost, c.RedisPort)}
+	}
+	if c.Redis.Mode == "cluster" && c.Redis.KeyPrefix == "" {
+		c.Redis.KeyPrefix = DEFAULT_CLUSTER_KEY_PREFIX
+	}
+
+	if c.Cache.Backend == "" {
+		c.Cache.Backend = DEFAULT_CACHE_BACKEND
+	}
+	if c.ShutdownTimeout == "" {
+		c.ShutdownTimeout = DEFAULT_SHUTDOWN_TIMEOUT
+	}
+	if c.LeaderElection.Enabled() {
+		c.LeaderElection.setDefaults()
+	}
+	if c.Cache.Backend == "bolt" && c.Cache.Path == "" {
+		c.Cache.Path = DEFAULT_CACHE_PATH
+	}
+	if c.Email.Enabled() && c.Email.Port == 0 {
+		c.Email.Port = DEFAULT_SMTP_PORT
+	}
+	if c.Email.Enabled() && c.Email.Subject == "" {
+		c.Email.Subject = DEFAULT_EMAIL_SUBJECT
+	}
+	for i := range c.Webhooks {
+		c.Webhooks[i].setDefaults()
+	}
+	if c.Slack.SigningSecret.IsSet() && len(c.Slack.SnoozeDurations) == 0 {
+		c.Slack.SnoozeDurations = strings.Split(DEFAULT_SNOOZE_DURATIONS, ",")
+	}
 	if c.Aws != nil || len(c.Aws) != 0 {
 		for i, aws := range c.Aws {
+			// a single region is the same as a list of one
+			if len(aws.Regions) == 0 && aws.Region != "" {
+				c.Aws[i].Regions = []string{aws.Region}
+			}
 			if aws.MaxClientRetry <= 0 {
 				c.Aws[i].MaxClientRetry = DEFAULT_MAX_RETRY
 			}
+			if aws.RateLimit <= 0 {
+				c.Aws[i].RateLimit = DEFAULT_RATE_LIMIT
+			}
+			if aws.RateBurst <= 0 {
+				c.Aws[i].RateBurst = DEFAULT_RATE_BURST
+			}
 			if aws.MarkSchedule == "" {
 				c.Aws[i].MarkSchedule = DEFAULT_MARK_SCHEDULE
 			}
@@ -135,6 +652,39 @@ func (c *Config) setDefaults() {
 			if aws.GracePeriod == "" {
 				c.Aws[i].GracePeriod = DEFAULT_GRACEPERIOD
 			}
+			c.Aws[i].Credentials.setDefaults()
+			c.Aws[i].TagKeys = aws.TagKeys.Or(c.TagKeys).Or(DefaultTagKeys())
+			c.Aws[i].SweepLimits = aws.SweepLimits.Or(c.SweepLimits)
+			if aws.Rds.FinalSnapshot == "" {
+				c.Aws[i].Rds.FinalSnapshot = DEFAULT_RDS_FINAL_SNAPSHOT
+			}
+			if aws.S3.ProtectedPolicy == "" {
+				c.Aws[i].S3.ProtectedPolicy = DEFAULT_S3_PROTECTED_POLICY
+			}
+			if aws.S3.MaxObjects == 0 {
+				c.Aws[i].S3.MaxObjects = DEFAULT_S3_MAX_OBJECTS
+			}
+			if aws.LogGroups.IdlePeriod == "" {
+				c.Aws[i].LogGroups.IdlePeriod = DEFAULT_LOG_GROUP_IDLE_PERIOD
+			}
+		}
+	}
+	if c.Gcp != nil || len(c.Gcp) != 0 {
+		for i, gcp := range c.Gcp {
+			if gcp.MarkSchedule == "" {
+				c.Gcp[i].MarkSchedule = DEFAULT_MARK_SCHEDULE
+			}
+			if gcp.SweepSchedule == "" {
+				c.Gcp[i].SweepSchedule = DEFAULT_SWEEP_SCHEDULE
+			}
+			if gcp.NotifySchedule == "" {
+				c.Gcp[i].NotifySchedule = DEFAULT_NOTIFY_SCHEDULE
+			}
+			if gcp.GracePeriod == "" {
+				c.Gcp[i].GracePeriod = DEFAULT_GRACEPERIOD
+			}
+			c.Gcp[i].TagKeys = gcp.TagKeys.Or(c.TagKeys).Or(DefaultTagKeys())
+			c.Gcp[i].SweepLimits = gcp.SweepLimits.Or(c.SweepLimits)
 		}
 	}
 	if c.Kubernetes != nil || len(c.Kubernetes) != 0 {
@@ -151,6 +701,12 @@ func (c *Config) setDefaults() {
 			if k8s.GracePeriod == "" {
 				c.Kubernetes[i].GracePeriod = DEFAULT_GRACEPERIOD
 			}
+			if k8s.AnnotationPrefix == nil {
+				prefix := DEFAULT_ANNOTATION_PREFIX
+				c.Kubernetes[i].AnnotationPrefix = &prefix
+			}
+			c.Kubernetes[i].TagKeys = k8s.TagKeys.Or(c.TagKeys).Or(DefaultTagKeys()).WithPrefix(*c.Kubernetes[i].AnnotationPrefix)
+			c.Kubernetes[i].SweepLimits = k8s.SweepLimits.Or(c.SweepLimits)
 			if k8s.KubeConfig == "" {
 				home, exists := os.LookupEnv("HOME")
 				if !exists {
@@ -164,23 +720,92 @@ func (c *Config) setDefaults() {
 }
 
 func (c *Config) validate() error {
-	awsErrors := []string{}
+	errs := []string{}
 	if c.Aws != nil {
 		for _, a := range c.Aws {
 			if a.Candidates == nil || len(a.Candidates) == 0 {
-				awsErrors = append(awsErrors, fmt.Sprintf("(%s) must select an aws object to mark", a.Name))
+				errs = append(errs, fmt.Sprintf("(%s) must select an aws object to mark", a.Name))
 				continue
 			}
+			if len(a.Regions) == 0 {
+				errs = append(errs, fmt.Sprintf("(%s) must set region or regions", a.Name))
+			}
+			for _, r := range a.Regions {
+				if r == AWS_ALL_REGIONS && len(a.Regions) != 1 {
+					errs = append(errs, fmt.Sprintf("(%s) regions can't mix %s with named regions", a.Name, AWS_ALL_REGIONS))
+					break
+				}
+			}
+			errs = append(errs, a.Credentials.validate(a.Name)...)
+			errs = append(errs, a.TagKeys.validate(a.Name)...)
+			errs = append(errs, a.SweepLimits.validate(a.Name, validAwsCandidates)...)
+			errs = append(errs, a.Rds.validate(a.Name)...)
+			errs = append(errs, a.S3.validate(a.Name)...)
+			errs = append(errs, a.LogGroups.validate(a.Name)...)
+		}
+	}
+	if c.Gcp != nil {
+		for _, g := range c.Gcp {
+			if g.Candidates == nil || len(g.Candidates) == 0 {
+				errs = append(errs, fmt.Sprintf("(%s) must select a gcp object to mark", g.Name))
+				continue
+			}
+			errs = append(errs, g.TagKeys.validate(g.Name)...)
+			errs = append(errs, g.SweepLimits.validate(g.Name, validGcpCandidates)...)
+		}
+	}
+	for _, d := range c.Slack.SnoozeDurations {
+		if err := isDuration(d, ""); err != nil {
+			errs = append(errs, fmt.Sprintf("(slack) invalid snooze duration %s: %v", d, err))
 		}
 	}
-	if len(awsErrors) != 0 {
-		return errors.New(strings.Join(awsErrors, "\n"))
+	if c.Email.Enabled() {
+		if c.Email.From == "" {
+			errs = append(errs, "(email) from is required")
+		}
+		if c.Email.DefaultTo == "" {
+			errs = append(errs, "(email) default_to is required")
+		}
+	}
+	for _, k := range c.Kubernetes {
+		errs = append(errs, k.TagKeys.validate(k.Name)...)
+		errs = append(errs, k.SweepLimits.validate(k.Name, validK8sCandidates)...)
+	}
+	errs = append(errs, c.TagKeys.validate("tag_keys")...)
+	errs = append(errs, c.SweepLimits.validate("sweep_limits", allCandidates())...)
+	webhookNames := map[string]bool{}
+	for i, w := range c.Webhooks {
+		if webhookNames[w.Name] {
+			errs = append(errs, fmt.Sprintf("(webhooks) %s is configured twice", w.Name))
+		}
+		webhookNames[w.Name] = true
+		errs = append(errs, c.Webhooks[i].validate()...)
+	}
+	if c.ShutdownTimeout != "" {
+		if err := isDuration(c.ShutdownTimeout, ""); err != nil {
+			errs = append(errs, fmt.Sprintf("invalid shutdown_timeout %s: %v", c.ShutdownTimeout, err))
+		}
+	}
+	if c.LeaderElection.Enabled() {
+		errs = append(errs, c.LeaderElection.validate(c.Cache.Backend)...)
+	}
+	if c.Cache.Backend == "" || c.Cache.Backend == "redis" {
+		errs = append(errs, c.Redis.validate()...)
+	}
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "\n"))
 	}
 	//nolint - the only error is on nil name
 	validator.SetValidationFunc("isuri", isURI)
 	//nolint - the only error is on nil name
 	validator.SetValidationFunc("isValidAwsCandidate", isAwsCandidate)
 	//nolint - the only error is on nil name
+	validator.SetValidationFunc("isValidGcpCandidate", isGcpCandidate)
+	//nolint - the only error is on nil name
+	validator.SetValidationFunc("isCacheBackend", isCacheBackend)
+	//nolint - the only error is on nil name
+	validator.SetValidationFunc("isRedisMode", isRedisMode)
+	//nolint - the only error is on nil name
 	validator.SetValidationFunc("isCron", isCron)
 	//nolint - the only error is on nil name
 	validator.SetValidationFunc("isDuration", isDuration)
@@ -195,6 +820,242 @@ func (c *Config) validate() error {
 	return nil
 }
 
+func (le *LeaderElection) setDefaults() {
+	if le.Name == "" {
+		le.Name = DEFAULT_LEADER_ELECTION_NAME
+	}
+	// in kubernetes the hostname is the pod name
+	if le.Identity == "" {
+		le.Identity, _ = os.Hostname()
+	}
+	if le.LeaseDuration == "" {
+		le.LeaseDuration = DEFAULT_LEADER_LEASE_DURATION
+	}
+	if le.RenewDeadline == "" {
+		le.RenewDeadline = DEFAULT_LEADER_RENEW_DEADLINE
+	}
+	if le.RetryPeriod == "" {
+		le.RetryPeriod = DEFAULT_LEADER_RETRY_PERIOD
+	}
+	if le.Backend == "kubernetes" && le.Namespace == "" {
+		le.Namespace = os.Getenv(POD_NAMESPACE_ENV)
+		if le.Namespace == "" {
+			if ns, err := os.ReadFile(SERVICE_ACCOUNT_NAMESPACE_FILE); err == nil {
+				le.Namespace = strings.TrimSpace(string(ns))
+			}
+		}
+		if le.Namespace == "" {
+			le.Namespace = DEFAULT_LEADER_NAMESPACE
+		}
+	}
+}
+
+func (le *LeaderElection) validate(cacheBackend string) []string {
+	errs := []string{}
+	if !validLeaderElectionBackends[le.Backend] {
+		errs = append(errs, fmt.Sprintf("(leader_election) invalid backend %s", le.Backend))
+	}
+	// replicas with their own bolt file wouldn't share candidates, electing one of them doesn't help
+	if cacheBackend == "bolt" {
+		errs = append(errs, "(leader_election) replicas have to share a redis cache")
+	}
+	if le.Identity == "" {
+		errs = append(errs, "(leader_election) identity is required")
+	}
+	durations := map[string]time.Duration{}
+	for name, d := range map[string]string{"lease_duration": le.LeaseDuration, "renew_deadline": le.RenewDeadline, "retry_period": le.RetryPeriod} {
+		parsed, err := model.ParseDuration(d)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("(leader_election) invalid %s %s: %v", name, d, err))
+			continue
+		}
+		durations[name] = time.Duration(parsed)
+	}
+	if len(durations) == 3 {
+		if durations["lease_duration"] < time.Second {
+			errs = append(errs, "(leader_election) lease_duration must be at least 1s")
+		}
+		if durations["renew_deadline"] >= durations["lease_duration"] || durations["retry_period"] >= durations["renew_deadline"] {
+			errs = append(errs, "(leader_election) must have lease_duration > renew_deadline > retry_period")
+		}
+	}
+	return errs
+}
+
+func (w *Webhook) setDefaults() {
+	if w.Mode == "" {
+		w.Mode = DEFAULT_WEBHOOK_MODE
+	}
+	if w.Mode == "event" && len(w.Events) == 0 {
+		w.Events = []string{"marked", "about-to-delete", "deleted", "sweep-halted", "refused"}
+	}
+	if w.WarnBefore == "" {
+		w.WarnBefore = DEFAULT_WEBHOOK_WARN_BEFORE
+	}
+	if w.ContentType == "" {
+		w.ContentType = DEFAULT_WEBHOOK_CONTENT_TYPE
+	}
+	if w.MaxRetries <= 0 {
+		w.MaxRetries = DEFAULT_WEBHOOK_MAX_RETRIES
+	}
+	if w.RetryBackoff == "" {
+		w.RetryBackoff = DEFAULT_WEBHOOK_RETRY_BACKOFF
+	}
+	if w.Timeout == "" {
+		w.Timeout = DEFAULT_WEBHOOK_TIMEOUT
+	}
+}
+
+func (w *Webhook) validate() []string {
+	errs := []string{}
+	if w.Name == "" {
+		errs = append(errs, "(webhooks) name is required")
+	}
+	u, err := url.ParseRequestURI(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		errs = append(errs, fmt.Sprintf("(webhooks) %s needs an http or https url", w.Name))
+	}
+	if !validWebhookModes[w.Mode] {
+		errs = append(errs, fmt.Sprintf("(webhooks) %s has invalid mode %s", w.Name, w.Mode))
+	}
+	if w.Mode == "owner" && len(w.Events) != 0 {
+		errs = append(errs, fmt.Sprintf("(webhooks) %s only takes events in event mode", w.Name))
+	}
+	for _, e := range w.Events {
+		if !validWebhookEvents[e] {
+			errs = append(errs, fmt.Sprintf("(webhooks) %s has invalid event %s", w.Name, e))
+		}
+	}
+	for name, d := range map[string]string{"warn_before": w.WarnBefore, "retry_backoff": w.RetryBackoff, "timeout": w.Timeout} {
+		if err := isDuration(d, ""); err != nil {
+			errs = append(errs, fmt.Sprintf("(webhooks) %s invalid %s %s: %v", w.Name, name, d, err))
+		}
+	}
+	return errs
+}
+
+// snapshot identifiers are letters, digits and single hyphens, starting with a letter
+var rdsSnapshotIdRegex = regexp.MustCompile(`^[A-Za-z](-?[A-Za-z0-9])*$`)
+
+func (ar AwsRds) validate(account string) []string {
+	errs := []string{}
+	// without the id every candidate swept at once would want the same snapshot
+	if !strings.Contains(ar.FinalSnapshot, "{id}") {
+		errs = append(errs, fmt.Sprintf("(%s) rds final_snapshot must contain {id}", account))
+	}
+	if !rdsSnapshotIdRegex.MatchString(ar.FinalSnapshotId("db", time.Now())) {
+		errs = append(errs, fmt.Sprintf("(%s) rds final_snapshot %s isn't a valid snapshot identifier", account, ar.FinalSnapshot))
+	}
+	return errs
+}
+
+func (as AwsS3) validate(account string) []string {
+	errs := []string{}
+	if _, err := regexp.Compile(as.ProtectedPolicy); err != nil {
+		errs = append(errs, fmt.Sprintf("(%s) s3 protected_policy %s: %v", account, as.ProtectedPolicy, err))
+	}
+	if as.MaxObjects < 1 {
+		errs = append(errs, fmt.Sprintf("(%s) s3 max_objects must be at least 1", account))
+	}
+	return errs
+}
+
+func (al AwsLogGroups) validate(account string) []string {
+	errs := []string{}
+	if err := isDuration(al.IdlePeriod, ""); err != nil {
+		errs = append(errs, fmt.Sprintf("(%s) loggroup idle_period %s: %v", account, al.IdlePeriod, err))
+	}
+	return errs
+}
+
+func (ac *AwsCredentials) setDefaults() {
+	if ac.WebIdentity != nil {
+		if ac.WebIdentity.RoleArn == "" {
+			ac.WebIdentity.RoleArn = os.Getenv(AWS_ROLE_ARN_ENV)
+		}
+		if ac.WebIdentity.TokenFile == "" {
+			ac.WebIdentity.TokenFile = os.Getenv(AWS_WEB_IDENTITY_TOKEN_FILE_ENV)
+		}
+		if ac.WebIdentity.SessionName == "" {
+			ac.WebIdentity.SessionName = DEFAULT_AWS_SESSION_NAME
+		}
+	}
+	for i, r := range ac.AssumeRoles {
+		if r.SessionName == "" {
+			ac.AssumeRoles[i].SessionName = DEFAULT_AWS_SESSION_NAME
+		}
+	}
+}
+
+func (ac *AwsCredentials) validate(account string) []string {
+	errs := []string{}
+	sources := []string{}
+	if ac.AccessKeyId.IsSet() || ac.SecretAccessKey.IsSet() {
+		sources = append(sources, "static keys")
+		if !ac.AccessKeyId.IsSet() || !ac.SecretAccessKey.IsSet() {
+			errs = append(errs, fmt.Sprintf("(%s) credentials access_key_id and secret_access_key must be set together", account))
+		}
+	}
+	if ac.SessionToken.IsSet() && !ac.AccessKeyId.IsSet() {
+		errs = append(errs, fmt.Sprintf("(%s) credentials session_token requires static keys", account))
+	}
+	if ac.Profile != "" {
+		sources = append(sources, "profile")
+	}
+	if ac.WebIdentity != nil {
+		sources = append(sources, "web_identity")
+		if ac.WebIdentity.RoleArn == "" {
+			errs = append(errs, fmt.Sprintf("(%s) credentials web_identity requires role_arn or %s", account, AWS_ROLE_ARN_ENV))
+		}
+		if ac.WebIdentity.TokenFile == "" {
+			errs = append(errs, fmt.Sprintf("(%s) credentials web_identity requires token_file or %s", account, AWS_WEB_IDENTITY_TOKEN_FILE_ENV))
+		}
+	}
+	if len(sources) > 1 {
+		errs = append(errs, fmt.Sprintf("(%s) credentials can only use one of %s", account, strings.Join(sources, ", ")))
+	}
+	for i, r := range ac.AssumeRoles {
+		if r.RoleArn == "" {
+			errs = append(errs, fmt.Sprintf("(%s) credentials assume_roles[%d] requires role_arn", account, i))
+		}
+		if r.Duration == "" {
+			continue
+		}
+		// sts won't hand out role sessions shorter than 15 minutes or longer than 12 hours
+		d, err := model.ParseDuration(r.Duration)
+		if err != nil || time.Duration(d) < 15*time.Minute || time.Duration(d) > 12*time.Hour {
+			errs = append(errs, fmt.Sprintf("(%s) credentials assume_roles[%d] duration must be between 15m and 12h", account, i))
+		}
+	}
+	return errs
+}
+
+func (r *Redis) validate() []string {
+	errs := []string{}
+	switch r.Mode {
+	case "sentinel":
+		if r.MasterName == "" {
+			errs = append(errs, "(redis) sentinel mode requires master_name")
+		}
+	case "cluster":
+		if r.DB != 0 {
+			errs = append(errs, "(redis) cluster mode only supports db 0")
+		}
+		if !strings.Contains(r.KeyPrefix, "{") || !strings.Contains(r.KeyPrefix, "}") {
+			errs = append(errs, "(redis) cluster mode requires a key_prefix with a hash tag, ex: {bilge}")
+		}
+	}
+	if r.TLS.CAFile != "" {
+		if err := isPath(r.TLS.CAFile, ""); err != nil {
+			errs = append(errs, fmt.Sprintf("(redis) %v", err))
+		}
+	}
+	if (r.TLS.CertFile == "") != (r.TLS.KeyFile == "") {
+		errs = append(errs, "(redis) tls cert_file and key_file must be set together")
+	}
+	return errs
+}
+
 func isURI(v interface{}, param string) error {
 	_, err := url.ParseRequestURI(reflect.ValueOf(v).String())
 	if err != nil {
@@ -213,6 +1074,17 @@ func isCron(v interface{}, param string) error {
 	return nil
 }
 
+// allCandidates is every candidate type of every marker, for settings that apply to all of them
+func allCandidates() map[string]bool {
+	all := map[string]bool{}
+	for _, valid := range []map[string]bool{validAwsCandidates, validGcpCandidates, validK8sCandidates} {
+		for t := range valid {
+			all[t] = true
+		}
+	}
+	return all
+}
+
 func isAwsCandidate(v interface{}, param string) error {
 	errs := []string{}
 	c := v.([]string)
@@ -227,6 +1099,38 @@ func isAwsCandidate(v interface{}, param string) error {
 	return nil
 }
 
+func isGcpCandidate(v interface{}, param string) error {
+	errs := []string{}
+	c := v.([]string)
+	for _, i := range c {
+		if !validGcpCandidates[i] {
+			errs = append(errs, i)
+		}
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf(fmt.Sprintf("the following candidates are invalid: %s", strings.Join(errs, ", ")))
+	}
+	return nil
+}
+
+func isCacheBackend(v interface{}, param string) error {
+	b := v.(string)
+	// an empty backend falls back to the default
+	if b != "" && !validCacheBackends[b] {
+		return fmt.Errorf("invalid cache backend: %s", b)
+	}
+	return nil
+}
+
+func isRedisMode(v interface{}, param string) error {
+	m := v.(string)
+	// an empty mode falls back to the default
+	if m != "" && !validRedisModes[m] {
+		return fmt.Errorf("invalid redis mode: %s", m)
+	}
+	return nil
+}
+
 func isDuration(v interface{}, param string) error {
 	c := v.(string)
 	_, err := model.ParseDuration(c)
@@ -1,7 +1,10 @@
 package config
 
 import (
+	"gopkg.in/yaml.v2"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -13,6 +16,22 @@ func GetNewValidConfig() Config {
 	}
 }
 
+func getNewValidAws(regions ...string) Aws {
+	return Aws{
+		Name:           "dev",
+		Candidates:     []string{"ec2"},
+		Regions:        regions,
+		MarkSchedule:   DEFAULT_MARK_SCHEDULE,
+		SweepSchedule:  DEFAULT_SWEEP_SCHEDULE,
+		NotifySchedule: DEFAULT_NOTIFY_SCHEDULE,
+		GracePeriod:    DEFAULT_GRACEPERIOD,
+		IamRole:        "arn:aws:iam::123456789012:role/bilgepump",
+		Rds:            AwsRds{FinalSnapshot: DEFAULT_RDS_FINAL_SNAPSHOT},
+		S3:             AwsS3{ProtectedPolicy: DEFAULT_S3_PROTECTED_POLICY, MaxObjects: DEFAULT_S3_MAX_OBJECTS},
+		LogGroups:      AwsLogGroups{IdlePeriod: DEFAULT_LOG_GROUP_IDLE_PERIOD},
+	}
+}
+
 func TestSetDefaults(t *testing.T) {
 	testCases := map[string]struct {
 		config   *Config
@@ -26,6 +45,14 @@ func TestSetDefaults(t *testing.T) {
 			expected: &Config{
 				RedisHost: "localhost",
 				RedisPort: uint32(5555),
+				Redis: Redis{
+					Mode:      DEFAULT_REDIS_MODE,
+					Addresses: []string{"localhost:5555"},
+				},
+				Cache: Cache{
+					Backend: DEFAULT_CACHE_BACKEND,
+				},
+				ShutdownTimeout: DEFAULT_SHUTDOWN_TIMEOUT,
 			},
 		},
 		"set nothing": {
@@ -33,6 +60,88 @@ func TestSetDefaults(t *testing.T) {
 			expected: &Config{
 				RedisHost: DEFAULT_REDIS_HOST,
 				RedisPort: DEFAULT_REDIS_PORT,
+				Redis: Redis{
+					Mode:      DEFAULT_REDIS_MODE,
+					Addresses: []string{"127.0.0.1:6379"},
+				},
+				Cache: Cache{
+					Backend: DEFAULT_CACHE_BACKEND,
+				},
+				ShutdownTimeout: DEFAULT_SHUTDOWN_TIMEOUT,
+			},
+		},
+		"bolt path": {
+			config: &Config{
+				Cache: Cache{
+					Backend: "bolt",
+				},
+			},
+			expected: &Config{
+				RedisHost: DEFAULT_REDIS_HOST,
+				RedisPort: DEFAULT_REDIS_PORT,
+				Redis: Redis{
+					Mode:      DEFAULT_REDIS_MODE,
+					Addresses: []string{"127.0.0.1:6379"},
+				},
+				Cache: Cache{
+					Backend: "bolt",
+					Path:    DEFAULT_CACHE_PATH,
+				},
+				ShutdownTimeout: DEFAULT_SHUTDOWN_TIMEOUT,
+			},
+		},
+		"single aws region": {
+			config: &Config{
+				Aws: []Aws{{Name: "dev", Region: "us-east-1"}},
+			},
+			expected: &Config{
+				RedisHost: DEFAULT_REDIS_HOST,
+				RedisPort: DEFAULT_REDIS_PORT,
+				Redis: Redis{
+					Mode:      DEFAULT_REDIS_MODE,
+					Addresses: []string{"127.0.0.1:6379"},
+				},
+				Cache: Cache{
+					Backend: DEFAULT_CACHE_BACKEND,
+				},
+				ShutdownTimeout: DEFAULT_SHUTDOWN_TIMEOUT,
+				Aws: []Aws{{
+					Name:           "dev",
+					Region:         "us-east-1",
+					Regions:        []string{"us-east-1"},
+					MaxClientRetry: DEFAULT_MAX_RETRY,
+					RateLimit:      DEFAULT_RATE_LIMIT,
+					RateBurst:      DEFAULT_RATE_BURST,
+					MarkSchedule:   DEFAULT_MARK_SCHEDULE,
+					SweepSchedule:  DEFAULT_SWEEP_SCHEDULE,
+					NotifySchedule: DEFAULT_NOTIFY_SCHEDULE,
+					GracePeriod:    DEFAULT_GRACEPERIOD,
+					TagKeys:        DefaultTagKeys(),
+					Rds:            AwsRds{FinalSnapshot: DEFAULT_RDS_FINAL_SNAPSHOT},
+					S3:             AwsS3{ProtectedPolicy: DEFAULT_S3_PROTECTED_POLICY, MaxObjects: DEFAULT_S3_MAX_OBJECTS},
+					LogGroups:      AwsLogGroups{IdlePeriod: DEFAULT_LOG_GROUP_IDLE_PERIOD},
+				}},
+			},
+		},
+		"redis cluster prefix": {
+			config: &Config{
+				Redis: Redis{
+					Mode:      "cluster",
+					Addresses: []string{"10.0.0.1:6379", "10.0.0.2:6379"},
+				},
+			},
+			expected: &Config{
+				RedisHost: DEFAULT_REDIS_HOST,
+				RedisPort: DEFAULT_REDIS_PORT,
+				Redis: Redis{
+					Mode:      "cluster",
+					Addresses: []string{"10.0.0.1:6379", "10.0.0.2:6379"},
+					KeyPrefix: DEFAULT_CLUSTER_KEY_PREFIX,
+				},
+				Cache: Cache{
+					Backend: DEFAULT_CACHE_BACKEND,
+				},
+				ShutdownTimeout: DEFAULT_SHUTDOWN_TIMEOUT,
 			},
 		},
 	}
@@ -56,6 +165,321 @@ func TestValidate(t *testing.T) {
 			},
 			expectErr: false,
 		},
+		"sentinel without master": {
+			config: func(c Config) *Config {
+				c.Redis.Mode = "sentinel"
+				return &c
+			},
+			expectErr: true,
+		},
+		"cluster without hash tag": {
+			config: func(c Config) *Config {
+				c.Redis.Mode = "cluster"
+				c.Redis.KeyPrefix = "bilge:"
+				return &c
+			},
+			expectErr: true,
+		},
+		"bad redis mode": {
+			config: func(c Config) *Config {
+				c.Redis.Mode = "proxy"
+				return &c
+			},
+			expectErr: true,
+		},
+		"bad shutdown timeout": {
+			config: func(c Config) *Config {
+				c.ShutdownTimeout = "soon"
+				return &c
+			},
+			expectErr: true,
+		},
+		"redis leader election": {
+			config: func(c Config) *Config {
+				c.LeaderElection = validLeaderElection("redis")
+				return &c
+			},
+			expectErr: false,
+		},
+		"bad leader election backend": {
+			config: func(c Config) *Config {
+				c.LeaderElection = validLeaderElection("etcd")
+				return &c
+			},
+			expectErr: true,
+		},
+		"leader election with bolt": {
+			config: func(c Config) *Config {
+				c.LeaderElection = validLeaderElection("kubernetes")
+				c.Cache = Cache{Backend: "bolt", Path: "/tmp/bilge.db"}
+				return &c
+			},
+			expectErr: true,
+		},
+		"leader renews after its lease": {
+			config: func(c Config) *Config {
+				c.LeaderElection = validLeaderElection("redis")
+				c.LeaderElection.RenewDeadline = "20s"
+				return &c
+			},
+			expectErr: true,
+		},
+		"email": {
+			config: func(c Config) *Config {
+				c.Email = Email{Host: "smtp.example.com", From: "bilge@example.com", DefaultTo: "cloud@example.com"}
+				return &c
+			},
+			expectErr: false,
+		},
+		"email without from": {
+			config: func(c Config) *Config {
+				c.Email = Email{Host: "smtp.example.com", DefaultTo: "cloud@example.com"}
+				return &c
+			},
+			expectErr: true,
+		},
+		"email without default_to": {
+			config: func(c Config) *Config {
+				c.Email = Email{Host: "smtp.example.com", From: "bilge@example.com"}
+				return &c
+			},
+			expectErr: true,
+		},
+		"webhook": {
+			config: func(c Config) *Config {
+				c.Webhooks = []Webhook{validWebhook("tickets")}
+				return &c
+			},
+			expectErr: false,
+		},
+		"webhook names collide": {
+			config: func(c Config) *Config {
+				c.Webhooks = []Webhook{validWebhook("tickets"), validWebhook("tickets")}
+				return &c
+			},
+			expectErr: true,
+		},
+		"webhook without a url": {
+			config: func(c Config) *Config {
+				w := validWebhook("tickets")
+				w.URL = "/hooks"
+				c.Webhooks = []Webhook{w}
+				return &c
+			},
+			expectErr: true,
+		},
+		"webhook events in owner mode": {
+			config: func(c Config) *Config {
+				w := validWebhook("tickets")
+				w.Events = []string{"deleted"}
+				c.Webhooks = []Webhook{w}
+				return &c
+			},
+			expectErr: true,
+		},
+		"bad webhook event": {
+			config: func(c Config) *Config {
+				w := validWebhook("tickets")
+				w.Mode = "event"
+				w.Events = []string{"exploded"}
+				c.Webhooks = []Webhook{w}
+				return &c
+			},
+			expectErr: true,
+		},
+		"bad cache backend": {
+			config: func(c Config) *Config {
+				c.Cache.Backend = "memcached"
+				return &c
+			},
+			expectErr: true,
+		},
+		"aws regions": {
+			config: func(c Config) *Config {
+				c.Aws = []Aws{getNewValidAws("us-east-1", "us-west-2")}
+				return &c
+			},
+			expectErr: false,
+		},
+		"aws all regions": {
+			config: func(c Config) *Config {
+				c.Aws = []Aws{getNewValidAws(AWS_ALL_REGIONS)}
+				return &c
+			},
+			expectErr: false,
+		},
+		"aws without region": {
+			config: func(c Config) *Config {
+				c.Aws = []Aws{getNewValidAws()}
+				return &c
+			},
+			expectErr: true,
+		},
+		"aws all with named regions": {
+			config: func(c Config) *Config {
+				c.Aws = []Aws{getNewValidAws(AWS_ALL_REGIONS, "us-east-1")}
+				return &c
+			},
+			expectErr: true,
+		},
+		"aws credentials chain": {
+			config: func(c Config) *Config {
+				a := getNewValidAws("us-east-1")
+				a.Credentials = AwsCredentials{
+					AccessKeyId:     Secret{Env: "AWS_ACCESS_KEY_ID"},
+					SecretAccessKey: Secret{File: "/var/run/secrets/aws"},
+					AssumeRoles:     []AwsAssumeRole{{RoleArn: "arn:aws:iam::1:role/a", ExternalId: Secret{Value: "x"}, Duration: "1h"}},
+				}
+				c.Aws = []Aws{a}
+				return &c
+			},
+			expectErr: false,
+		},
+		"aws credentials half static keys": {
+			config: func(c Config) *Config {
+				a := getNewValidAws("us-east-1")
+				a.Credentials = AwsCredentials{AccessKeyId: Secret{Value: "id"}}
+				c.Aws = []Aws{a}
+				return &c
+			},
+			expectErr: true,
+		},
+		"aws credentials two sources": {
+			config: func(c Config) *Config {
+				a := getNewValidAws("us-east-1")
+				a.Credentials = AwsCredentials{Profile: "dev", WebIdentity: &AwsWebIdentity{RoleArn: "arn:aws:iam::1:role/a", TokenFile: "/token"}}
+				c.Aws = []Aws{a}
+				return &c
+			},
+			expectErr: true,
+		},
+		"aws credentials web identity without role": {
+			config: func(c Config) *Config {
+				a := getNewValidAws("us-east-1")
+				a.Credentials = AwsCredentials{WebIdentity: &AwsWebIdentity{TokenFile: "/token"}}
+				c.Aws = []Aws{a}
+				return &c
+			},
+			expectErr: true,
+		},
+		"aws credentials role without arn": {
+			config: func(c Config) *Config {
+				a := getNewValidAws("us-east-1")
+				a.Credentials = AwsCredentials{AssumeRoles: []AwsAssumeRole{{ExternalId: Secret{Value: "x"}}}}
+				c.Aws = []Aws{a}
+				return &c
+			},
+			expectErr: true,
+		},
+		"aws credentials role too long": {
+			config: func(c Config) *Config {
+				a := getNewValidAws("us-east-1")
+				a.Credentials = AwsCredentials{AssumeRoles: []AwsAssumeRole{{RoleArn: "arn:aws:iam::1:role/a", Duration: "1d"}}}
+				c.Aws = []Aws{a}
+				return &c
+			},
+			expectErr: true,
+		},
+		"sweep limits": {
+			config: func(c Config) *Config {
+				a := getNewValidAws("us-east-1")
+				a.SweepLimits = SweepLimits{MaxDeletions: 50, MaxDeletionsPerType: map[string]int{"ec2": 10}, MaxPercent: 20}
+				c.Aws = []Aws{a}
+				return &c
+			},
+			expectErr: false,
+		},
+		"sweep limits over 100 percent": {
+			config: func(c Config) *Config {
+				c.SweepLimits = SweepLimits{MaxPercent: 120}
+				return &c
+			},
+			expectErr: true,
+		},
+		"sweep limits negative": {
+			config: func(c Config) *Config {
+				a := getNewValidAws("us-east-1")
+				a.SweepLimits = SweepLimits{MaxDeletions: -1}
+				c.Aws = []Aws{a}
+				return &c
+			},
+			expectErr: true,
+		},
+		"sweep limits for another marker's type": {
+			config: func(c Config) *Config {
+				a := getNewValidAws("us-east-1")
+				a.SweepLimits = SweepLimits{MaxDeletionsPerType: map[string]int{"namespace": 1}}
+				c.Aws = []Aws{a}
+				return &c
+			},
+			expectErr: true,
+		},
+		"rds candidates": {
+			config: func(c Config) *Config {
+				a := getNewValidAws("us-east-1")
+				a.Candidates = []string{"rds", "aurora"}
+				a.Rds.FinalSnapshot = "final-{id}"
+				c.Aws = []Aws{a}
+				return &c
+			},
+			expectErr: false,
+		},
+		"rds final snapshot without id": {
+			config: func(c Config) *Config {
+				a := getNewValidAws("us-east-1")
+				a.Rds.FinalSnapshot = "final-{date}"
+				c.Aws = []Aws{a}
+				return &c
+			},
+			expectErr: true,
+		},
+		"rds final snapshot invalid identifier": {
+			config: func(c Config) *Config {
+				a := getNewValidAws("us-east-1")
+				a.Rds.FinalSnapshot = "{id}_final"
+				c.Aws = []Aws{a}
+				return &c
+			},
+			expectErr: true,
+		},
+		"s3 protected policy invalid regex": {
+			config: func(c Config) *Config {
+				a := getNewValidAws("us-east-1")
+				a.Candidates = []string{"s3"}
+				a.S3.ProtectedPolicy = "s3:(Delete"
+				c.Aws = []Aws{a}
+				return &c
+			},
+			expectErr: true,
+		},
+		"s3 max objects negative": {
+			config: func(c Config) *Config {
+				a := getNewValidAws("us-east-1")
+				a.S3.MaxObjects = -1
+				c.Aws = []Aws{a}
+				return &c
+			},
+			expectErr: true,
+		},
+		"loggroup candidates": {
+			config: func(c Config) *Config {
+				a := getNewValidAws("us-east-1")
+				a.Candidates = []string{"lambda", "ecr", "loggroup"}
+				a.LogGroups.IdlePeriod = "2w"
+				c.Aws = []Aws{a}
+				return &c
+			},
+			expectErr: false,
+		},
+		"loggroup idle period invalid": {
+			config: func(c Config) *Config {
+				a := getNewValidAws("us-east-1")
+				a.LogGroups.IdlePeriod = "a while"
+				c.Aws = []Aws{a}
+				return &c
+			},
+			expectErr: true,
+		},
 	}
 
 	for desc, tc := range testCases {
@@ -66,3 +490,130 @@ func TestValidate(t *testing.T) {
 		})
 	}
 }
+
+func TestRdsFinalSnapshotId(t *testing.T) {
+	ar := AwsRds{FinalSnapshot: DEFAULT_RDS_FINAL_SNAPSHOT}
+	swept := time.Date(2019, 3, 4, 5, 6, 7, 0, time.UTC)
+	assert.Equal(t, "bilge-final-orders-db-20190304-050607", ar.FinalSnapshotId("orders-db", swept))
+}
+
+func TestSweepLimitsOr(t *testing.T) {
+	global := SweepLimits{MaxDeletions: 100, MaxDeletionsPerType: map[string]int{"ec2": 10, "ebs": 20}, MaxPercent: 10}
+	own := SweepLimits{MaxDeletions: 5, MaxDeletionsPerType: map[string]int{"ec2": 1}}
+	assert.Equal(t, SweepLimits{MaxDeletions: 5, MaxDeletionsPerType: map[string]int{"ec2": 1, "ebs": 20}, MaxPercent: 10}, own.Or(global))
+	assert.Equal(t, global, SweepLimits{}.Or(global))
+}
+
+func validLeaderElection(backend string) LeaderElection {
+	return LeaderElection{
+		Backend:       backend,
+		Name:          DEFAULT_LEADER_ELECTION_NAME,
+		Identity:      "bilgepump-0",
+		LeaseDuration: DEFAULT_LEADER_LEASE_DURATION,
+		RenewDeadline: DEFAULT_LEADER_RENEW_DEADLINE,
+		RetryPeriod:   DEFAULT_LEADER_RETRY_PERIOD,
+	}
+}
+
+func validWebhook(name string) Webhook {
+	w := Webhook{Name: name, URL: "https://hooks.example.com/bilge"}
+	w.setDefaults()
+	return w
+}
+
+func TestWebhookDefaults(t *testing.T) {
+	w := Webhook{Name: "tickets", URL: "https://hooks.example.com/bilge", Mode: "event"}
+	w.setDefaults()
+	assert.Equal(t, []string{"marked", "about-to-delete", "deleted", "sweep-halted", "refused"}, w.Events)
+	assert.Equal(t, DEFAULT_WEBHOOK_MAX_RETRIES, w.MaxRetries)
+	assert.Equal(t, DEFAULT_WEBHOOK_CONTENT_TYPE, w.ContentType)
+	assert.Empty(t, w.validate())
+}
+
+func TestTagKeys(t *testing.T) {
+	var c Config
+	assert.Nil(t, yaml.Unmarshal([]byte(`
+tag_keys:
+  ttl: expiry
+  owner: [team, created-by]
+aws:
+  - name: dev
+    tag_keys:
+      owner: [owner, team]
+gcp:
+  - name: gce
+kubernetes:
+  - name: eks
+    kubeconfig: /dev/null
+    annotation_keys:
+      purpose: [purpose, example.com/cost-center]
+  - name: bare
+    kubeconfig: /dev/null
+    annotation_prefix: ""
+`), &c))
+	c.setDefaults()
+
+	// accounts fall back to the global keys, then the defaults, one setting at a time
+	assert.Equal(t, TagKeys{Ttl: KeyList{"expiry"}, Expires: KeyList{"expires"}, Owner: KeyList{"owner", "team"}, Purpose: KeyList{"purpose"}}, c.Aws[0].TagKeys)
+	assert.Equal(t, TagKeys{Ttl: KeyList{"expiry"}, Expires: KeyList{"expires"}, Owner: KeyList{"team", "created-by"}, Purpose: KeyList{"purpose"}}, c.Gcp[0].TagKeys)
+	assert.Equal(t, TagKeys{
+		Ttl:     KeyList{"armory.io/bilge.expiry"},
+		Expires: KeyList{"armory.io/bilge.expires"},
+		Owner:   KeyList{"armory.io/bilge.team", "armory.io/bilge.created-by"},
+		Purpose: KeyList{"armory.io/bilge.purpose", "example.com/cost-center"},
+	}, c.Kubernetes[0].TagKeys)
+	assert.Equal(t, KeyList{"team", "created-by"}, c.Kubernetes[1].TagKeys.Owner)
+
+	c.TagKeys.Ttl = KeyList{""}
+	assert.NotEmpty(t, c.TagKeys.validate("tag_keys"))
+}
+
+func TestLeaderElectionDefaults(t *testing.T) {
+	t.Setenv(POD_NAMESPACE_ENV, "tools")
+	le := LeaderElection{Backend: "kubernetes", Identity: "bilgepump-0"}
+	le.setDefaults()
+	expected := validLeaderElection("kubernetes")
+	expected.Namespace = "tools"
+	assert.Equal(t, expected, le)
+	assert.Empty(t, le.validate("redis"))
+}
+
+func TestAwsCredentialsDefaults(t *testing.T) {
+	t.Setenv(AWS_ROLE_ARN_ENV, "arn:aws:iam::1:role/irsa")
+	t.Setenv(AWS_WEB_IDENTITY_TOKEN_FILE_ENV, "/var/run/secrets/eks.amazonaws.com/serviceaccount/token")
+	ac := AwsCredentials{
+		WebIdentity: &AwsWebIdentity{},
+		AssumeRoles: []AwsAssumeRole{{RoleArn: "arn:aws:iam::2:role/a"}},
+	}
+	ac.setDefaults()
+	assert.Equal(t, &AwsWebIdentity{
+		RoleArn:     "arn:aws:iam::1:role/irsa",
+		TokenFile:   "/var/run/secrets/eks.amazonaws.com/serviceaccount/token",
+		SessionName: DEFAULT_AWS_SESSION_NAME,
+	}, ac.WebIdentity)
+	assert.Equal(t, DEFAULT_AWS_SESSION_NAME, ac.AssumeRoles[0].SessionName)
+	assert.Empty(t, ac.validate("dev"))
+}
+
+func TestSecret(t *testing.T) {
+	t.Setenv("BILGE_TEST_SECRET", "from-env")
+	file := t.TempDir() + "/secret"
+	assert.Nil(t, os.WriteFile(file, []byte("from-file\n"), 0600))
+
+	var c struct {
+		Inline Secret `yaml:"inline"`
+		Env    Secret `yaml:"env"`
+		File   Secret `yaml:"file"`
+	}
+	err := yaml.Unmarshal([]byte("inline: plain\nenv:\n  env: BILGE_TEST_SECRET\nfile:\n  file: "+file+"\n"), &c)
+	assert.Nil(t, err)
+
+	for expected, s := range map[string]Secret{"plain": c.Inline, "from-env": c.Env, "from-file": c.File} {
+		v, err := s.Resolve()
+		assert.Nil(t, err)
+		assert.Equal(t, expected, v)
+	}
+
+	_, err = Secret{Env: "BILGE_TEST_MISSING"}.Resolve()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,178 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"github.com/armory-io/bilgepump/pkg/cache"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/armory-io/bilgepump/pkg/metrics"
+	"github.com/prometheus/common/model"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"sync"
+	"time"
+)
+
+// Elector campaigns for leadership until it's resigned.  Only the leader should schedule mark, sweep
+// and notify runs; every replica can keep serving the api and metrics.
+type Elector struct {
+	Config    *config.LeaderElection
+	Logger    *logrus.Entry
+	elector   *leaderelection.LeaderElector
+	lead      func()
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+	lost      chan struct{}
+	mux       sync.Mutex
+	leading   bool
+	resigning bool
+}
+
+// NewElector builds an elector for the configured backend.  lead is called once, in the background,
+// when this replica becomes the leader.
+func NewElector(cfg *config.Config, logger *logrus.Logger, c cache.Cache, lead func()) (*Elector, error) {
+	le := &cfg.LeaderElection
+	entry := logger.WithFields(logrus.Fields{"class": "leader", "identity": le.Identity})
+	lock, err := newLock(cfg, entry, c)
+	if err != nil {
+		return nil, err
+	}
+	// validated with the rest of the config
+	leaseDuration, _ := model.ParseDuration(le.LeaseDuration)
+	renewDeadline, _ := model.ParseDuration(le.RenewDeadline)
+	retryPeriod, _ := model.ParseDuration(le.RetryPeriod)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	e := &Elector{
+		Config: le,
+		Logger: entry,
+		lead:   lead,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		lost:   make(chan struct{}),
+	}
+	e.elector, err = leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		Name:            le.Name,
+		LeaseDuration:   time.Duration(leaseDuration),
+		RenewDeadline:   time.Duration(renewDeadline),
+		RetryPeriod:     time.Duration(retryPeriod),
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: e.startedLeading,
+			OnStoppedLeading: e.stoppedLeading,
+			OnNewLeader: func(identity string) {
+				if identity != le.Identity {
+					entry.Infof("%s is the leader", identity)
+				}
+			},
+		},
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return e, nil
+}
+
+func newLock(cfg *config.Config, logger *logrus.Entry, c cache.Cache) (resourcelock.Interface, error) {
+	le := &cfg.LeaderElection
+	switch le.Backend {
+	case "redis":
+		rc, ok := c.(*cache.RedisCache)
+		if !ok {
+			return nil, errors.New("redis leader election needs the redis cache backend")
+		}
+		return newRedisLock(rc.Client, cfg.Redis.KeyPrefix+REDIS_LEADER_KEY+le.Name, le.Identity, logger), nil
+	case "kubernetes":
+		kconf, err := clientcmd.BuildConfigFromFlags("", le.KubeConfig)
+		if err != nil {
+			return nil, err
+		}
+		clientset, err := kubernetes.NewForConfig(kconf)
+		if err != nil {
+			return nil, err
+		}
+		return &resourcelock.LeaseLock{
+			LeaseMeta: v1.ObjectMeta{
+				Namespace: le.Namespace,
+				Name:      le.Name,
+			},
+			Client:     clientset.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: le.Identity},
+		}, nil
+	default:
+		return nil, errors.New("unknown leader election backend " + le.Backend)
+	}
+}
+
+// Run campaigns in the background until Resign is called
+func (e *Elector) Run() {
+	e.Logger.Infof("Campaigning for leadership of %s using %s", e.Config.Name, e.Config.Backend)
+	go func() {
+		defer close(e.done)
+		e.elector.Run(e.ctx)
+	}()
+}
+
+func (e *Elector) IsLeader() bool {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	return e.leading
+}
+
+// Lost is closed if we stop being the leader without resigning, eg: we couldn't renew the lease in time.
+// Another replica may already be running jobs, so ours have to stop right away.
+func (e *Elector) Lost() <-chan struct{} {
+	return e.lost
+}
+
+// Resign stops campaigning and gives up the lease if we hold it so a standby can take over without
+// waiting for it to expire.  It waits up to timeout for the lease to be released.
+func (e *Elector) Resign(timeout time.Duration) {
+	e.mux.Lock()
+	e.resigning = true
+	e.mux.Unlock()
+	e.cancel()
+	select {
+	case <-e.done:
+	case <-time.After(timeout):
+		e.Logger.Warnf("Gave up releasing the lease after %s", timeout)
+	}
+}
+
+func (e *Elector) startedLeading(ctx context.Context) {
+	e.mux.Lock()
+	// the elector stops leading by canceling ctx first, so this can't race with stoppedLeading
+	if ctx.Err() != nil {
+		e.mux.Unlock()
+		return
+	}
+	e.leading = true
+	e.mux.Unlock()
+	metrics.Leader.Set(1)
+	e.Logger.Info("Became the leader")
+	e.lead()
+}
+
+func (e *Elector) stoppedLeading() {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if !e.leading {
+		return
+	}
+	e.leading = false
+	metrics.Leader.Set(0)
+	if e.resigning {
+		e.Logger.Info("Resigned leadership")
+		return
+	}
+	e.Logger.Error("Lost leadership")
+	close(e.lost)
+}
@@ -0,0 +1,119 @@
+package leader
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/armory-io/bilgepump/pkg/cache"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"testing"
+	"time"
+)
+
+func newTestElector(t *testing.T, mr *miniredis.Miniredis, identity string) (*Elector, chan bool) {
+	cfg := &config.Config{
+		Redis: config.Redis{Mode: "standalone", Addresses: []string{mr.Addr()}, KeyPrefix: "test:"},
+		LeaderElection: config.LeaderElection{
+			Backend:       "redis",
+			Name:          "bilgepump",
+			Identity:      identity,
+			LeaseDuration: "1s",
+			RenewDeadline: "500ms",
+			RetryPeriod:   "100ms",
+		},
+	}
+	rc, err := cache.NewRedisCache(cfg, logrus.New())
+	assert.Nil(t, err)
+	t.Cleanup(func() { rc.Close() })
+	led := make(chan bool, 1)
+	e, err := NewElector(cfg, logrus.New(), rc, func() { led <- true })
+	assert.Nil(t, err)
+	return e, led
+}
+
+func TestRedisLock(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rc, err := cache.NewRedisCache(&config.Config{Redis: config.Redis{Mode: "standalone", Addresses: []string{mr.Addr()}}}, logrus.New())
+	assert.Nil(t, err)
+	ctx := context.Background()
+	a := newRedisLock(rc.Client, "bilge:leader:test", "a", logrus.NewEntry(logrus.New()))
+	b := newRedisLock(rc.Client, "bilge:leader:test", "b", logrus.NewEntry(logrus.New()))
+
+	_, _, err = a.Get(ctx)
+	assert.True(t, apierrors.IsNotFound(err))
+	assert.Nil(t, a.Create(ctx, resourcelock.LeaderElectionRecord{HolderIdentity: "a"}))
+	assert.NotNil(t, b.Create(ctx, resourcelock.LeaderElectionRecord{HolderIdentity: "b"}))
+
+	record, _, err := b.Get(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "a", record.HolderIdentity)
+	assert.Nil(t, a.Update(ctx, resourcelock.LeaderElectionRecord{HolderIdentity: "a", LeaderTransitions: 1}))
+	// b read the record before a renewed it
+	assert.Equal(t, errLockChanged, b.Update(ctx, resourcelock.LeaderElectionRecord{HolderIdentity: "b"}))
+
+	record, _, err = b.Get(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, record.LeaderTransitions)
+	assert.Nil(t, b.Update(ctx, resourcelock.LeaderElectionRecord{HolderIdentity: "b"}))
+}
+
+func TestElectorHandsOver(t *testing.T) {
+	mr := miniredis.RunT(t)
+	a, aLed := newTestElector(t, mr, "a")
+	b, bLed := newTestElector(t, mr, "b")
+
+	a.Run()
+	select {
+	case <-aLed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a never became the leader")
+	}
+	assert.True(t, mr.Exists("test:bilge:leader:bilgepump"))
+	b.Run()
+	select {
+	case <-bLed:
+		t.Fatal("b became the leader while a held the lease")
+	case <-time.After(1500 * time.Millisecond):
+	}
+	assert.True(t, a.IsLeader())
+	assert.False(t, b.IsLeader())
+
+	a.Resign(time.Second)
+	assert.False(t, a.IsLeader())
+	select {
+	case <-bLed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("b never took over")
+	}
+	assert.True(t, b.IsLeader())
+	select {
+	case <-a.Lost():
+		t.Fatal("resigning isn't losing leadership")
+	default:
+	}
+	b.Resign(time.Second)
+}
+
+func TestElectorLosesLease(t *testing.T) {
+	mr := miniredis.RunT(t)
+	a, aLed := newTestElector(t, mr, "a")
+	a.Run()
+	select {
+	case <-aLed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a never became the leader")
+	}
+
+	// someone else takes the lease out from under us
+	mr.Set("test:bilge:leader:bilgepump", `{"holderIdentity":"b","leaseDurationSeconds":60}`)
+	select {
+	case <-a.Lost():
+	case <-time.After(5 * time.Second):
+		t.Fatal("a never noticed it lost the lease")
+	}
+	assert.False(t, a.IsLeader())
+	a.Resign(time.Second)
+}
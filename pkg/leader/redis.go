@@ -0,0 +1,115 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"sync"
+)
+
+const REDIS_LEADER_KEY = "bilge:leader:"
+
+// only overwrite the record if nobody else has since we read it
+var redisCompareAndSet = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("SET", KEYS[1], ARGV[2])
+end
+return false
+`)
+
+var errLockChanged = errors.New("leader record changed since it was read")
+
+// redisLock keeps the election record in a single redis key.  Updates are compare and set against the
+// record we last read, the same way a Lease is updated against its resource version.
+type redisLock struct {
+	client   redis.UniversalClient
+	key      string
+	identity string
+	logger   *logrus.Entry
+	mux      sync.Mutex
+	raw      []byte
+}
+
+func newRedisLock(client redis.UniversalClient, key, identity string, logger *logrus.Entry) *redisLock {
+	return &redisLock{
+		client:   client,
+		key:      key,
+		identity: identity,
+		logger:   logger,
+	}
+}
+
+func (rl *redisLock) Get(ctx context.Context) (*resourcelock.LeaderElectionRecord, []byte, error) {
+	raw, err := rl.client.Get(ctx, rl.key).Bytes()
+	if err == redis.Nil {
+		return nil, nil, apierrors.NewNotFound(schema.GroupResource{Resource: "redis"}, rl.key)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var record resourcelock.LeaderElectionRecord
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return nil, nil, err
+	}
+	rl.mux.Lock()
+	rl.raw = raw
+	rl.mux.Unlock()
+	return &record, raw, nil
+}
+
+func (rl *redisLock) Create(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	raw, err := json.Marshal(ler)
+	if err != nil {
+		return err
+	}
+	ok, err := rl.client.SetNX(ctx, rl.key, raw, 0).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errLockChanged
+	}
+	rl.mux.Lock()
+	rl.raw = raw
+	rl.mux.Unlock()
+	return nil
+}
+
+func (rl *redisLock) Update(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	raw, err := json.Marshal(ler)
+	if err != nil {
+		return err
+	}
+	rl.mux.Lock()
+	defer rl.mux.Unlock()
+	if rl.raw == nil {
+		return errors.New("leader record not initialized, call get or create first")
+	}
+	err = redisCompareAndSet.Run(ctx, rl.client, []string{rl.key}, rl.raw, raw).Err()
+	if err == redis.Nil {
+		return errLockChanged
+	}
+	if err != nil {
+		return err
+	}
+	rl.raw = raw
+	return nil
+}
+
+func (rl *redisLock) RecordEvent(s string) {
+	rl.logger.Infof("%s %s", rl.identity, s)
+}
+
+func (rl *redisLock) Identity() string {
+	return rl.identity
+}
+
+func (rl *redisLock) Describe() string {
+	return fmt.Sprintf("redis:%s", rl.key)
+}
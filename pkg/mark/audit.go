@@ -0,0 +1,156 @@
+package mark
+
+import (
+	"encoding/json"
+	"github.com/armory-io/bilgepump/pkg/cache"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// actions recorded in the audit log.  every change to a candidate's state is written as one of these, along
+// with whatever we knew about the candidate when it happened.
+const (
+	AUDIT_MARK    = "mark"
+	AUDIT_IGNORE  = "ignore"
+	AUDIT_DROP    = "drop"
+	AUDIT_SNOOZE  = "snooze"
+	AUDIT_EXEMPT  = "exempt"
+	AUDIT_APPROVE = "approve"
+	AUDIT_DELETE  = "delete"
+	// a sweep wouldn't delete a candidate that was due, eg: a bucket with too much in it.  it stays marked.
+	AUDIT_REFUSE = "refuse"
+	// a sweep went over its limits, and someone let it go ahead.  these are keyed by marker, not candidate.
+	AUDIT_HALT   = "halt"
+	AUDIT_RESUME = "resume"
+)
+
+type AuditEvent struct {
+	Time          time.Time         `json:"time"`
+	Action        string            `json:"action"`
+	Key           string            `json:"key"`
+	MarkerType    string            `json:"marker_type,omitempty"`
+	CandidateType string            `json:"candidate_type,omitempty"`
+	Id            string            `json:"id,omitempty"`
+	Owner         string            `json:"owner,omitempty"`
+	Account       string            `json:"account,omitempty"`
+	Region        string            `json:"region,omitempty"`
+	Reason        string            `json:"reason,omitempty"`
+	Tags          map[string]string `json:"tags,omitempty"`
+	GracePeriod   string            `json:"grace_period,omitempty"`
+	DryRun        bool              `json:"dry_run"`
+	Actor         string            `json:"actor,omitempty"`
+}
+
+// AuditQuery narrows ReadAudit down.  zero values match everything.
+type AuditQuery struct {
+	Id    string
+	Owner string
+	Since time.Time
+	Until time.Time
+}
+
+func (q AuditQuery) matches(e *AuditEvent) bool {
+	if q.Id != "" && q.Id != e.Id && q.Id != e.Key {
+		return false
+	}
+	if q.Owner != "" && q.Owner != e.Owner {
+		return false
+	}
+	if !q.Since.IsZero() && e.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && e.Time.After(q.Until) {
+		return false
+	}
+	return true
+}
+
+func Audit(c cache.Cache, e *AuditEvent) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	ejson, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return c.AppendAudit(string(ejson))
+}
+
+// AuditCandidate records action against the candidate stored under key, filling in the event from the
+// candidate's record if we still have it
+func AuditCandidate(c cache.Cache, action, key string, e *AuditEvent) error {
+	e.Action = action
+	e.Key = key
+	if m, ok := ReadCandidate(c, key); ok {
+		e.fill(m)
+	}
+	return Audit(c, e)
+}
+
+func (e *AuditEvent) fill(m *MarkedCandidate) {
+	e.MarkerType = m.MarkerType.String()
+	e.CandidateType = m.CandidateType
+	e.Id = m.Id
+	e.Owner = m.Owner
+	e.Account = m.Account
+	e.Region = m.Region
+	e.Tags = m.Tags
+	if e.Reason == "" {
+		e.Reason = m.Reason
+	}
+}
+
+// ReadAudit returns the audit events matching q, oldest first.  records we can't read are skipped.
+func ReadAudit(c cache.Cache, q AuditQuery) ([]*AuditEvent, error) {
+	records, err := c.ReadAudit()
+	if err != nil {
+		return nil, err
+	}
+	events := []*AuditEvent{}
+	for _, r := range records {
+		var e *AuditEvent
+		if err := json.Unmarshal([]byte(r), &e); err != nil {
+			continue
+		}
+		if q.matches(e) {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+// ReadCandidate is the candidate at key, or false when there isn't one or it can't be read
+func ReadCandidate(c cache.Cache, key string) (*MarkedCandidate, bool) {
+	if !c.CandidateExists(key) {
+		return nil, false
+	}
+	raw, err := c.ReadCandidate(key)
+	if err != nil {
+		return nil, false
+	}
+	var m *MarkedCandidate
+	if err := json.Unmarshal([]byte(raw), &m); err != nil {
+		return nil, false
+	}
+	return m, true
+}
+
+// FilterName is the name a filter function is recorded under in the audit log, without its package or
+// receiver.  eg: NoTTLTagFilter or IgnoreConfigFilter
+func FilterName(f interface{}) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer())
+	if fn == nil {
+		return ""
+	}
+	name := fn.Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	name = strings.TrimSuffix(name, "-fm")
+	// drop the package, then a method's receiver
+	name = name[strings.Index(name, ".")+1:]
+	if strings.HasPrefix(name, "(") {
+		name = name[strings.Index(name, ".")+1:]
+	}
+	return name
+}
@@ -9,27 +9,19 @@ import (
 func (am *AwsMarker) markAlb() error {
 	svc := am.getElbV2Session()
 
-	err := svc.DescribeLoadBalancersPages(nil, am.processAlbMarkPages)
-	if serr, ok := err.(awserr.Error); ok {
-		if serr.Code() == "Throttling" {
-			am.Logger.Warn(err)
-		} else {
-			return err
-		}
+	err := svc.DescribeLoadBalancersPagesWithContext(am.Ctx, nil, am.processAlbMarkPages)
+	if isThrottle(err) {
+		am.skip("alb pages", err)
+		return nil
 	}
-	return nil
+	return err
 }
 
 func (am *AwsMarker) processAlbMarkPages(page *elbv2.DescribeLoadBalancersOutput, lastPage bool) bool {
 
 	if len(page.LoadBalancers) != 0 {
 		for _, lb := range page.LoadBalancers {
-			am.FilterAwsObject(am.newAwsFilterable(lb).
-				WithIgnoreFilter(am.IgnoreConfigFilter).
-				WithIgnoreFilter(IgnoreK8sTagFilter).
-				WithComplianceFilter(NoTagFilter).
-				WithComplianceFilter(NoTTLTagFilter).
-				WithComplianceFilter(TTLTagExpiredFilter))
+			am.FilterAwsObject(am.albFilterable(lb))
 		}
 	}
 
@@ -39,6 +31,31 @@ func (am *AwsMarker) processAlbMarkPages(page *elbv2.DescribeLoadBalancersOutput
 	return false
 }
 
+func (am *AwsMarker) albFilterable(lb *elbv2.LoadBalancer) *awsFilterable {
+	return am.newAwsFilterable(lb).
+		WithIgnoreFilter(am.IgnoreConfigFilter).
+		WithIgnoreFilter(IgnoreK8sTagFilter).
+		WithComplianceFilter(NoTagFilter).
+		WithComplianceFilter(am.NoTTLTagFilter).
+		WithComplianceFilter(am.TTLTagExpiredFilter)
+}
+
+func (am *AwsMarker) recheckAlb(id *string) (bool, bool, error) {
+	result, err := am.getElbV2Session().DescribeLoadBalancersWithContext(am.Ctx, &elbv2.DescribeLoadBalancersInput{
+		LoadBalancerArns: []*string{id},
+	})
+	if hasErrorCode(err, elbv2.ErrCodeLoadBalancerNotFoundException) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	for _, lb := range result.LoadBalancers {
+		return filterableCandidate(am.albFilterable(lb))
+	}
+	return false, false, nil
+}
+
 func (am *AwsMarker) sweepAlb() error {
 	svc := am.getElbV2Session()
 
@@ -48,7 +65,7 @@ func (am *AwsMarker) sweepAlb() error {
 	}
 
 	for _, o := range owners {
-		toDelete := am.toDelete(o, "alb")
+		toDelete := am.recheck(am.toDelete(o, "alb"), am.recheckAlb)
 
 		am.Logger.Debug("DryRun? ", !am.Config.DeleteEnabled)
 		if len(toDelete) != 0 {
@@ -57,19 +74,26 @@ func (am *AwsMarker) sweepAlb() error {
 					input := &elbv2.DeleteLoadBalancerInput{
 						LoadBalancerArn: lb,
 					}
-					_, err := svc.DeleteLoadBalancer(input)
+					_, err := svc.DeleteLoadBalancerWithContext(am.Ctx, input)
+					if isCanceled(err) {
+						return err
+					}
 					if serr, ok := err.(awserr.Error); ok {
-						if serr.Code() == "Throttling" {
+						if isThrottle(serr) {
 							am.Logger.Warn(err)
 							continue
 						} else {
 							am.Logger.Error(err)
 						}
+					} else if err == nil {
+						am.swept("alb", *lb, false)
 					}
-					err = mark.RemoveCandidates(o, am.Cache, []*string{lb})
+					err = mark.RemoveCandidates(am.Cache, []string{am.candidateKey(*lb)})
 					if err != nil {
 						am.Logger.Error(err)
 					}
+				} else {
+					am.swept("alb", *lb, true)
 				}
 			}
 		}
@@ -0,0 +1,275 @@
+package aws
+
+import (
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// OWNER_SELF limits images and snapshots to the ones the account owns.  public and shared ones aren't ours
+// to delete.
+const OWNER_SELF = "self"
+
+func (am *AwsMarker) markAmi() error {
+	svc := am.getEc2Session()
+
+	// if we can't tell what's in use we can't tell what isn't, so skip the whole run rather than mark
+	// images something still launches from
+	if what, err := am.loadInUseAmis(); err != nil {
+		if isThrottle(err) {
+			am.skip(what, err)
+			return nil
+		}
+		return err
+	}
+
+	result, err := svc.DescribeImagesWithContext(am.Ctx, &ec2.DescribeImagesInput{
+		Owners: []*string{aws.String(OWNER_SELF)},
+	})
+	if isThrottle(err) {
+		am.skip("images", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, i := range result.Images {
+		am.FilterAwsObject(am.amiFilterable(i))
+	}
+	return nil
+}
+
+// loadInUseAmis resets the in-use images, returning what it was listing when it fails
+func (am *AwsMarker) loadInUseAmis() (string, error) {
+	am.amis = nil
+	for what, list := range map[string]func() (map[string]bool, error){
+		"instance images":             am.getEc2InstanceAmiList,
+		"launch configuration images": am.getLaunchConfigAmiList,
+		"launch template images":      am.getLaunchTemplateAmiList,
+	} {
+		amis, err := list()
+		if err != nil {
+			am.amis = nil
+			return what, err
+		}
+		am.amis = append(am.amis, amis)
+	}
+	return "", nil
+}
+
+// getEc2InstanceAmiList counts stopped instances too, they can't be started again without their image
+func (am *AwsMarker) getEc2InstanceAmiList() (map[string]bool, error) {
+	svc := am.getEc2Session()
+
+	instanceAmis := make(map[string]bool)
+	err := svc.DescribeInstancesPagesWithContext(am.Ctx, nil, func(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
+		for _, r := range page.Reservations {
+			for _, i := range r.Instances {
+				if i.ImageId != nil && !Ec2IgnoreTerminatedFilter(i, am.Logger) {
+					instanceAmis[*i.ImageId] = true
+				}
+			}
+		}
+		return page.NextToken != nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return instanceAmis, nil
+}
+
+func (am *AwsMarker) getLaunchConfigAmiList() (map[string]bool, error) {
+	svc := am.getASGSession()
+
+	lcAmis := make(map[string]bool)
+	err := svc.DescribeLaunchConfigurationsPagesWithContext(am.Ctx, nil, func(page *autoscaling.DescribeLaunchConfigurationsOutput, lastPage bool) bool {
+		for _, lc := range page.LaunchConfigurations {
+			if lc.ImageId != nil {
+				lcAmis[*lc.ImageId] = true
+			}
+		}
+		return page.NextToken != nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lcAmis, nil
+}
+
+// getLaunchTemplateAmiList looks at every version of every template, since an asg or a fleet can pin any
+// of them
+func (am *AwsMarker) getLaunchTemplateAmiList() (map[string]bool, error) {
+	svc := am.getEc2Session()
+
+	var templates []*string
+	err := svc.DescribeLaunchTemplatesPagesWithContext(am.Ctx, &ec2.DescribeLaunchTemplatesInput{}, func(page *ec2.DescribeLaunchTemplatesOutput, lastPage bool) bool {
+		for _, lt := range page.LaunchTemplates {
+			templates = append(templates, lt.LaunchTemplateId)
+		}
+		return page.NextToken != nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ltAmis := make(map[string]bool)
+	for _, lt := range templates {
+		err := svc.DescribeLaunchTemplateVersionsPagesWithContext(am.Ctx, &ec2.DescribeLaunchTemplateVersionsInput{
+			LaunchTemplateId: lt,
+		}, func(page *ec2.DescribeLaunchTemplateVersionsOutput, lastPage bool) bool {
+			for _, v := range page.LaunchTemplateVersions {
+				if v.LaunchTemplateData != nil && v.LaunchTemplateData.ImageId != nil {
+					ltAmis[*v.LaunchTemplateData.ImageId] = true
+				}
+			}
+			return page.NextToken != nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ltAmis, nil
+}
+
+func (am *AwsMarker) amiFilterable(i *ec2.Image) *awsFilterable {
+	return am.newAwsFilterable(i).
+		WithIgnoreFilter(am.IgnoreConfigFilter).
+		WithTypedIgnoreFilter(am.AmiIgnoreInUse).
+		WithComplianceFilter(NoTagFilter).
+		WithComplianceFilter(am.NoTTLTagFilter).
+		WithComplianceFilter(am.TTLTagExpiredFilter)
+}
+
+// describeAmi filters by id, which unlike ImageIds doesn't fail when the image is gone
+func (am *AwsMarker) describeAmi(id *string) (*ec2.Image, error) {
+	result, err := am.getEc2Session().DescribeImagesWithContext(am.Ctx, &ec2.DescribeImagesInput{
+		Owners:  []*string{aws.String(OWNER_SELF)},
+		Filters: []*ec2.Filter{{Name: aws.String("image-id"), Values: []*string{id}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range result.Images {
+		return i, nil
+	}
+	return nil, nil
+}
+
+// recheckAmi needs the in-use images loaded by sweepAmi
+func (am *AwsMarker) recheckAmi(id *string) (bool, bool, error) {
+	i, err := am.describeAmi(id)
+	if err != nil || i == nil {
+		return false, false, err
+	}
+	return filterableCandidate(am.amiFilterable(i))
+}
+
+func (am *AwsMarker) sweepAmi() error {
+	svc := am.getEc2Session()
+
+	owners, err := am.Cache.ReadOwners()
+	if err != nil {
+		return err
+	}
+	// an image something started launching from during its grace period must not be deregistered
+	if what, err := am.loadInUseAmis(); err != nil {
+		am.Logger.Warnf("Couldn't list %s, leaving images for the next sweep: %v", what, err)
+		return nil
+	}
+	if am.Config.Ami.DeleteSnapshots {
+		if err := am.loadAmiSnapshots(); err != nil {
+			am.Logger.Warnf("Couldn't list image snapshots, leaving images for the next sweep: %v", err)
+			return nil
+		}
+	}
+
+	for _, o := range owners {
+		toDelete := am.recheck(am.toDelete(o, "ami"), am.recheckAmi)
+		am.Logger.Debug("DryRun? ", !am.Config.DeleteEnabled)
+		for _, id := range toDelete {
+			// recheck doesn't hand back what it described, and we need the image's snapshots
+			image, err := am.describeAmi(id)
+			if isCanceled(err) {
+				return err
+			}
+			if err != nil || image == nil {
+				am.Logger.Warnf("Couldn't describe %s, leaving it for the next sweep: %v", *id, err)
+				continue
+			}
+			_, err = svc.DeregisterImageWithContext(am.Ctx, &ec2.DeregisterImageInput{
+				ImageId: id,
+				DryRun:  aws.Bool(!am.Config.DeleteEnabled),
+			})
+			if isCanceled(err) {
+				return err
+			}
+			if awsErr, ok := err.(awserr.Error); ok {
+				if awsErr.Code() == "DryRunOperation" {
+					am.Logger.Warnf("Would have deregistered %s but we're in DryRun", *id)
+					am.swept("ami", *id, true)
+					continue
+				}
+				if isThrottle(awsErr) {
+					am.Logger.Warn(err)
+					continue
+				}
+				am.Logger.Error(awsErr)
+			} else if err == nil {
+				am.swept("ami", *id, false)
+				if am.Config.Ami.DeleteSnapshots {
+					am.deleteAmiSnapshots(image)
+				}
+			}
+			err = mark.RemoveCandidates(am.Cache, []string{am.candidateKey(*id)})
+			if err != nil {
+				am.Logger.Error(err)
+			}
+		}
+	}
+	return nil
+}
+
+// deleteAmiSnapshots deletes the snapshots behind a deregistered image that no other image uses.  they're
+// audited as deletes, and dropped from the candidates if they were marked on their own as well.
+func (am *AwsMarker) deleteAmiSnapshots(image *ec2.Image) {
+	svc := am.getEc2Session()
+	for _, snapshot := range amiSnapshotIds(image) {
+		if shared := am.amiSnapshots[snapshot]; len(shared) != 1 || shared[0] != *image.ImageId {
+			am.Logger.Infof("Keeping %s. Reason: backs other images", snapshot)
+			continue
+		}
+		_, err := svc.DeleteSnapshotWithContext(am.Ctx, &ec2.DeleteSnapshotInput{SnapshotId: aws.String(snapshot)})
+		if err != nil {
+			am.Logger.Errorf("Couldn't delete %s behind %s: %v", snapshot, *image.ImageId, err)
+			continue
+		}
+		am.Logger.Infof("Deleted %s behind %s", snapshot, *image.ImageId)
+		key := am.candidateKey(snapshot)
+		err = mark.AuditCandidate(am.Cache, mark.AUDIT_DELETE, key, &mark.AuditEvent{
+			MarkerType:    mark.AWS.String(),
+			CandidateType: "snapshot",
+			Id:            snapshot,
+			Account:       am.Config.Name,
+			Region:        am.region,
+			Reason:        "backed " + *image.ImageId,
+		})
+		if err != nil {
+			am.Logger.Error(err)
+		}
+		if err := mark.RemoveCandidates(am.Cache, []string{key}); err != nil {
+			am.Logger.Error(err)
+		}
+	}
+}
+
+func amiSnapshotIds(image *ec2.Image) []string {
+	ids := []string{}
+	for _, bdm := range image.BlockDeviceMappings {
+		if bdm.Ebs != nil && bdm.Ebs.SnapshotId != nil {
+			ids = append(ids, *bdm.Ebs.SnapshotId)
+		}
+	}
+	return ids
+}
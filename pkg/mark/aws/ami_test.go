@@ -0,0 +1,153 @@
+package aws
+
+import (
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// fakeImages answers describes from images, snapshots and instances, keyed by id, and records every deregister and
+// snapshot delete
+type fakeImages struct {
+	mux          sync.Mutex
+	images       map[string]string
+	snapshots    map[string]string
+	instances    string
+	deregistered []string
+	deleted      []string
+}
+
+func (fi *fakeImages) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fi.mux.Lock()
+	defer fi.mux.Unlock()
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if r.Form.Get("DryRun") == "true" {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		w.Write([]byte(`<Response><Errors><Error><Code>DryRunOperation</Code><Message>dry run</Message></Error></Errors></Response>`)) //nolint
+		return
+	}
+	switch action := r.Form.Get("Action"); action {
+	case "DescribeImages":
+		images := ""
+		for id, i := range fi.images {
+			if filter := r.Form.Get("Filter.1.Value.1"); filter == "" || filter == id {
+				images += i
+			}
+		}
+		w.Write([]byte(`<DescribeImagesResponse><imagesSet>` + images + `</imagesSet></DescribeImagesResponse>`)) //nolint
+	case "DescribeSnapshots":
+		w.Write([]byte(`<DescribeSnapshotsResponse><snapshotSet>` + fi.snapshots[r.Form.Get("Filter.1.Value.1")] + `</snapshotSet></DescribeSnapshotsResponse>`)) //nolint
+	case "DescribeInstances":
+		w.Write([]byte(`<DescribeInstancesResponse><reservationSet><item><instancesSet>` + fi.instances + `</instancesSet></item></reservationSet></DescribeInstancesResponse>`)) //nolint
+	case "DescribeLaunchConfigurations":
+		w.Write([]byte(`<DescribeLaunchConfigurationsResponse><DescribeLaunchConfigurationsResult><LaunchConfigurations/></DescribeLaunchConfigurationsResult></DescribeLaunchConfigurationsResponse>`)) //nolint
+	case "DescribeLaunchTemplates":
+		w.Write([]byte(`<DescribeLaunchTemplatesResponse><launchTemplates/></DescribeLaunchTemplatesResponse>`)) //nolint
+	case "DeregisterImage":
+		fi.deregistered = append(fi.deregistered, r.Form.Get("ImageId"))
+		delete(fi.images, r.Form.Get("ImageId"))
+		w.Write([]byte(`<DeregisterImageResponse><return>true</return></DeregisterImageResponse>`)) //nolint
+	case "DeleteSnapshot":
+		fi.deleted = append(fi.deleted, r.Form.Get("SnapshotId"))
+		w.Write([]byte(`<DeleteSnapshotResponse><return>true</return></DeleteSnapshotResponse>`)) //nolint
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func image(id string, snapshots ...string) string {
+	bdms := ""
+	for _, s := range snapshots {
+		bdms += `<item><ebs><snapshotId>` + s + `</snapshotId></ebs></item>`
+	}
+	return `<item><imageId>` + id + `</imageId><creationDate>2019-01-01T00:00:00.000Z</creationDate><blockDeviceMapping>` + bdms + `</blockDeviceMapping></item>`
+}
+
+func TestSweepAmiDeletesUnsharedSnapshots(t *testing.T) {
+	fi := &fakeImages{images: map[string]string{
+		"ami-old":  image("ami-old", "snap-old", "snap-shared"),
+		"ami-keep": image("ami-keep", "snap-shared"),
+	}}
+	srv := httptest.NewServer(fi)
+	defer srv.Close()
+	am := newTestAwsMarker(t, &config.Aws{Name: "dev", DeleteEnabled: true, Ami: config.AwsAmi{DeleteSnapshots: true}}, srv.URL)
+	writeTestCandidates(t, am, "ami", "ami-old")
+	writeTestCandidates(t, am, "snapshot", "snap-old")
+
+	assert.Nil(t, am.sweepAmi())
+	assert.Equal(t, []string{"ami-old"}, fi.deregistered)
+	assert.Equal(t, []string{"snap-old"}, fi.deleted)
+	assert.False(t, am.Cache.CandidateExists(am.candidateKey("ami-old")))
+	assert.False(t, am.Cache.CandidateExists(am.candidateKey("snap-old")))
+}
+
+func TestSweepAmiSkipsInUse(t *testing.T) {
+	fi := &fakeImages{
+		images:    map[string]string{"ami-used": image("ami-used", "snap-used")},
+		instances: `<item><instanceId>i-1</instanceId><imageId>ami-used</imageId><instanceState><name>stopped</name></instanceState></item>`,
+	}
+	srv := httptest.NewServer(fi)
+	defer srv.Close()
+	am := newTestAwsMarker(t, &config.Aws{Name: "dev", DeleteEnabled: true, Ami: config.AwsAmi{DeleteSnapshots: true}}, srv.URL)
+	writeTestCandidates(t, am, "ami", "ami-used")
+
+	assert.Nil(t, am.sweepAmi())
+	assert.Empty(t, fi.deregistered)
+	assert.Empty(t, fi.deleted)
+	assert.False(t, am.Cache.CandidateExists(am.candidateKey("ami-used")))
+}
+
+func TestSweepAmiDryRun(t *testing.T) {
+	fi := &fakeImages{images: map[string]string{"ami-old": image("ami-old", "snap-old")}}
+	srv := httptest.NewServer(fi)
+	defer srv.Close()
+	am := newTestAwsMarker(t, &config.Aws{Name: "dev", Ami: config.AwsAmi{DeleteSnapshots: true}}, srv.URL)
+	writeTestCandidates(t, am, "ami", "ami-old")
+
+	assert.Nil(t, am.sweepAmi())
+	assert.Empty(t, fi.deregistered)
+	assert.Empty(t, fi.deleted)
+	assert.True(t, am.Cache.CandidateExists(am.candidateKey("ami-old")))
+}
+
+func TestSweepSnapshotSkipsAmiBacked(t *testing.T) {
+	fi := &fakeImages{
+		images:    map[string]string{"ami-new": image("ami-new", "snap-registered")},
+		snapshots: map[string]string{"snap-registered": `<item><snapshotId>snap-registered</snapshotId></item>`},
+	}
+	srv := httptest.NewServer(fi)
+	defer srv.Close()
+	am := newTestAwsMarker(t, &config.Aws{Name: "dev", DeleteEnabled: true}, srv.URL)
+	writeTestCandidates(t, am, "snapshot", "snap-registered")
+
+	assert.Nil(t, am.sweepSnapshot())
+	assert.Empty(t, fi.deleted)
+	assert.False(t, am.Cache.CandidateExists(am.candidateKey("snap-registered")))
+}
+
+func TestAmiFilters(t *testing.T) {
+	entry := logrus.NewEntry(log)
+	am := &AwsMarker{
+		amis:         []map[string]bool{{"ami-lc": true}},
+		amiSnapshots: map[string][]string{"snap-1": {"ami-1"}},
+	}
+	assert.True(t, am.AmiIgnoreInUse(&ec2.Image{ImageId: aws.String("ami-lc")}, entry))
+	assert.False(t, am.AmiIgnoreInUse(&ec2.Image{ImageId: aws.String("ami-unused")}, entry))
+	assert.True(t, am.SnapshotIgnoreAmiBacked(&ec2.Snapshot{SnapshotId: aws.String("snap-1")}, entry))
+	assert.False(t, am.SnapshotIgnoreAmiBacked(&ec2.Snapshot{SnapshotId: aws.String("snap-2")}, entry))
+
+	id, _, created, canType, err := am.extractTags(&ec2.Image{ImageId: aws.String("ami-1"), CreationDate: aws.String("2019-01-01T00:00:00.000Z")})
+	assert.Nil(t, err)
+	assert.Equal(t, "ami-1", *id)
+	assert.Equal(t, "ami", canType)
+	assert.Equal(t, 2019, created.Year())
+}
@@ -10,28 +10,19 @@ import (
 func (am *AwsMarker) markAsg() error {
 	svc := am.getASGSession()
 
-	err := svc.DescribeAutoScalingGroupsPages(nil, am.processsAsgMarkPages)
-	if serr, ok := err.(awserr.Error); ok {
-		if serr.Code() == "Throttling" {
-			am.Logger.Warn(err)
-		} else {
-			return err
-		}
+	err := svc.DescribeAutoScalingGroupsPagesWithContext(am.Ctx, nil, am.processsAsgMarkPages)
+	if isThrottle(err) {
+		am.skip("autoscaling group pages", err)
+		return nil
 	}
-	return nil
+	return err
 }
 
 func (am *AwsMarker) processsAsgMarkPages(page *autoscaling.DescribeAutoScalingGroupsOutput, lastPage bool) bool {
 
 	if len(page.AutoScalingGroups) != 0 {
 		for _, asg := range page.AutoScalingGroups {
-			am.FilterAwsObject(am.newAwsFilterable(asg).
-				WithIgnoreFilter(am.IgnoreConfigFilter).
-				WithIgnoreFilter(IgnoreK8sTagFilter).
-				WithComplianceFilter(NoTagFilter).
-				WithComplianceFilter(NoTTLTagFilter).
-				WithComplianceFilter(TTLTagExpiredFilter).
-				WithTypedComplianceFilter(AsgZeroCapacity))
+			am.FilterAwsObject(am.asgFilterable(asg))
 		}
 	}
 
@@ -41,6 +32,29 @@ func (am *AwsMarker) processsAsgMarkPages(page *autoscaling.DescribeAutoScalingG
 	return false
 }
 
+func (am *AwsMarker) asgFilterable(asg *autoscaling.Group) *awsFilterable {
+	return am.newAwsFilterable(asg).
+		WithIgnoreFilter(am.IgnoreConfigFilter).
+		WithIgnoreFilter(IgnoreK8sTagFilter).
+		WithComplianceFilter(NoTagFilter).
+		WithComplianceFilter(am.NoTTLTagFilter).
+		WithComplianceFilter(am.TTLTagExpiredFilter).
+		WithTypedComplianceFilter(AsgZeroCapacity)
+}
+
+func (am *AwsMarker) recheckAsg(id *string) (bool, bool, error) {
+	result, err := am.getASGSession().DescribeAutoScalingGroupsWithContext(am.Ctx, &autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: []*string{id},
+	})
+	if err != nil {
+		return false, false, err
+	}
+	for _, asg := range result.AutoScalingGroups {
+		return filterableCandidate(am.asgFilterable(asg))
+	}
+	return false, false, nil
+}
+
 func (am *AwsMarker) sweepAsg() error {
 	svc := am.getASGSession()
 
@@ -50,7 +64,7 @@ func (am *AwsMarker) sweepAsg() error {
 	}
 
 	for _, o := range owners {
-		toDelete := am.toDelete(o, "asg")
+		toDelete := am.recheck(am.toDelete(o, "asg"), am.recheckAsg)
 
 		am.Logger.Debug("DryRun? ", !am.Config.DeleteEnabled)
 		if len(toDelete) != 0 {
@@ -60,9 +74,12 @@ func (am *AwsMarker) sweepAsg() error {
 						AutoScalingGroupName: asg,
 						ForceDelete:          aws.Bool(true),
 					}
-					_, err := svc.DeleteAutoScalingGroup(input)
+					_, err := svc.DeleteAutoScalingGroupWithContext(am.Ctx, input)
+					if isCanceled(err) {
+						return err
+					}
 					if serr, ok := err.(awserr.Error); ok {
-						if serr.Code() == "Throttling" {
+						if isThrottle(serr) {
 							am.Logger.Warn(err)
 							continue
 						} else if serr.Code() == "ValidationError" {
@@ -72,11 +89,15 @@ func (am *AwsMarker) sweepAsg() error {
 							am.Logger.Error(err)
 							continue
 						}
+					} else if err == nil {
+						am.swept("asg", *asg, false)
 					}
-					err = mark.RemoveCandidates(o, am.Cache, []*string{asg})
+					err = mark.RemoveCandidates(am.Cache, []string{am.candidateKey(*asg)})
 					if err != nil {
 						am.Logger.Error(err)
 					}
+				} else {
+					am.swept("asg", *asg, true)
 				}
 			}
 		}
@@ -2,26 +2,33 @@ package aws
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"github.com/armory-io/bilgepump/pkg/cache"
 	"github.com/armory-io/bilgepump/pkg/config"
 	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/armory-io/bilgepump/pkg/metrics"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecs"
 	"github.com/aws/aws-sdk-go/service/eks"
 	"github.com/aws/aws-sdk-go/service/elasticache"
 	"github.com/aws/aws-sdk-go/service/elb"
 	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/sts"
-	"github.com/prometheus/common/model"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -34,23 +41,54 @@ type AwsMarker struct {
 	sess   *session.Session         // this isn't exported on purpose
 	mux    *sync.Mutex
 	sgs    []map[string]bool
+	// images in use by instances, launch configurations and launch templates, see loadInUseAmis
+	amis []map[string]bool
+	// the images behind each snapshot that backs one, see loadAmiSnapshots
+	amiSnapshots map[string][]string
+	// vpcs with network interfaces in use, see loadInterfaceVpcs
+	vpcs map[string]bool
+	// functions that an event source mapping still invokes, see loadLambdaSources
+	lambdaSources map[string]bool
+	// every function in the region, see loadLambdaFunctions
+	functions map[string]bool
+	// repositories with images in running ecs tasks and services, see loadEcsImages
+	ecsImages map[string]bool
+	// what each candidate type couldn't read during the current mark pass
+	skipped map[string][]string
+	current string
+	// the region a per region copy of the marker works in, see forRegion
+	region string
+	// what the mark runs looked at, shared by the per region copies
+	inventory *mark.Inventory
+	// the account's buckets by region, listed once per mark run for the per region copies, see bucketRegions
+	buckets *bucketRegions
+	// the account's buckets by name, see loadBuckets
+	bucketNames map[string]*s3.Bucket
 }
 
 type AwsCandidateFuncMap map[string]func() error
 
-func NewAwsMarker(ctx context.Context, cfg *config.Aws, logger *logrus.Logger, cache cache.Cache) *AwsMarker {
-	sess := session.Must(session.NewSession())
-	creds := stscreds.NewCredentials(sess, cfg.IamRole)
+func NewAwsMarker(ctx context.Context, cfg *config.Aws, logger *logrus.Logger, cache cache.Cache) (*AwsMarker, error) {
+	sess, err := newAwsSession(cfg, aws.NewConfig().WithRegion(discoveryRegion(cfg)))
+	if err != nil {
+		return nil, err
+	}
+	creds, err := newCredentials(sess, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("(%s) credentials: %v", cfg.Name, err)
+	}
 
 	return &AwsMarker{
-		Config: cfg,
-		Logger: logger.WithFields(logrus.Fields{"class": mark.AWS, "account": cfg.Name, "region": cfg.Region}),
-		Cache:  cache,
-		Ctx:    ctx,
-		creds:  creds,
-		sess:   sess,
-		mux:    &sync.Mutex{},
-	}
+		Config:    cfg,
+		Logger:    logger.WithFields(logrus.Fields{"class": mark.AWS, "account": cfg.Name}),
+		Cache:     cache,
+		Ctx:       ctx,
+		creds:     creds,
+		sess:      sess,
+		mux:       &sync.Mutex{},
+		skipped:   map[string][]string{},
+		inventory: mark.NewInventory(),
+	}, nil
 }
 
 func (am *AwsMarker) GetMarkSchedule() string {
@@ -73,28 +111,65 @@ func (am *AwsMarker) GetType() mark.MarkerType {
 	return mark.AWS
 }
 
+// discoveryRegion is where we look up the account's regions and get credentials.  it's the region set
+// on the account, if there is one.
+func discoveryRegion(cfg *config.Aws) string {
+	if cfg.Region != "" {
+		return cfg.Region
+	}
+	return DEFAULT_DISCOVERY_REGION
+}
+
+func (am *AwsMarker) awsConfig() *aws.Config {
+	return &aws.Config{Credentials: am.creds, Region: aws.String(am.region)}
+}
+
 func (am *AwsMarker) getEc2Session() *ec2.EC2 {
-	return ec2.New(am.sess, &aws.Config{Credentials: am.creds})
+	return ec2.New(am.sess, am.awsConfig())
 }
 
 func (am *AwsMarker) getElbSession() *elb.ELB {
-	return elb.New(am.sess, &aws.Config{Credentials: am.creds})
+	return elb.New(am.sess, am.awsConfig())
 }
 
 func (am *AwsMarker) getElbV2Session() *elbv2.ELBV2 {
-	return elbv2.New(am.sess, &aws.Config{Credentials: am.creds})
+	return elbv2.New(am.sess, am.awsConfig())
 }
 
 func (am *AwsMarker) getEksSession() *eks.EKS {
-	return eks.New(am.sess, &aws.Config{Credentials: am.creds})
+	return eks.New(am.sess, am.awsConfig())
 }
 
 func (am *AwsMarker) getECSession() *elasticache.ElastiCache {
-	return elasticache.New(am.sess, &aws.Config{Credentials: am.creds})
+	return elasticache.New(am.sess, am.awsConfig())
 }
 
 func (am *AwsMarker) getASGSession() *autoscaling.AutoScaling {
-	return autoscaling.New(am.sess, &aws.Config{Credentials: am.creds})
+	return autoscaling.New(am.sess, am.awsConfig())
+}
+
+func (am *AwsMarker) getRdsSession() *rds.RDS {
+	return rds.New(am.sess, am.awsConfig())
+}
+
+func (am *AwsMarker) getS3Session() *s3.S3 {
+	return s3.New(am.sess, am.awsConfig())
+}
+
+func (am *AwsMarker) getLambdaSession() *lambda.Lambda {
+	return lambda.New(am.sess, am.awsConfig())
+}
+
+func (am *AwsMarker) getEcrSession() *ecr.ECR {
+	return ecr.New(am.sess, am.awsConfig())
+}
+
+func (am *AwsMarker) getEcsSession() *ecs.ECS {
+	return ecs.New(am.sess, am.awsConfig())
+}
+
+func (am *AwsMarker) getLogsSession() *cloudwatchlogs.CloudWatchLogs {
+	return cloudwatchlogs.New(am.sess, am.awsConfig())
 }
 
 //
@@ -103,7 +178,7 @@ func (am *AwsMarker) getASGSession() *autoscaling.AutoScaling {
 //}
 
 func (am *AwsMarker) getStsSession() *sts.STS {
-	return sts.New(am.sess, &aws.Config{Credentials: am.creds})
+	return sts.New(am.sess, am.awsConfig())
 }
 
 //func (am *AwsMarker) getMasterAccountId() *string {
@@ -122,150 +197,365 @@ func (am *AwsMarker) getStsSession() *sts.STS {
 //	return result.Organization.MasterAccountId
 //}
 
-func (am *AwsMarker) getAccountId() *string {
+func (am *AwsMarker) getAccountId() (*string, error) {
 	svc := am.getStsSession()
 
-	result, err := svc.GetCallerIdentity(&sts.GetCallerIdentityInput{})
-	if serr, ok := err.(awserr.Error); ok {
-		if serr.Code() == "Throttling" {
-			am.Logger.Warn(err)
-		} else {
-			am.Logger.Error(err)
-			return nil
-		}
+	result, err := svc.GetCallerIdentityWithContext(am.Ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, err
 	}
-	return result.Account
+	return result.Account, nil
 }
 
 func (am *AwsMarker) Mark() {
 	am.Logger.Debugf("starting %s mark run for %s", mark.AWS, am.Config.Name)
 
+	am.mux.Lock()
+	defer am.mux.Unlock()
+	done := metrics.Run(mark.AWS.String(), am.Config.Name, metrics.PHASE_MARK)
+	am.buckets = &bucketRegions{}
+	done(!am.eachRegion((*AwsMarker).mark))
+}
+
+// mark returns false if any candidate type failed or was still incomplete after every pass
+func (am *AwsMarker) mark() bool {
 	fm := AwsCandidateFuncMap{
-		"ec2": am.markEc2,
-		"eks": am.markEks,
-		"ebs": am.markEbs,
-		"sg":  am.markSG,
-		"elb": am.markElb,
-		"alb": am.markAlb,
-		"ec":  am.markElasticache,
-		"asg": am.markAsg,
-		"lc":  am.markLaunchConfig,
+		"ec2":      am.markEc2,
+		"eks":      am.markEks,
+		"ebs":      am.markEbs,
+		"sg":       am.markSG,
+		"elb":      am.markElb,
+		"alb":      am.markAlb,
+		"ec":       am.markElasticache,
+		"asg":      am.markAsg,
+		"lc":       am.markLaunchConfig,
+		"rds":      am.markRds,
+		"aurora":   am.markAurora,
+		"snapshot": am.markSnapshot,
+		"ami":      am.markAmi,
+		"eip":      am.markEip,
+		"natgw":    am.markNatGw,
+		"eni":      am.markEni,
+		"s3":       am.markS3,
+		"lambda":   am.markLambda,
+		"ecr":      am.markEcr,
+		"loggroup": am.markLogGroup,
 	}
 
-	am.mux.Lock()
-	defer am.mux.Unlock()
-	for _, c := range am.Config.Candidates {
-		am.Logger = am.Logger.WithFields(logrus.Fields{"type": c, "phase": "mark"})
-		err := fm[c]()
-		if err != nil {
-			am.Logger.Error(err)
+	ok := true
+	pending := am.Config.Candidates
+	for pass := 1; ; pass++ {
+		am.skipped = map[string][]string{}
+		for _, c := range pending {
+			if am.Ctx.Err() != nil {
+				return false
+			}
+			am.current = c
+			am.inventory.Reset(am.inventoryScope(c))
+			am.Logger = am.Logger.WithFields(logrus.Fields{"type": c, "phase": "mark"})
+			err := fm[c]()
+			if err != nil {
+				am.Logger.Error(err)
+				ok = false
+			}
+		}
+
+		// anything that skipped pages gets another pass, everything else is done
+		retry := []string{}
+		for _, c := range pending {
+			if len(am.skipped[c]) != 0 {
+				retry = append(retry, c)
+			}
+		}
+		if len(retry) == 0 {
+			return ok
 		}
+		if pass == MAX_MARK_PASSES {
+			for _, c := range retry {
+				am.Logger.Errorf("%s mark run is incomplete after %d passes, skipped: %s", c, pass, strings.Join(am.skipped[c], ", "))
+			}
+			return false
+		}
+		delay := backoff(pass, MARK_PASS_BASE_DELAY, MAX_MARK_PASS_DELAY)
+		am.Logger.Warnf("Retrying %s mark in %s", strings.Join(retry, ", "), delay)
+		select {
+		case <-am.Ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+		pending = retry
 	}
 }
 
 func (am *AwsMarker) Sweep() {
 	am.Logger.Debugf("starting %s sweep run for %s", mark.AWS, am.Config.Name)
-	fm := AwsCandidateFuncMap{
-		"ec2": am.sweepEc2,
-		"eks": am.sweepEks,
-		"ebs": am.sweepEbs,
-		"sg":  am.sweepSG,
-		"elb": am.sweepElb,
-		"alb": am.sweepAlb,
-		"ec":  am.sweepElasticache,
-		"asg": am.sweepAsg,
-		"lc":  am.sweepLaunchConfig,
-	}
 
 	am.mux.Lock()
 	defer am.mux.Unlock()
-	for _, c := range am.Config.Candidates {
+	done := metrics.Run(mark.AWS.String(), am.Config.Name, metrics.PHASE_SWEEP)
+	if am.sweepHeld() {
+		done(true)
+		return
+	}
+	done(!am.eachRegion((*AwsMarker).sweep))
+}
+
+// sweepHeld checks the account's sweep limits before any region is swept.  nothing may be deleted while
+// it's true, and that includes when we can't tell.
+func (am *AwsMarker) sweepHeld() bool {
+	hold, err := mark.CheckSweep(am.Cache, mark.AWS, am.Config.Name, am.Config.SweepLimits, am.inventory)
+	if err != nil {
+		am.Logger.Errorf("Couldn't check sweep limits, leaving everything for the next sweep: %v", err)
+		return true
+	}
+	if hold != nil {
+		am.Logger.Warn(hold.Summary())
+		metrics.SweepsHalted.WithLabelValues(mark.AWS.String(), am.Config.Name).Inc()
+		return true
+	}
+	return false
+}
+
+// inventoryScope counts each candidate type in each region separately
+func (am *AwsMarker) inventoryScope(canType string) string {
+	return am.region + "/" + canType
+}
+
+// sweep returns false if any candidate type failed
+func (am *AwsMarker) sweep() bool {
+	fm := AwsCandidateFuncMap{
+		"ec2":      am.sweepEc2,
+		"eks":      am.sweepEks,
+		"ebs":      am.sweepEbs,
+		"sg":       am.sweepSG,
+		"elb":      am.sweepElb,
+		"alb":      am.sweepAlb,
+		"ec":       am.sweepElasticache,
+		"asg":      am.sweepAsg,
+		"lc":       am.sweepLaunchConfig,
+		"rds":      am.sweepRds,
+		"aurora":   am.sweepAurora,
+		"snapshot": am.sweepSnapshot,
+		"ami":      am.sweepAmi,
+		"eip":      am.sweepEip,
+		"natgw":    am.sweepNatGw,
+		"eni":      am.sweepEni,
+		"s3":       am.sweepS3,
+		"lambda":   am.sweepLambda,
+		"ecr":      am.sweepEcr,
+		"loggroup": am.sweepLogGroup,
+	}
+
+	ok := true
+	for _, c := range sweepOrder(am.Config.Candidates) {
+		// shutting down, leave the rest for the next sweep
+		if am.Ctx.Err() != nil {
+			return false
+		}
 		am.Logger = am.Logger.WithFields(logrus.Fields{"type": c, "phase": "sweep"})
 		err := fm[c]()
 		if err != nil {
 			am.Logger.Error(err)
+			ok = false
 		}
 	}
+	return ok
 }
 
-func checkRequiredTags(required string, tags []*ec2.Tag) (int, bool) {
-	for ti, k := range tags {
-		if *k.Key == required {
-			return ti, true
+// sweepFirst are the candidate types that hold on to others, swept ahead of the rest whatever order they're
+// configured in.  nat gateways keep their elastic ips associated and network interfaces keep their security
+// groups in use.
+var sweepFirst = map[string]bool{"natgw": true, "eni": true}
+
+func sweepOrder(candidates []string) []string {
+	ordered := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		if sweepFirst[c] {
+			ordered = append(ordered, c)
 		}
 	}
-	return 0, false
+	for _, c := range candidates {
+		if !sweepFirst[c] {
+			ordered = append(ordered, c)
+		}
+	}
+	return ordered
 }
 
-func tagOrNil(tag string, tags []*ec2.Tag) string {
-	var tagResult string
-	tagIndex, tagExists := checkRequiredTags(tag, tags)
-	if tagExists {
-		tagResult = *tags[tagIndex].Value
+// eachRegion runs fn in parallel against a copy of the marker for each region.  the copies share the
+// session, so the account as a whole still stays inside its rate limit.  it's only ok if every region is.
+func (am *AwsMarker) eachRegion(fn func(*AwsMarker) bool) bool {
+	regions, err := am.resolveRegions()
+	if err != nil {
+		am.Logger.Error(err)
+		return false
 	}
-	return tagResult
+	var wg sync.WaitGroup
+	var failed int32
+	for _, r := range regions {
+		wg.Add(1)
+		go func(rm *AwsMarker) {
+			defer wg.Done()
+			if !fn(rm) {
+				atomic.StoreInt32(&failed, 1)
+			}
+		}(am.forRegion(r))
+	}
+	wg.Wait()
+	return failed == 0
 }
 
-func (am *AwsMarker) filterableUpdate(awsObject interface{}, canType string) error {
-	id, tags, _, _ := am.ExtractTags(awsObject)
-	owner := tagOrNil("owner", tags)
-	err := mark.RemoveCandidates(owner, am.Cache, []*string{id})
-	if err != nil {
-		if _, ok := err.(*mark.NoCandidatesError); !ok {
-			am.Logger.Error(err)
-		}
+func (am *AwsMarker) count(counter *prometheus.CounterVec, canType string) {
+	counter.WithLabelValues(mark.AWS.String(), am.Config.Name, canType).Inc()
+}
+
+// refused records a candidate the sweep wouldn't delete.  it stays marked, and its owner hears about it
+// once the sweep is done.
+func (am *AwsMarker) refused(canType, id, reason string, dryRun bool) {
+	am.Logger.Warnf("Refusing to delete %s: %s", id, reason)
+	am.count(metrics.CandidatesRefused, canType)
+	if err := mark.Refused(am.Cache, am.candidateKey(id), reason, dryRun); err != nil {
+		am.Logger.Error(err)
 	}
-	return nil
 }
 
-func (am *AwsMarker) ttlRejected(awsObject interface{}, canType string) error {
-	id, tags, _, _ := am.ExtractTags(awsObject)
-	gp, _ := model.ParseDuration(am.Config.GracePeriod) // already checked this in config
-	owner := tagOrNil("owner", tags)
-	extraTags := map[string]string{}
-	if len(tags) != 0 {
-		for _, t := range tags {
-			extraTags[*t.Key] = *t.Value
-		}
+// swept counts and audits a candidate the sweep deleted, or would have deleted if this weren't a dry run
+func (am *AwsMarker) swept(canType, id string, dryRun bool) {
+	if dryRun {
+		am.count(metrics.CandidatesDryRun, canType)
+	} else {
+		am.count(metrics.CandidatesDeleted, canType)
 	}
-	extraTags["region"] = am.Config.Region
-	marked := &mark.MarkedCandidate{
-		MarkerType:    mark.AWS,
-		CandidateType: canType,
-		Id:            *id,
-		Owner:         owner,
-		Purpose:       tagOrNil("purpose", tags),
-		Ttl:           tagOrNil("ttl", tags),
-		Account:       am.Config.Name,
-		Tags:          extraTags,
+	if err := mark.Swept(am.Cache, am.candidateKey(id), dryRun); err != nil {
+		am.Logger.Error(err)
+	}
+}
+
+func (am *AwsMarker) forRegion(region string) *AwsMarker {
+	rm := *am
+	rm.region = region
+	rm.Logger = am.Logger.WithFields(logrus.Fields{"region": region})
+	rm.skipped = map[string][]string{}
+	rm.sgs = nil
+	rm.amis = nil
+	rm.amiSnapshots = nil
+	rm.vpcs = nil
+	rm.lambdaSources = nil
+	rm.functions = nil
+	rm.ecsImages = nil
+	rm.bucketNames = nil
+	return &rm
+}
+
+// resolveRegions expands "all" into every region enabled for the account
+func (am *AwsMarker) resolveRegions() ([]string, error) {
+	if len(am.Config.Regions) != 1 || am.Config.Regions[0] != config.AWS_ALL_REGIONS {
+		return am.Config.Regions, nil
 	}
-	mjson, err := json.Marshal(marked)
+	svc := ec2.New(am.sess, &aws.Config{Credentials: am.creds, Region: aws.String(discoveryRegion(am.Config))})
+	// without AllRegions this only lists regions that are enabled for the account
+	result, err := svc.DescribeRegionsWithContext(am.Ctx, &ec2.DescribeRegionsInput{})
 	if err != nil {
-		return err
+		return nil, err
+	}
+	regions := []string{}
+	for _, r := range result.Regions {
+		regions = append(regions, *r.RegionName)
+	}
+	sort.Strings(regions)
+	am.Logger.Debugf("discovered regions: %v", regions)
+	return regions, nil
+}
+
+func checkRequiredTags(required string, tags []*ec2.Tag) (int, bool) {
+	for ti, k := range tags {
+		if *k.Key == required {
+			return ti, true
+		}
+	}
+	return 0, false
+}
+
+// firstTag returns the value of the first of keys that's tagged
+func firstTag(keys []string, tags []*ec2.Tag) (string, bool) {
+	for _, k := range keys {
+		if ti, ok := checkRequiredTags(k, tags); ok {
+			return *tags[ti].Value, true
+		}
 	}
-	if am.Cache.CandidateExists(owner, string(mjson)) {
-		am.Logger.Debugf("Instance: %s already exists in cache, skip", *id)
+	return "", false
+}
+
+func firstTagOrNil(keys []string, tags []*ec2.Tag) string {
+	v, _ := firstTag(keys, tags)
+	return v
+}
+
+// tagKeys falls back to the default keys for markers built without a defaulted config
+func (am *AwsMarker) tagKeys() config.TagKeys {
+	return am.Config.TagKeys.Or(config.DefaultTagKeys())
+}
+
+func (am *AwsMarker) candidateKey(id string) string {
+	return mark.CandidateKey(mark.AWS, am.Config.Name, am.region, id)
+}
+
+func (am *AwsMarker) filterableUpdate(awsObject interface{}, canType, reason string) error {
+	id, tags, created, _ := am.ExtractTags(awsObject)
+	if id == nil {
 		return nil
 	}
-	// owner index update
-	err = am.Cache.Write("bilge:owners", owner)
+	err := mark.Ignore(am.Cache, am.newCandidate(*id, tags, created, canType, reason))
 	if err != nil {
-		return err
+		am.Logger.Error(err)
 	}
-	// write candidate by owner
-	err = am.Cache.Write(fmt.Sprintf("bilge:candidates:%s", owner), string(mjson))
+	return nil
+}
+
+func (am *AwsMarker) ttlRejected(awsObject interface{}, canType, reason string) error {
+	id, tags, created, _, err := am.extractTags(awsObject)
 	if err != nil {
+		if isThrottle(err) {
+			am.skip(fmt.Sprintf("%s tags", canType), err)
+			return nil
+		}
 		return err
 	}
-	// write an expiring key with our grace period
-	err = am.Cache.WriteTimer(fmt.Sprintf("bilge:timers:%s", *id),
-		am.Config.GracePeriod, time.Now().Local().Add(time.Duration(gp)))
+	written, err := mark.WriteCandidate(am.Cache, am.newCandidate(*id, tags, created, canType, reason), am.Config.GracePeriod)
 	if err != nil {
 		return err
 	}
+	if written {
+		am.count(metrics.CandidatesMarked, canType)
+	}
 	return nil
 }
 
+func (am *AwsMarker) newCandidate(id string, tags []*ec2.Tag, created *time.Time, canType, reason string) *mark.MarkedCandidate {
+	extraTags := map[string]string{}
+	for _, t := range tags {
+		extraTags[*t.Key] = *t.Value
+	}
+	extraTags["region"] = am.region
+	// unreadable dates were already reported by the filter
+	keys := am.tagKeys()
+	ttl := firstTagOrNil(keys.Ttl, tags)
+	expires, _ := mark.Expiry(ttl, firstTagOrNil(keys.Expires, tags), created)
+	return &mark.MarkedCandidate{
+		MarkerType:    mark.AWS,
+		CandidateType: canType,
+		Id:            id,
+		Owner:         firstTagOrNil(keys.Owner, tags),
+		Purpose:       firstTagOrNil(keys.Purpose, tags),
+		Ttl:           ttl,
+		Account:       am.Config.Name,
+		Region:        am.region,
+		Tags:          extraTags,
+		Reason:        reason,
+		Expires:       expires,
+	}
+}
+
 func (am *AwsMarker) toDelete(owner, thing string) []*string {
 	toDelete := []*string{}
 	mcs, err := mark.BuildCandidates(owner, am.Cache)
@@ -273,11 +563,12 @@ func (am *AwsMarker) toDelete(owner, thing string) []*string {
 		return nil
 	}
 	for _, m := range mcs {
-		if !am.Cache.TimerExists(fmt.Sprintf("bilge:timers:%s", m.Id)) {
-			if m.CandidateType == thing && m.Account == am.Config.Name {
-				am.Logger.Info("Will delete ", m.Id)
-				toDelete = append(toDelete, aws.String(m.Id))
-			}
+		if m.MarkerType != mark.AWS || m.CandidateType != thing || m.Account != am.Config.Name || m.Region != am.region {
+			continue
+		}
+		if !am.Cache.TimerExists(mark.TimerKey(m.Key())) {
+			am.Logger.Info("Will delete ", m.Id)
+			toDelete = append(toDelete, aws.String(m.Id))
 		}
 	}
 	return toDelete
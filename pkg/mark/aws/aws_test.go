@@ -0,0 +1,64 @@
+package aws
+
+import (
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const describeRegions = `<DescribeRegionsResponse><regionInfo>
+<item><regionName>us-west-2</regionName><regionEndpoint>ec2.us-west-2.amazonaws.com</regionEndpoint></item>
+<item><regionName>eu-west-1</regionName><regionEndpoint>ec2.eu-west-1.amazonaws.com</regionEndpoint></item>
+</regionInfo></DescribeRegionsResponse>`
+
+func TestResolveRegions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(describeRegions)) //nolint
+	}))
+	defer srv.Close()
+
+	cases := map[string]struct {
+		regions  []string
+		expected []string
+	}{
+		"named": {regions: []string{"us-east-1", "us-east-2"}, expected: []string{"us-east-1", "us-east-2"}},
+		"all":   {regions: []string{config.AWS_ALL_REGIONS}, expected: []string{"eu-west-1", "us-west-2"}},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			am := newTestAwsMarker(t, &config.Aws{Regions: c.regions}, srv.URL)
+			regions, err := am.resolveRegions()
+			assert.Nil(t, err)
+			assert.Equal(t, c.expected, regions)
+		})
+	}
+}
+
+func TestToDeleteMatchesRegion(t *testing.T) {
+	am := newTestAwsMarker(t, &config.Aws{Name: "dev", GracePeriod: "0s"}, "")
+	for _, region := range []string{"us-east-1", "us-west-2"} {
+		_, err := mark.WriteCandidate(am.Cache, &mark.MarkedCandidate{
+			MarkerType:    mark.AWS,
+			CandidateType: "ec2",
+			Id:            "i-" + region,
+			Owner:         "alice",
+			Account:       "dev",
+			Region:        region,
+		}, "0s")
+		assert.Nil(t, err)
+	}
+
+	east := am.forRegion("us-east-1")
+	assert.Equal(t, []*string{aws.String("i-us-east-1")}, east.toDelete("alice", "ec2"))
+	west := am.forRegion("us-west-2")
+	assert.Equal(t, []*string{aws.String("i-us-west-2")}, west.toDelete("alice", "ec2"))
+}
+
+func TestSweepOrder(t *testing.T) {
+	assert.Equal(t, []string{"eni", "natgw", "ec2", "sg", "eip"}, sweepOrder([]string{"ec2", "sg", "eni", "eip", "natgw"}))
+	assert.Equal(t, []string{"ebs"}, sweepOrder([]string{"ebs"}))
+}
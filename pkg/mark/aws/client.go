@@ -0,0 +1,126 @@
+package aws
+
+import (
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/armory-io/bilgepump/pkg/metrics"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"golang.org/x/time/rate"
+	"math/rand"
+	"time"
+)
+
+const (
+	RETRY_BASE_DELAY    = 100 * time.Millisecond
+	THROTTLE_BASE_DELAY = 500 * time.Millisecond
+	MAX_RETRY_DELAY     = 30 * time.Second
+	// a mark run that still has skipped pages after this many passes is given up until the next schedule
+	MAX_MARK_PASSES      = 3
+	MARK_PASS_BASE_DELAY = 10 * time.Second
+	MAX_MARK_PASS_DELAY  = 2 * time.Minute
+	// where we discover regions when the account doesn't name one
+	DEFAULT_DISCOVERY_REGION = "us-east-1"
+)
+
+// backoff is "full jitter" exponential backoff: a random delay between zero and base * 2^attempt,
+// never more than max.  spreading retries out keeps every marker from hammering the api in lock step.
+func backoff(attempt int, base, max time.Duration) time.Duration {
+	ceiling := max
+	if attempt < 32 {
+		if d := base << uint(attempt); d > 0 && d < max {
+			ceiling = d
+		}
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// backoffRetryer keeps the sdk's decisions about what to retry but replaces its delays with full jitter
+// backoff, backing off harder when we're being throttled
+type backoffRetryer struct {
+	client.DefaultRetryer
+	baseDelay         time.Duration
+	throttleBaseDelay time.Duration
+	maxDelay          time.Duration
+}
+
+func newBackoffRetryer(maxRetries int) *backoffRetryer {
+	return &backoffRetryer{
+		DefaultRetryer:    client.DefaultRetryer{NumMaxRetries: maxRetries},
+		baseDelay:         RETRY_BASE_DELAY,
+		throttleBaseDelay: THROTTLE_BASE_DELAY,
+		maxDelay:          MAX_RETRY_DELAY,
+	}
+}
+
+func (br *backoffRetryer) RetryRules(r *request.Request) time.Duration {
+	if r.IsErrorThrottle() {
+		return backoff(r.RetryCount, br.throttleBaseDelay, br.maxDelay)
+	}
+	return backoff(r.RetryCount, br.baseDelay, br.maxDelay)
+}
+
+// rateLimitHandler holds every attempt, retries included, until the account's token bucket has room.
+// it runs in the sign phase because that runs once per attempt.
+func rateLimitHandler(limiter *rate.Limiter) request.NamedHandler {
+	return request.NamedHandler{
+		Name: "bilgepump.RateLimit",
+		Fn: func(r *request.Request) {
+			if err := limiter.Wait(r.Context()); err != nil {
+				r.Error = awserr.New(request.CanceledErrorCode, "rate limit wait canceled", err)
+			}
+		},
+	}
+}
+
+// newAwsSession builds the session every client for an account is made from, so they all share the
+// account's retry settings and rate limit
+func newAwsSession(cfg *config.Aws, cfgs ...*aws.Config) (*session.Session, error) {
+	awsCfg := request.WithRetryer(aws.NewConfig().WithMaxRetries(cfg.MaxClientRetry), newBackoffRetryer(cfg.MaxClientRetry))
+	sess, err := session.NewSession(append([]*aws.Config{awsCfg}, cfgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	limit := rate.Limit(cfg.RateLimit)
+	if cfg.RateLimit <= 0 {
+		limit = rate.Inf
+	}
+	sess.Handlers.Sign.PushFrontNamed(rateLimitHandler(rate.NewLimiter(limit, cfg.RateBurst)))
+	sess.Handlers.AfterRetry.PushFrontNamed(throttleMetricHandler(cfg.Name))
+	return sess, nil
+}
+
+// throttleMetricHandler counts every throttled attempt, including the ones a retry recovers from
+func throttleMetricHandler(account string) request.NamedHandler {
+	return request.NamedHandler{
+		Name: "bilgepump.ThrottleMetric",
+		Fn: func(r *request.Request) {
+			if r.IsErrorThrottle() {
+				metrics.Throttled.WithLabelValues(mark.AWS.String(), account).Inc()
+			}
+		},
+	}
+}
+
+func isThrottle(err error) bool {
+	return request.IsErrorThrottle(err)
+}
+
+// isCanceled is true when the marker's context was canceled under a request, which happens when we're
+// shutting down.  the request may or may not have reached aws, so nothing is recorded for it.
+func isCanceled(err error) bool {
+	if awsErr, ok := err.(awserr.Error); ok {
+		return awsErr.Code() == request.CanceledErrorCode
+	}
+	return false
+}
+
+// skip records part of a mark run we couldn't read, usually because we were still throttled after every
+// retry.  Mark runs the candidate type again rather than treating the run as complete.
+func (am *AwsMarker) skip(what string, err error) {
+	am.Logger.Warnf("Skipped %s: %v", what, err)
+	am.skipped[am.current] = append(am.skipped[am.current], what)
+}
@@ -0,0 +1,138 @@
+package aws
+
+import (
+	"context"
+	"github.com/armory-io/bilgepump/pkg/cache"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/armory-io/bilgepump/pkg/metrics"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	throttledResponse = `<Response><Errors><Error><Code>RequestLimitExceeded</Code><Message>Request limit exceeded.</Message></Error></Errors><RequestID>1</RequestID></Response>`
+	emptyInstances    = `<DescribeInstancesResponse><reservationSet/></DescribeInstancesResponse>`
+)
+
+// fakeEc2 throttles the first throttled requests and answers the rest with no instances
+func fakeEc2(t *testing.T, throttled int32) (*httptest.Server, *int32) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) <= throttled {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(throttledResponse)) //nolint
+			return
+		}
+		w.Write([]byte(emptyInstances)) //nolint
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func newTestAwsMarker(t *testing.T, cfg *config.Aws, endpoint string) *AwsMarker {
+	retryer := newBackoffRetryer(cfg.MaxClientRetry)
+	retryer.baseDelay, retryer.throttleBaseDelay, retryer.maxDelay = time.Millisecond, time.Millisecond, 5*time.Millisecond
+	sess, err := newAwsSession(cfg, request.WithRetryer(&aws.Config{
+		Endpoint:         aws.String(endpoint),
+		Region:           aws.String("us-west-2"),
+		S3ForcePathStyle: aws.Bool(true),
+	}, retryer))
+	assert.Nil(t, err)
+	return &AwsMarker{
+		Config:    cfg,
+		Logger:    logrus.NewEntry(logrus.New()),
+		Cache:     cache.NewMemoryCache(),
+		Ctx:       context.Background(),
+		creds:     credentials.NewStaticCredentials("id", "secret", ""),
+		sess:      sess,
+		mux:       &sync.Mutex{},
+		skipped:   map[string][]string{},
+		region:    "us-west-2",
+		inventory: mark.NewInventory(),
+	}
+}
+
+// writeTestCandidates marks ids as candidates whose grace period has already run out
+func writeTestCandidates(t *testing.T, am *AwsMarker, canType string, ids ...string) {
+	for _, id := range ids {
+		_, err := mark.WriteCandidate(am.Cache, &mark.MarkedCandidate{
+			MarkerType:    mark.AWS,
+			CandidateType: canType,
+			Id:            id,
+			Owner:         "alice",
+			Account:       "dev",
+			Region:        am.region,
+		}, "0s")
+		assert.Nil(t, err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt := 0; attempt < 40; attempt++ {
+		d := backoff(attempt, 100*time.Millisecond, 5*time.Second)
+		assert.True(t, d >= 0)
+		assert.True(t, d <= 5*time.Second)
+		if attempt < 5 {
+			assert.True(t, d <= 100*time.Millisecond<<uint(attempt))
+		}
+	}
+}
+
+func TestRetriesUseMaxClientRetry(t *testing.T) {
+	cases := map[string]struct {
+		maxRetries      int
+		throttled       int32
+		expectHits      int32
+		expectErr       bool
+		expectThrottled float64
+	}{
+		"recovers":    {maxRetries: 3, throttled: 2, expectHits: 3, expectThrottled: 2},
+		"gives up":    {maxRetries: 2, throttled: 10, expectHits: 3, expectErr: true, expectThrottled: 3},
+		"never fails": {maxRetries: 0, throttled: 0, expectHits: 1},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv, hits := fakeEc2(t, c.throttled)
+			am := newTestAwsMarker(t, &config.Aws{Name: name, MaxClientRetry: c.maxRetries}, srv.URL)
+			_, err := am.getEc2Session().DescribeInstances(&ec2.DescribeInstancesInput{})
+			assert.Equal(t, c.expectErr, err != nil)
+			if c.expectErr {
+				assert.True(t, isThrottle(err))
+			}
+			assert.Equal(t, c.expectHits, atomic.LoadInt32(hits))
+			assert.Equal(t, c.expectThrottled, testutil.ToFloat64(metrics.Throttled.WithLabelValues(mark.AWS.String(), name)))
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	srv, _ := fakeEc2(t, 0)
+	am := newTestAwsMarker(t, &config.Aws{RateLimit: 20, RateBurst: 1}, srv.URL)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		_, err := am.getEc2Session().DescribeInstances(&ec2.DescribeInstancesInput{})
+		assert.Nil(t, err)
+	}
+	// the first request uses the burst, the other four wait 50ms each
+	assert.True(t, time.Since(start) >= 190*time.Millisecond)
+}
+
+func TestThrottledMarkIsSkipped(t *testing.T) {
+	srv, _ := fakeEc2(t, 100)
+	am := newTestAwsMarker(t, &config.Aws{MaxClientRetry: 1}, srv.URL)
+	am.current = "ec2"
+	assert.Nil(t, am.markEc2())
+	assert.Equal(t, []string{"ec2 instance pages"}, am.skipped["ec2"])
+}
@@ -0,0 +1,82 @@
+package aws
+
+import (
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/prometheus/common/model"
+	"time"
+)
+
+// newCredentials starts from the account's base credentials and assumes each role in the chain in turn,
+// ending with iamRole when it's set
+func newCredentials(sess *session.Session, cfg *config.Aws) (*credentials.Credentials, error) {
+	creds, err := baseCredentials(sess, &cfg.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	roles := append([]config.AwsAssumeRole{}, cfg.Credentials.AssumeRoles...)
+	if cfg.IamRole != "" {
+		roles = append(roles, config.AwsAssumeRole{RoleArn: cfg.IamRole, SessionName: config.DEFAULT_AWS_SESSION_NAME})
+	}
+	for _, role := range roles {
+		externalId, err := role.ExternalId.Resolve()
+		if err != nil {
+			return nil, err
+		}
+		var duration time.Duration
+		if role.Duration != "" {
+			d, err := model.ParseDuration(role.Duration)
+			if err != nil {
+				return nil, err
+			}
+			duration = time.Duration(d)
+		}
+		svc := sts.New(sess, &aws.Config{Credentials: creds})
+		sessionName := role.SessionName
+		creds = stscreds.NewCredentialsWithClient(svc, role.RoleArn, func(p *stscreds.AssumeRoleProvider) {
+			p.RoleSessionName = sessionName
+			p.Duration = duration
+			if externalId != "" {
+				p.ExternalID = aws.String(externalId)
+			}
+		})
+	}
+	return creds, nil
+}
+
+// baseCredentials returns nil when the account doesn't pick a source, which leaves the session's default
+// chain in charge
+func baseCredentials(sess *session.Session, ac *config.AwsCredentials) (*credentials.Credentials, error) {
+	switch {
+	case ac.AccessKeyId.IsSet():
+		id, err := ac.AccessKeyId.Resolve()
+		if err != nil {
+			return nil, err
+		}
+		secret, err := ac.SecretAccessKey.Resolve()
+		if err != nil {
+			return nil, err
+		}
+		token, err := ac.SessionToken.Resolve()
+		if err != nil {
+			return nil, err
+		}
+		return credentials.NewStaticCredentials(id, secret, token), nil
+	case ac.Profile != "":
+		ps, err := session.NewSessionWithOptions(session.Options{
+			Profile:           ac.Profile,
+			SharedConfigState: session.SharedConfigEnable,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return ps.Config.Credentials, nil
+	case ac.WebIdentity != nil:
+		return stscreds.NewWebIdentityCredentials(sess, ac.WebIdentity.RoleArn, ac.WebIdentity.SessionName, ac.WebIdentity.TokenFile), nil
+	}
+	return nil, nil
+}
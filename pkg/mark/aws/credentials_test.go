@@ -0,0 +1,103 @@
+package aws
+
+import (
+	"fmt"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const assumeRoleResponse = `<AssumeRoleResponse><AssumeRoleResult><Credentials>
+<AccessKeyId>%s</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>token</SessionToken>
+<Expiration>%s</Expiration></Credentials></AssumeRoleResult></AssumeRoleResponse>`
+
+type assumedRole struct {
+	roleArn     string
+	externalId  string
+	sessionName string
+	// the access key the request was signed with
+	signedWith string
+}
+
+// fakeSts hands out an access key named after each role it's asked to assume
+func fakeSts(t *testing.T) (*httptest.Server, func() []assumedRole) {
+	var mu sync.Mutex
+	assumed := []assumedRole{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Nil(t, r.ParseForm())
+		auth := r.Header.Get("Authorization")
+		signedWith := auth[strings.Index(auth, "Credential=")+len("Credential=") : strings.Index(auth, "/")]
+		mu.Lock()
+		assumed = append(assumed, assumedRole{r.Form.Get("RoleArn"), r.Form.Get("ExternalId"), r.Form.Get("RoleSessionName"), signedWith})
+		mu.Unlock()
+		key := "key-" + r.Form.Get("RoleArn")[strings.LastIndex(r.Form.Get("RoleArn"), "/")+1:]
+		fmt.Fprintf(w, assumeRoleResponse, key, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []assumedRole {
+		mu.Lock()
+		defer mu.Unlock()
+		return assumed
+	}
+}
+
+func TestAssumeRoleChain(t *testing.T) {
+	srv, assumed := fakeSts(t)
+	t.Setenv("BILGE_TEST_ACCESS_KEY", "base-key")
+	cfg := &config.Aws{
+		IamRole: "arn:aws:iam::333333333333:role/last",
+		Credentials: config.AwsCredentials{
+			AccessKeyId:     config.Secret{Env: "BILGE_TEST_ACCESS_KEY"},
+			SecretAccessKey: config.Secret{Value: "base-secret"},
+			AssumeRoles: []config.AwsAssumeRole{
+				{RoleArn: "arn:aws:iam::111111111111:role/first", SessionName: "hop"},
+				{RoleArn: "arn:aws:iam::222222222222:role/second", ExternalId: config.Secret{Value: "ext-123"}, SessionName: "bilgepump"},
+			},
+		},
+	}
+	sess, err := newAwsSession(cfg, &aws.Config{Endpoint: aws.String(srv.URL), Region: aws.String("us-east-1")})
+	assert.Nil(t, err)
+	creds, err := newCredentials(sess, cfg)
+	assert.Nil(t, err)
+
+	v, err := creds.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, "key-last", v.AccessKeyID)
+	assert.Equal(t, []assumedRole{
+		{"arn:aws:iam::111111111111:role/first", "", "hop", "base-key"},
+		{"arn:aws:iam::222222222222:role/second", "ext-123", "bilgepump", "key-first"},
+		{"arn:aws:iam::333333333333:role/last", "", config.DEFAULT_AWS_SESSION_NAME, "key-second"},
+	}, assumed())
+}
+
+func TestBaseCredentials(t *testing.T) {
+	sess, err := newAwsSession(&config.Aws{}, &aws.Config{Region: aws.String("us-east-1")})
+	assert.Nil(t, err)
+
+	creds, err := baseCredentials(sess, &config.AwsCredentials{})
+	assert.Nil(t, err)
+	assert.Nil(t, creds, "no source leaves the default chain in charge")
+
+	_, err = baseCredentials(sess, &config.AwsCredentials{
+		AccessKeyId:     config.Secret{Env: "BILGE_TEST_UNSET_ACCESS_KEY"},
+		SecretAccessKey: config.Secret{Value: "secret"},
+	})
+	assert.NotNil(t, err)
+
+	creds, err = baseCredentials(sess, &config.AwsCredentials{
+		AccessKeyId:     config.Secret{Value: "id"},
+		SecretAccessKey: config.Secret{Value: "secret"},
+		SessionToken:    config.Secret{Value: "token"},
+	})
+	assert.Nil(t, err)
+	v, err := creds.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, "id", v.AccessKeyID)
+	assert.Equal(t, "token", v.SessionToken)
+}
@@ -10,27 +10,19 @@ import (
 func (am *AwsMarker) markEbs() error {
 	svc := am.getEc2Session()
 
-	err := svc.DescribeVolumesPages(nil, am.processEbsMarkPages)
-	if serr, ok := err.(awserr.Error); ok {
-		if serr.Code() == "Throttling" {
-			am.Logger.Warn(err)
-		} else {
-			return err
-		}
+	err := svc.DescribeVolumesPagesWithContext(am.Ctx, nil, am.processEbsMarkPages)
+	if isThrottle(err) {
+		am.skip("ebs volume pages", err)
+		return nil
 	}
-	return nil
+	return err
 }
 
 func (am *AwsMarker) processEbsMarkPages(page *ec2.DescribeVolumesOutput, lastPage bool) bool {
 
 	if len(page.Volumes) != 0 {
 		for _, v := range page.Volumes {
-			am.FilterAwsObject(am.newAwsFilterable(v).
-				WithIgnoreFilter(am.IgnoreConfigFilter).
-				WithTypedIgnoreFilter(EbsIgnoreAttachedFilter).
-				WithComplianceFilter(NoTagFilter).
-				WithComplianceFilter(NoTTLTagFilter).
-				WithComplianceFilter(TTLTagExpiredFilter))
+			am.FilterAwsObject(am.ebsFilterable(v))
 		}
 	}
 
@@ -40,6 +32,28 @@ func (am *AwsMarker) processEbsMarkPages(page *ec2.DescribeVolumesOutput, lastPa
 	return false
 }
 
+func (am *AwsMarker) ebsFilterable(v *ec2.Volume) *awsFilterable {
+	return am.newAwsFilterable(v).
+		WithIgnoreFilter(am.IgnoreConfigFilter).
+		WithTypedIgnoreFilter(EbsIgnoreAttachedFilter).
+		WithComplianceFilter(NoTagFilter).
+		WithComplianceFilter(am.NoTTLTagFilter).
+		WithComplianceFilter(am.TTLTagExpiredFilter)
+}
+
+func (am *AwsMarker) recheckEbs(id *string) (bool, bool, error) {
+	result, err := am.getEc2Session().DescribeVolumesWithContext(am.Ctx, &ec2.DescribeVolumesInput{
+		Filters: []*ec2.Filter{{Name: aws.String("volume-id"), Values: []*string{id}}},
+	})
+	if err != nil {
+		return false, false, err
+	}
+	for _, v := range result.Volumes {
+		return filterableCandidate(am.ebsFilterable(v))
+	}
+	return false, false, nil
+}
+
 func (am *AwsMarker) sweepEbs() error {
 	svc := am.getEc2Session()
 
@@ -49,7 +63,7 @@ func (am *AwsMarker) sweepEbs() error {
 	}
 
 	for _, o := range owners {
-		toDelete := am.toDelete(o, "ebs")
+		toDelete := am.recheck(am.toDelete(o, "ebs"), am.recheckEbs)
 		am.Logger.Debug("DryRun? ", !am.Config.DeleteEnabled)
 		if len(toDelete) != 0 {
 			for _, v := range toDelete {
@@ -57,19 +71,25 @@ func (am *AwsMarker) sweepEbs() error {
 					VolumeId: v,
 					DryRun:   aws.Bool(!am.Config.DeleteEnabled),
 				}
-				_, err := svc.DeleteVolume(vol)
+				_, err := svc.DeleteVolumeWithContext(am.Ctx, vol)
+				if isCanceled(err) {
+					return err
+				}
 				if awsErr, ok := err.(awserr.Error); ok {
 					if awsErr.Code() == "DryRunOperation" {
 						am.Logger.Warnf("Would have deleted %s but we're in DryRun", *v)
+						am.swept("ebs", *v, true)
 						continue
 					}
-					if awsErr.Code() == "Throttling" {
+					if isThrottle(awsErr) {
 						am.Logger.Warn(err)
 						continue
 					}
 					am.Logger.Error(awsErr)
+				} else if err == nil {
+					am.swept("ebs", *v, false)
 				}
-				err = mark.RemoveCandidates(o, am.Cache, []*string{v})
+				err = mark.RemoveCandidates(am.Cache, []string{am.candidateKey(*v)})
 				if err != nil {
 					am.Logger.Error(err)
 				}
@@ -11,15 +11,12 @@ func (am *AwsMarker) peekEc2Instances(fn func(*ec2.DescribeInstancesOutput, bool
 	svc := am.getEc2Session()
 
 	err := svc.DescribeInstancesPagesWithContext(am.Ctx, nil, fn)
-	if serr, ok := err.(awserr.Error); ok {
-		if serr.Code() == "Throttling" {
-			am.Logger.Warn(err)
-		} else {
-			return err
-		}
+	if isThrottle(err) {
+		am.skip("ec2 instance pages", err)
+		return nil
 	}
 
-	return nil
+	return err
 }
 
 func (am *AwsMarker) processEc2PagesCallback(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
@@ -28,13 +25,7 @@ func (am *AwsMarker) processEc2PagesCallback(page *ec2.DescribeInstancesOutput,
 		for _, r := range page.Reservations {
 			if len(r.Instances) != 0 {
 				for _, i := range r.Instances {
-					am.FilterAwsObject(am.newAwsFilterable(i).
-						WithIgnoreFilter(am.IgnoreConfigFilter).
-						WithIgnoreFilter(Ec2IgnoreAutoScaleInstanceFilter).
-						WithTypedIgnoreFilter(Ec2IgnoreTerminatedFilter).
-						WithComplianceFilter(NoTagFilter).
-						WithComplianceFilter(NoTTLTagFilter).
-						WithComplianceFilter(TTLTagExpiredFilter))
+					am.FilterAwsObject(am.ec2Filterable(i))
 				}
 			}
 		}
@@ -45,6 +36,32 @@ func (am *AwsMarker) processEc2PagesCallback(page *ec2.DescribeInstancesOutput,
 	return false
 }
 
+func (am *AwsMarker) ec2Filterable(i *ec2.Instance) *awsFilterable {
+	return am.newAwsFilterable(i).
+		WithIgnoreFilter(am.IgnoreConfigFilter).
+		WithIgnoreFilter(Ec2IgnoreAutoScaleInstanceFilter).
+		WithTypedIgnoreFilter(Ec2IgnoreTerminatedFilter).
+		WithComplianceFilter(NoTagFilter).
+		WithComplianceFilter(am.NoTTLTagFilter).
+		WithComplianceFilter(am.TTLTagExpiredFilter)
+}
+
+func (am *AwsMarker) recheckEc2(id *string) (bool, bool, error) {
+	// filtering by id, unlike InstanceIds, doesn't fail when the instance is gone
+	result, err := am.getEc2Session().DescribeInstancesWithContext(am.Ctx, &ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{{Name: aws.String("instance-id"), Values: []*string{id}}},
+	})
+	if err != nil {
+		return false, false, err
+	}
+	for _, r := range result.Reservations {
+		for _, i := range r.Instances {
+			return filterableCandidate(am.ec2Filterable(i))
+		}
+	}
+	return false, false, nil
+}
+
 func (am *AwsMarker) markEc2() error {
 	err := am.peekEc2Instances(am.processEc2PagesCallback)
 	if err != nil {
@@ -64,7 +81,7 @@ func (am *AwsMarker) sweepEc2() error {
 	}
 
 	for _, o := range owners {
-		toDelete := am.toDelete(o, "ec2")
+		toDelete := am.recheck(am.toDelete(o, "ec2"), am.recheckEc2)
 
 		am.Logger.Debug("DryRun? ", !am.Config.DeleteEnabled)
 		if len(toDelete) != 0 {
@@ -73,19 +90,25 @@ func (am *AwsMarker) sweepEc2() error {
 					InstanceIds: []*string{i},
 					DryRun:      aws.Bool(!am.Config.DeleteEnabled),
 				}
-				_, err := svc.TerminateInstances(instances)
+				_, err := svc.TerminateInstancesWithContext(am.Ctx, instances)
+				if isCanceled(err) {
+					return err
+				}
 				if awsErr, ok := err.(awserr.Error); ok {
 					if awsErr.Code() == "DryRunOperation" {
 						am.Logger.Warnf("Would have deleted %s but we're in DryRun", *i)
+						am.swept("ec2", *i, true)
 						continue
 					}
-					if awsErr.Code() == "Throttling" {
+					if isThrottle(awsErr) {
 						am.Logger.Warn(err)
 						continue
 					}
 					am.Logger.Error(awsErr)
+				} else if err == nil {
+					am.swept("ec2", *i, false)
 				}
-				err = mark.RemoveCandidates(o, am.Cache, []*string{i})
+				err = mark.RemoveCandidates(am.Cache, []string{am.candidateKey(*i)})
 				if err != nil {
 					am.Logger.Error(err)
 				}
@@ -0,0 +1,229 @@
+package aws
+
+import (
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"strings"
+)
+
+const (
+	// DescribeServices and DescribeTasks take at most this many at a time
+	ECS_DESCRIBE_SERVICES_BATCH = 10
+	ECS_DESCRIBE_TASKS_BATCH    = 100
+)
+
+func (am *AwsMarker) markEcr() error {
+	svc := am.getEcrSession()
+
+	// a repository we can't see the tasks of looks unused, so skip the whole run rather than mark it
+	if err := am.loadEcsImages(); err != nil {
+		if isThrottle(err) {
+			am.skip("ecs images", err)
+			return nil
+		}
+		return err
+	}
+
+	err := svc.DescribeRepositoriesPagesWithContext(am.Ctx, &ecr.DescribeRepositoriesInput{}, am.processEcrMarkPages)
+	if isThrottle(err) {
+		am.skip("ecr repository pages", err)
+		return nil
+	}
+	return err
+}
+
+// loadEcsImages resets the repositories that images in the task definitions of running tasks, and of every
+// deployment of a service, come from.  a service scaled to zero still counts, it'll want its images back when
+// it's scaled up.
+func (am *AwsMarker) loadEcsImages() error {
+	am.ecsImages = nil
+	svc := am.getEcsSession()
+
+	taskDefinitions := make(map[string]bool)
+	var clusters []*string
+	err := svc.ListClustersPagesWithContext(am.Ctx, &ecs.ListClustersInput{}, func(page *ecs.ListClustersOutput, lastPage bool) bool {
+		clusters = append(clusters, page.ClusterArns...)
+		return page.NextToken != nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, c := range clusters {
+		if err := am.loadServiceTaskDefinitions(c, taskDefinitions); err != nil {
+			return err
+		}
+		if err := am.loadTaskTaskDefinitions(c, taskDefinitions); err != nil {
+			return err
+		}
+	}
+
+	images := make(map[string]bool)
+	for td := range taskDefinitions {
+		result, err := svc.DescribeTaskDefinitionWithContext(am.Ctx, &ecs.DescribeTaskDefinitionInput{TaskDefinition: aws.String(td)})
+		if err != nil {
+			return err
+		}
+		for _, cd := range result.TaskDefinition.ContainerDefinitions {
+			images[imageRepository(aws.StringValue(cd.Image))] = true
+		}
+	}
+	am.ecsImages = images
+	return nil
+}
+
+func (am *AwsMarker) loadServiceTaskDefinitions(cluster *string, taskDefinitions map[string]bool) error {
+	svc := am.getEcsSession()
+
+	var services []*string
+	err := svc.ListServicesPagesWithContext(am.Ctx, &ecs.ListServicesInput{Cluster: cluster}, func(page *ecs.ListServicesOutput, lastPage bool) bool {
+		services = append(services, page.ServiceArns...)
+		return page.NextToken != nil
+	})
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(services); start += ECS_DESCRIBE_SERVICES_BATCH {
+		end := start + ECS_DESCRIBE_SERVICES_BATCH
+		if end > len(services) {
+			end = len(services)
+		}
+		result, err := svc.DescribeServicesWithContext(am.Ctx, &ecs.DescribeServicesInput{Cluster: cluster, Services: services[start:end]})
+		if err != nil {
+			return err
+		}
+		for _, s := range result.Services {
+			for _, d := range s.Deployments {
+				taskDefinitions[aws.StringValue(d.TaskDefinition)] = true
+			}
+			if s.TaskDefinition != nil {
+				taskDefinitions[*s.TaskDefinition] = true
+			}
+		}
+	}
+	return nil
+}
+
+// loadTaskTaskDefinitions covers tasks run on their own, outside a service
+func (am *AwsMarker) loadTaskTaskDefinitions(cluster *string, taskDefinitions map[string]bool) error {
+	svc := am.getEcsSession()
+
+	var tasks []*string
+	err := svc.ListTasksPagesWithContext(am.Ctx, &ecs.ListTasksInput{Cluster: cluster}, func(page *ecs.ListTasksOutput, lastPage bool) bool {
+		tasks = append(tasks, page.TaskArns...)
+		return page.NextToken != nil
+	})
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(tasks); start += ECS_DESCRIBE_TASKS_BATCH {
+		end := start + ECS_DESCRIBE_TASKS_BATCH
+		if end > len(tasks) {
+			end = len(tasks)
+		}
+		result, err := svc.DescribeTasksWithContext(am.Ctx, &ecs.DescribeTasksInput{Cluster: cluster, Tasks: tasks[start:end]})
+		if err != nil {
+			return err
+		}
+		for _, t := range result.Tasks {
+			taskDefinitions[aws.StringValue(t.TaskDefinitionArn)] = true
+		}
+	}
+	return nil
+}
+
+// imageRepository strips the tag or digest off an image, leaving the repository uri ecr reports
+func imageRepository(image string) string {
+	if i := strings.Index(image, "@"); i != -1 {
+		image = image[:i]
+	}
+	// a colon before the last slash is a registry port, not a tag
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
+
+func (am *AwsMarker) processEcrMarkPages(page *ecr.DescribeRepositoriesOutput, lastPage bool) bool {
+	for _, r := range page.Repositories {
+		am.FilterAwsObject(am.ecrFilterable(r))
+	}
+	return page.NextToken != nil
+}
+
+func (am *AwsMarker) ecrFilterable(r *ecr.Repository) *awsFilterable {
+	return am.newAwsFilterable(r).
+		WithIgnoreFilter(am.IgnoreConfigFilter).
+		WithTypedIgnoreFilter(am.EcrIgnoreInUseFilter).
+		WithComplianceFilter(NoTagFilter).
+		WithComplianceFilter(am.NoTTLTagFilter).
+		WithComplianceFilter(am.TTLTagExpiredFilter)
+}
+
+// recheckEcr needs the ecs images loaded by sweepEcr
+func (am *AwsMarker) recheckEcr(id *string) (bool, bool, error) {
+	result, err := am.getEcrSession().DescribeRepositoriesWithContext(am.Ctx, &ecr.DescribeRepositoriesInput{
+		RepositoryNames: []*string{id},
+	})
+	if hasErrorCode(err, ecr.ErrCodeRepositoryNotFoundException) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	for _, r := range result.Repositories {
+		return filterableCandidate(am.ecrFilterable(r))
+	}
+	return false, false, nil
+}
+
+// sweepEcr deletes a repository with whatever images are still in it
+func (am *AwsMarker) sweepEcr() error {
+	svc := am.getEcrSession()
+
+	owners, err := am.Cache.ReadOwners()
+	if err != nil {
+		return err
+	}
+	// a repository that a task started using during the grace period is in use again
+	if err := am.loadEcsImages(); err != nil {
+		am.Logger.Warnf("Couldn't list ecs images, leaving ecr repositories for the next sweep: %v", err)
+		return nil
+	}
+
+	for _, o := range owners {
+		toDelete := am.recheck(am.toDelete(o, "ecr"), am.recheckEcr)
+		am.Logger.Debug("DryRun? ", !am.Config.DeleteEnabled)
+		for _, r := range toDelete {
+			if !am.Config.DeleteEnabled {
+				am.Logger.Warnf("would delete %s but we're in DryRun", *r)
+				am.swept("ecr", *r, true)
+				continue
+			}
+			_, err := svc.DeleteRepositoryWithContext(am.Ctx, &ecr.DeleteRepositoryInput{
+				RepositoryName: r,
+				Force:          aws.Bool(true),
+			})
+			if isCanceled(err) {
+				return err
+			}
+			if err != nil && !hasErrorCode(err, ecr.ErrCodeRepositoryNotFoundException) {
+				if isThrottle(err) {
+					am.Logger.Warn(err)
+				} else {
+					am.Logger.Error(err)
+				}
+				continue
+			}
+			if err == nil {
+				am.swept("ecr", *r, false)
+			}
+			err = mark.RemoveCandidates(am.Cache, []string{am.candidateKey(*r)})
+			if err != nil {
+				am.Logger.Error(err)
+			}
+		}
+	}
+	return nil
+}
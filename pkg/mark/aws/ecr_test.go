@@ -0,0 +1,122 @@
+package aws
+
+import (
+	"encoding/json"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeContainers answers ecs and ecr json requests.  one cluster runs a service from serviceImage and a task
+// from taskImage, and repositories are keyed by name.  every repository deleted is recorded.
+type fakeContainers struct {
+	mux          sync.Mutex
+	serviceImage string
+	taskImage    string
+	repositories map[string]bool
+	deleted      []string
+}
+
+func (fc *fakeContainers) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fc.mux.Lock()
+	defer fc.mux.Unlock()
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	target := r.Header.Get("X-Amz-Target")
+	switch target[strings.Index(target, ".")+1:] {
+	case "ListClusters":
+		w.Write([]byte(`{"clusterArns":["arn:aws:ecs:us-west-2:1:cluster/dev"]}`)) //nolint
+	case "ListServices":
+		w.Write([]byte(`{"serviceArns":["arn:aws:ecs:us-west-2:1:service/dev/api"]}`)) //nolint
+	case "DescribeServices":
+		w.Write([]byte(`{"services":[{"taskDefinition":"api:2","deployments":[{"taskDefinition":"api:2"}]}]}`)) //nolint
+	case "ListTasks":
+		w.Write([]byte(`{"taskArns":["arn:aws:ecs:us-west-2:1:task/dev/1"]}`)) //nolint
+	case "DescribeTasks":
+		w.Write([]byte(`{"tasks":[{"taskDefinitionArn":"job:1"}]}`)) //nolint
+	case "DescribeTaskDefinition":
+		image := fc.taskImage
+		if body["taskDefinition"] == "api:2" {
+			image = fc.serviceImage
+		}
+		w.Write([]byte(`{"taskDefinition":{"containerDefinitions":[{"image":"` + image + `"}]}}`)) //nolint
+	case "DescribeRepositories":
+		repositories := []string{}
+		for _, n := range body["repositoryNames"].([]interface{}) {
+			if fc.repositories[n.(string)] {
+				repositories = append(repositories, `{"repositoryName":"`+n.(string)+`","repositoryArn":"arn:aws:ecr:us-west-2:1:repository/`+n.(string)+`","repositoryUri":"1.dkr.ecr.us-west-2.amazonaws.com/`+n.(string)+`"}`)
+			}
+		}
+		w.Write([]byte(`{"repositories":[` + strings.Join(repositories, ",") + `]}`)) //nolint
+	case "ListTagsForResource":
+		w.Write([]byte(`{"tags":[]}`)) //nolint
+	case "DeleteRepository":
+		name := body["repositoryName"].(string)
+		fc.deleted = append(fc.deleted, name)
+		delete(fc.repositories, name)
+		w.Write([]byte(`{}`)) //nolint
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestSweepEcrSkipsInUse(t *testing.T) {
+	fc := &fakeContainers{
+		serviceImage: "1.dkr.ecr.us-west-2.amazonaws.com/api:v2",
+		taskImage:    "1.dkr.ecr.us-west-2.amazonaws.com/team/job@sha256:abc",
+		repositories: map[string]bool{"api": true, "team/job": true, "stale": true},
+	}
+	srv := httptest.NewServer(fc)
+	defer srv.Close()
+	am := newTestAwsMarker(t, &config.Aws{Name: "dev", DeleteEnabled: true}, srv.URL)
+	writeTestCandidates(t, am, "ecr", "api", "team/job", "stale", "gone")
+
+	assert.Nil(t, am.sweepEcr())
+	assert.Equal(t, []string{"stale"}, fc.deleted)
+	for _, id := range []string{"api", "team/job", "stale", "gone"} {
+		assert.False(t, am.Cache.CandidateExists(am.candidateKey(id)), id)
+	}
+}
+
+func TestSweepEcrDryRun(t *testing.T) {
+	fc := &fakeContainers{repositories: map[string]bool{"stale": true}}
+	srv := httptest.NewServer(fc)
+	defer srv.Close()
+	am := newTestAwsMarker(t, &config.Aws{Name: "dev"}, srv.URL)
+	writeTestCandidates(t, am, "ecr", "stale")
+
+	assert.Nil(t, am.sweepEcr())
+	assert.Empty(t, fc.deleted)
+	assert.True(t, am.Cache.CandidateExists(am.candidateKey("stale")))
+}
+
+func TestImageRepository(t *testing.T) {
+	for image, expected := range map[string]string{
+		"1.dkr.ecr.us-west-2.amazonaws.com/api":                 "1.dkr.ecr.us-west-2.amazonaws.com/api",
+		"1.dkr.ecr.us-west-2.amazonaws.com/api:v2":              "1.dkr.ecr.us-west-2.amazonaws.com/api",
+		"1.dkr.ecr.us-west-2.amazonaws.com/team/job@sha256:abc": "1.dkr.ecr.us-west-2.amazonaws.com/team/job",
+		"1.dkr.ecr.us-west-2.amazonaws.com/api:v2@sha256:abc":   "1.dkr.ecr.us-west-2.amazonaws.com/api",
+		"registry.local:5000/api":                               "registry.local:5000/api",
+		"registry.local:5000/api:latest":                        "registry.local:5000/api",
+	} {
+		assert.Equal(t, expected, imageRepository(image), image)
+	}
+}
+
+func TestEcrIgnoreInUseFilter(t *testing.T) {
+	entry := logrus.NewEntry(log)
+	am := &AwsMarker{ecsImages: map[string]bool{"1.dkr.ecr.us-west-2.amazonaws.com/api": true}}
+	assert.True(t, am.EcrIgnoreInUseFilter(&ecr.Repository{RepositoryName: aws.String("api"), RepositoryUri: aws.String("1.dkr.ecr.us-west-2.amazonaws.com/api")}, entry))
+	assert.False(t, am.EcrIgnoreInUseFilter(&ecr.Repository{RepositoryName: aws.String("stale"), RepositoryUri: aws.String("1.dkr.ecr.us-west-2.amazonaws.com/stale")}, entry))
+}
@@ -0,0 +1,92 @@
+package aws
+
+import (
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func (am *AwsMarker) markEip() error {
+	svc := am.getEc2Session()
+
+	// addresses don't page
+	result, err := svc.DescribeAddressesWithContext(am.Ctx, &ec2.DescribeAddressesInput{
+		Filters: []*ec2.Filter{{Name: aws.String("domain"), Values: []*string{aws.String(ec2.DomainTypeVpc)}}},
+	})
+	if isThrottle(err) {
+		am.skip("elastic ips", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, a := range result.Addresses {
+		am.FilterAwsObject(am.eipFilterable(a))
+	}
+	return nil
+}
+
+func (am *AwsMarker) eipFilterable(a *ec2.Address) *awsFilterable {
+	return am.newAwsFilterable(a).
+		WithIgnoreFilter(am.IgnoreConfigFilter).
+		WithTypedIgnoreFilter(EipIgnoreAssociatedFilter).
+		WithComplianceFilter(NoTagFilter).
+		WithComplianceFilter(am.NoTTLTagFilter).
+		WithComplianceFilter(am.TTLTagExpiredFilter)
+}
+
+func (am *AwsMarker) recheckEip(id *string) (bool, bool, error) {
+	result, err := am.getEc2Session().DescribeAddressesWithContext(am.Ctx, &ec2.DescribeAddressesInput{
+		Filters: []*ec2.Filter{{Name: aws.String("allocation-id"), Values: []*string{id}}},
+	})
+	if err != nil {
+		return false, false, err
+	}
+	for _, a := range result.Addresses {
+		return filterableCandidate(am.eipFilterable(a))
+	}
+	return false, false, nil
+}
+
+func (am *AwsMarker) sweepEip() error {
+	svc := am.getEc2Session()
+
+	owners, err := am.Cache.ReadOwners()
+	if err != nil {
+		return err
+	}
+
+	for _, o := range owners {
+		toDelete := am.recheck(am.toDelete(o, "eip"), am.recheckEip)
+		am.Logger.Debug("DryRun? ", !am.Config.DeleteEnabled)
+		for _, a := range toDelete {
+			_, err := svc.ReleaseAddressWithContext(am.Ctx, &ec2.ReleaseAddressInput{
+				AllocationId: a,
+				DryRun:       aws.Bool(!am.Config.DeleteEnabled),
+			})
+			if isCanceled(err) {
+				return err
+			}
+			if awsErr, ok := err.(awserr.Error); ok {
+				if awsErr.Code() == "DryRunOperation" {
+					am.Logger.Warnf("Would have released %s but we're in DryRun", *a)
+					am.swept("eip", *a, true)
+					continue
+				}
+				if isThrottle(awsErr) {
+					am.Logger.Warn(err)
+					continue
+				}
+				am.Logger.Error(awsErr)
+			} else if err == nil {
+				am.swept("eip", *a, false)
+			}
+			err = mark.RemoveCandidates(am.Cache, []string{am.candidateKey(*a)})
+			if err != nil {
+				am.Logger.Error(err)
+			}
+		}
+	}
+	return nil
+}
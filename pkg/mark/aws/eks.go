@@ -1,13 +1,12 @@
 package aws
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/armory-io/bilgepump/pkg/metrics"
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/eks"
-	"github.com/prometheus/common/model"
-	"time"
 )
 
 func (am *AwsMarker) markEks() error {
@@ -18,104 +17,112 @@ func (am *AwsMarker) markEks() error {
 	return nil
 }
 
-func (am *AwsMarker) getEksClusters() []*eks.DescribeClusterOutput {
+func (am *AwsMarker) getEksClusters() ([]*eks.DescribeClusterOutput, error) {
 	svc := am.getEksSession()
 
 	var clusters []*string
-	cx, err := svc.ListClustersWithContext(am.Ctx, nil)
+	err := svc.ListClustersPagesWithContext(am.Ctx, &eks.ListClustersInput{}, func(page *eks.ListClustersOutput, lastPage bool) bool {
+		clusters = append(clusters, page.Clusters...)
+		return page.NextToken != nil
+	})
 	if err != nil {
-		return nil
+		return nil, err
 	}
 
-	clusters = append(clusters, cx.Clusters...)
-
-	for cx.NextToken != nil {
-		in := &eks.ListClustersInput{
-			NextToken: cx.NextToken,
-		}
-		cx, err := svc.ListClustersWithContext(am.Ctx, in)
-		if err != nil {
-			am.Logger.Error(err)
-			continue
-		}
-		clusters = append(clusters, cx.Clusters...)
-
-	}
-	decodedClusters := make([]*eks.DescribeClusterOutput, len(clusters))
-	for ix, c := range clusters {
+	decodedClusters := []*eks.DescribeClusterOutput{}
+	for _, c := range clusters {
 		in := &eks.DescribeClusterInput{
 			Name: c,
 		}
-		cInfo, err := svc.DescribeCluster(in)
+		cInfo, err := svc.DescribeClusterWithContext(am.Ctx, in)
 		if err != nil {
-			am.Logger.Error(err)
+			if isThrottle(err) {
+				am.skip(fmt.Sprintf("eks cluster %s", *c), err)
+			} else {
+				am.Logger.Error(err)
+			}
 			continue
 		}
-		decodedClusters[ix] = cInfo
+		decodedClusters = append(decodedClusters, cInfo)
 	}
 
-	return decodedClusters
+	return decodedClusters, nil
 }
 
-func (am *AwsMarker) checkEksCluster(i *ec2.Instance, cluster *eks.Cluster) {
+// eksNodeExpired checks the ttl on an instance belonging to a cluster, which stands in for the cluster's
+func (am *AwsMarker) eksNodeExpired(i *ec2.Instance) (bool, string) {
 	id, tags, created, _ := am.ExtractTags(i)
 	tagFilters := []Filter{
-		NoTTLTagFilter,
-		TTLTagExpiredFilter,
+		am.NoTTLTagFilter,
+		am.TTLTagExpiredFilter,
 	}
 	for _, f := range tagFilters {
 		if f(id, tags, created, am.Logger) {
-			err := am.eksTtlRejected(i, cluster)
-			if err != nil {
-				am.Logger.Error(err)
+			return true, mark.FilterName(f)
+		}
+	}
+	return false, ""
+}
+
+func eksClusterTag(name string) string {
+	return fmt.Sprintf("kubernetes.io/cluster/%s", name)
+}
+
+// eksClusterNode returns the first instance that belongs to the cluster and isn't ignored, or nil
+func (am *AwsMarker) eksClusterNode(cluster *eks.Cluster, reservations []*ec2.Reservation) *ec2.Instance {
+	for _, r := range reservations {
+	InstanceList:
+		for _, i := range r.Instances {
+			if Ec2IgnoreTerminatedFilter(i, am.Logger) {
+				continue InstanceList
+			}
+			id, tags, created, _ := am.ExtractTags(i)
+			ignoreFilters := []Filter{
+				am.IgnoreConfigFilter,
+				NoTagFilter,
+			}
+			for _, f := range ignoreFilters {
+				if f(id, tags, created, am.Logger) {
+					continue InstanceList
+				}
+			}
+			// we have tag data, see if we match the eks cluster name
+			for _, t := range i.Tags {
+				if eksClusterTag(*cluster.Name) == *t.Key {
+					am.Logger.Debugf("matched eks cluster: %s", *cluster.Name)
+					return i
+				}
 			}
-			break
 		}
 	}
+	return nil
 }
 
 func (am *AwsMarker) processEksPeekCallback(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
-	clusters := am.getEksClusters()
+	clusters, err := am.getEksClusters()
+	if err != nil {
+		if isThrottle(err) {
+			am.skip("eks cluster pages", err)
+		} else {
+			am.Logger.Error(err)
+		}
+		return false
+	}
 	if len(clusters) == 0 {
 		am.Logger.Warn("No eks clusters to process")
 		return false
 	}
-ClusterList:
 	for _, c := range clusters {
-		if len(page.Reservations) != 0 {
-			for _, r := range page.Reservations {
-				if len(r.Instances) != 0 {
-				InstanceList:
-					for _, i := range r.Instances {
-						if Ec2IgnoreTerminatedFilter(i, am.Logger) {
-							continue InstanceList
-						}
-						id, tags, created, _ := am.ExtractTags(i)
-						ignoreFilters := []Filter{
-							am.IgnoreConfigFilter,
-							NoTagFilter,
-						}
-						for _, f := range ignoreFilters {
-							if f(id, tags, created, am.Logger) {
-								continue InstanceList
-							}
-						}
-						// we have tag data, see if we match the eks cluster name
-						for _, t := range i.Tags {
-							if fmt.Sprintf("kubernetes.io/cluster/%s", *c.Cluster.Name) == *t.Key {
-								// we matched a cluster, dawg
-								am.Logger.Debugf("matched eks cluster: %s", *c.Cluster.Name)
-								// process the cluster TTLs
-								am.checkEksCluster(i, c.Cluster)
-								continue ClusterList
-							}
-						}
-					}
-				}
+		node := am.eksClusterNode(c.Cluster, page.Reservations)
+		// a cluster without a node to take the ttl from isn't to spec, flag it for sweep
+		reason := "NoClusterNode"
+		if node != nil {
+			var expired bool
+			if expired, reason = am.eksNodeExpired(node); !expired {
+				continue
 			}
 		}
-		// if we get here in the ClusterList it isn't to spec, flag it for sweep
-		err := am.eksTtlRejected(nil, c.Cluster)
+		err := am.eksTtlRejected(node, c.Cluster, reason)
 		if err != nil {
 			am.Logger.Error(err)
 		}
@@ -123,56 +130,63 @@ ClusterList:
 	return page.NextToken != nil
 }
 
-func (am *AwsMarker) eksTtlRejected(i *ec2.Instance, cluster *eks.Cluster) error {
-	gp, _ := model.ParseDuration(am.Config.GracePeriod) // already checked this in config
-	marked := &mark.MarkedCandidate{}
-	var owner string
+func (am *AwsMarker) eksTtlRejected(i *ec2.Instance, cluster *eks.Cluster, reason string) error {
+	marked := &mark.MarkedCandidate{
+		MarkerType:    mark.AWS,
+		CandidateType: "eks",
+		Id:            *cluster.Name,
+		Account:       am.Config.Name,
+		Region:        am.region,
+		Reason:        reason,
+	}
 	if i != nil {
 		_, tags, _, _ := am.ExtractTags(i)
-		owner := tagOrNil("owner", tags)
 		extraTags := map[string]string{}
 		if len(i.Tags) != 0 {
 			for _, t := range i.Tags {
 				extraTags[*t.Key] = *t.Value
 			}
 		}
-		marked.MarkerType = mark.AWS
-		marked.CandidateType = "eks"
-		marked.Id = *cluster.Name
-		marked.Owner = owner
-		marked.Purpose = tagOrNil("purpose", tags)
-		marked.Ttl = tagOrNil("ttl", tags)
-	} else {
-		marked.MarkerType = mark.AWS
-		marked.CandidateType = "eks"
-		marked.Id = *cluster.Name
-		marked.Owner = ""
-	}
-	mjson, err := json.Marshal(marked)
+		keys := am.tagKeys()
+		marked.Owner = firstTagOrNil(keys.Owner, tags)
+		marked.Purpose = firstTagOrNil(keys.Purpose, tags)
+		marked.Ttl = firstTagOrNil(keys.Ttl, tags)
+		marked.Tags = extraTags
+	}
+	written, err := mark.WriteCandidate(am.Cache, marked, am.Config.GracePeriod)
 	if err != nil {
 		return err
 	}
-	if am.Cache.CandidateExists(owner, string(mjson)) {
-		am.Logger.Debugf("EKS Cluster: %s already exists in cache, skip", *cluster.Name)
-		return nil
+	if written {
+		am.count(metrics.CandidatesMarked, "eks")
 	}
-	// owner index update
-	err = am.Cache.Write("bilge:owners", owner)
-	if err != nil {
-		return err
+	return nil
+}
+
+func (am *AwsMarker) recheckEks(id *string) (bool, bool, error) {
+	result, err := am.getEksSession().DescribeClusterWithContext(am.Ctx, &eks.DescribeClusterInput{Name: id})
+	if hasErrorCode(err, eks.ErrCodeResourceNotFoundException) {
+		return false, false, nil
 	}
-	// write candidate by owner
-	err = am.Cache.Write(fmt.Sprintf("bilge:candidates:%s", owner), string(mjson))
 	if err != nil {
-		return err
-	}
-	// write an expiring key with our grace period
-	err = am.Cache.WriteTimer(fmt.Sprintf("bilge:timers:%s", *cluster.Name),
-		am.Config.GracePeriod, time.Now().Local().Add(time.Duration(gp)))
+		return false, false, err
+	}
+	reservations := []*ec2.Reservation{}
+	err = am.getEc2Session().DescribeInstancesPagesWithContext(am.Ctx, &ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{{Name: aws.String("tag-key"), Values: []*string{aws.String(eksClusterTag(*id))}}},
+	}, func(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
+		reservations = append(reservations, page.Reservations...)
+		return page.NextToken != nil
+	})
 	if err != nil {
-		return err
+		return false, false, err
 	}
-	return nil
+	node := am.eksClusterNode(result.Cluster, reservations)
+	if node == nil {
+		return true, true, nil
+	}
+	expired, _ := am.eksNodeExpired(node)
+	return expired, true, nil
 }
 
 func (am *AwsMarker) sweepEks() error {
@@ -184,7 +198,7 @@ func (am *AwsMarker) sweepEks() error {
 	}
 
 	for _, o := range owners {
-		toDelete := am.toDelete(o, "eks")
+		toDelete := am.recheck(am.toDelete(o, "eks"), am.recheckEks)
 		am.Logger.Debug("DryRun? ", !am.Config.DeleteEnabled)
 		if len(toDelete) != 0 {
 			for _, c := range toDelete {
@@ -192,17 +206,22 @@ func (am *AwsMarker) sweepEks() error {
 					Name: c,
 				}
 				if am.Config.DeleteEnabled {
-					_, err := svc.DeleteCluster(indel)
+					_, err := svc.DeleteClusterWithContext(am.Ctx, indel)
+					if isCanceled(err) {
+						return err
+					}
 					if err != nil {
 						am.Logger.Error(err)
 						continue
 					}
-					err = mark.RemoveCandidates(o, am.Cache, []*string{c})
+					am.swept("eks", *c, false)
+					err = mark.RemoveCandidates(am.Cache, []string{am.candidateKey(*c)})
 					if err != nil {
 						am.Logger.Error(err)
 					}
 				} else {
 					am.Logger.Warnf("would delete %s but we're in DryRun", *c)
+					am.swept("eks", *c, true)
 					continue
 				}
 			}
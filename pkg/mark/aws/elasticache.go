@@ -9,26 +9,19 @@ import (
 func (am *AwsMarker) markElasticache() error {
 	svc := am.getECSession()
 
-	err := svc.DescribeCacheClustersPages(nil, am.processECMarkPages)
-	if serr, ok := err.(awserr.Error); ok {
-		if serr.Code() == "Throttling" {
-			am.Logger.Warn(err)
-		} else {
-			return err
-		}
+	err := svc.DescribeCacheClustersPagesWithContext(am.Ctx, nil, am.processECMarkPages)
+	if isThrottle(err) {
+		am.skip("elasticache cluster pages", err)
+		return nil
 	}
-	return nil
+	return err
 }
 
 func (am *AwsMarker) processECMarkPages(page *elasticache.DescribeCacheClustersOutput, lastPage bool) bool {
 
 	if len(page.CacheClusters) != 0 {
 		for _, cc := range page.CacheClusters {
-			am.FilterAwsObject(am.newAwsFilterable(cc).
-				WithIgnoreFilter(am.IgnoreConfigFilter).
-				WithComplianceFilter(NoTagFilter).
-				WithComplianceFilter(NoTTLTagFilter).
-				WithComplianceFilter(TTLTagExpiredFilter))
+			am.FilterAwsObject(am.ecFilterable(cc))
 		}
 	}
 	if page.Marker != nil {
@@ -37,6 +30,30 @@ func (am *AwsMarker) processECMarkPages(page *elasticache.DescribeCacheClustersO
 	return false
 }
 
+func (am *AwsMarker) ecFilterable(cc *elasticache.CacheCluster) *awsFilterable {
+	return am.newAwsFilterable(cc).
+		WithIgnoreFilter(am.IgnoreConfigFilter).
+		WithComplianceFilter(NoTagFilter).
+		WithComplianceFilter(am.NoTTLTagFilter).
+		WithComplianceFilter(am.TTLTagExpiredFilter)
+}
+
+func (am *AwsMarker) recheckElasticache(id *string) (bool, bool, error) {
+	result, err := am.getECSession().DescribeCacheClustersWithContext(am.Ctx, &elasticache.DescribeCacheClustersInput{
+		CacheClusterId: id,
+	})
+	if hasErrorCode(err, elasticache.ErrCodeCacheClusterNotFoundFault) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	for _, cc := range result.CacheClusters {
+		return filterableCandidate(am.ecFilterable(cc))
+	}
+	return false, false, nil
+}
+
 func (am *AwsMarker) sweepElasticache() error {
 	svc := am.getECSession()
 
@@ -46,7 +63,7 @@ func (am *AwsMarker) sweepElasticache() error {
 	}
 
 	for _, o := range owners {
-		toDelete := am.toDelete(o, "ec")
+		toDelete := am.recheck(am.toDelete(o, "ec"), am.recheckElasticache)
 
 		am.Logger.Debug("DryRun? ", !am.Config.DeleteEnabled)
 		if len(toDelete) != 0 {
@@ -55,19 +72,26 @@ func (am *AwsMarker) sweepElasticache() error {
 					input := &elasticache.DeleteCacheClusterInput{
 						CacheClusterId: cc,
 					}
-					_, err := svc.DeleteCacheCluster(input)
+					_, err := svc.DeleteCacheClusterWithContext(am.Ctx, input)
+					if isCanceled(err) {
+						return err
+					}
 					if awsErr, ok := err.(awserr.Error); ok {
-						if awsErr.Code() == "Throttling" {
+						if isThrottle(awsErr) {
 							am.Logger.Warn(err)
 						} else {
 							am.Logger.Error(err)
 							continue
 						}
+					} else if err == nil {
+						am.swept("ec", *cc, false)
 					}
-					err = mark.RemoveCandidates(o, am.Cache, []*string{cc})
+					err = mark.RemoveCandidates(am.Cache, []string{am.candidateKey(*cc)})
 					if err != nil {
 						am.Logger.Error(err)
 					}
+				} else {
+					am.swept("ec", *cc, true)
 				}
 			}
 		}
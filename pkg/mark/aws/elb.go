@@ -9,27 +9,19 @@ import (
 func (am *AwsMarker) markElb() error {
 	svc := am.getElbSession()
 
-	err := svc.DescribeLoadBalancersPages(nil, am.processElbMarkPages)
-	if serr, ok := err.(awserr.Error); ok {
-		if serr.Code() == "Throttling" {
-			am.Logger.Warn(err)
-		} else {
-			return err
-		}
+	err := svc.DescribeLoadBalancersPagesWithContext(am.Ctx, nil, am.processElbMarkPages)
+	if isThrottle(err) {
+		am.skip("elb pages", err)
+		return nil
 	}
-	return nil
+	return err
 }
 
 func (am *AwsMarker) processElbMarkPages(page *elb.DescribeLoadBalancersOutput, lastPage bool) bool {
 
 	if len(page.LoadBalancerDescriptions) != 0 {
 		for _, lb := range page.LoadBalancerDescriptions {
-			am.FilterAwsObject(am.newAwsFilterable(lb).
-				WithIgnoreFilter(am.IgnoreConfigFilter).
-				WithIgnoreFilter(IgnoreK8sTagFilter).
-				WithComplianceFilter(NoTagFilter).
-				WithComplianceFilter(NoTTLTagFilter).
-				WithComplianceFilter(TTLTagExpiredFilter))
+			am.FilterAwsObject(am.elbFilterable(lb))
 		}
 	}
 
@@ -39,6 +31,31 @@ func (am *AwsMarker) processElbMarkPages(page *elb.DescribeLoadBalancersOutput,
 	return false
 }
 
+func (am *AwsMarker) elbFilterable(lb *elb.LoadBalancerDescription) *awsFilterable {
+	return am.newAwsFilterable(lb).
+		WithIgnoreFilter(am.IgnoreConfigFilter).
+		WithIgnoreFilter(IgnoreK8sTagFilter).
+		WithComplianceFilter(NoTagFilter).
+		WithComplianceFilter(am.NoTTLTagFilter).
+		WithComplianceFilter(am.TTLTagExpiredFilter)
+}
+
+func (am *AwsMarker) recheckElb(id *string) (bool, bool, error) {
+	result, err := am.getElbSession().DescribeLoadBalancersWithContext(am.Ctx, &elb.DescribeLoadBalancersInput{
+		LoadBalancerNames: []*string{id},
+	})
+	if hasErrorCode(err, elb.ErrCodeAccessPointNotFoundException) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	for _, lb := range result.LoadBalancerDescriptions {
+		return filterableCandidate(am.elbFilterable(lb))
+	}
+	return false, false, nil
+}
+
 func (am *AwsMarker) sweepElb() error {
 	svc := am.getElbSession()
 
@@ -48,7 +65,7 @@ func (am *AwsMarker) sweepElb() error {
 	}
 
 	for _, o := range owners {
-		toDelete := am.toDelete(o, "elb")
+		toDelete := am.recheck(am.toDelete(o, "elb"), am.recheckElb)
 
 		am.Logger.Debug("DryRun? ", !am.Config.DeleteEnabled)
 		if len(toDelete) != 0 {
@@ -57,18 +74,25 @@ func (am *AwsMarker) sweepElb() error {
 					input := &elb.DeleteLoadBalancerInput{
 						LoadBalancerName: lb,
 					}
-					_, err := svc.DeleteLoadBalancer(input)
+					_, err := svc.DeleteLoadBalancerWithContext(am.Ctx, input)
+					if isCanceled(err) {
+						return err
+					}
 					if awsErr, ok := err.(awserr.Error); ok {
-						if awsErr.Code() == "Throttling" {
+						if isThrottle(awsErr) {
 							am.Logger.Warn(err)
 						} else {
 							am.Logger.Error(err)
 						}
+					} else if err == nil {
+						am.swept("elb", *lb, false)
 					}
-					err = mark.RemoveCandidates(o, am.Cache, []*string{lb})
+					err = mark.RemoveCandidates(am.Cache, []string{am.candidateKey(*lb)})
 					if err != nil {
 						am.Logger.Error(err)
 					}
+				} else {
+					am.swept("elb", *lb, true)
 				}
 			}
 		}
@@ -0,0 +1,112 @@
+package aws
+
+import (
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func (am *AwsMarker) markEni() error {
+	svc := am.getEc2Session()
+
+	err := svc.DescribeNetworkInterfacesPagesWithContext(am.Ctx, &ec2.DescribeNetworkInterfacesInput{}, am.processEniMarkPages)
+	if isThrottle(err) {
+		am.skip("network interface pages", err)
+		return nil
+	}
+	return err
+}
+
+func (am *AwsMarker) processEniMarkPages(page *ec2.DescribeNetworkInterfacesOutput, lastPage bool) bool {
+	for _, eni := range page.NetworkInterfaces {
+		am.FilterAwsObject(am.eniFilterable(eni))
+	}
+	return page.NextToken != nil
+}
+
+func (am *AwsMarker) eniFilterable(eni *ec2.NetworkInterface) *awsFilterable {
+	return am.newAwsFilterable(eni).
+		WithIgnoreFilter(am.IgnoreConfigFilter).
+		WithIgnoreFilter(IgnoreK8sTagFilter).
+		WithTypedIgnoreFilter(EniIgnoreInUseFilter).
+		WithTypedIgnoreFilter(EniIgnoreRequesterManagedFilter).
+		WithComplianceFilter(NoTagFilter).
+		WithComplianceFilter(am.NoTTLTagFilter).
+		WithComplianceFilter(am.TTLTagExpiredFilter)
+}
+
+func (am *AwsMarker) recheckEni(id *string) (bool, bool, error) {
+	result, err := am.getEc2Session().DescribeNetworkInterfacesWithContext(am.Ctx, &ec2.DescribeNetworkInterfacesInput{
+		Filters: []*ec2.Filter{{Name: aws.String("network-interface-id"), Values: []*string{id}}},
+	})
+	if err != nil {
+		return false, false, err
+	}
+	for _, eni := range result.NetworkInterfaces {
+		return filterableCandidate(am.eniFilterable(eni))
+	}
+	return false, false, nil
+}
+
+// getEniSgList covers everything that puts an interface in a vpc, lambdas, rds and ecs tasks included.
+// detached interfaces count too, a group can't be deleted while any interface has it.
+func (am *AwsMarker) getEniSgList() (map[string]bool, error) {
+	svc := am.getEc2Session()
+
+	eniSgs := make(map[string]bool)
+	err := svc.DescribeNetworkInterfacesPagesWithContext(am.Ctx, &ec2.DescribeNetworkInterfacesInput{}, func(page *ec2.DescribeNetworkInterfacesOutput, lastPage bool) bool {
+		for _, eni := range page.NetworkInterfaces {
+			for _, sg := range eni.Groups {
+				eniSgs[*sg.GroupId] = true
+			}
+		}
+		return page.NextToken != nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return eniSgs, nil
+}
+
+func (am *AwsMarker) sweepEni() error {
+	svc := am.getEc2Session()
+
+	owners, err := am.Cache.ReadOwners()
+	if err != nil {
+		return err
+	}
+
+	for _, o := range owners {
+		toDelete := am.recheck(am.toDelete(o, "eni"), am.recheckEni)
+		am.Logger.Debug("DryRun? ", !am.Config.DeleteEnabled)
+		for _, eni := range toDelete {
+			_, err := svc.DeleteNetworkInterfaceWithContext(am.Ctx, &ec2.DeleteNetworkInterfaceInput{
+				NetworkInterfaceId: eni,
+				DryRun:             aws.Bool(!am.Config.DeleteEnabled),
+			})
+			if isCanceled(err) {
+				return err
+			}
+			if awsErr, ok := err.(awserr.Error); ok {
+				if awsErr.Code() == "DryRunOperation" {
+					am.Logger.Warnf("Would have deleted %s but we're in DryRun", *eni)
+					am.swept("eni", *eni, true)
+					continue
+				}
+				if isThrottle(awsErr) {
+					am.Logger.Warn(err)
+					continue
+				}
+				am.Logger.Error(awsErr)
+			} else if err == nil {
+				am.swept("eni", *eni, false)
+			}
+			err = mark.RemoveCandidates(am.Cache, []string{am.candidateKey(*eni)})
+			if err != nil {
+				am.Logger.Error(err)
+			}
+		}
+	}
+	return nil
+}
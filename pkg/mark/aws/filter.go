@@ -3,36 +3,54 @@ package aws
 import (
 	"fmt"
 	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/armory-io/bilgepump/pkg/metrics"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/autoscaling"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ecr"
 	"github.com/aws/aws-sdk-go/service/elasticache"
 	"github.com/aws/aws-sdk-go/service/elb"
 	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/rds"
 	"github.com/sirupsen/logrus"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 )
 
 type genericAwsFilter interface {
+	Err() error
 	Ignore() bool
 	Compliant() bool
 	GetTypeString() string
 	GetTypeInterface() interface{}
+	// the filter that made the last Ignore or Compliant call return what it did
+	Reason() string
 }
 
 func (am *AwsMarker) FilterAwsObject(filterable genericAwsFilter) {
+	// without its tags we can't tell whether an object complies, so leave it for the next pass
+	if err := filterable.Err(); err != nil {
+		if isThrottle(err) {
+			am.skip(fmt.Sprintf("%s tags", filterable.GetTypeString()), err)
+		} else {
+			am.Logger.Error(err)
+		}
+		return
+	}
+	am.inventory.Add(am.inventoryScope(filterable.GetTypeString()))
 	if filterable.Ignore() {
-		err := am.filterableUpdate(filterable.GetTypeInterface(), filterable.GetTypeString())
+		am.count(metrics.CandidatesIgnored, filterable.GetTypeString())
+		err := am.filterableUpdate(filterable.GetTypeInterface(), filterable.GetTypeString(), filterable.Reason())
 		if err != nil {
 			am.Logger.Error(err)
 		}
 		return
 	}
 	if !filterable.Compliant() {
-		err := am.ttlRejected(filterable.GetTypeInterface(), filterable.GetTypeString())
+		err := am.ttlRejected(filterable.GetTypeInterface(), filterable.GetTypeString(), filterable.Reason())
 		if err != nil {
 			am.Logger.Error(err)
 		}
@@ -50,10 +68,12 @@ type awsFilterable struct {
 	log                    *logrus.Entry
 	awsObjectType          string
 	object                 interface{}
+	err                    error
+	reason                 string
 }
 
 func (am *AwsMarker) newAwsFilterable(i interface{}) *awsFilterable {
-	id, tags, created, t := am.ExtractTags(i)
+	id, tags, created, t, err := am.extractTags(i)
 	return &awsFilterable{
 		id:            id,
 		tags:          tags,
@@ -61,17 +81,24 @@ func (am *AwsMarker) newAwsFilterable(i interface{}) *awsFilterable {
 		log:           am.Logger,
 		awsObjectType: t,
 		object:        i,
+		err:           err,
 	}
 }
 
+func (e *awsFilterable) Err() error {
+	return e.err
+}
+
 func (e *awsFilterable) Ignore() bool {
 	for _, f := range e.ignoreFilters {
 		if f(e.id, e.tags, e.created, e.log) {
+			e.reason = mark.FilterName(f)
 			return true
 		}
 	}
 	for _, f := range e.typedIgnoreFilters {
 		if f(e.object, e.log) {
+			e.reason = mark.FilterName(f)
 			return true
 		}
 	}
@@ -81,17 +108,23 @@ func (e *awsFilterable) Ignore() bool {
 func (e *awsFilterable) Compliant() bool {
 	for _, f := range e.complianceFilters {
 		if f(e.id, e.tags, e.created, e.log) {
+			e.reason = mark.FilterName(f)
 			return false
 		}
 	}
 	for _, f := range e.typedComplianceFilters {
 		if f(e.object, e.log) {
+			e.reason = mark.FilterName(f)
 			return false
 		}
 	}
 	return true
 }
 
+func (e *awsFilterable) Reason() string {
+	return e.reason
+}
+
 func (e *awsFilterable) GetTypeString() string {
 	return e.awsObjectType
 }
@@ -121,7 +154,7 @@ func (e *awsFilterable) WithTypedComplianceFilter(f TypedFilter) *awsFilterable
 }
 
 /* Normalize ELB tags into EC2 Tags */
-func (am *AwsMarker) extractElbTags(e *elb.LoadBalancerDescription) []*ec2.Tag {
+func (am *AwsMarker) extractElbTags(e *elb.LoadBalancerDescription) ([]*ec2.Tag, error) {
 	svc := am.getElbSession()
 
 	input := &elb.DescribeTagsInput{
@@ -129,14 +162,9 @@ func (am *AwsMarker) extractElbTags(e *elb.LoadBalancerDescription) []*ec2.Tag {
 			e.LoadBalancerName,
 		},
 	}
-	elbtags, err := svc.DescribeTags(input)
-	if serr, ok := err.(awserr.Error); ok {
-		if serr.Code() == "Throttling" {
-			am.Logger.Warn(err)
-		} else {
-			am.Logger.Error(err)
-			return nil
-		}
+	elbtags, err := svc.DescribeTagsWithContext(am.Ctx, input)
+	if err != nil {
+		return nil, err
 	}
 	// normalize elb tags into ec2 tags.  they're the same format.
 	ec2Tags := []*ec2.Tag{}
@@ -153,11 +181,11 @@ func (am *AwsMarker) extractElbTags(e *elb.LoadBalancerDescription) []*ec2.Tag {
 			}
 		}
 	}
-	return ec2Tags
+	return ec2Tags, nil
 }
 
 /* Normalize ALB tags into EC2 Tags */
-func (am *AwsMarker) extractAlbTags(e *elbv2.LoadBalancer) []*ec2.Tag {
+func (am *AwsMarker) extractAlbTags(e *elbv2.LoadBalancer) ([]*ec2.Tag, error) {
 	svc := am.getElbV2Session()
 
 	input := &elbv2.DescribeTagsInput{
@@ -165,14 +193,9 @@ func (am *AwsMarker) extractAlbTags(e *elbv2.LoadBalancer) []*ec2.Tag {
 			e.LoadBalancerArn,
 		},
 	}
-	elbtags, err := svc.DescribeTags(input)
-	if serr, ok := err.(awserr.Error); ok {
-		if serr.Code() == "Throttling" {
-			am.Logger.Warn(err)
-		} else {
-			am.Logger.Error(err)
-			return nil
-		}
+	elbtags, err := svc.DescribeTagsWithContext(am.Ctx, input)
+	if err != nil {
+		return nil, err
 	}
 	// normalize elb tags into ec2 tags.  they're the same format.
 	ec2Tags := []*ec2.Tag{}
@@ -189,30 +212,24 @@ func (am *AwsMarker) extractAlbTags(e *elbv2.LoadBalancer) []*ec2.Tag {
 			}
 		}
 	}
-	return ec2Tags
+	return ec2Tags, nil
 }
 
 /* Normalize Elasticache tags into EC2 tags */
-func (am *AwsMarker) extractECTags(ec *elasticache.CacheCluster) []*ec2.Tag {
+func (am *AwsMarker) extractECTags(ec *elasticache.CacheCluster) ([]*ec2.Tag, error) {
 	svc := am.getECSession()
 
-	acctId := am.getAccountId()
-	if acctId == nil {
-		am.Logger.Error("unable to determine account id")
-		return nil
+	acctId, err := am.getAccountId()
+	if err != nil {
+		return nil, err
 	}
-	clusterArn := fmt.Sprintf("arn:aws:elasticache:%s:%s:cluster:%s", am.Config.Region, *acctId, *ec.CacheClusterId)
+	clusterArn := fmt.Sprintf("arn:aws:elasticache:%s:%s:cluster:%s", am.region, *acctId, *ec.CacheClusterId)
 	input := &elasticache.ListTagsForResourceInput{
 		ResourceName: aws.String(clusterArn),
 	}
-	result, err := svc.ListTagsForResource(input)
-	if serr, ok := err.(awserr.Error); ok {
-		if serr.Code() == "Throttling" {
-			am.Logger.Warn(err)
-		} else {
-			am.Logger.Error(err)
-			return nil
-		}
+	result, err := svc.ListTagsForResourceWithContext(am.Ctx, input)
+	if err != nil {
+		return nil, err
 	}
 	ec2Tags := []*ec2.Tag{}
 	if len(result.TagList) != 0 {
@@ -224,16 +241,75 @@ func (am *AwsMarker) extractECTags(ec *elasticache.CacheCluster) []*ec2.Tag {
 			ec2Tags = append(ec2Tags, et)
 		}
 	}
+	return ec2Tags, nil
+}
+
+/* Normalize RDS tags into EC2 tags.  instances and clusters are both looked up by arn */
+func (am *AwsMarker) extractRdsTags(arn *string) ([]*ec2.Tag, error) {
+	svc := am.getRdsSession()
+
+	result, err := svc.ListTagsForResourceWithContext(am.Ctx, &rds.ListTagsForResourceInput{
+		ResourceName: arn,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ec2Tags := []*ec2.Tag{}
+	for _, t := range result.TagList {
+		ec2Tags = append(ec2Tags, &ec2.Tag{
+			Key:   t.Key,
+			Value: t.Value,
+		})
+	}
+	return ec2Tags, nil
+}
+
+/* Normalize Lambda tags into EC2 tags */
+func (am *AwsMarker) extractLambdaTags(arn *string) ([]*ec2.Tag, error) {
+	result, err := am.getLambdaSession().ListTagsWithContext(am.Ctx, &lambda.ListTagsInput{Resource: arn})
+	if err != nil {
+		return nil, err
+	}
+	return mapTags(result.Tags), nil
+}
+
+/* Normalize ECR tags into EC2 tags */
+func (am *AwsMarker) extractEcrTags(arn *string) ([]*ec2.Tag, error) {
+	result, err := am.getEcrSession().ListTagsForResourceWithContext(am.Ctx, &ecr.ListTagsForResourceInput{ResourceArn: arn})
+	if err != nil {
+		return nil, err
+	}
+	ec2Tags := []*ec2.Tag{}
+	for _, t := range result.Tags {
+		ec2Tags = append(ec2Tags, &ec2.Tag{
+			Key:   t.Key,
+			Value: t.Value,
+		})
+	}
+	return ec2Tags, nil
+}
+
+/* Normalize the tag maps lambda and cloudwatch logs return into EC2 tags, sorted by key */
+func mapTags(m map[string]*string) []*ec2.Tag {
+	ec2Tags := []*ec2.Tag{}
+	for k, v := range m {
+		ec2Tags = append(ec2Tags, &ec2.Tag{
+			Key:   aws.String(k),
+			Value: v,
+		})
+	}
+	sort.Slice(ec2Tags, func(i, j int) bool { return *ec2Tags[i].Key < *ec2Tags[j].Key })
 	return ec2Tags
 }
 
 func (am *AwsMarker) extractLcTags(lc *autoscaling.LaunchConfiguration) []*ec2.Tag {
 	ec2Tags := []*ec2.Tag{}
+	keys := am.tagKeys()
 	tagMap := map[int]string{
-		0: "owner",
+		0: keys.Owner[0],
 		1: "version",
 		2: "date",
-		3: "ttl",
+		3: keys.Ttl[0],
 	}
 	// LaunchConfigs don't support tags.  Use a naming convention instead.
 	// format: ${owner}-${version}-${date}-${ttl}
@@ -262,11 +338,19 @@ func (am *AwsMarker) extractAsgTags(asg *autoscaling.Group) []*ec2.Tag {
 	return ec2Tags
 }
 
+// ExtractTags normalizes the id, tags and creation time of anything we mark.  Tags are nil if they had to
+// be looked up and the lookup failed.
 func (am *AwsMarker) ExtractTags(awsObject interface{}) (*string, []*ec2.Tag, *time.Time, string) {
+	id, tags, created, objType, _ := am.extractTags(awsObject)
+	return id, tags, created, objType
+}
+
+func (am *AwsMarker) extractTags(awsObject interface{}) (*string, []*ec2.Tag, *time.Time, string, error) {
 	var id *string
 	var tags []*ec2.Tag
 	var created *time.Time
 	var objType string
+	var err error
 	switch obj := awsObject.(type) {
 	case *ec2.Volume:
 		id = obj.VolumeId
@@ -285,17 +369,17 @@ func (am *AwsMarker) ExtractTags(awsObject interface{}) (*string, []*ec2.Tag, *t
 	case *elb.LoadBalancerDescription:
 		id = obj.LoadBalancerName
 		created = obj.CreatedTime
-		tags = am.extractElbTags(obj)
+		tags, err = am.extractElbTags(obj)
 		objType = "elb"
 	case *elbv2.LoadBalancer:
 		id = obj.LoadBalancerArn
 		created = obj.CreatedTime
-		tags = am.extractAlbTags(obj)
+		tags, err = am.extractAlbTags(obj)
 		objType = "alb"
 	case *elasticache.CacheCluster:
 		id = obj.CacheClusterId
 		created = obj.CacheClusterCreateTime
-		tags = am.extractECTags(obj)
+		tags, err = am.extractECTags(obj)
 		objType = "ec"
 	case *autoscaling.Group:
 		id = obj.AutoScalingGroupName
@@ -307,8 +391,76 @@ func (am *AwsMarker) ExtractTags(awsObject interface{}) (*string, []*ec2.Tag, *t
 		created = obj.CreatedTime
 		tags = am.extractLcTags(obj)
 		objType = "lc"
+	case *ec2.Snapshot:
+		id = obj.SnapshotId
+		tags = obj.Tags
+		created = obj.StartTime
+		objType = "snapshot"
+	case *ec2.Image:
+		id = obj.ImageId
+		tags = obj.Tags
+		created = imageCreated(obj)
+		objType = "ami"
+	case *ec2.Address:
+		id = obj.AllocationId
+		tags = obj.Tags
+		objType = "eip"
+	case *ec2.NatGateway:
+		id = obj.NatGatewayId
+		tags = obj.Tags
+		created = obj.CreateTime
+		objType = "natgw"
+	case *ec2.NetworkInterface:
+		id = obj.NetworkInterfaceId
+		tags = obj.TagSet
+		objType = "eni"
+	case *s3Bucket:
+		id = obj.Name
+		tags = obj.Tags
+		created = obj.CreationDate
+		objType = "s3"
+	case *rds.DBInstance:
+		id = obj.DBInstanceIdentifier
+		created = obj.InstanceCreateTime
+		tags, err = am.extractRdsTags(obj.DBInstanceArn)
+		objType = "rds"
+	case *rds.DBCluster:
+		id = obj.DBClusterIdentifier
+		created = obj.ClusterCreateTime
+		tags, err = am.extractRdsTags(obj.DBClusterArn)
+		objType = "aurora"
+	case *lambda.FunctionConfiguration:
+		// lambda only keeps when a function was last modified, which every deploy resets.  without a creation time
+		// only the expires tag can run out.
+		id = obj.FunctionName
+		tags, err = am.extractLambdaTags(obj.FunctionArn)
+		objType = "lambda"
+	case *ecr.Repository:
+		id = obj.RepositoryName
+		created = obj.CreatedAt
+		tags, err = am.extractEcrTags(obj.RepositoryArn)
+		objType = "ecr"
+	case *logGroup:
+		id = obj.LogGroupName
+		tags = obj.Tags
+		if obj.CreationTime != nil {
+			created = msTime(*obj.CreationTime)
+		}
+		objType = "loggroup"
 	}
-	return id, tags, created, objType
+	return id, tags, created, objType, err
+}
+
+// imageCreated parses an image's creation date, which unlike everything else's is a string
+func imageCreated(i *ec2.Image) *time.Time {
+	if i.CreationDate == nil {
+		return nil
+	}
+	created, err := time.Parse(time.RFC3339, *i.CreationDate)
+	if err != nil {
+		return nil
+	}
+	return &created
 }
 
 /* ----------------- START FILTER ----------------- */
@@ -355,24 +507,39 @@ func NoTagFilter(id *string, tags []*ec2.Tag, created *time.Time, log *logrus.En
 	return false
 }
 
-func NoTTLTagFilter(id *string, tags []*ec2.Tag, created *time.Time, log *logrus.Entry) bool {
-	_, tagExists := checkRequiredTags(mark.REQUIRED_TAG, tags)
-	if !tagExists {
-		log.Infof("Adding AWS candidate: %s, Reason: no ttl tag, Created: %+v", *id, created)
+func (am *AwsMarker) NoTTLTagFilter(id *string, tags []*ec2.Tag, created *time.Time, log *logrus.Entry) bool {
+	keys := am.tagKeys()
+	_, ttlExists := firstTag(keys.Ttl, tags)
+	_, expiresExists := firstTag(keys.Expires, tags)
+	if !ttlExists && !expiresExists {
+		log.Infof("Adding AWS candidate: %s, Reason: no ttl or expires tag, Created: %+v", *id, created)
 		return true
 	}
 	return false
 }
 
-func TTLTagExpiredFilter(id *string, tags []*ec2.Tag, created *time.Time, log *logrus.Entry) bool {
-	tagIndex, _ := checkRequiredTags(mark.REQUIRED_TAG, tags)
-	timeToLive := *tags[tagIndex].Value
-	if timeToLive == "0" {
+// TTLTagExpiredFilter checks the expires tag if there is one, otherwise the ttl from the creation time
+func (am *AwsMarker) TTLTagExpiredFilter(id *string, tags []*ec2.Tag, created *time.Time, log *logrus.Entry) bool {
+	keys := am.tagKeys()
+	timeToLive := firstTagOrNil(keys.Ttl, tags)
+	expires := firstTagOrNil(keys.Expires, tags)
+	if expires == "" && timeToLive == "0" {
 		log.Debugf("Ignoring %s. Reason: Unlimited TTL", *id)
 		return false
 	}
-	if !mark.WithinTTLTime(timeToLive, *created) {
-		log.Infof("Adding AWS candidate: %s, Reason: ttl expired, Created: %+v", *id, created)
+	expiry, err := mark.Expiry(timeToLive, expires, created)
+	if err != nil {
+		log.Infof("Adding AWS candidate: %s, Reason: %v, Created: %+v", *id, err, created)
+		return true
+	}
+	if expiry == nil {
+		if timeToLive != "" {
+			log.Debugf("Unable to determine creation time of %s, skipping ttl check", *id)
+		}
+		return false
+	}
+	if !time.Now().Before(*expiry) {
+		log.Infof("Adding AWS candidate: %s, Reason: expired %v, Created: %+v", *id, expiry, created)
 		return true
 	}
 	return false
@@ -451,4 +618,208 @@ func AsgZeroCapacity(a interface{}, log *logrus.Entry) bool {
 	return true
 }
 
+func (am *AwsMarker) AmiIgnoreInUse(image interface{}, log *logrus.Entry) bool {
+	if i, ok := image.(*ec2.Image); ok {
+		for _, m := range am.amis {
+			if m[*i.ImageId] {
+				log.Debugf("Ignoring %s. Reason: launched from", *i.ImageId)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (am *AwsMarker) SnapshotIgnoreAmiBacked(snapshot interface{}, log *logrus.Entry) bool {
+	if s, ok := snapshot.(*ec2.Snapshot); ok {
+		if images := am.amiSnapshots[*s.SnapshotId]; len(images) != 0 {
+			log.Debugf("Ignoring %s. Reason: backs image %s", *s.SnapshotId, strings.Join(images, ", "))
+			return true
+		}
+	}
+	return false
+}
+
+func EipIgnoreAssociatedFilter(a interface{}, log *logrus.Entry) bool {
+	if address, ok := a.(*ec2.Address); ok {
+		if address.AssociationId != nil || address.NetworkInterfaceId != nil || address.InstanceId != nil {
+			log.Debugf("Ignoring %s. Reason: associated", aws.StringValue(address.AllocationId))
+			return true
+		}
+	}
+	return false
+}
+
+func EniIgnoreInUseFilter(i interface{}, log *logrus.Entry) bool {
+	if eni, ok := i.(*ec2.NetworkInterface); ok {
+		if aws.StringValue(eni.Status) != ec2.NetworkInterfaceStatusAvailable {
+			log.Debugf("Ignoring %s. Reason: %s", *eni.NetworkInterfaceId, aws.StringValue(eni.Status))
+			return true
+		}
+	}
+	return false
+}
+
+// EniIgnoreRequesterManagedFilter leaves interfaces aws manages for a service to that service.  they can't
+// be deleted by us anyway.
+func EniIgnoreRequesterManagedFilter(i interface{}, log *logrus.Entry) bool {
+	if eni, ok := i.(*ec2.NetworkInterface); ok {
+		if aws.BoolValue(eni.RequesterManaged) {
+			log.Debugf("Ignoring %s. Reason: managed by %s", *eni.NetworkInterfaceId, aws.StringValue(eni.RequesterId))
+			return true
+		}
+	}
+	return false
+}
+
+func NatGwIgnoreDeletedFilter(n interface{}, log *logrus.Entry) bool {
+	if nat, ok := n.(*ec2.NatGateway); ok {
+		switch aws.StringValue(nat.State) {
+		case ec2.NatGatewayStateDeleting, ec2.NatGatewayStateDeleted:
+			log.Debugf("Ignoring %s. Reason: %s", *nat.NatGatewayId, *nat.State)
+			return true
+		}
+	}
+	return false
+}
+
+// NatGwIdle flags a gateway in a vpc where nothing else has a network interface in use.  it needs the vpcs
+// loaded by loadInterfaceVpcs.
+func (am *AwsMarker) NatGwIdle(n interface{}, log *logrus.Entry) bool {
+	if nat, ok := n.(*ec2.NatGateway); ok {
+		if am.vpcs != nil && !am.vpcs[aws.StringValue(nat.VpcId)] {
+			log.Infof("Adding AWS candidate: %s, Reason: no interfaces in use in %s", *nat.NatGatewayId, aws.StringValue(nat.VpcId))
+			return true
+		}
+	}
+	return false
+}
+
+func S3IgnoreObjectLockFilter(b interface{}, log *logrus.Entry) bool {
+	if bucket, ok := b.(*s3Bucket); ok && bucket.Locked {
+		log.Debugf("Ignoring %s. Reason: object lock enabled", *bucket.Name)
+		return true
+	}
+	return false
+}
+
+func (am *AwsMarker) S3IgnoreProtectedPolicyFilter(b interface{}, log *logrus.Entry) bool {
+	if bucket, ok := b.(*s3Bucket); ok && bucket.Policy != "" {
+		// MustCompile shouldn't panic because we've already checked it in config parse
+		if regexp.MustCompile(am.s3Config().ProtectedPolicy).MatchString(bucket.Policy) {
+			log.Debugf("Ignoring %s. Reason: bucket policy matches protected_policy", *bucket.Name)
+			return true
+		}
+	}
+	return false
+}
+
+func RdsIgnoreDeletionProtectionFilter(i interface{}, log *logrus.Entry) bool {
+	switch db := i.(type) {
+	case *rds.DBInstance:
+		if aws.BoolValue(db.DeletionProtection) {
+			log.Debugf("Ignoring %s. Reason: deletion protection is on", *db.DBInstanceIdentifier)
+			return true
+		}
+	case *rds.DBCluster:
+		if aws.BoolValue(db.DeletionProtection) {
+			log.Debugf("Ignoring %s. Reason: deletion protection is on", *db.DBClusterIdentifier)
+			return true
+		}
+	}
+	return false
+}
+
+// RdsIgnoreReplicationSourceFilter keeps anything its read replicas depend on.  a replica on its own can go,
+// except an aurora replica cluster, which has to be promoted first.
+func RdsIgnoreReplicationSourceFilter(i interface{}, log *logrus.Entry) bool {
+	switch db := i.(type) {
+	case *rds.DBInstance:
+		if len(db.ReadReplicaDBInstanceIdentifiers) != 0 || len(db.ReadReplicaDBClusterIdentifiers) != 0 {
+			log.Debugf("Ignoring %s. Reason: has read replicas", *db.DBInstanceIdentifier)
+			return true
+		}
+	case *rds.DBCluster:
+		if len(db.ReadReplicaIdentifiers) != 0 {
+			log.Debugf("Ignoring %s. Reason: has read replicas", *db.DBClusterIdentifier)
+			return true
+		}
+		if db.ReplicationSourceIdentifier != nil {
+			log.Debugf("Ignoring %s. Reason: replicates %s", *db.DBClusterIdentifier, *db.ReplicationSourceIdentifier)
+			return true
+		}
+	}
+	return false
+}
+
+func RdsIgnoreDeletingFilter(i interface{}, log *logrus.Entry) bool {
+	switch db := i.(type) {
+	case *rds.DBInstance:
+		if aws.StringValue(db.DBInstanceStatus) == RDS_STATUS_DELETING {
+			log.Debugf("Ignoring %s. Reason: already deleting", *db.DBInstanceIdentifier)
+			return true
+		}
+	case *rds.DBCluster:
+		if aws.StringValue(db.Status) == RDS_STATUS_DELETING {
+			log.Debugf("Ignoring %s. Reason: already deleting", *db.DBClusterIdentifier)
+			return true
+		}
+	}
+	return false
+}
+
+// LambdaIgnoreEventSourceFilter keeps functions that a queue, stream or table still feeds.  it needs the
+// event sources loaded by loadLambdaSources.
+func (am *AwsMarker) LambdaIgnoreEventSourceFilter(f interface{}, log *logrus.Entry) bool {
+	if fn, ok := f.(*lambda.FunctionConfiguration); ok && am.lambdaSources[*fn.FunctionName] {
+		log.Debugf("Ignoring %s. Reason: has an event source mapping", *fn.FunctionName)
+		return true
+	}
+	return false
+}
+
+// EcrIgnoreInUseFilter keeps repositories with images in a running ecs task or service.  it needs the images
+// loaded by loadEcsImages.
+func (am *AwsMarker) EcrIgnoreInUseFilter(r interface{}, log *logrus.Entry) bool {
+	if repo, ok := r.(*ecr.Repository); ok && am.ecsImages[aws.StringValue(repo.RepositoryUri)] {
+		log.Debugf("Ignoring %s. Reason: images used by an ecs task definition", *repo.RepositoryName)
+		return true
+	}
+	return false
+}
+
+// LogGroupIgnoreLiveFunctionFilter leaves a function's log group to it while it's around.  it needs the
+// functions loaded by loadLambdaFunctions.
+func (am *AwsMarker) LogGroupIgnoreLiveFunctionFilter(g interface{}, log *logrus.Entry) bool {
+	if lg, ok := g.(*logGroup); ok && strings.HasPrefix(*lg.LogGroupName, LAMBDA_LOG_GROUP_PREFIX) {
+		if am.functions[strings.TrimPrefix(*lg.LogGroupName, LAMBDA_LOG_GROUP_PREFIX)] {
+			log.Debugf("Ignoring %s. Reason: its function still exists", *lg.LogGroupName)
+			return true
+		}
+	}
+	return false
+}
+
+// LogGroupEmptyFilter flags a group that's never had an event and was created longer than an idle period ago
+func (am *AwsMarker) LogGroupEmptyFilter(g interface{}, log *logrus.Entry) bool {
+	if lg, ok := g.(*logGroup); ok && lg.LastEvent == nil && lg.CreationTime != nil {
+		if created := msTime(*lg.CreationTime); time.Since(*created) > am.logGroupIdlePeriod() {
+			log.Infof("Adding AWS candidate: %s, Reason: empty, Created: %+v", *lg.LogGroupName, created)
+			return true
+		}
+	}
+	return false
+}
+
+// LogGroupIdleFilter flags a group whose latest event is older than an idle period
+func (am *AwsMarker) LogGroupIdleFilter(g interface{}, log *logrus.Entry) bool {
+	if lg, ok := g.(*logGroup); ok && lg.LastEvent != nil {
+		if time.Since(*lg.LastEvent) > am.logGroupIdlePeriod() {
+			log.Infof("Adding AWS candidate: %s, Reason: no events since %v", *lg.LogGroupName, lg.LastEvent)
+			return true
+		}
+	}
+	return false
+}
+
 /* ----------------- END FILTER ----------------- */
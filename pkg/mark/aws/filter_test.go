@@ -16,6 +16,7 @@ import (
 var log = logrus.New()
 
 func TestFilters(t *testing.T) {
+	am := &AwsMarker{Config: &config.Aws{}}
 	testCases := map[string]struct {
 		filter  Filter
 		matched bool
@@ -47,7 +48,7 @@ func TestFilters(t *testing.T) {
 			},
 		},
 		"no_ttl_tag_filter": {
-			filter:  NoTTLTagFilter,
+			filter:  am.NoTTLTagFilter,
 			matched: true,
 			tags: []*ec2.Tag{
 				{
@@ -57,7 +58,7 @@ func TestFilters(t *testing.T) {
 			},
 		},
 		"no_ttl_tag_filter_pass": {
-			filter:  NoTTLTagFilter,
+			filter:  am.NoTTLTagFilter,
 			matched: false,
 			tags: []*ec2.Tag{
 				{
@@ -67,7 +68,7 @@ func TestFilters(t *testing.T) {
 			},
 		},
 		"ttl_tag_expired": {
-			filter:  TTLTagExpiredFilter,
+			filter:  am.TTLTagExpiredFilter,
 			matched: true,
 			tags: []*ec2.Tag{
 				{
@@ -77,7 +78,7 @@ func TestFilters(t *testing.T) {
 			},
 		},
 		"ttl_tag_not_expired": {
-			filter:  TTLTagExpiredFilter,
+			filter:  am.TTLTagExpiredFilter,
 			matched: false,
 			tags: []*ec2.Tag{
 				{
@@ -87,7 +88,7 @@ func TestFilters(t *testing.T) {
 			},
 		},
 		"ttl_tag_expired_unlimited": {
-			filter:  TTLTagExpiredFilter,
+			filter:  am.TTLTagExpiredFilter,
 			matched: false,
 			tags: []*ec2.Tag{
 				{
@@ -96,6 +97,50 @@ func TestFilters(t *testing.T) {
 				},
 			},
 		},
+		"no_ttl_tag_filter_expires_pass": {
+			filter:  am.NoTTLTagFilter,
+			matched: false,
+			tags: []*ec2.Tag{
+				{
+					Key:   aws.String("expires"),
+					Value: aws.String("2099-12-31"),
+				},
+			},
+		},
+		"expires_tag_expired": {
+			filter:  am.TTLTagExpiredFilter,
+			matched: true,
+			tags: []*ec2.Tag{
+				{
+					Key:   aws.String("expires"),
+					Value: aws.String("2020-03-31T17:00:00Z"),
+				},
+			},
+		},
+		"expires_tag_wins_over_ttl": {
+			filter:  am.TTLTagExpiredFilter,
+			matched: false,
+			tags: []*ec2.Tag{
+				{
+					Key:   aws.String("ttl"),
+					Value: aws.String("-1w"),
+				},
+				{
+					Key:   aws.String("expires"),
+					Value: aws.String("Dec 31 2099"),
+				},
+			},
+		},
+		"expires_tag_unreadable": {
+			filter:  am.TTLTagExpiredFilter,
+			matched: true,
+			tags: []*ec2.Tag{
+				{
+					Key:   aws.String("expires"),
+					Value: aws.String("end of the quarter"),
+				},
+			},
+		},
 		"ignore_k8s_thing": {
 			filter:  IgnoreK8sTagFilter,
 			matched: true,
@@ -116,6 +161,39 @@ func TestFilters(t *testing.T) {
 	}
 }
 
+func TestTTLTagExpiredFilterWithoutCreated(t *testing.T) {
+	// security groups don't have a creation time, so only expires can say anything about them
+	am := &AwsMarker{Config: &config.Aws{}}
+	ttl := []*ec2.Tag{{Key: aws.String("ttl"), Value: aws.String("1d")}}
+	assert.False(t, am.TTLTagExpiredFilter(aws.String("sg-1"), ttl, nil, logrus.NewEntry(log)))
+	expired := []*ec2.Tag{{Key: aws.String("expires"), Value: aws.String("2020-01-01")}}
+	assert.True(t, am.TTLTagExpiredFilter(aws.String("sg-1"), expired, nil, logrus.NewEntry(log)))
+}
+
+func TestTagKeyFallbacks(t *testing.T) {
+	am := &AwsMarker{Config: &config.Aws{Name: "dev", TagKeys: config.TagKeys{
+		Ttl:   config.KeyList{"ttl", "lifetime"},
+		Owner: config.KeyList{"owner", "created-by"},
+	}}}
+	created := time.Now().Add(-48 * time.Hour)
+	tags := []*ec2.Tag{
+		{Key: aws.String("created-by"), Value: aws.String("alice")},
+		{Key: aws.String("lifetime"), Value: aws.String("1d")},
+	}
+	// the fallback keys count, and the unset ones use the defaults
+	assert.False(t, am.NoTTLTagFilter(aws.String("i-1"), tags, &created, logrus.NewEntry(log)))
+	assert.True(t, am.TTLTagExpiredFilter(aws.String("i-1"), tags, &created, logrus.NewEntry(log)))
+	mc := am.newCandidate("i-1", tags, &created, "ec2", "TTLTagExpiredFilter")
+	assert.Equal(t, "alice", mc.Owner)
+	assert.Equal(t, "1d", mc.Ttl)
+	assert.NotNil(t, mc.Expires)
+
+	// the first key set wins
+	tags = append(tags, &ec2.Tag{Key: aws.String("owner"), Value: aws.String("bob")})
+	assert.Equal(t, "bob", am.newCandidate("i-1", tags, &created, "ec2", "").Owner)
+	assert.False(t, am.NoTTLTagFilter(aws.String("i-2"), []*ec2.Tag{{Key: aws.String("expires"), Value: aws.String("2020-01-01")}}, &created, logrus.NewEntry(log)))
+}
+
 func TestTypeFilters(t *testing.T) {
 	testEc2Instance := &ec2.Instance{
 		InstanceId: aws.String("test_instance"),
@@ -201,7 +279,7 @@ func TestTypeFilters(t *testing.T) {
 
 func TestAwsMarkerIgnoreFilters(t *testing.T) {
 
-	notMarker := NewAwsMarker(context.Background(), &config.Aws{
+	notMarker, err := NewAwsMarker(context.Background(), &config.Aws{
 		Not: []config.AwsTagKV{
 			{
 				Key:   "foo",
@@ -209,8 +287,9 @@ func TestAwsMarkerIgnoreFilters(t *testing.T) {
 			},
 		},
 	}, log, cache.NewMockCache())
+	assert.Nil(t, err)
 
-	regexMarker := NewAwsMarker(context.Background(), &config.Aws{
+	regexMarker, err := NewAwsMarker(context.Background(), &config.Aws{
 		Not: []config.AwsTagKV{
 			{
 				KeyRegex:   "^foo.*",
@@ -218,6 +297,7 @@ func TestAwsMarkerIgnoreFilters(t *testing.T) {
 			},
 		},
 	}, log, cache.NewMockCache())
+	assert.Nil(t, err)
 
 	testCases := map[string]struct {
 		marker  *AwsMarker
@@ -291,7 +371,8 @@ func TestAwsMarkerIgnoreFilters(t *testing.T) {
 }
 
 func TestAwsMarkerIngoreTyped(t *testing.T) {
-	m := NewAwsMarker(context.Background(), &config.Aws{}, log, cache.NewMockCache())
+	m, err := NewAwsMarker(context.Background(), &config.Aws{}, log, cache.NewMockCache())
+	assert.Nil(t, err)
 	m.sgs = []map[string]bool{
 		{
 			"foo": true,
@@ -315,14 +396,17 @@ func TestAwsMarkerIngoreTyped(t *testing.T) {
 
 type mockFilter struct{}
 
+func (mf *mockFilter) Err() error                    { return nil }
 func (mf *mockFilter) Ignore() bool                  { return true }
 func (mf *mockFilter) Compliant() bool               { return true }
 func (mf *mockFilter) GetTypeString() string         { return "mock" }
 func (mf *mockFilter) GetTypeInterface() interface{} { return nil }
+func (mf *mockFilter) Reason() string                { return "mock" }
 func newMockFilterable() *mockFilter                 { return &mockFilter{} }
 
 func TestFilterAwsObject(t *testing.T) {
-	m := NewAwsMarker(context.Background(), &config.Aws{}, log, cache.NewMockCache())
+	m, err := NewAwsMarker(context.Background(), &config.Aws{}, log, cache.NewMockCache())
+	assert.Nil(t, err)
 	f := newMockFilterable()
 	assert.NotPanics(t, func() { m.FilterAwsObject(f) })
 }
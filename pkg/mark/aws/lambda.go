@@ -0,0 +1,153 @@
+package aws
+
+import (
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"strings"
+)
+
+const LAMBDA_MAPPING_DISABLED = "Disabled"
+
+func (am *AwsMarker) markLambda() error {
+	svc := am.getLambdaSession()
+
+	// a function we can't see the event sources of looks unused, so skip the whole run rather than mark it
+	if err := am.loadLambdaSources(); err != nil {
+		if isThrottle(err) {
+			am.skip("lambda event sources", err)
+			return nil
+		}
+		return err
+	}
+
+	err := svc.ListFunctionsPagesWithContext(am.Ctx, &lambda.ListFunctionsInput{}, am.processLambdaMarkPages)
+	if isThrottle(err) {
+		am.skip("lambda function pages", err)
+		return nil
+	}
+	return err
+}
+
+// loadLambdaSources resets the functions that an event source mapping invokes.  a mapping that's being
+// created or updated counts, only disabled ones don't.
+func (am *AwsMarker) loadLambdaSources() error {
+	am.lambdaSources = nil
+	sources := make(map[string]bool)
+	err := am.getLambdaSession().ListEventSourceMappingsPagesWithContext(am.Ctx, &lambda.ListEventSourceMappingsInput{}, func(page *lambda.ListEventSourceMappingsOutput, lastPage bool) bool {
+		for _, m := range page.EventSourceMappings {
+			if aws.StringValue(m.State) != LAMBDA_MAPPING_DISABLED {
+				sources[lambdaFunctionName(aws.StringValue(m.FunctionArn))] = true
+			}
+		}
+		return page.NextMarker != nil
+	})
+	if err != nil {
+		return err
+	}
+	am.lambdaSources = sources
+	return nil
+}
+
+// loadLambdaFunctions resets the names of every function in the region
+func (am *AwsMarker) loadLambdaFunctions() error {
+	am.functions = nil
+	functions := make(map[string]bool)
+	err := am.getLambdaSession().ListFunctionsPagesWithContext(am.Ctx, &lambda.ListFunctionsInput{}, func(page *lambda.ListFunctionsOutput, lastPage bool) bool {
+		for _, f := range page.Functions {
+			functions[*f.FunctionName] = true
+		}
+		return page.NextMarker != nil
+	})
+	if err != nil {
+		return err
+	}
+	am.functions = functions
+	return nil
+}
+
+// lambdaFunctionName is the name in a function arn, which mappings qualify with a version or alias
+func lambdaFunctionName(arn string) string {
+	// arn:aws:lambda:region:account:function:name[:qualifier]
+	parts := strings.Split(arn, ":")
+	if len(parts) < 7 {
+		return arn
+	}
+	return parts[6]
+}
+
+func (am *AwsMarker) processLambdaMarkPages(page *lambda.ListFunctionsOutput, lastPage bool) bool {
+	for _, f := range page.Functions {
+		am.FilterAwsObject(am.lambdaFilterable(f))
+	}
+	return page.NextMarker != nil
+}
+
+func (am *AwsMarker) lambdaFilterable(f *lambda.FunctionConfiguration) *awsFilterable {
+	return am.newAwsFilterable(f).
+		WithIgnoreFilter(am.IgnoreConfigFilter).
+		WithTypedIgnoreFilter(am.LambdaIgnoreEventSourceFilter).
+		WithComplianceFilter(NoTagFilter).
+		WithComplianceFilter(am.NoTTLTagFilter).
+		WithComplianceFilter(am.TTLTagExpiredFilter)
+}
+
+// recheckLambda needs the event sources loaded by sweepLambda
+func (am *AwsMarker) recheckLambda(id *string) (bool, bool, error) {
+	result, err := am.getLambdaSession().GetFunctionWithContext(am.Ctx, &lambda.GetFunctionInput{FunctionName: id})
+	if hasErrorCode(err, lambda.ErrCodeResourceNotFoundException) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return filterableCandidate(am.lambdaFilterable(result.Configuration))
+}
+
+// sweepLambda deletes every version of a function along with it.  its log group is left to the loggroup
+// sweep.
+func (am *AwsMarker) sweepLambda() error {
+	svc := am.getLambdaSession()
+
+	owners, err := am.Cache.ReadOwners()
+	if err != nil {
+		return err
+	}
+	// a function that got an event source during the grace period is in use again
+	if err := am.loadLambdaSources(); err != nil {
+		am.Logger.Warnf("Couldn't list lambda event sources, leaving functions for the next sweep: %v", err)
+		return nil
+	}
+
+	for _, o := range owners {
+		toDelete := am.recheck(am.toDelete(o, "lambda"), am.recheckLambda)
+		am.Logger.Debug("DryRun? ", !am.Config.DeleteEnabled)
+		for _, f := range toDelete {
+			if !am.Config.DeleteEnabled {
+				am.Logger.Warnf("would delete %s but we're in DryRun", *f)
+				am.swept("lambda", *f, true)
+				continue
+			}
+			_, err := svc.DeleteFunctionWithContext(am.Ctx, &lambda.DeleteFunctionInput{FunctionName: f})
+			if isCanceled(err) {
+				return err
+			}
+			if err != nil && !hasErrorCode(err, lambda.ErrCodeResourceNotFoundException) {
+				if isThrottle(err) {
+					am.Logger.Warn(err)
+				} else {
+					am.Logger.Error(err)
+				}
+				continue
+			}
+			if err == nil {
+				am.swept("lambda", *f, false)
+			}
+			err = mark.RemoveCandidates(am.Cache, []string{am.candidateKey(*f)})
+			if err != nil {
+				am.Logger.Error(err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package aws
+
+import (
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	LAMBDA_FUNCTIONS_PATH = "/2015-03-31/functions/"
+	LAMBDA_MAPPINGS_PATH  = "/2015-03-31/event-source-mappings/"
+	LAMBDA_TAGS_PATH      = "/2017-03-31/tags/"
+)
+
+// fakeLambda answers rest requests for functions, keyed by name with the state of the event source mapping that
+// invokes each one, or "" for none.  tags are keyed by function name too.  every function deleted is recorded.
+type fakeLambda struct {
+	mux       sync.Mutex
+	functions map[string]string
+	tags      map[string]string
+	deleted   []string
+}
+
+func lambdaFunction(name string) string {
+	return `{"FunctionName":"` + name + `","FunctionArn":"arn:aws:lambda:us-west-2:1:function:` + name + `"}`
+}
+
+func (fl *fakeLambda) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fl.mux.Lock()
+	defer fl.mux.Unlock()
+	path := r.URL.Path
+	switch {
+	case path == LAMBDA_FUNCTIONS_PATH:
+		functions := []string{}
+		for name := range fl.functions {
+			functions = append(functions, lambdaFunction(name))
+		}
+		w.Write([]byte(`{"Functions":[` + strings.Join(functions, ",") + `]}`)) //nolint
+	case strings.HasPrefix(path, LAMBDA_FUNCTIONS_PATH):
+		name := strings.TrimPrefix(path, LAMBDA_FUNCTIONS_PATH)
+		if _, ok := fl.functions[name]; !ok {
+			w.Header().Set("X-Amzn-Errortype", lambda.ErrCodeResourceNotFoundException)
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"Type":"User","Message":"Function not found: ` + name + `"}`)) //nolint
+			return
+		}
+		if r.Method == http.MethodDelete {
+			fl.deleted = append(fl.deleted, name)
+			delete(fl.functions, name)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Write([]byte(`{"Configuration":` + lambdaFunction(name) + `}`)) //nolint
+	case strings.HasPrefix(path, LAMBDA_MAPPINGS_PATH):
+		mappings := []string{}
+		for name, state := range fl.functions {
+			if state != "" {
+				mappings = append(mappings, `{"FunctionArn":"arn:aws:lambda:us-west-2:1:function:`+name+`:live","State":"`+state+`"}`)
+			}
+		}
+		w.Write([]byte(`{"EventSourceMappings":[` + strings.Join(mappings, ",") + `]}`)) //nolint
+	case strings.HasPrefix(path, LAMBDA_TAGS_PATH):
+		w.Write([]byte(`{"Tags":{` + fl.tags[lambdaFunctionName(strings.TrimPrefix(path, LAMBDA_TAGS_PATH))] + `}}`)) //nolint
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestMarkLambda(t *testing.T) {
+	fl := &fakeLambda{
+		functions: map[string]string{"fed": "Enabled", "updating": "Updating", "paused": "Disabled", "idle": "", "kept": "", "expired": ""},
+		tags: map[string]string{
+			// without a creation time a ttl alone never runs out
+			"kept":    `"owner":"alice","ttl":"1d"`,
+			"expired": `"owner":"alice","expires":"2019-01-01"`,
+		},
+	}
+	srv := httptest.NewServer(fl)
+	defer srv.Close()
+	am := newTestAwsMarker(t, &config.Aws{Name: "dev", GracePeriod: "1h"}, srv.URL)
+
+	assert.Nil(t, am.markLambda())
+	for id, marked := range map[string]bool{"fed": false, "updating": false, "paused": true, "idle": true, "kept": false, "expired": true} {
+		assert.Equal(t, marked, am.Cache.CandidateExists(am.candidateKey(id)), id)
+	}
+}
+
+func TestSweepLambda(t *testing.T) {
+	fl := &fakeLambda{functions: map[string]string{"idle": "", "fed": "Enabled"}}
+	srv := httptest.NewServer(fl)
+	defer srv.Close()
+	am := newTestAwsMarker(t, &config.Aws{Name: "dev", DeleteEnabled: true}, srv.URL)
+	writeTestCandidates(t, am, "lambda", "idle", "fed", "gone")
+
+	assert.Nil(t, am.sweepLambda())
+	assert.Equal(t, []string{"idle"}, fl.deleted)
+	for _, id := range []string{"idle", "fed", "gone"} {
+		assert.False(t, am.Cache.CandidateExists(am.candidateKey(id)), id)
+	}
+}
+
+func TestSweepLambdaDryRun(t *testing.T) {
+	fl := &fakeLambda{functions: map[string]string{"idle": ""}}
+	srv := httptest.NewServer(fl)
+	defer srv.Close()
+	am := newTestAwsMarker(t, &config.Aws{Name: "dev"}, srv.URL)
+	writeTestCandidates(t, am, "lambda", "idle")
+
+	assert.Nil(t, am.sweepLambda())
+	assert.Empty(t, fl.deleted)
+	assert.True(t, am.Cache.CandidateExists(am.candidateKey("idle")))
+}
+
+func TestLambdaFilters(t *testing.T) {
+	entry := logrus.NewEntry(log)
+	am := &AwsMarker{lambdaSources: map[string]bool{"fed": true}}
+	assert.True(t, am.LambdaIgnoreEventSourceFilter(&lambda.FunctionConfiguration{FunctionName: aws.String("fed")}, entry))
+	assert.False(t, am.LambdaIgnoreEventSourceFilter(&lambda.FunctionConfiguration{FunctionName: aws.String("idle")}, entry))
+	assert.Equal(t, "fed", lambdaFunctionName("arn:aws:lambda:us-west-2:1:function:fed:live"))
+	assert.Equal(t, "fed", lambdaFunctionName("arn:aws:lambda:us-west-2:1:function:fed"))
+}
@@ -9,27 +9,20 @@ import (
 func (am *AwsMarker) markLaunchConfig() error {
 	svc := am.getASGSession()
 
-	err := svc.DescribeLaunchConfigurationsPages(nil, am.processLaunchConfigsCallback)
-	if serr, ok := err.(awserr.Error); ok {
-		if serr.Code() == "Throttling" {
-			am.Logger.Warn(err)
-		} else {
-			return err
-		}
+	err := svc.DescribeLaunchConfigurationsPagesWithContext(am.Ctx, nil, am.processLaunchConfigsCallback)
+	if isThrottle(err) {
+		am.skip("launch configuration pages", err)
+		return nil
 	}
 
-	return nil
+	return err
 }
 
 func (am *AwsMarker) processLaunchConfigsCallback(page *autoscaling.DescribeLaunchConfigurationsOutput, lastPage bool) bool {
 
 	if len(page.LaunchConfigurations) != 0 {
 		for _, lc := range page.LaunchConfigurations {
-			am.FilterAwsObject(am.newAwsFilterable(lc).
-				WithIgnoreFilter(am.IgnoreConfigFilter).
-				WithComplianceFilter(NoTagFilter).
-				WithComplianceFilter(NoTTLTagFilter).
-				WithComplianceFilter(TTLTagExpiredFilter))
+			am.FilterAwsObject(am.lcFilterable(lc))
 		}
 	}
 
@@ -39,6 +32,27 @@ func (am *AwsMarker) processLaunchConfigsCallback(page *autoscaling.DescribeLaun
 	return false
 }
 
+func (am *AwsMarker) lcFilterable(lc *autoscaling.LaunchConfiguration) *awsFilterable {
+	return am.newAwsFilterable(lc).
+		WithIgnoreFilter(am.IgnoreConfigFilter).
+		WithComplianceFilter(NoTagFilter).
+		WithComplianceFilter(am.NoTTLTagFilter).
+		WithComplianceFilter(am.TTLTagExpiredFilter)
+}
+
+func (am *AwsMarker) recheckLaunchConfig(id *string) (bool, bool, error) {
+	result, err := am.getASGSession().DescribeLaunchConfigurationsWithContext(am.Ctx, &autoscaling.DescribeLaunchConfigurationsInput{
+		LaunchConfigurationNames: []*string{id},
+	})
+	if err != nil {
+		return false, false, err
+	}
+	for _, lc := range result.LaunchConfigurations {
+		return filterableCandidate(am.lcFilterable(lc))
+	}
+	return false, false, nil
+}
+
 func (am *AwsMarker) sweepLaunchConfig() error {
 	svc := am.getASGSession()
 
@@ -48,7 +62,7 @@ func (am *AwsMarker) sweepLaunchConfig() error {
 	}
 
 	for _, o := range owners {
-		toDelete := am.toDelete(o, "lc")
+		toDelete := am.recheck(am.toDelete(o, "lc"), am.recheckLaunchConfig)
 
 		am.Logger.Debug("DryRun? ", !am.Config.DeleteEnabled)
 		if am.Config.DeleteEnabled {
@@ -57,22 +71,30 @@ func (am *AwsMarker) sweepLaunchConfig() error {
 					input := &autoscaling.DeleteLaunchConfigurationInput{
 						LaunchConfigurationName: lc,
 					}
-					_, err := svc.DeleteLaunchConfiguration(input)
+					_, err := svc.DeleteLaunchConfigurationWithContext(am.Ctx, input)
+					if isCanceled(err) {
+						return err
+					}
 					if awsErr, ok := err.(awserr.Error); ok {
-						if awsErr.Code() == "Throttling" {
+						if isThrottle(awsErr) {
 							am.Logger.Warn(err)
 							continue
 						}
 						am.Logger.Error(awsErr.Message())
 						continue
 					}
-					err = mark.RemoveCandidates(o, am.Cache, []*string{lc})
+					am.swept("lc", *lc, false)
+					err = mark.RemoveCandidates(am.Cache, []string{am.candidateKey(*lc)})
 					if err != nil {
 						am.Logger.Error(err)
 					}
 				}
 
 			}
+		} else {
+			for _, lc := range toDelete {
+				am.swept("lc", *lc, true)
+			}
 		}
 
 	}
@@ -0,0 +1,187 @@
+package aws
+
+import (
+	"fmt"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/prometheus/common/model"
+	"time"
+)
+
+// lambda writes to a log group of this name for each function, creating it on the first invocation
+const LAMBDA_LOG_GROUP_PREFIX = "/aws/lambda/"
+
+// logGroup is a log group with its tags and the time of its latest event, each of which takes a call of its
+// own to find.  LastEvent is nil for a group that's never had one.
+type logGroup struct {
+	*cloudwatchlogs.LogGroup
+	Tags      []*ec2.Tag
+	LastEvent *time.Time
+}
+
+func (am *AwsMarker) markLogGroup() error {
+	svc := am.getLogsSession()
+
+	// a function's log group would come straight back if we deleted it, so skip the whole run rather than mark it
+	if err := am.loadLambdaFunctions(); err != nil {
+		if isThrottle(err) {
+			am.skip("lambda functions", err)
+			return nil
+		}
+		return err
+	}
+
+	err := svc.DescribeLogGroupsPagesWithContext(am.Ctx, &cloudwatchlogs.DescribeLogGroupsInput{}, am.processLogGroupMarkPages)
+	if isThrottle(err) {
+		am.skip("log group pages", err)
+		return nil
+	}
+	return err
+}
+
+func (am *AwsMarker) processLogGroupMarkPages(page *cloudwatchlogs.DescribeLogGroupsOutput, lastPage bool) bool {
+	for _, g := range page.LogGroups {
+		lg, err := am.describeLogGroup(g)
+		if isThrottle(err) {
+			am.skip(fmt.Sprintf("log group %s", *g.LogGroupName), err)
+			continue
+		}
+		if err != nil {
+			am.Logger.Error(err)
+			continue
+		}
+		am.FilterAwsObject(am.logGroupFilterable(lg))
+	}
+	return page.NextToken != nil
+}
+
+func (am *AwsMarker) describeLogGroup(g *cloudwatchlogs.LogGroup) (*logGroup, error) {
+	svc := am.getLogsSession()
+
+	lg := &logGroup{LogGroup: g}
+	tags, err := svc.ListTagsLogGroupWithContext(am.Ctx, &cloudwatchlogs.ListTagsLogGroupInput{LogGroupName: g.LogGroupName})
+	if err != nil {
+		return nil, err
+	}
+	lg.Tags = mapTags(tags.Tags)
+	// a stream's last event time can lag its events by up to an hour, which is nothing next to an idle period
+	streams, err := svc.DescribeLogStreamsWithContext(am.Ctx, &cloudwatchlogs.DescribeLogStreamsInput{
+		LogGroupName: g.LogGroupName,
+		OrderBy:      aws.String(cloudwatchlogs.OrderByLastEventTime),
+		Descending:   aws.Bool(true),
+		Limit:        aws.Int64(1),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range streams.LogStreams {
+		if s.LastEventTimestamp != nil {
+			lg.LastEvent = msTime(*s.LastEventTimestamp)
+		}
+	}
+	return lg, nil
+}
+
+// msTime converts the milliseconds since the epoch that cloudwatch logs uses for times
+func msTime(ms int64) *time.Time {
+	t := time.Unix(0, ms*int64(time.Millisecond))
+	return &t
+}
+
+func (am *AwsMarker) logGroupFilterable(lg *logGroup) *awsFilterable {
+	return am.newAwsFilterable(lg).
+		WithIgnoreFilter(am.IgnoreConfigFilter).
+		WithTypedIgnoreFilter(am.LogGroupIgnoreLiveFunctionFilter).
+		WithComplianceFilter(NoTagFilter).
+		WithComplianceFilter(am.NoTTLTagFilter).
+		WithComplianceFilter(am.TTLTagExpiredFilter).
+		WithTypedComplianceFilter(am.LogGroupEmptyFilter).
+		WithTypedComplianceFilter(am.LogGroupIdleFilter)
+}
+
+// recheckLogGroup needs the functions loaded by sweepLogGroup
+func (am *AwsMarker) recheckLogGroup(id *string) (bool, bool, error) {
+	result, err := am.getLogsSession().DescribeLogGroupsWithContext(am.Ctx, &cloudwatchlogs.DescribeLogGroupsInput{
+		LogGroupNamePrefix: id,
+	})
+	if err != nil {
+		return false, false, err
+	}
+	for _, g := range result.LogGroups {
+		if *g.LogGroupName != *id {
+			continue
+		}
+		lg, err := am.describeLogGroup(g)
+		if hasErrorCode(err, cloudwatchlogs.ErrCodeResourceNotFoundException) {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+		return filterableCandidate(am.logGroupFilterable(lg))
+	}
+	return false, false, nil
+}
+
+// logGroupIdlePeriod falls back to the default for markers built without a defaulted config
+func (am *AwsMarker) logGroupIdlePeriod() time.Duration {
+	idle := am.Config.LogGroups.IdlePeriod
+	if idle == "" {
+		idle = config.DEFAULT_LOG_GROUP_IDLE_PERIOD
+	}
+	// shouldn't fail because we've already checked it in config parse
+	d, err := model.ParseDuration(idle)
+	if err != nil {
+		am.Logger.Error(err)
+	}
+	return time.Duration(d)
+}
+
+func (am *AwsMarker) sweepLogGroup() error {
+	svc := am.getLogsSession()
+
+	owners, err := am.Cache.ReadOwners()
+	if err != nil {
+		return err
+	}
+	// a group whose function was deployed during the grace period is in use again
+	if err := am.loadLambdaFunctions(); err != nil {
+		am.Logger.Warnf("Couldn't list lambda functions, leaving log groups for the next sweep: %v", err)
+		return nil
+	}
+
+	for _, o := range owners {
+		toDelete := am.recheck(am.toDelete(o, "loggroup"), am.recheckLogGroup)
+		am.Logger.Debug("DryRun? ", !am.Config.DeleteEnabled)
+		for _, g := range toDelete {
+			if !am.Config.DeleteEnabled {
+				am.Logger.Warnf("would delete %s but we're in DryRun", *g)
+				am.swept("loggroup", *g, true)
+				continue
+			}
+			_, err := svc.DeleteLogGroupWithContext(am.Ctx, &cloudwatchlogs.DeleteLogGroupInput{LogGroupName: g})
+			if isCanceled(err) {
+				return err
+			}
+			if err != nil && !hasErrorCode(err, cloudwatchlogs.ErrCodeResourceNotFoundException) {
+				if isThrottle(err) {
+					am.Logger.Warn(err)
+				} else {
+					am.Logger.Error(err)
+				}
+				continue
+			}
+			if err == nil {
+				am.swept("loggroup", *g, false)
+			}
+			err = mark.RemoveCandidates(am.Cache, []string{am.candidateKey(*g)})
+			if err != nil {
+				am.Logger.Error(err)
+			}
+		}
+	}
+	return nil
+}
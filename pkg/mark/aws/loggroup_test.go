@@ -0,0 +1,163 @@
+package aws
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeLogGroup struct {
+	created   time.Time
+	lastEvent *time.Time
+	tags      string
+}
+
+// fakeLogs answers cloudwatch logs json requests for log groups, keyed by name, and hands lambda requests to
+// lambda.  every log group deleted is recorded.
+type fakeLogs struct {
+	mux     sync.Mutex
+	lambda  fakeLambda
+	groups  map[string]*fakeLogGroup
+	deleted []string
+}
+
+func msString(t time.Time) string {
+	return fmt.Sprint(t.UnixNano() / int64(time.Millisecond))
+}
+
+func (fl *fakeLogs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fl.mux.Lock()
+	defer fl.mux.Unlock()
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Target"), "Logs_") {
+		fl.lambda.ServeHTTP(w, r)
+		return
+	}
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	target := r.Header.Get("X-Amz-Target")
+	switch target[strings.Index(target, ".")+1:] {
+	case "DescribeLogGroups":
+		groups := []string{}
+		for name, g := range fl.groups {
+			if prefix, ok := body["logGroupNamePrefix"].(string); !ok || strings.HasPrefix(name, prefix) {
+				groups = append(groups, `{"logGroupName":"`+name+`","creationTime":`+msString(g.created)+`}`)
+			}
+		}
+		w.Write([]byte(`{"logGroups":[` + strings.Join(groups, ",") + `]}`)) //nolint
+	case "ListTagsLogGroup":
+		w.Write([]byte(`{"tags":{` + fl.groups[body["logGroupName"].(string)].tags + `}}`)) //nolint
+	case "DescribeLogStreams":
+		streams := ""
+		if last := fl.groups[body["logGroupName"].(string)].lastEvent; last != nil {
+			streams = `{"logStreamName":"s","lastEventTimestamp":` + msString(*last) + `}`
+		}
+		w.Write([]byte(`{"logStreams":[` + streams + `]}`)) //nolint
+	case "DeleteLogGroup":
+		name := body["logGroupName"].(string)
+		fl.deleted = append(fl.deleted, name)
+		delete(fl.groups, name)
+		w.Write([]byte(`{}`)) //nolint
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestMarkLogGroup(t *testing.T) {
+	old := time.Now().Add(-60 * 24 * time.Hour)
+	recent := time.Now().Add(-time.Hour)
+	ttl := `"owner":"alice","ttl":"0"`
+	fl := &fakeLogs{
+		lambda: fakeLambda{functions: map[string]string{"live": ""}},
+		groups: map[string]*fakeLogGroup{
+			"/aws/lambda/live": {created: old, tags: ttl},
+			"/aws/lambda/gone": {created: old, lastEvent: &old, tags: ttl},
+			"/app/empty":       {created: old, tags: ttl},
+			"/app/new":         {created: recent, tags: ttl},
+			"/app/busy":        {created: old, lastEvent: &recent, tags: ttl},
+			"/app/untagged":    {created: old, lastEvent: &recent},
+		},
+	}
+	srv := httptest.NewServer(fl)
+	defer srv.Close()
+	am := newTestAwsMarker(t, &config.Aws{Name: "dev", GracePeriod: "1h", LogGroups: config.AwsLogGroups{IdlePeriod: "30d"}}, srv.URL)
+
+	assert.Nil(t, am.markLogGroup())
+	for id, marked := range map[string]bool{
+		"/aws/lambda/live": false,
+		"/aws/lambda/gone": true,
+		"/app/empty":       true,
+		"/app/new":         false,
+		"/app/busy":        false,
+		"/app/untagged":    true,
+	} {
+		assert.Equal(t, marked, am.Cache.CandidateExists(am.candidateKey(id)), id)
+	}
+}
+
+func TestSweepLogGroup(t *testing.T) {
+	old := time.Now().Add(-60 * 24 * time.Hour)
+	fl := &fakeLogs{
+		lambda: fakeLambda{functions: map[string]string{"redeployed": ""}},
+		groups: map[string]*fakeLogGroup{
+			"/app/idle":              {created: old, lastEvent: &old, tags: `"ttl":"0"`},
+			"/aws/lambda/redeployed": {created: old, lastEvent: &old, tags: `"ttl":"0"`},
+		},
+	}
+	srv := httptest.NewServer(fl)
+	defer srv.Close()
+	am := newTestAwsMarker(t, &config.Aws{Name: "dev", DeleteEnabled: true}, srv.URL)
+	writeTestCandidates(t, am, "loggroup", "/app/idle", "/aws/lambda/redeployed")
+
+	assert.Nil(t, am.sweepLogGroup())
+	assert.Equal(t, []string{"/app/idle"}, fl.deleted)
+	assert.False(t, am.Cache.CandidateExists(am.candidateKey("/app/idle")))
+	assert.False(t, am.Cache.CandidateExists(am.candidateKey("/aws/lambda/redeployed")))
+}
+
+func TestLogGroupFilters(t *testing.T) {
+	entry := logrus.NewEntry(log)
+	am := &AwsMarker{
+		Config:    &config.Aws{LogGroups: config.AwsLogGroups{IdlePeriod: "1d"}},
+		Logger:    entry,
+		functions: map[string]bool{"api": true},
+	}
+	ms := func(t time.Time) *int64 { return aws.Int64(t.UnixNano() / int64(time.Millisecond)) }
+	old, recent := time.Now().Add(-48*time.Hour), time.Now().Add(-time.Hour)
+
+	live := &logGroup{LogGroup: &cloudwatchlogs.LogGroup{LogGroupName: aws.String("/aws/lambda/api")}}
+	orphaned := &logGroup{LogGroup: &cloudwatchlogs.LogGroup{LogGroupName: aws.String("/aws/lambda/gone")}}
+	assert.True(t, am.LogGroupIgnoreLiveFunctionFilter(live, entry))
+	assert.False(t, am.LogGroupIgnoreLiveFunctionFilter(orphaned, entry))
+
+	emptyOld := &logGroup{LogGroup: &cloudwatchlogs.LogGroup{LogGroupName: aws.String("a"), CreationTime: ms(old)}}
+	emptyNew := &logGroup{LogGroup: &cloudwatchlogs.LogGroup{LogGroupName: aws.String("b"), CreationTime: ms(recent)}}
+	idle := &logGroup{LogGroup: &cloudwatchlogs.LogGroup{LogGroupName: aws.String("c"), CreationTime: ms(old)}, LastEvent: &old}
+	busy := &logGroup{LogGroup: &cloudwatchlogs.LogGroup{LogGroupName: aws.String("d"), CreationTime: ms(old)}, LastEvent: &recent}
+	assert.True(t, am.LogGroupEmptyFilter(emptyOld, entry))
+	assert.False(t, am.LogGroupEmptyFilter(emptyNew, entry))
+	assert.False(t, am.LogGroupEmptyFilter(idle, entry))
+	assert.True(t, am.LogGroupIdleFilter(idle, entry))
+	assert.False(t, am.LogGroupIdleFilter(busy, entry))
+	assert.False(t, am.LogGroupIdleFilter(emptyOld, entry))
+
+	id, _, created, canType, err := am.extractTags(emptyOld)
+	assert.Nil(t, err)
+	assert.Equal(t, "a", *id)
+	assert.Equal(t, "loggroup", canType)
+	assert.Equal(t, old.Truncate(time.Millisecond).Unix(), created.Unix())
+}
@@ -0,0 +1,136 @@
+package aws
+
+import (
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// describes report a gateway's interface type as nat_gateway, not the sdk's natGateway
+var natGwInterfaceTypes = map[string]bool{"nat_gateway": true, ec2.NetworkInterfaceTypeNatGateway: true}
+
+func (am *AwsMarker) markNatGw() error {
+	svc := am.getEc2Session()
+
+	// a gateway in a vpc we can't see the interfaces of looks idle, so skip the whole run rather than mark it
+	if err := am.loadInterfaceVpcs(); err != nil {
+		if isThrottle(err) {
+			am.skip("interface vpcs", err)
+			return nil
+		}
+		return err
+	}
+
+	err := svc.DescribeNatGatewaysPagesWithContext(am.Ctx, &ec2.DescribeNatGatewaysInput{}, am.processNatGwMarkPages)
+	if isThrottle(err) {
+		am.skip("nat gateway pages", err)
+		return nil
+	}
+	return err
+}
+
+// loadInterfaceVpcs resets the vpcs that have network interfaces in use, other than nat gateways' own.  a
+// gateway serves the private subnets routed to it rather than the public one it sits in, so it's the whole vpc
+// that counts.  interfaces cover lambdas, fargate tasks and rds as well as instances, stopped ones included,
+// since an instance keeps its interface attached when it's stopped.
+func (am *AwsMarker) loadInterfaceVpcs() error {
+	am.vpcs = nil
+	vpcs := make(map[string]bool)
+	err := am.getEc2Session().DescribeNetworkInterfacesPagesWithContext(am.Ctx, &ec2.DescribeNetworkInterfacesInput{}, func(page *ec2.DescribeNetworkInterfacesOutput, lastPage bool) bool {
+		for _, eni := range page.NetworkInterfaces {
+			if eni.VpcId == nil || natGwInterfaceTypes[aws.StringValue(eni.InterfaceType)] {
+				continue
+			}
+			if aws.StringValue(eni.Status) == ec2.NetworkInterfaceStatusInUse {
+				vpcs[*eni.VpcId] = true
+			}
+		}
+		return page.NextToken != nil
+	})
+	if err != nil {
+		return err
+	}
+	am.vpcs = vpcs
+	return nil
+}
+
+func (am *AwsMarker) processNatGwMarkPages(page *ec2.DescribeNatGatewaysOutput, lastPage bool) bool {
+	for _, n := range page.NatGateways {
+		am.FilterAwsObject(am.natGwFilterable(n))
+	}
+	return page.NextToken != nil
+}
+
+func (am *AwsMarker) natGwFilterable(n *ec2.NatGateway) *awsFilterable {
+	return am.newAwsFilterable(n).
+		WithIgnoreFilter(am.IgnoreConfigFilter).
+		WithTypedIgnoreFilter(NatGwIgnoreDeletedFilter).
+		WithComplianceFilter(NoTagFilter).
+		WithComplianceFilter(am.NoTTLTagFilter).
+		WithComplianceFilter(am.TTLTagExpiredFilter).
+		WithTypedComplianceFilter(am.NatGwIdle)
+}
+
+// recheckNatGw needs the interface vpcs loaded by sweepNatGw
+func (am *AwsMarker) recheckNatGw(id *string) (bool, bool, error) {
+	result, err := am.getEc2Session().DescribeNatGatewaysWithContext(am.Ctx, &ec2.DescribeNatGatewaysInput{
+		Filter: []*ec2.Filter{{Name: aws.String("nat-gateway-id"), Values: []*string{id}}},
+	})
+	if err != nil {
+		return false, false, err
+	}
+	for _, n := range result.NatGateways {
+		return filterableCandidate(am.natGwFilterable(n))
+	}
+	return false, false, nil
+}
+
+// sweepNatGw leaves a gateway's elastic ips alone.  they're released by the eip sweep once the gateway is
+// gone and they've been unassociated for a grace period of their own.
+func (am *AwsMarker) sweepNatGw() error {
+	svc := am.getEc2Session()
+
+	owners, err := am.Cache.ReadOwners()
+	if err != nil {
+		return err
+	}
+	// a vpc that got an interface during the grace period still needs its gateway
+	if err := am.loadInterfaceVpcs(); err != nil {
+		am.Logger.Warnf("Couldn't list interface vpcs, leaving nat gateways for the next sweep: %v", err)
+		return nil
+	}
+
+	for _, o := range owners {
+		toDelete := am.recheck(am.toDelete(o, "natgw"), am.recheckNatGw)
+		am.Logger.Debug("DryRun? ", !am.Config.DeleteEnabled)
+		for _, n := range toDelete {
+			_, err := svc.DeleteNatGatewayWithContext(am.Ctx, &ec2.DeleteNatGatewayInput{
+				NatGatewayId: n,
+				DryRun:       aws.Bool(!am.Config.DeleteEnabled),
+			})
+			if isCanceled(err) {
+				return err
+			}
+			if awsErr, ok := err.(awserr.Error); ok {
+				if awsErr.Code() == "DryRunOperation" {
+					am.Logger.Warnf("Would have deleted %s but we're in DryRun", *n)
+					am.swept("natgw", *n, true)
+					continue
+				}
+				if isThrottle(awsErr) {
+					am.Logger.Warn(err)
+					continue
+				}
+				am.Logger.Error(awsErr)
+			} else if err == nil {
+				am.swept("natgw", *n, false)
+			}
+			err = mark.RemoveCandidates(am.Cache, []string{am.candidateKey(*n)})
+			if err != nil {
+				am.Logger.Error(err)
+			}
+		}
+	}
+	return nil
+}
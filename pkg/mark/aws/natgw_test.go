@@ -0,0 +1,217 @@
+package aws
+
+import (
+	"fmt"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// fakeNetwork answers describes from nat gateways, interfaces and addresses, keyed by id, and records every
+// delete and release.  an unfiltered describe gets all of them.
+type fakeNetwork struct {
+	mux        sync.Mutex
+	gateways   map[string]string
+	interfaces map[string]string
+	addresses  map[string]string
+	deleted    []string
+}
+
+func filtered(items map[string]string, id string) string {
+	if id != "" {
+		return items[id]
+	}
+	all := ""
+	for _, i := range items {
+		all += i
+	}
+	return all
+}
+
+func (fn *fakeNetwork) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fn.mux.Lock()
+	defer fn.mux.Unlock()
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if r.Form.Get("DryRun") == "true" {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		w.Write([]byte(`<Response><Errors><Error><Code>DryRunOperation</Code><Message>dry run</Message></Error></Errors></Response>`)) //nolint
+		return
+	}
+	switch action := r.Form.Get("Action"); action {
+	case "DescribeNatGateways":
+		w.Write([]byte(`<DescribeNatGatewaysResponse><natGatewaySet>` + filtered(fn.gateways, r.Form.Get("Filter.1.Value.1")) + `</natGatewaySet></DescribeNatGatewaysResponse>`)) //nolint
+	case "DescribeNetworkInterfaces":
+		w.Write([]byte(`<DescribeNetworkInterfacesResponse><networkInterfaceSet>` + filtered(fn.interfaces, r.Form.Get("Filter.1.Value.1")) + `</networkInterfaceSet></DescribeNetworkInterfacesResponse>`)) //nolint
+	case "DescribeAddresses":
+		// marking filters on the domain rather than an id
+		id := ""
+		if r.Form.Get("Filter.1.Name") == "allocation-id" {
+			id = r.Form.Get("Filter.1.Value.1")
+		}
+		w.Write([]byte(`<DescribeAddressesResponse><addressesSet>` + filtered(fn.addresses, id) + `</addressesSet></DescribeAddressesResponse>`)) //nolint
+	case "ReleaseAddress":
+		fn.deleted = append(fn.deleted, r.Form.Get("AllocationId"))
+		w.Write([]byte(`<ReleaseAddressResponse><return>true</return></ReleaseAddressResponse>`)) //nolint
+	case "DeleteNatGateway":
+		fn.deleted = append(fn.deleted, r.Form.Get("NatGatewayId"))
+		w.Write([]byte(`<DeleteNatGatewayResponse><natGatewayId>` + r.Form.Get("NatGatewayId") + `</natGatewayId></DeleteNatGatewayResponse>`)) //nolint
+	case "DeleteNetworkInterface":
+		fn.deleted = append(fn.deleted, r.Form.Get("NetworkInterfaceId"))
+		w.Write([]byte(`<DeleteNetworkInterfaceResponse><return>true</return></DeleteNetworkInterfaceResponse>`)) //nolint
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func natGateway(id, vpc, tags string) string {
+	return `<item><natGatewayId>` + id + `</natGatewayId><vpcId>` + vpc + `</vpcId><state>available</state>` +
+		`<createTime>2019-01-01T00:00:00.000Z</createTime><tagSet>` + tags + `</tagSet></item>`
+}
+
+func vpcInterface(id, vpc, interfaceType, status string) string {
+	return `<item><networkInterfaceId>` + id + `</networkInterfaceId><vpcId>` + vpc + `</vpcId><interfaceType>` + interfaceType +
+		`</interfaceType><status>` + status + `</status></item>`
+}
+
+func TestSweepNatGwKeepsVpcsWithInterfaces(t *testing.T) {
+	tags := `<item><key>owner</key><value>alice</value></item><item><key>ttl</key><value>0</value></item>`
+	fn := &fakeNetwork{
+		gateways: map[string]string{
+			"nat-idle":     natGateway("nat-idle", "vpc-abandoned", tags),
+			"nat-instance": natGateway("nat-instance", "vpc-instance", tags),
+			"nat-lambda":   natGateway("nat-lambda", "vpc-lambda", tags),
+			"nat-fargate":  natGateway("nat-fargate", "vpc-fargate", tags),
+		},
+		interfaces: map[string]string{
+			// every gateway's own interface is in use, and doesn't count
+			"eni-nat-idle":     vpcInterface("eni-nat-idle", "vpc-abandoned", "nat_gateway", "in-use"),
+			"eni-nat-instance": vpcInterface("eni-nat-instance", "vpc-instance", "nat_gateway", "in-use"),
+			"eni-nat-lambda":   vpcInterface("eni-nat-lambda", "vpc-lambda", "nat_gateway", "in-use"),
+			"eni-nat-fargate":  vpcInterface("eni-nat-fargate", "vpc-fargate", "nat_gateway", "in-use"),
+			// nor does one that's detached
+			"eni-detached": vpcInterface("eni-detached", "vpc-abandoned", "interface", "available"),
+			"eni-instance": vpcInterface("eni-instance", "vpc-instance", "interface", "in-use"),
+			"eni-lambda":   vpcInterface("eni-lambda", "vpc-lambda", "lambda", "in-use"),
+			"eni-fargate":  vpcInterface("eni-fargate", "vpc-fargate", "interface", "in-use"),
+		},
+	}
+	srv := httptest.NewServer(fn)
+	defer srv.Close()
+	am := newTestAwsMarker(t, &config.Aws{Name: "dev", DeleteEnabled: true}, srv.URL)
+	writeTestCandidates(t, am, "natgw", "nat-idle", "nat-instance", "nat-lambda", "nat-fargate")
+
+	assert.Nil(t, am.sweepNatGw())
+	assert.Equal(t, []string{"nat-idle"}, fn.deleted)
+	for _, id := range []string{"nat-idle", "nat-instance", "nat-lambda", "nat-fargate"} {
+		assert.False(t, am.Cache.CandidateExists(am.candidateKey(id)), id)
+	}
+}
+
+func address(id, extra string) string {
+	return `<item><allocationId>` + id + `</allocationId><domain>vpc</domain>` + extra + `</item>`
+}
+
+func TestSweepEipSkipsAssociated(t *testing.T) {
+	fn := &fakeNetwork{addresses: map[string]string{
+		"eipalloc-free":       address("eipalloc-free", ""),
+		"eipalloc-associated": address("eipalloc-associated", `<associationId>eipassoc-1</associationId><instanceId>i-1</instanceId>`),
+	}}
+	srv := httptest.NewServer(fn)
+	defer srv.Close()
+	am := newTestAwsMarker(t, &config.Aws{Name: "dev", DeleteEnabled: true}, srv.URL)
+	writeTestCandidates(t, am, "eip", "eipalloc-free", "eipalloc-associated", "eipalloc-gone")
+
+	assert.Nil(t, am.sweepEip())
+	assert.Equal(t, []string{"eipalloc-free"}, fn.deleted)
+	for _, id := range []string{"eipalloc-free", "eipalloc-associated", "eipalloc-gone"} {
+		assert.False(t, am.Cache.CandidateExists(am.candidateKey(id)), id)
+	}
+}
+
+func TestSweepEipDryRun(t *testing.T) {
+	fn := &fakeNetwork{addresses: map[string]string{"eipalloc-free": address("eipalloc-free", "")}}
+	srv := httptest.NewServer(fn)
+	defer srv.Close()
+	am := newTestAwsMarker(t, &config.Aws{Name: "dev"}, srv.URL)
+	writeTestCandidates(t, am, "eip", "eipalloc-free")
+
+	assert.Nil(t, am.sweepEip())
+	assert.Empty(t, fn.deleted)
+	assert.True(t, am.Cache.CandidateExists(am.candidateKey("eipalloc-free")))
+}
+
+func TestSweepEniOnlyDeletesAvailable(t *testing.T) {
+	eni := `<item><networkInterfaceId>%s</networkInterfaceId><status>%s</status><requesterManaged>%s</requesterManaged></item>`
+	fn := &fakeNetwork{interfaces: map[string]string{
+		"eni-orphan":  fmt.Sprintf(eni, "eni-orphan", "available", "false"),
+		"eni-in-use":  fmt.Sprintf(eni, "eni-in-use", "in-use", "false"),
+		"eni-managed": fmt.Sprintf(eni, "eni-managed", "available", "true"),
+	}}
+	srv := httptest.NewServer(fn)
+	defer srv.Close()
+	am := newTestAwsMarker(t, &config.Aws{Name: "dev", DeleteEnabled: true}, srv.URL)
+	writeTestCandidates(t, am, "eni", "eni-orphan", "eni-in-use", "eni-managed")
+
+	assert.Nil(t, am.sweepEni())
+	assert.Equal(t, []string{"eni-orphan"}, fn.deleted)
+}
+
+func TestNetworkFilters(t *testing.T) {
+	entry := logrus.NewEntry(log)
+	am := &AwsMarker{vpcs: map[string]bool{"vpc-busy": true}}
+	testCases := map[string]struct {
+		filter  TypedFilter
+		object  interface{}
+		matched bool
+	}{
+		"eip_associated": {
+			filter:  EipIgnoreAssociatedFilter,
+			object:  &ec2.Address{AllocationId: aws.String("eipalloc-1"), AssociationId: aws.String("eipassoc-1")},
+			matched: true,
+		},
+		"eip_unassociated": {
+			filter:  EipIgnoreAssociatedFilter,
+			object:  &ec2.Address{AllocationId: aws.String("eipalloc-1")},
+			matched: false,
+		},
+		"eni_in_use": {
+			filter:  EniIgnoreInUseFilter,
+			object:  &ec2.NetworkInterface{NetworkInterfaceId: aws.String("eni-1"), Status: aws.String(ec2.NetworkInterfaceStatusInUse)},
+			matched: true,
+		},
+		"eni_available": {
+			filter:  EniIgnoreInUseFilter,
+			object:  &ec2.NetworkInterface{NetworkInterfaceId: aws.String("eni-1"), Status: aws.String(ec2.NetworkInterfaceStatusAvailable)},
+			matched: false,
+		},
+		"natgw_deleting": {
+			filter:  NatGwIgnoreDeletedFilter,
+			object:  &ec2.NatGateway{NatGatewayId: aws.String("nat-1"), State: aws.String(ec2.NatGatewayStateDeleting)},
+			matched: true,
+		},
+		"natgw_idle": {
+			filter:  am.NatGwIdle,
+			object:  &ec2.NatGateway{NatGatewayId: aws.String("nat-1"), VpcId: aws.String("vpc-abandoned")},
+			matched: true,
+		},
+		"natgw_busy": {
+			filter:  am.NatGwIdle,
+			object:  &ec2.NatGateway{NatGatewayId: aws.String("nat-1"), VpcId: aws.String("vpc-busy")},
+			matched: false,
+		},
+	}
+	for desc, tc := range testCases {
+		t.Run(desc, func(t *testing.T) {
+			assert.Equal(t, tc.matched, tc.filter(tc.object, entry))
+		})
+	}
+}
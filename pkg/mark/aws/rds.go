@@ -0,0 +1,291 @@
+package aws
+
+import (
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"strings"
+	"time"
+)
+
+const (
+	RDS_STATUS_DELETING = "deleting"
+	// aurora, aurora-mysql and aurora-postgresql.  neptune and documentdb clusters share the rds api.
+	AURORA_ENGINE_PREFIX = "aurora"
+)
+
+func (am *AwsMarker) markRds() error {
+	svc := am.getRdsSession()
+
+	err := svc.DescribeDBInstancesPagesWithContext(am.Ctx, &rds.DescribeDBInstancesInput{}, am.processRdsMarkPages)
+	if isThrottle(err) {
+		am.skip("rds instance pages", err)
+		return nil
+	}
+	return err
+}
+
+func (am *AwsMarker) processRdsMarkPages(page *rds.DescribeDBInstancesOutput, lastPage bool) bool {
+	for _, db := range page.DBInstances {
+		// cluster members live and die with their cluster, see markAurora
+		if db.DBClusterIdentifier != nil {
+			continue
+		}
+		am.FilterAwsObject(am.rdsFilterable(db))
+	}
+	return page.Marker != nil
+}
+
+func (am *AwsMarker) rdsFilterable(db *rds.DBInstance) *awsFilterable {
+	return am.newAwsFilterable(db).
+		WithIgnoreFilter(am.IgnoreConfigFilter).
+		WithTypedIgnoreFilter(RdsIgnoreDeletionProtectionFilter).
+		WithTypedIgnoreFilter(RdsIgnoreReplicationSourceFilter).
+		WithTypedIgnoreFilter(RdsIgnoreDeletingFilter).
+		WithComplianceFilter(NoTagFilter).
+		WithComplianceFilter(am.NoTTLTagFilter).
+		WithComplianceFilter(am.TTLTagExpiredFilter)
+}
+
+func (am *AwsMarker) markAurora() error {
+	svc := am.getRdsSession()
+
+	err := svc.DescribeDBClustersPagesWithContext(am.Ctx, &rds.DescribeDBClustersInput{}, am.processAuroraMarkPages)
+	if isThrottle(err) {
+		am.skip("aurora cluster pages", err)
+		return nil
+	}
+	return err
+}
+
+func (am *AwsMarker) processAuroraMarkPages(page *rds.DescribeDBClustersOutput, lastPage bool) bool {
+	for _, c := range page.DBClusters {
+		if !strings.HasPrefix(aws.StringValue(c.Engine), AURORA_ENGINE_PREFIX) {
+			continue
+		}
+		am.FilterAwsObject(am.auroraFilterable(c))
+	}
+	return page.Marker != nil
+}
+
+func (am *AwsMarker) auroraFilterable(c *rds.DBCluster) *awsFilterable {
+	return am.newAwsFilterable(c).
+		WithIgnoreFilter(am.IgnoreConfigFilter).
+		WithTypedIgnoreFilter(RdsIgnoreDeletionProtectionFilter).
+		WithTypedIgnoreFilter(RdsIgnoreReplicationSourceFilter).
+		WithTypedIgnoreFilter(RdsIgnoreDeletingFilter).
+		WithComplianceFilter(NoTagFilter).
+		WithComplianceFilter(am.NoTTLTagFilter).
+		WithComplianceFilter(am.TTLTagExpiredFilter)
+}
+
+func (am *AwsMarker) describeDBInstance(id *string) (*rds.DBInstance, error) {
+	result, err := am.getRdsSession().DescribeDBInstancesWithContext(am.Ctx, &rds.DescribeDBInstancesInput{
+		DBInstanceIdentifier: id,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, db := range result.DBInstances {
+		return db, nil
+	}
+	return nil, awserr.New(rds.ErrCodeDBInstanceNotFoundFault, *id, nil)
+}
+
+func (am *AwsMarker) describeDBCluster(id *string) (*rds.DBCluster, error) {
+	result, err := am.getRdsSession().DescribeDBClustersWithContext(am.Ctx, &rds.DescribeDBClustersInput{
+		DBClusterIdentifier: id,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range result.DBClusters {
+		return c, nil
+	}
+	return nil, awserr.New(rds.ErrCodeDBClusterNotFoundFault, *id, nil)
+}
+
+func (am *AwsMarker) recheckRds(id *string) (bool, bool, error) {
+	db, err := am.describeDBInstance(id)
+	if hasErrorCode(err, rds.ErrCodeDBInstanceNotFoundFault) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return filterableCandidate(am.rdsFilterable(db))
+}
+
+func (am *AwsMarker) recheckAurora(id *string) (bool, bool, error) {
+	c, err := am.describeDBCluster(id)
+	if hasErrorCode(err, rds.ErrCodeDBClusterNotFoundFault) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return filterableCandidate(am.auroraFilterable(c))
+}
+
+// finalSnapshotId falls back to the default pattern for markers built without a defaulted config
+func (am *AwsMarker) finalSnapshotId(id string) string {
+	ar := am.Config.Rds
+	if ar.FinalSnapshot == "" {
+		ar.FinalSnapshot = config.DEFAULT_RDS_FINAL_SNAPSHOT
+	}
+	return ar.FinalSnapshotId(id, time.Now())
+}
+
+// deleteDBInstanceInput takes a final snapshot of everything but read replicas, which rds won't snapshot on
+// delete.  their source still has the data.
+func (am *AwsMarker) deleteDBInstanceInput(db *rds.DBInstance) *rds.DeleteDBInstanceInput {
+	input := &rds.DeleteDBInstanceInput{DBInstanceIdentifier: db.DBInstanceIdentifier}
+	if db.ReadReplicaSourceDBInstanceIdentifier != nil {
+		input.SkipFinalSnapshot = aws.Bool(true)
+	} else {
+		input.FinalDBSnapshotIdentifier = aws.String(am.finalSnapshotId(*db.DBInstanceIdentifier))
+	}
+	return input
+}
+
+func (am *AwsMarker) sweepRds() error {
+	svc := am.getRdsSession()
+
+	owners, err := am.Cache.ReadOwners()
+	if err != nil {
+		return err
+	}
+
+	for _, o := range owners {
+		toDelete := am.recheck(am.toDelete(o, "rds"), am.recheckRds)
+
+		am.Logger.Debug("DryRun? ", !am.Config.DeleteEnabled)
+		for _, id := range toDelete {
+			if !am.Config.DeleteEnabled {
+				am.Logger.Warnf("would delete %s but we're in DryRun", *id)
+				am.swept("rds", *id, true)
+				continue
+			}
+			// recheck doesn't hand back what it described, and we need to know whether it's a replica
+			db, err := am.describeDBInstance(id)
+			if isCanceled(err) {
+				return err
+			}
+			if err != nil {
+				am.Logger.Error(err)
+				continue
+			}
+			input := am.deleteDBInstanceInput(db)
+			_, err = svc.DeleteDBInstanceWithContext(am.Ctx, input)
+			if isCanceled(err) {
+				return err
+			}
+			if err != nil {
+				if isThrottle(err) {
+					am.Logger.Warn(err)
+				} else {
+					am.Logger.Error(err)
+				}
+				continue
+			}
+			am.Logger.Infof("Deleted %s, final snapshot: %s", *id, aws.StringValue(input.FinalDBSnapshotIdentifier))
+			am.swept("rds", *id, false)
+			err = mark.RemoveCandidates(am.Cache, []string{am.candidateKey(*id)})
+			if err != nil {
+				am.Logger.Error(err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// sweepAurora deletes a cluster's instances first, since rds won't delete a cluster that still has any.
+// the cluster itself, and its final snapshot, are left to a later sweep once they're gone.
+func (am *AwsMarker) sweepAurora() error {
+	svc := am.getRdsSession()
+
+	owners, err := am.Cache.ReadOwners()
+	if err != nil {
+		return err
+	}
+
+	for _, o := range owners {
+		toDelete := am.recheck(am.toDelete(o, "aurora"), am.recheckAurora)
+
+		am.Logger.Debug("DryRun? ", !am.Config.DeleteEnabled)
+		for _, id := range toDelete {
+			if !am.Config.DeleteEnabled {
+				am.Logger.Warnf("would delete %s but we're in DryRun", *id)
+				am.swept("aurora", *id, true)
+				continue
+			}
+			c, err := am.describeDBCluster(id)
+			if isCanceled(err) {
+				return err
+			}
+			if err != nil {
+				am.Logger.Error(err)
+				continue
+			}
+			if len(c.DBClusterMembers) != 0 {
+				if err := am.deleteAuroraMembers(c); err != nil {
+					return err
+				}
+				continue
+			}
+			snapshot := am.finalSnapshotId(*id)
+			_, err = svc.DeleteDBClusterWithContext(am.Ctx, &rds.DeleteDBClusterInput{
+				DBClusterIdentifier:       id,
+				FinalDBSnapshotIdentifier: aws.String(snapshot),
+			})
+			if isCanceled(err) {
+				return err
+			}
+			if err != nil {
+				if isThrottle(err) || isInvalidRdsState(err) {
+					am.Logger.Warn(err)
+				} else {
+					am.Logger.Error(err)
+				}
+				continue
+			}
+			am.Logger.Infof("Deleted %s, final snapshot: %s", *id, snapshot)
+			am.swept("aurora", *id, false)
+			err = mark.RemoveCandidates(am.Cache, []string{am.candidateKey(*id)})
+			if err != nil {
+				am.Logger.Error(err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// deleteAuroraMembers only returns an error when we're shutting down.  members that are already being
+// deleted are left to it.
+func (am *AwsMarker) deleteAuroraMembers(c *rds.DBCluster) error {
+	svc := am.getRdsSession()
+	for _, m := range c.DBClusterMembers {
+		_, err := svc.DeleteDBInstanceWithContext(am.Ctx, &rds.DeleteDBInstanceInput{
+			DBInstanceIdentifier: m.DBInstanceIdentifier,
+		})
+		if isCanceled(err) {
+			return err
+		}
+		if err != nil && !isInvalidRdsState(err) {
+			am.Logger.Error(err)
+			continue
+		}
+		am.Logger.Infof("Deleting %s, a member of %s", *m.DBInstanceIdentifier, *c.DBClusterIdentifier)
+	}
+	am.Logger.Infof("%s will be deleted once its instances are gone", *c.DBClusterIdentifier)
+	return nil
+}
+
+// isInvalidRdsState is true when an instance or cluster is busy, usually being deleted already
+func isInvalidRdsState(err error) bool {
+	return hasErrorCode(err, rds.ErrCodeInvalidDBInstanceStateFault) || hasErrorCode(err, rds.ErrCodeInvalidDBClusterStateFault)
+}
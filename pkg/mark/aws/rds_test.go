@@ -0,0 +1,166 @@
+package aws
+
+import (
+	"fmt"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRds answers describes from instances and clusters, keyed by id, and records every delete
+type fakeRds struct {
+	mux       sync.Mutex
+	instances map[string]string
+	clusters  map[string]string
+	deletes   []url.Values
+}
+
+func (fr *fakeRds) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fr.mux.Lock()
+	defer fr.mux.Unlock()
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	switch action := r.Form.Get("Action"); action {
+	case "DescribeDBInstances":
+		db, ok := fr.instances[r.Form.Get("DBInstanceIdentifier")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`<ErrorResponse><Error><Code>DBInstanceNotFound</Code><Message>gone</Message></Error></ErrorResponse>`)) //nolint
+			return
+		}
+		w.Write([]byte(`<DescribeDBInstancesResponse><DescribeDBInstancesResult><DBInstances>` + db + `</DBInstances></DescribeDBInstancesResult></DescribeDBInstancesResponse>`)) //nolint
+	case "DescribeDBClusters":
+		c := fr.clusters[r.Form.Get("DBClusterIdentifier")]
+		w.Write([]byte(`<DescribeDBClustersResponse><DescribeDBClustersResult><DBClusters>` + c + `</DBClusters></DescribeDBClustersResult></DescribeDBClustersResponse>`)) //nolint
+	case "ListTagsForResource":
+		w.Write([]byte(`<ListTagsForResourceResponse><ListTagsForResourceResult><TagList/></ListTagsForResourceResult></ListTagsForResourceResponse>`)) //nolint
+	case "DeleteDBInstance", "DeleteDBCluster":
+		fr.deletes = append(fr.deletes, r.Form)
+		w.Write([]byte(`<` + action + `Response><` + action + `Result/></` + action + `Response>`)) //nolint
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func dbInstance(id, extra string) string {
+	return `<DBInstance><DBInstanceIdentifier>` + id + `</DBInstanceIdentifier><DBInstanceArn>arn:aws:rds:us-west-2:1:db:` + id +
+		`</DBInstanceArn><DBInstanceStatus>available</DBInstanceStatus><InstanceCreateTime>2019-01-01T00:00:00.000Z</InstanceCreateTime>` + extra + `</DBInstance>`
+}
+
+func TestSweepRds(t *testing.T) {
+	fr := &fakeRds{instances: map[string]string{
+		"db-primary":   dbInstance("db-primary", ""),
+		"db-replica":   dbInstance("db-replica", `<ReadReplicaSourceDBInstanceIdentifier>db-source</ReadReplicaSourceDBInstanceIdentifier>`),
+		"db-protected": dbInstance("db-protected", `<DeletionProtection>true</DeletionProtection>`),
+	}}
+	srv := httptest.NewServer(fr)
+	defer srv.Close()
+	am := newTestAwsMarker(t, &config.Aws{Name: "dev", DeleteEnabled: true, Rds: config.AwsRds{FinalSnapshot: "final-{id}"}}, srv.URL)
+	writeTestCandidates(t, am, "rds", "db-primary", "db-replica", "db-protected")
+
+	assert.Nil(t, am.sweepRds())
+	deleted := map[string]url.Values{}
+	for _, d := range fr.deletes {
+		deleted[d.Get("DBInstanceIdentifier")] = d
+	}
+	assert.Len(t, deleted, 2)
+	assert.Equal(t, "final-db-primary", deleted["db-primary"].Get("FinalDBSnapshotIdentifier"))
+	assert.Equal(t, "", deleted["db-replica"].Get("FinalDBSnapshotIdentifier"))
+	assert.Equal(t, "true", deleted["db-replica"].Get("SkipFinalSnapshot"))
+	for _, id := range []string{"db-primary", "db-replica", "db-protected"} {
+		assert.False(t, am.Cache.CandidateExists(am.candidateKey(id)), id)
+	}
+}
+
+func TestSweepRdsDryRun(t *testing.T) {
+	fr := &fakeRds{instances: map[string]string{"db-primary": dbInstance("db-primary", "")}}
+	srv := httptest.NewServer(fr)
+	defer srv.Close()
+	am := newTestAwsMarker(t, &config.Aws{Name: "dev"}, srv.URL)
+	writeTestCandidates(t, am, "rds", "db-primary")
+
+	assert.Nil(t, am.sweepRds())
+	assert.Empty(t, fr.deletes)
+	assert.True(t, am.Cache.CandidateExists(am.candidateKey("db-primary")))
+}
+
+func TestSweepAuroraDeletesMembersFirst(t *testing.T) {
+	cluster := `<DBCluster><DBClusterIdentifier>orders</DBClusterIdentifier><DBClusterArn>arn:aws:rds:us-west-2:1:cluster:orders</DBClusterArn>
+<Engine>aurora-postgresql</Engine><Status>available</Status>%s</DBCluster>`
+	fr := &fakeRds{clusters: map[string]string{
+		"orders": fmt.Sprintf(cluster, `<DBClusterMembers><DBClusterMember><DBInstanceIdentifier>orders-1</DBInstanceIdentifier></DBClusterMember></DBClusterMembers>`),
+	}}
+	srv := httptest.NewServer(fr)
+	defer srv.Close()
+	am := newTestAwsMarker(t, &config.Aws{Name: "dev", DeleteEnabled: true}, srv.URL)
+	writeTestCandidates(t, am, "aurora", "orders")
+
+	// the cluster can't go until its instances have
+	assert.Nil(t, am.sweepAurora())
+	assert.Len(t, fr.deletes, 1)
+	assert.Equal(t, "DeleteDBInstance", fr.deletes[0].Get("Action"))
+	assert.Equal(t, "orders-1", fr.deletes[0].Get("DBInstanceIdentifier"))
+	assert.True(t, am.Cache.CandidateExists(am.candidateKey("orders")))
+
+	fr.clusters["orders"] = fmt.Sprintf(cluster, "")
+	assert.Nil(t, am.sweepAurora())
+	assert.Len(t, fr.deletes, 2)
+	assert.Equal(t, "DeleteDBCluster", fr.deletes[1].Get("Action"))
+	assert.True(t, strings.HasPrefix(fr.deletes[1].Get("FinalDBSnapshotIdentifier"), "bilge-final-orders-"))
+	assert.False(t, am.Cache.CandidateExists(am.candidateKey("orders")))
+}
+
+func TestRdsFilters(t *testing.T) {
+	entry := logrus.NewEntry(log)
+	testCases := map[string]struct {
+		filter  TypedFilter
+		object  interface{}
+		matched bool
+	}{
+		"instance_deletion_protection": {
+			filter:  RdsIgnoreDeletionProtectionFilter,
+			object:  &rds.DBInstance{DBInstanceIdentifier: aws.String("db"), DeletionProtection: aws.Bool(true)},
+			matched: true,
+		},
+		"cluster_no_deletion_protection": {
+			filter:  RdsIgnoreDeletionProtectionFilter,
+			object:  &rds.DBCluster{DBClusterIdentifier: aws.String("c"), DeletionProtection: aws.Bool(false)},
+			matched: false,
+		},
+		"instance_with_replicas": {
+			filter:  RdsIgnoreReplicationSourceFilter,
+			object:  &rds.DBInstance{DBInstanceIdentifier: aws.String("db"), ReadReplicaDBInstanceIdentifiers: aws.StringSlice([]string{"db-r"})},
+			matched: true,
+		},
+		"instance_replica": {
+			filter:  RdsIgnoreReplicationSourceFilter,
+			object:  &rds.DBInstance{DBInstanceIdentifier: aws.String("db-r"), ReadReplicaSourceDBInstanceIdentifier: aws.String("db")},
+			matched: false,
+		},
+		"cluster_replica": {
+			filter:  RdsIgnoreReplicationSourceFilter,
+			object:  &rds.DBCluster{DBClusterIdentifier: aws.String("c-r"), ReplicationSourceIdentifier: aws.String("arn:aws:rds:us-east-1:1:cluster:c")},
+			matched: true,
+		},
+		"instance_deleting": {
+			filter:  RdsIgnoreDeletingFilter,
+			object:  &rds.DBInstance{DBInstanceIdentifier: aws.String("db"), DBInstanceStatus: aws.String(RDS_STATUS_DELETING)},
+			matched: true,
+		},
+	}
+	for desc, tc := range testCases {
+		t.Run(desc, func(t *testing.T) {
+			assert.Equal(t, tc.matched, tc.filter(tc.object, entry))
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package aws
+
+import (
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// recheckFunc describes a single candidate again and reports whether it still fails the filter chain it
+// was marked with.  found is false once the resource is gone.
+type recheckFunc func(id *string) (candidate bool, found bool, err error)
+
+// recheck runs just before a sweep deletes anything.  the candidates were judged at mark time, and an
+// owner may have fixed a tag or re-attached a volume since, so each one is described again and only the
+// ones that still aren't compliant are returned.  the rest are dropped from the cache.  anything we can't
+// describe right now is left for the next sweep rather than deleted blind.
+func (am *AwsMarker) recheck(ids []*string, describe recheckFunc) []*string {
+	stillCandidates := []*string{}
+	for _, id := range ids {
+		candidate, found, err := describe(id)
+		// we're shutting down, delete nothing
+		if isCanceled(err) {
+			return nil
+		}
+		if err != nil {
+			if isThrottle(err) {
+				am.Logger.Warnf("Couldn't recheck %s, leaving it for the next sweep: %v", *id, err)
+			} else {
+				am.Logger.Errorf("Couldn't recheck %s, leaving it for the next sweep: %v", *id, err)
+			}
+			continue
+		}
+		if found && candidate {
+			stillCandidates = append(stillCandidates, id)
+			continue
+		}
+		reason := "no longer exists"
+		if found {
+			reason = "compliant at sweep time"
+		}
+		am.Logger.Infof("Dropping candidate %s. Reason: %s", *id, reason)
+		if err := mark.Drop(am.Cache, am.candidateKey(*id), reason); err != nil {
+			am.Logger.Error(err)
+		}
+	}
+	return stillCandidates
+}
+
+// filterableCandidate runs a filter chain the same way FilterAwsObject does at mark time
+func filterableCandidate(f genericAwsFilter) (bool, bool, error) {
+	if err := f.Err(); err != nil {
+		return false, true, err
+	}
+	return !f.Ignore() && !f.Compliant(), true, nil
+}
+
+// hasErrorCode is true when err is an aws error with code, eg: a not found or an invalid state code
+func hasErrorCode(err error, code string) bool {
+	if awsErr, ok := err.(awserr.Error); ok {
+		return awsErr.Code() == code
+	}
+	return false
+}
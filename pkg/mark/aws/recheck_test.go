@@ -0,0 +1,90 @@
+package aws
+
+import (
+	"context"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// volumes as they look at sweep time, keyed by id
+var sweepTimeVolumes = map[string]string{
+	"vol-untagged": `<item><volumeId>vol-untagged</volumeId><status>available</status><createTime>2019-01-01T00:00:00.000Z</createTime></item>`,
+	"vol-fixed": `<item><volumeId>vol-fixed</volumeId><status>available</status><createTime>2019-01-01T00:00:00.000Z</createTime>
+<tagSet><item><key>ttl</key><value>0</value></item></tagSet></item>`,
+	"vol-attached": `<item><volumeId>vol-attached</volumeId><status>in-use</status><createTime>2019-01-01T00:00:00.000Z</createTime>
+<attachmentSet><item><instanceId>i-1</instanceId></item></attachmentSet></item>`,
+}
+
+func fakeVolumes(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Nil(t, r.ParseForm())
+		id := r.Form.Get("Filter.1.Value.1")
+		if id == "vol-throttled" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(throttledResponse)) //nolint
+			return
+		}
+		w.Write([]byte(`<DescribeVolumesResponse><volumeSet>` + sweepTimeVolumes[id] + `</volumeSet></DescribeVolumesResponse>`)) //nolint
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRecheck(t *testing.T) {
+	srv := fakeVolumes(t)
+	am := newTestAwsMarker(t, &config.Aws{Name: "dev"}, srv.URL)
+
+	ids := []string{"vol-untagged", "vol-fixed", "vol-attached", "vol-gone", "vol-throttled"}
+	for _, id := range ids {
+		_, err := mark.WriteCandidate(am.Cache, &mark.MarkedCandidate{
+			MarkerType:    mark.AWS,
+			CandidateType: "ebs",
+			Id:            id,
+			Owner:         "alice",
+			Account:       "dev",
+			Region:        am.region,
+		}, "0s")
+		assert.Nil(t, err)
+	}
+
+	stillCandidates := am.recheck(aws.StringSlice(ids), am.recheckEbs)
+	assert.Equal(t, []string{"vol-untagged"}, aws.StringValueSlice(stillCandidates))
+
+	expected := map[string]bool{
+		"vol-untagged":  true,
+		"vol-fixed":     false,
+		"vol-attached":  false,
+		"vol-gone":      false,
+		"vol-throttled": true,
+	}
+	for id, exists := range expected {
+		assert.Equal(t, exists, am.Cache.CandidateExists(am.candidateKey(id)), id)
+	}
+}
+
+func TestSweepStopsWhenCanceled(t *testing.T) {
+	srv := fakeVolumes(t)
+	am := newTestAwsMarker(t, &config.Aws{Name: "dev", DeleteEnabled: true, Candidates: []string{"ebs"}}, srv.URL)
+	_, err := mark.WriteCandidate(am.Cache, &mark.MarkedCandidate{
+		MarkerType:    mark.AWS,
+		CandidateType: "ebs",
+		Id:            "vol-untagged",
+		Owner:         "alice",
+		Account:       "dev",
+		Region:        am.region,
+	}, "0s")
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	am.Ctx = ctx
+	assert.Nil(t, am.sweepEbs())
+	assert.False(t, am.sweep())
+	// nothing was deleted, so the candidate is still there for the next sweep
+	assert.True(t, am.Cache.CandidateExists(am.candidateKey("vol-untagged")))
+}
@@ -0,0 +1,299 @@
+package aws
+
+import (
+	"fmt"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"sync"
+)
+
+const (
+	// errors s3 returns for a bucket that has none of the thing asked for
+	S3_NO_TAGS        = "NoSuchTagSet"
+	S3_NO_OBJECT_LOCK = "ObjectLockConfigurationNotFoundError"
+	S3_NO_POLICY      = "NoSuchBucketPolicy"
+	// DeleteObjects takes at most this many keys
+	S3_DELETE_BATCH = 1000
+)
+
+// s3Bucket is a bucket with everything its filters look at, each of which takes a call of its own to find
+type s3Bucket struct {
+	*s3.Bucket
+	Tags   []*ec2.Tag
+	Locked bool
+	Policy string
+}
+
+// bucketRegions lists the account's buckets and finds each one's region once, for every region's marker to
+// share.  a listing that fails isn't kept, so the next pass tries again.
+type bucketRegions struct {
+	mux     sync.Mutex
+	buckets map[string][]*s3.Bucket
+}
+
+func (br *bucketRegions) get(am *AwsMarker) ([]*s3.Bucket, error) {
+	br.mux.Lock()
+	defer br.mux.Unlock()
+	if br.buckets == nil {
+		buckets, err := am.listBucketRegions()
+		if err != nil {
+			return nil, err
+		}
+		br.buckets = buckets
+	}
+	return br.buckets[am.region], nil
+}
+
+func (am *AwsMarker) listBucketRegions() (map[string][]*s3.Bucket, error) {
+	result, err := am.getS3Session().ListBucketsWithContext(am.Ctx, &s3.ListBucketsInput{})
+	if err != nil {
+		return nil, err
+	}
+	buckets := make(map[string][]*s3.Bucket)
+	for _, b := range result.Buckets {
+		region, err := am.bucketRegion(b.Name)
+		if isThrottle(err) || isCanceled(err) {
+			return nil, err
+		}
+		if err != nil {
+			am.Logger.Errorf("Couldn't find the region of %s: %v", *b.Name, err)
+			continue
+		}
+		buckets[region] = append(buckets[region], b)
+	}
+	return buckets, nil
+}
+
+func (am *AwsMarker) bucketRegion(name *string) (string, error) {
+	location, err := am.getS3Session().GetBucketLocationWithContext(am.Ctx, &s3.GetBucketLocationInput{Bucket: name})
+	if err != nil {
+		return "", err
+	}
+	return s3.NormalizeBucketLocation(aws.StringValue(location.LocationConstraint)), nil
+}
+
+func (am *AwsMarker) markS3() error {
+	// buckets are listed for the whole account, the marker for each region only looks at its own
+	if am.buckets == nil {
+		am.buckets = &bucketRegions{}
+	}
+	buckets, err := am.buckets.get(am)
+	if isThrottle(err) {
+		am.skip("s3 buckets", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, b := range buckets {
+		bucket, err := am.describeBucket(b)
+		if isThrottle(err) {
+			am.skip(fmt.Sprintf("s3 bucket %s", *b.Name), err)
+			continue
+		}
+		if err != nil {
+			am.Logger.Error(err)
+			continue
+		}
+		am.FilterAwsObject(am.s3Filterable(bucket))
+	}
+	return nil
+}
+
+// describeBucket looks up everything the filters want to know about a bucket in the marker's region
+func (am *AwsMarker) describeBucket(b *s3.Bucket) (*s3Bucket, error) {
+	svc := am.getS3Session()
+
+	bucket := &s3Bucket{Bucket: b}
+	tagging, err := svc.GetBucketTaggingWithContext(am.Ctx, &s3.GetBucketTaggingInput{Bucket: b.Name})
+	if err != nil && !hasErrorCode(err, S3_NO_TAGS) {
+		return nil, err
+	}
+	if err == nil {
+		for _, t := range tagging.TagSet {
+			bucket.Tags = append(bucket.Tags, &ec2.Tag{Key: t.Key, Value: t.Value})
+		}
+	}
+	lock, err := svc.GetObjectLockConfigurationWithContext(am.Ctx, &s3.GetObjectLockConfigurationInput{Bucket: b.Name})
+	if err != nil && !hasErrorCode(err, S3_NO_OBJECT_LOCK) {
+		return nil, err
+	}
+	if err == nil && lock.ObjectLockConfiguration != nil {
+		bucket.Locked = aws.StringValue(lock.ObjectLockConfiguration.ObjectLockEnabled) == s3.ObjectLockEnabledEnabled
+	}
+	policy, err := svc.GetBucketPolicyWithContext(am.Ctx, &s3.GetBucketPolicyInput{Bucket: b.Name})
+	if err != nil && !hasErrorCode(err, S3_NO_POLICY) {
+		return nil, err
+	}
+	if err == nil {
+		bucket.Policy = aws.StringValue(policy.Policy)
+	}
+	return bucket, nil
+}
+
+func (am *AwsMarker) s3Filterable(b *s3Bucket) *awsFilterable {
+	return am.newAwsFilterable(b).
+		WithIgnoreFilter(am.IgnoreConfigFilter).
+		WithTypedIgnoreFilter(S3IgnoreObjectLockFilter).
+		WithTypedIgnoreFilter(am.S3IgnoreProtectedPolicyFilter).
+		WithComplianceFilter(NoTagFilter).
+		WithComplianceFilter(am.NoTTLTagFilter).
+		WithComplianceFilter(am.TTLTagExpiredFilter)
+}
+
+// loadBuckets resets the account's buckets by name.  the listing is the only place a bucket's creation date
+// comes from.
+func (am *AwsMarker) loadBuckets() error {
+	am.bucketNames = nil
+	result, err := am.getS3Session().ListBucketsWithContext(am.Ctx, &s3.ListBucketsInput{})
+	if err != nil {
+		return err
+	}
+	buckets := make(map[string]*s3.Bucket)
+	for _, b := range result.Buckets {
+		buckets[*b.Name] = b
+	}
+	am.bucketNames = buckets
+	return nil
+}
+
+// recheckS3 needs the buckets loaded by sweepS3
+func (am *AwsMarker) recheckS3(id *string) (bool, bool, error) {
+	region, err := am.bucketRegion(id)
+	if hasErrorCode(err, s3.ErrCodeNoSuchBucket) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	b, ok := am.bucketNames[*id]
+	// a bucket by this name that's newer than the listing, or in another region, isn't the one that was marked
+	if !ok || region != am.region {
+		return false, false, nil
+	}
+	bucket, err := am.describeBucket(b)
+	if hasErrorCode(err, s3.ErrCodeNoSuchBucket) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return filterableCandidate(am.s3Filterable(bucket))
+}
+
+// s3Config falls back to the defaults for markers built without a defaulted config
+func (am *AwsMarker) s3Config() config.AwsS3 {
+	as := am.Config.S3
+	if as.ProtectedPolicy == "" {
+		as.ProtectedPolicy = config.DEFAULT_S3_PROTECTED_POLICY
+	}
+	if as.MaxObjects == 0 {
+		as.MaxObjects = config.DEFAULT_S3_MAX_OBJECTS
+	}
+	return as
+}
+
+// sweepS3 empties each bucket of every version and delete marker before deleting it.  a bucket with more
+// than max_objects in it is refused rather than emptied, in a dry run too, so its owner can clear it out
+// themselves or exempt it.
+func (am *AwsMarker) sweepS3() error {
+	svc := am.getS3Session()
+	maxObjects := am.s3Config().MaxObjects
+
+	owners, err := am.Cache.ReadOwners()
+	if err != nil {
+		return err
+	}
+	if err := am.loadBuckets(); err != nil {
+		am.Logger.Warnf("Couldn't list s3 buckets, leaving them for the next sweep: %v", err)
+		return nil
+	}
+
+	for _, o := range owners {
+		toDelete := am.recheck(am.toDelete(o, "s3"), am.recheckS3)
+		am.Logger.Debug("DryRun? ", !am.Config.DeleteEnabled)
+		for _, b := range toDelete {
+			objects, err := am.bucketObjects(b, maxObjects)
+			if isCanceled(err) {
+				return err
+			}
+			if err != nil {
+				am.Logger.Warnf("Couldn't list the objects in %s, leaving it for the next sweep: %v", *b, err)
+				continue
+			}
+			if len(objects) > maxObjects {
+				am.refused("s3", *b, fmt.Sprintf("holds more than max_objects (%d)", maxObjects), !am.Config.DeleteEnabled)
+				continue
+			}
+			if !am.Config.DeleteEnabled {
+				am.Logger.Warnf("Would have emptied %s of %d objects and deleted it but we're in DryRun", *b, len(objects))
+				am.swept("s3", *b, true)
+				continue
+			}
+			if err := am.emptyBucket(b, objects); err != nil {
+				if isCanceled(err) {
+					return err
+				}
+				am.Logger.Warnf("Couldn't empty %s, leaving it for the next sweep: %v", *b, err)
+				continue
+			}
+			_, err = svc.DeleteBucketWithContext(am.Ctx, &s3.DeleteBucketInput{Bucket: b})
+			if isCanceled(err) {
+				return err
+			}
+			if err != nil {
+				// something was written to it since we listed it, the next sweep will get it
+				am.Logger.Warn(err)
+				continue
+			}
+			am.Logger.Infof("Emptied %s of %d objects and deleted it", *b, len(objects))
+			am.swept("s3", *b, false)
+			err = mark.RemoveCandidates(am.Cache, []string{am.candidateKey(*b)})
+			if err != nil {
+				am.Logger.Error(err)
+			}
+		}
+	}
+	return nil
+}
+
+// bucketObjects lists every version and delete marker in a bucket, stopping once there are more than
+// limit of them
+func (am *AwsMarker) bucketObjects(bucket *string, limit int) ([]*s3.ObjectIdentifier, error) {
+	objects := []*s3.ObjectIdentifier{}
+	err := am.getS3Session().ListObjectVersionsPagesWithContext(am.Ctx, &s3.ListObjectVersionsInput{Bucket: bucket}, func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
+		for _, v := range page.Versions {
+			objects = append(objects, &s3.ObjectIdentifier{Key: v.Key, VersionId: v.VersionId})
+		}
+		for _, dm := range page.DeleteMarkers {
+			objects = append(objects, &s3.ObjectIdentifier{Key: dm.Key, VersionId: dm.VersionId})
+		}
+		return len(objects) <= limit
+	})
+	return objects, err
+}
+
+func (am *AwsMarker) emptyBucket(bucket *string, objects []*s3.ObjectIdentifier) error {
+	svc := am.getS3Session()
+	for start := 0; start < len(objects); start += S3_DELETE_BATCH {
+		end := start + S3_DELETE_BATCH
+		if end > len(objects) {
+			end = len(objects)
+		}
+		result, err := svc.DeleteObjectsWithContext(am.Ctx, &s3.DeleteObjectsInput{
+			Bucket: bucket,
+			Delete: &s3.Delete{Objects: objects[start:end], Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return err
+		}
+		if len(result.Errors) != 0 {
+			e := result.Errors[0]
+			return fmt.Errorf("%d objects weren't deleted, eg: %s: %s", len(result.Errors), aws.StringValue(e.Key), aws.StringValue(e.Message))
+		}
+	}
+	return nil
+}
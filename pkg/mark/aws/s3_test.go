@@ -0,0 +1,217 @@
+package aws
+
+import (
+	"fmt"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type fakeBucket struct {
+	region  string
+	objects int
+	locked  bool
+	policy  string
+	tags    string
+}
+
+// fakeS3 answers path style requests for buckets, keyed by name, and records every object and bucket
+// deleted, along with how many times buckets were listed and located
+type fakeS3 struct {
+	mux            sync.Mutex
+	buckets        map[string]*fakeBucket
+	deletedObjects int
+	deleted        []string
+	listed         int
+	located        int
+}
+
+func s3Error(w http.ResponseWriter, code string) {
+	w.WriteHeader(http.StatusNotFound)
+	w.Write([]byte(`<Error><Code>` + code + `</Code><Message>none</Message></Error>`)) //nolint
+}
+
+func (fs *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	name := strings.Trim(r.URL.Path, "/")
+	if name == "" {
+		fs.listed++
+		buckets := ""
+		for n := range fs.buckets {
+			buckets += `<Bucket><Name>` + n + `</Name><CreationDate>2019-01-01T00:00:00.000Z</CreationDate></Bucket>`
+		}
+		w.Write([]byte(`<ListAllMyBucketsResult><Buckets>` + buckets + `</Buckets></ListAllMyBucketsResult>`)) //nolint
+		return
+	}
+	b, ok := fs.buckets[name]
+	if !ok {
+		s3Error(w, "NoSuchBucket")
+		return
+	}
+	q := r.URL.Query()
+	switch {
+	case r.Method == http.MethodDelete:
+		fs.deleted = append(fs.deleted, name)
+		delete(fs.buckets, name)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && q.Has("delete"):
+		body, _ := io.ReadAll(r.Body)
+		fs.deletedObjects += strings.Count(string(body), "<Object>")
+		b.objects = 0
+		w.Write([]byte(`<DeleteResult/>`)) //nolint
+	case q.Has("location"):
+		fs.located++
+		w.Write([]byte(`<LocationConstraint>` + b.region + `</LocationConstraint>`)) //nolint
+	case q.Has("tagging"):
+		if b.tags == "" {
+			s3Error(w, S3_NO_TAGS)
+			return
+		}
+		w.Write([]byte(`<Tagging><TagSet>` + b.tags + `</TagSet></Tagging>`)) //nolint
+	case q.Has("object-lock"):
+		if !b.locked {
+			s3Error(w, S3_NO_OBJECT_LOCK)
+			return
+		}
+		w.Write([]byte(`<ObjectLockConfiguration><ObjectLockEnabled>Enabled</ObjectLockEnabled></ObjectLockConfiguration>`)) //nolint
+	case q.Has("policy"):
+		if b.policy == "" {
+			s3Error(w, S3_NO_POLICY)
+			return
+		}
+		w.Write([]byte(b.policy)) //nolint
+	case q.Has("versions"):
+		versions := ""
+		for i := 0; i < b.objects; i++ {
+			// every other one is a delete marker
+			tag := "Version"
+			if i%2 == 1 {
+				tag = "DeleteMarker"
+			}
+			versions += fmt.Sprintf(`<%s><Key>k%d</Key><VersionId>v%d</VersionId></%s>`, tag, i/2, i, tag)
+		}
+		w.Write([]byte(`<ListVersionsResult><IsTruncated>false</IsTruncated>` + versions + `</ListVersionsResult>`)) //nolint
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestMarkS3(t *testing.T) {
+	fs := &fakeS3{buckets: map[string]*fakeBucket{
+		"scratch":   {region: "us-west-2"},
+		"elsewhere": {region: "eu-west-1"},
+		"locked":    {region: "us-west-2", locked: true},
+		"protected": {region: "us-west-2", policy: `{"Statement":[{"Effect":"Deny","Action":"s3:DeleteBucket"}]}`},
+		"public":    {region: "us-west-2", policy: `{"Statement":[{"Effect":"Allow","Action":"s3:GetObject"}]}`},
+	}}
+	srv := httptest.NewServer(fs)
+	defer srv.Close()
+	am := newTestAwsMarker(t, &config.Aws{Name: "dev", GracePeriod: "1h"}, srv.URL)
+
+	assert.Nil(t, am.markS3())
+	for id, marked := range map[string]bool{"scratch": true, "public": true, "elsewhere": false, "locked": false, "protected": false} {
+		assert.Equal(t, marked, am.Cache.CandidateExists(am.candidateKey(id)), id)
+	}
+}
+
+func TestMarkS3ListsBucketsOncePerRun(t *testing.T) {
+	fs := &fakeS3{buckets: map[string]*fakeBucket{
+		"west":  {region: "us-west-2"},
+		"east":  {region: "us-east-1"},
+		"east2": {region: "us-east-1"},
+	}}
+	srv := httptest.NewServer(fs)
+	defer srv.Close()
+	am := newTestAwsMarker(t, &config.Aws{Name: "dev", GracePeriod: "1h"}, srv.URL)
+	am.buckets = &bucketRegions{}
+
+	for _, region := range []string{"us-west-2", "us-east-1", "eu-west-1"} {
+		assert.Nil(t, am.forRegion(region).markS3())
+	}
+	assert.Equal(t, 1, fs.listed)
+	assert.Equal(t, 3, fs.located)
+	for _, id := range []string{"west", "east", "east2"} {
+		region := fs.buckets[id].region
+		assert.True(t, am.Cache.CandidateExists(mark.CandidateKey(mark.AWS, "dev", region, id)), id)
+	}
+}
+
+func TestSweepS3RechecksEachBucket(t *testing.T) {
+	fs := &fakeS3{buckets: map[string]*fakeBucket{
+		"scratch":  {region: "us-west-2"},
+		"scratch2": {region: "us-west-2"},
+		"moved":    {region: "eu-west-1"},
+	}}
+	srv := httptest.NewServer(fs)
+	defer srv.Close()
+	am := newTestAwsMarker(t, &config.Aws{Name: "dev", DeleteEnabled: true}, srv.URL)
+	writeTestCandidates(t, am, "s3", "scratch", "scratch2", "moved", "gone")
+
+	assert.Nil(t, am.sweepS3())
+	assert.Equal(t, 1, fs.listed)
+	assert.ElementsMatch(t, []string{"scratch", "scratch2"}, fs.deleted)
+	for _, id := range []string{"scratch", "scratch2", "moved", "gone"} {
+		assert.False(t, am.Cache.CandidateExists(am.candidateKey(id)), id)
+	}
+}
+
+func TestSweepS3EmptiesBucket(t *testing.T) {
+	fs := &fakeS3{buckets: map[string]*fakeBucket{"scratch": {region: "us-west-2", objects: 3}}}
+	srv := httptest.NewServer(fs)
+	defer srv.Close()
+	am := newTestAwsMarker(t, &config.Aws{Name: "dev", DeleteEnabled: true}, srv.URL)
+	writeTestCandidates(t, am, "s3", "scratch")
+
+	assert.Nil(t, am.sweepS3())
+	assert.Equal(t, 3, fs.deletedObjects)
+	assert.Equal(t, []string{"scratch"}, fs.deleted)
+	assert.False(t, am.Cache.CandidateExists(am.candidateKey("scratch")))
+}
+
+func TestSweepS3RefusesOverMaxObjects(t *testing.T) {
+	for desc, deleteEnabled := range map[string]bool{"delete_enabled": true, "dry_run": false} {
+		t.Run(desc, func(t *testing.T) {
+			fs := &fakeS3{buckets: map[string]*fakeBucket{"full": {region: "us-west-2", objects: 3}}}
+			srv := httptest.NewServer(fs)
+			defer srv.Close()
+			am := newTestAwsMarker(t, &config.Aws{Name: "dev", DeleteEnabled: deleteEnabled, S3: config.AwsS3{MaxObjects: 2}}, srv.URL)
+			writeTestCandidates(t, am, "s3", "full")
+
+			assert.Nil(t, am.sweepS3())
+			assert.Zero(t, fs.deletedObjects)
+			assert.Empty(t, fs.deleted)
+			assert.True(t, am.Cache.CandidateExists(am.candidateKey("full")))
+			events, err := mark.ReadAudit(am.Cache, mark.AuditQuery{Id: "full"})
+			assert.Nil(t, err)
+			last := events[len(events)-1]
+			assert.Equal(t, mark.AUDIT_REFUSE, last.Action)
+			assert.Equal(t, "holds more than max_objects (2)", last.Reason)
+			assert.Equal(t, !deleteEnabled, last.DryRun)
+		})
+	}
+}
+
+func TestSweepS3DryRun(t *testing.T) {
+	fs := &fakeS3{buckets: map[string]*fakeBucket{"scratch": {region: "us-west-2", objects: 3}}}
+	srv := httptest.NewServer(fs)
+	defer srv.Close()
+	am := newTestAwsMarker(t, &config.Aws{Name: "dev"}, srv.URL)
+	writeTestCandidates(t, am, "s3", "scratch")
+
+	assert.Nil(t, am.sweepS3())
+	assert.Zero(t, fs.deletedObjects)
+	assert.Empty(t, fs.deleted)
+	assert.True(t, am.Cache.CandidateExists(am.candidateKey("scratch")))
+	events, err := mark.ReadAudit(am.Cache, mark.AuditQuery{Id: "scratch"})
+	assert.Nil(t, err)
+	last := events[len(events)-1]
+	assert.Equal(t, mark.AUDIT_DELETE, last.Action)
+	assert.True(t, last.DryRun)
+}
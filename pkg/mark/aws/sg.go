@@ -5,110 +5,106 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/elbv2"
 )
 
 func (am *AwsMarker) markSG() error {
 	svc := am.getEc2Session()
 
-	// reset the in-use security groups
-	am.sgs = nil
-	am.sgs = []map[string]bool{
-		am.getEc2InstanceSgList(),
-		am.getElbV2SgList(),
-		am.getElbSgList(),
+	// if we can't tell what's in use we can't tell what isn't, so skip the whole run rather than mark
+	// groups that are attached to something
+	if what, err := am.loadInUseSgs(); err != nil {
+		if isThrottle(err) {
+			am.skip(what, err)
+			return nil
+		}
+		return err
 	}
 
-	err := svc.DescribeSecurityGroupsPages(nil, am.processSGMarkPages)
-	if serr, ok := err.(awserr.Error); ok {
-		if serr.Code() == "Throttling" {
-			am.Logger.Warn(err)
-		} else {
-			return err
-		}
+	err := svc.DescribeSecurityGroupsPagesWithContext(am.Ctx, nil, am.processSGMarkPages)
+	if isThrottle(err) {
+		am.skip("security group pages", err)
+		return nil
 	}
-	return nil
+	return err
 }
 
-func (am *AwsMarker) getEc2InstanceSgList() map[string]bool {
-	svc := am.getEc2Session()
-
-	result, err := svc.DescribeInstances(nil)
-	if serr, ok := err.(awserr.Error); ok {
-		if serr.Code() == "Throttling" {
-			am.Logger.Warn(err)
-		} else {
-			am.Logger.Error(err)
-			return nil
+// loadInUseSgs resets the in-use security groups, returning what it was listing when it fails
+func (am *AwsMarker) loadInUseSgs() (string, error) {
+	am.sgs = nil
+	for what, list := range map[string]func() (map[string]bool, error){
+		"instance security groups":  am.getEc2InstanceSgList,
+		"alb security groups":       am.getElbV2SgList,
+		"elb security groups":       am.getElbSgList,
+		"interface security groups": am.getEniSgList,
+	} {
+		sgs, err := list()
+		if err != nil {
+			am.sgs = nil
+			return what, err
 		}
+		am.sgs = append(am.sgs, sgs)
 	}
+	return "", nil
+}
+
+func (am *AwsMarker) getEc2InstanceSgList() (map[string]bool, error) {
+	svc := am.getEc2Session()
 
 	instanceSgs := make(map[string]bool)
-	if len(result.Reservations) != 0 {
-		for _, r := range result.Reservations {
-			if len(r.Instances) != 0 {
-				for _, i := range r.Instances {
-					for _, sg := range i.SecurityGroups {
-						instanceSgs[*sg.GroupId] = true
-					}
+	err := svc.DescribeInstancesPagesWithContext(am.Ctx, nil, func(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
+		for _, r := range page.Reservations {
+			for _, i := range r.Instances {
+				for _, sg := range i.SecurityGroups {
+					instanceSgs[*sg.GroupId] = true
 				}
 			}
 		}
+		return page.NextToken != nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return instanceSgs
+	return instanceSgs, nil
 }
 
-func (am *AwsMarker) getElbV2SgList() map[string]bool {
+func (am *AwsMarker) getElbV2SgList() (map[string]bool, error) {
 	// covers ELB and ALB new-gen
 	svc := am.getElbV2Session()
 
-	result, err := svc.DescribeLoadBalancers(nil)
-	if serr, ok := err.(awserr.Error); ok {
-		if serr.Code() == "Throttling" {
-			am.Logger.Warn(err)
-		} else {
-			am.Logger.Error(err)
-			return nil
-		}
-	}
-
 	elbSgs := make(map[string]bool)
-	if len(result.LoadBalancers) != 0 {
-		for _, l := range result.LoadBalancers {
-			if len(l.SecurityGroups) != 0 {
-				for _, sg := range l.SecurityGroups {
-					elbSgs[*sg] = true
-				}
+	err := svc.DescribeLoadBalancersPagesWithContext(am.Ctx, nil, func(page *elbv2.DescribeLoadBalancersOutput, lastPage bool) bool {
+		for _, l := range page.LoadBalancers {
+			for _, sg := range l.SecurityGroups {
+				elbSgs[*sg] = true
 			}
 		}
+		return page.NextMarker != nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return elbSgs
+	return elbSgs, nil
 }
 
-func (am *AwsMarker) getElbSgList() map[string]bool {
+func (am *AwsMarker) getElbSgList() (map[string]bool, error) {
 	// covers classic ELB
 	svc := am.getElbSession()
 
-	result, err := svc.DescribeLoadBalancers(nil)
-	if serr, ok := err.(awserr.Error); ok {
-		if serr.Code() == "Throttling" {
-			am.Logger.Warn(err)
-		} else {
-			am.Logger.Error(err)
-			return nil
-		}
-	}
-
 	elbSgs := make(map[string]bool)
-	if len(result.LoadBalancerDescriptions) != 0 {
-		for _, lb := range result.LoadBalancerDescriptions {
-			if len(lb.SecurityGroups) != 0 {
-				for _, sg := range lb.SecurityGroups {
-					elbSgs[*sg] = true
-				}
+	err := svc.DescribeLoadBalancersPagesWithContext(am.Ctx, nil, func(page *elb.DescribeLoadBalancersOutput, lastPage bool) bool {
+		for _, lb := range page.LoadBalancerDescriptions {
+			for _, sg := range lb.SecurityGroups {
+				elbSgs[*sg] = true
 			}
 		}
+		return page.NextMarker != nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return elbSgs
+	return elbSgs, nil
 }
 
 func (am *AwsMarker) processSGMarkPages(page *ec2.DescribeSecurityGroupsOutput, lastPage bool) bool {
@@ -119,11 +115,7 @@ func (am *AwsMarker) processSGMarkPages(page *ec2.DescribeSecurityGroupsOutput,
 
 	if len(page.SecurityGroups) != 0 {
 		for _, sg := range page.SecurityGroups {
-			am.FilterAwsObject(am.newAwsFilterable(sg).
-				WithIgnoreFilter(am.IgnoreConfigFilter).
-				WithTypedIgnoreFilter(SGIgnoreChild).
-				WithTypedIgnoreFilter(am.SGIgnoreInUse).
-				WithComplianceFilter(NoTagFilter))
+			am.FilterAwsObject(am.sgFilterable(sg))
 		}
 	}
 
@@ -133,6 +125,29 @@ func (am *AwsMarker) processSGMarkPages(page *ec2.DescribeSecurityGroupsOutput,
 	return false
 }
 
+func (am *AwsMarker) sgFilterable(sg *ec2.SecurityGroup) *awsFilterable {
+	return am.newAwsFilterable(sg).
+		WithIgnoreFilter(am.IgnoreConfigFilter).
+		WithTypedIgnoreFilter(SGIgnoreChild).
+		WithTypedIgnoreFilter(am.SGIgnoreInUse).
+		WithComplianceFilter(NoTagFilter).
+		WithComplianceFilter(am.TTLTagExpiredFilter)
+}
+
+// recheckSG needs the in-use security groups loaded by sweepSG
+func (am *AwsMarker) recheckSG(id *string) (bool, bool, error) {
+	result, err := am.getEc2Session().DescribeSecurityGroupsWithContext(am.Ctx, &ec2.DescribeSecurityGroupsInput{
+		Filters: []*ec2.Filter{{Name: aws.String("group-id"), Values: []*string{id}}},
+	})
+	if err != nil {
+		return false, false, err
+	}
+	for _, sg := range result.SecurityGroups {
+		return filterableCandidate(am.sgFilterable(sg))
+	}
+	return false, false, nil
+}
+
 func (am *AwsMarker) sweepSG() error {
 	svc := am.getEc2Session()
 
@@ -140,9 +155,14 @@ func (am *AwsMarker) sweepSG() error {
 	if err != nil {
 		return err
 	}
+	// a group that picked up an attachment during its grace period must not be deleted
+	if what, err := am.loadInUseSgs(); err != nil {
+		am.Logger.Warnf("Couldn't list %s, leaving security groups for the next sweep: %v", what, err)
+		return nil
+	}
 
 	for _, o := range owners {
-		toDelete := am.toDelete(o, "sg")
+		toDelete := am.recheck(am.toDelete(o, "sg"), am.recheckSG)
 
 		am.Logger.Debug("DryRun? ", !am.Config.DeleteEnabled)
 		if len(toDelete) != 0 {
@@ -151,19 +171,25 @@ func (am *AwsMarker) sweepSG() error {
 					GroupId: sg,
 					DryRun:  aws.Bool(!am.Config.DeleteEnabled),
 				}
-				_, err := svc.DeleteSecurityGroup(delSgs)
+				_, err := svc.DeleteSecurityGroupWithContext(am.Ctx, delSgs)
+				if isCanceled(err) {
+					return err
+				}
 				if awsErr, ok := err.(awserr.Error); ok {
 					if awsErr.Code() == "DryRunOperation" {
 						am.Logger.Warnf("Would have deleted %d instances but we're in DryRun", len(toDelete))
+						am.swept("sg", *sg, true)
 						continue
 					}
-					if awsErr.Code() == "Throttling" {
+					if isThrottle(awsErr) {
 						am.Logger.Warn(err)
 						continue
 					}
 					am.Logger.Error(awsErr)
+				} else if err == nil {
+					am.swept("sg", *sg, false)
 				}
-				err = mark.RemoveCandidates(o, am.Cache, []*string{sg})
+				err = mark.RemoveCandidates(am.Cache, []string{am.candidateKey(*sg)})
 				if err != nil {
 					am.Logger.Error(err)
 				}
@@ -0,0 +1,128 @@
+package aws
+
+import (
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func (am *AwsMarker) markSnapshot() error {
+	svc := am.getEc2Session()
+
+	// a snapshot behind an image can't be deleted until the image is, so skip the whole run rather than
+	// mark snapshots we can't tell apart
+	if err := am.loadAmiSnapshots(); err != nil {
+		if isThrottle(err) {
+			am.skip("image snapshots", err)
+			return nil
+		}
+		return err
+	}
+
+	err := svc.DescribeSnapshotsPagesWithContext(am.Ctx, &ec2.DescribeSnapshotsInput{
+		OwnerIds: []*string{aws.String(OWNER_SELF)},
+	}, am.processSnapshotMarkPages)
+	if isThrottle(err) {
+		am.skip("snapshot pages", err)
+		return nil
+	}
+	return err
+}
+
+// loadAmiSnapshots maps each snapshot behind one of the account's images to the images it's behind
+func (am *AwsMarker) loadAmiSnapshots() error {
+	am.amiSnapshots = nil
+	result, err := am.getEc2Session().DescribeImagesWithContext(am.Ctx, &ec2.DescribeImagesInput{
+		Owners: []*string{aws.String(OWNER_SELF)},
+	})
+	if err != nil {
+		return err
+	}
+	amiSnapshots := map[string][]string{}
+	for _, i := range result.Images {
+		for _, s := range amiSnapshotIds(i) {
+			amiSnapshots[s] = append(amiSnapshots[s], *i.ImageId)
+		}
+	}
+	am.amiSnapshots = amiSnapshots
+	return nil
+}
+
+func (am *AwsMarker) processSnapshotMarkPages(page *ec2.DescribeSnapshotsOutput, lastPage bool) bool {
+	for _, s := range page.Snapshots {
+		am.FilterAwsObject(am.snapshotFilterable(s))
+	}
+	return page.NextToken != nil
+}
+
+func (am *AwsMarker) snapshotFilterable(s *ec2.Snapshot) *awsFilterable {
+	return am.newAwsFilterable(s).
+		WithIgnoreFilter(am.IgnoreConfigFilter).
+		WithTypedIgnoreFilter(am.SnapshotIgnoreAmiBacked).
+		WithComplianceFilter(NoTagFilter).
+		WithComplianceFilter(am.NoTTLTagFilter).
+		WithComplianceFilter(am.TTLTagExpiredFilter)
+}
+
+// recheckSnapshot needs the image snapshots loaded by sweepSnapshot
+func (am *AwsMarker) recheckSnapshot(id *string) (bool, bool, error) {
+	result, err := am.getEc2Session().DescribeSnapshotsWithContext(am.Ctx, &ec2.DescribeSnapshotsInput{
+		OwnerIds: []*string{aws.String(OWNER_SELF)},
+		Filters:  []*ec2.Filter{{Name: aws.String("snapshot-id"), Values: []*string{id}}},
+	})
+	if err != nil {
+		return false, false, err
+	}
+	for _, s := range result.Snapshots {
+		return filterableCandidate(am.snapshotFilterable(s))
+	}
+	return false, false, nil
+}
+
+func (am *AwsMarker) sweepSnapshot() error {
+	svc := am.getEc2Session()
+
+	owners, err := am.Cache.ReadOwners()
+	if err != nil {
+		return err
+	}
+	// a snapshot that was registered as an image during its grace period must not be deleted
+	if err := am.loadAmiSnapshots(); err != nil {
+		am.Logger.Warnf("Couldn't list image snapshots, leaving snapshots for the next sweep: %v", err)
+		return nil
+	}
+
+	for _, o := range owners {
+		toDelete := am.recheck(am.toDelete(o, "snapshot"), am.recheckSnapshot)
+		am.Logger.Debug("DryRun? ", !am.Config.DeleteEnabled)
+		for _, s := range toDelete {
+			_, err := svc.DeleteSnapshotWithContext(am.Ctx, &ec2.DeleteSnapshotInput{
+				SnapshotId: s,
+				DryRun:     aws.Bool(!am.Config.DeleteEnabled),
+			})
+			if isCanceled(err) {
+				return err
+			}
+			if awsErr, ok := err.(awserr.Error); ok {
+				if awsErr.Code() == "DryRunOperation" {
+					am.Logger.Warnf("Would have deleted %s but we're in DryRun", *s)
+					am.swept("snapshot", *s, true)
+					continue
+				}
+				if isThrottle(awsErr) {
+					am.Logger.Warn(err)
+					continue
+				}
+				am.Logger.Error(awsErr)
+			} else if err == nil {
+				am.swept("snapshot", *s, false)
+			}
+			err = mark.RemoveCandidates(am.Cache, []string{am.candidateKey(*s)})
+			if err != nil {
+				am.Logger.Error(err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package gcp
+
+import (
+	"google.golang.org/api/compute/v1"
+)
+
+func (gm *GcpMarker) markDisk() error {
+	call := gm.compute.Disks.AggregatedList(gm.Config.Project)
+	return call.Pages(gm.Ctx, gm.processDiskPages)
+}
+
+func (gm *GcpMarker) processDiskPages(page *compute.DiskAggregatedList) error {
+	for _, scoped := range page.Items {
+		for _, d := range scoped.Disks {
+			gm.FilterGcpObject(gm.newGcpFilterable(d).
+				WithIgnoreFilter(gm.IgnoreConfigFilter).
+				WithIgnoreFilter(GceIgnoreGkeNodeFilter).
+				WithTypedIgnoreFilter(DiskIgnoreAttachedFilter).
+				WithComplianceFilter(NoLabelFilter).
+				WithComplianceFilter(gm.NoTTLLabelFilter).
+				WithComplianceFilter(gm.TTLLabelExpiredFilter))
+		}
+	}
+	return nil
+}
+
+func (gm *GcpMarker) sweepDisk() error {
+	return gm.sweepCandidates("disk", func(zone, name string) error {
+		_, err := gm.compute.Disks.Delete(gm.Config.Project, zone, name).Context(gm.Ctx).Do()
+		return err
+	})
+}
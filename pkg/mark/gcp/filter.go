@@ -0,0 +1,280 @@
+package gcp
+
+import (
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/armory-io/bilgepump/pkg/metrics"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/container/v1"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type genericGcpFilter interface {
+	Ignore() bool
+	Compliant() bool
+	GetTypeString() string
+	GetTypeInterface() interface{}
+	// the filter that made the last Ignore or Compliant call return what it did
+	Reason() string
+}
+
+func (gm *GcpMarker) FilterGcpObject(filterable genericGcpFilter) {
+	gm.inventory.Add(filterable.GetTypeString())
+	if filterable.Ignore() {
+		gm.count(metrics.CandidatesIgnored, filterable.GetTypeString())
+		err := gm.filterableUpdate(filterable.GetTypeInterface(), filterable.GetTypeString(), filterable.Reason())
+		if err != nil {
+			gm.Logger.Error(err)
+		}
+		return
+	}
+	if !filterable.Compliant() {
+		err := gm.ttlRejected(filterable.GetTypeInterface(), filterable.GetTypeString(), filterable.Reason())
+		if err != nil {
+			gm.Logger.Error(err)
+		}
+	}
+}
+
+type gcpFilterable struct {
+	ignoreFilters          []Filter
+	complianceFilters      []Filter
+	typedIgnoreFilters     []TypedFilter
+	typedComplianceFilters []TypedFilter
+	id                     string
+	labels                 map[string]string
+	created                *time.Time
+	log                    *logrus.Entry
+	gcpObjectType          string
+	object                 interface{}
+	reason                 string
+}
+
+func (gm *GcpMarker) newGcpFilterable(i interface{}) *gcpFilterable {
+	id, labels, created, t := ExtractLabels(i)
+	return &gcpFilterable{
+		id:            id,
+		labels:        labels,
+		created:       created,
+		log:           gm.Logger,
+		gcpObjectType: t,
+		object:        i,
+	}
+}
+
+func (e *gcpFilterable) Ignore() bool {
+	for _, f := range e.ignoreFilters {
+		if f(e.id, e.labels, e.created, e.log) {
+			e.reason = mark.FilterName(f)
+			return true
+		}
+	}
+	for _, f := range e.typedIgnoreFilters {
+		if f(e.object, e.log) {
+			e.reason = mark.FilterName(f)
+			return true
+		}
+	}
+	return false
+}
+
+func (e *gcpFilterable) Compliant() bool {
+	for _, f := range e.complianceFilters {
+		if f(e.id, e.labels, e.created, e.log) {
+			e.reason = mark.FilterName(f)
+			return false
+		}
+	}
+	for _, f := range e.typedComplianceFilters {
+		if f(e.object, e.log) {
+			e.reason = mark.FilterName(f)
+			return false
+		}
+	}
+	return true
+}
+
+func (e *gcpFilterable) Reason() string {
+	return e.reason
+}
+
+func (e *gcpFilterable) GetTypeString() string {
+	return e.gcpObjectType
+}
+
+func (e *gcpFilterable) GetTypeInterface() interface{} {
+	return e.object
+}
+
+func (e *gcpFilterable) WithIgnoreFilter(f Filter) *gcpFilterable {
+	e.ignoreFilters = append(e.ignoreFilters, f)
+	return e
+}
+
+func (e *gcpFilterable) WithComplianceFilter(f Filter) *gcpFilterable {
+	e.complianceFilters = append(e.complianceFilters, f)
+	return e
+}
+
+func (e *gcpFilterable) WithTypedIgnoreFilter(f TypedFilter) *gcpFilterable {
+	e.typedIgnoreFilters = append(e.typedIgnoreFilters, f)
+	return e
+}
+
+func (e *gcpFilterable) WithTypedComplianceFilter(f TypedFilter) *gcpFilterable {
+	e.typedComplianceFilters = append(e.typedComplianceFilters, f)
+	return e
+}
+
+// parseTimestamp reads the RFC3339 creation times returned by the compute and container APIs
+func parseTimestamp(ts string) *time.Time {
+	t, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+func ExtractLabels(gcpObject interface{}) (string, map[string]string, *time.Time, string) {
+	var id string
+	var labels map[string]string
+	var created *time.Time
+	var objType string
+	switch obj := gcpObject.(type) {
+	case *compute.Instance:
+		id = candidateId(obj.Zone, obj.Name)
+		labels = obj.Labels
+		created = parseTimestamp(obj.CreationTimestamp)
+		objType = "gce"
+	case *compute.Disk:
+		id = candidateId(obj.Zone, obj.Name)
+		labels = obj.Labels
+		created = parseTimestamp(obj.CreationTimestamp)
+		objType = "disk"
+	case *container.Cluster:
+		id = candidateId(obj.Location, obj.Name)
+		labels = obj.ResourceLabels
+		created = parseTimestamp(obj.CreateTime)
+		objType = "gke"
+	}
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	return id, labels, created, objType
+}
+
+/* ----------------- START FILTER ----------------- */
+type Filter func(id string, labels map[string]string, created *time.Time, log *logrus.Entry) bool
+type TypedFilter func(interface{}, *logrus.Entry) bool
+
+func (gm *GcpMarker) IgnoreConfigFilter(id string, labels map[string]string, created *time.Time, log *logrus.Entry) bool {
+	for k, v := range labels {
+		// ignore if the resource matches our not criteria (must match both key and value)
+		for _, ignore := range gm.Config.Not {
+			if ignore.Key == k && ignore.Value == v {
+				gm.Logger.Debugf("Ignoring %s. Reason: matched ignore rule: %s:%s", id, ignore.Key, ignore.Value)
+				return true
+			}
+			// MustCompile shouldn't panic because we've already checked it in config parse
+			if ignore.KeyRegex != "" && regexp.MustCompile(ignore.KeyRegex).MatchString(k) {
+				gm.Logger.Debugf("Ignoring %s. Reason: matched ignore key regex: %s", id, ignore.KeyRegex)
+				return true
+			}
+			if ignore.ValueRegex != "" && regexp.MustCompile(ignore.ValueRegex).MatchString(v) {
+				gm.Logger.Debugf("Ignoring %s. Reason: matched ignore value regex: %s", id, ignore.ValueRegex)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func NoLabelFilter(id string, labels map[string]string, created *time.Time, log *logrus.Entry) bool {
+	if len(labels) == 0 {
+		log.Infof("Adding GCP candidate: %s, Reason: no labels, Created: %+v", id, created)
+		return true
+	}
+	return false
+}
+
+func (gm *GcpMarker) NoTTLLabelFilter(id string, labels map[string]string, created *time.Time, log *logrus.Entry) bool {
+	keys := gm.labelKeys()
+	_, ttlExists := mark.Lookup(labels, keys.Ttl)
+	_, expiresExists := mark.Lookup(labels, keys.Expires)
+	if !ttlExists && !expiresExists {
+		log.Infof("Adding GCP candidate: %s, Reason: no ttl or expires label, Created: %+v", id, created)
+		return true
+	}
+	return false
+}
+
+// TTLLabelExpiredFilter checks the expires label if there is one, otherwise the ttl from the creation time.
+// label values can't hold a colon, so only dates work in expires.
+func (gm *GcpMarker) TTLLabelExpiredFilter(id string, labels map[string]string, created *time.Time, log *logrus.Entry) bool {
+	keys := gm.labelKeys()
+	timeToLive, _ := mark.Lookup(labels, keys.Ttl)
+	expires, _ := mark.Lookup(labels, keys.Expires)
+	if expires == "" && timeToLive == "0" {
+		log.Debugf("Ignoring %s. Reason: Unlimited TTL", id)
+		return false
+	}
+	expiry, err := mark.Expiry(timeToLive, expires, created)
+	if err != nil {
+		log.Infof("Adding GCP candidate: %s, Reason: %v, Created: %+v", id, err, created)
+		return true
+	}
+	if expiry == nil {
+		log.Warnf("Unable to determine creation time of %s, skipping ttl check", id)
+		return false
+	}
+	if !time.Now().Before(*expiry) {
+		log.Infof("Adding GCP candidate: %s, Reason: expired %v, Created: %+v", id, expiry, created)
+		return true
+	}
+	return false
+}
+
+// GceIgnoreGkeNodeFilter skips node pool instances.  They are owned by their cluster and are cleaned up with it.
+func GceIgnoreGkeNodeFilter(id string, labels map[string]string, created *time.Time, log *logrus.Entry) bool {
+	if _, exists := labels["goog-gke-node"]; exists {
+		log.Debugf("Ignoring %s. Reason: Managed by GKE", id)
+		return true
+	}
+	return false
+}
+
+func GceIgnoreManagedInstanceFilter(i interface{}, log *logrus.Entry) bool {
+	if instance, ok := i.(*compute.Instance); ok && instance.Metadata != nil {
+		for _, item := range instance.Metadata.Items {
+			if item.Key == "created-by" && item.Value != nil && strings.Contains(*item.Value, "/instanceGroupManagers/") {
+				log.Debugf("Ignoring %s. Reason: Managed by instance group", instance.Name)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func DiskIgnoreAttachedFilter(d interface{}, log *logrus.Entry) bool {
+	if disk, ok := d.(*compute.Disk); ok {
+		if len(disk.Users) != 0 {
+			log.Debugf("Ignoring %s. Reason: attached to instance", disk.Name)
+			return true
+		}
+	}
+	return false
+}
+
+func GkeIgnoreTransitioningFilter(c interface{}, log *logrus.Entry) bool {
+	if cluster, ok := c.(*container.Cluster); ok {
+		if cluster.Status == "PROVISIONING" || cluster.Status == "STOPPING" {
+			log.Debugf("Ignoring %s. Reason: cluster is %s", cluster.Name, strings.ToLower(cluster.Status))
+			return true
+		}
+	}
+	return false
+}
+
+/* ----------------- END FILTER ----------------- */
@@ -0,0 +1,142 @@
+package gcp
+
+import (
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/container/v1"
+	"testing"
+	"time"
+)
+
+var log = logrus.New()
+
+func TestFilters(t *testing.T) {
+	gm := &GcpMarker{Config: &config.Gcp{}}
+	testCases := map[string]struct {
+		filter  Filter
+		matched bool
+		labels  map[string]string
+	}{
+		"no_label_filter": {
+			filter:  NoLabelFilter,
+			matched: true,
+			labels:  map[string]string{},
+		},
+		"no_label_filter_pass": {
+			filter:  NoLabelFilter,
+			matched: false,
+			labels:  map[string]string{"owner": "some-jerk"},
+		},
+		"no_ttl_label_filter": {
+			filter:  gm.NoTTLLabelFilter,
+			matched: true,
+			labels:  map[string]string{"owner": "some-jerk"},
+		},
+		"no_ttl_label_filter_pass": {
+			filter:  gm.NoTTLLabelFilter,
+			matched: false,
+			labels:  map[string]string{"ttl": "0"},
+		},
+		"ttl_label_expired": {
+			filter:  gm.TTLLabelExpiredFilter,
+			matched: true,
+			labels:  map[string]string{"ttl": "-1w"},
+		},
+		"ttl_label_not_expired": {
+			filter:  gm.TTLLabelExpiredFilter,
+			matched: false,
+			labels:  map[string]string{"ttl": "1w"},
+		},
+		"ttl_label_unlimited": {
+			filter:  gm.TTLLabelExpiredFilter,
+			matched: false,
+			labels:  map[string]string{"ttl": "0"},
+		},
+		"no_ttl_label_filter_expires_pass": {
+			filter:  gm.NoTTLLabelFilter,
+			matched: false,
+			labels:  map[string]string{"expires": "2099-12-31"},
+		},
+		"expires_label_expired": {
+			filter:  gm.TTLLabelExpiredFilter,
+			matched: true,
+			labels:  map[string]string{"ttl": "1w", "expires": "2020-03-31"},
+		},
+		"fallback_ttl_label_expired": {
+			filter:  (&GcpMarker{Config: &config.Gcp{TagKeys: config.TagKeys{Ttl: config.KeyList{"ttl", "lifetime"}}}}).TTLLabelExpiredFilter,
+			matched: true,
+			labels:  map[string]string{"lifetime": "-1w"},
+		},
+		"ignore_gke_node": {
+			filter:  GceIgnoreGkeNodeFilter,
+			matched: true,
+			labels:  map[string]string{"goog-gke-node": ""},
+		},
+	}
+
+	for desc, tc := range testCases {
+		t.Run(desc, func(t *testing.T) {
+			now := time.Now()
+			filterResult := tc.filter("us-central1-a/test-instance", tc.labels, &now, logrus.NewEntry(log))
+			assert.Equal(t, tc.matched, filterResult)
+		})
+	}
+}
+
+func TestTypeFilters(t *testing.T) {
+	createdBy := "projects/1234/zones/us-central1-a/instanceGroupManagers/some-mig"
+	managed := &compute.Instance{
+		Name: "some-mig-abcd",
+		Metadata: &compute.Metadata{
+			Items: []*compute.MetadataItems{
+				{Key: "created-by", Value: &createdBy},
+			},
+		},
+	}
+	t.Run("gce_ignore_managed_instance", func(t *testing.T) {
+		assert.Equal(t, true, GceIgnoreManagedInstanceFilter(managed, logrus.NewEntry(log)))
+	})
+	t.Run("gce_match_unmanaged_instance", func(t *testing.T) {
+		assert.Equal(t, false, GceIgnoreManagedInstanceFilter(&compute.Instance{Name: "foo"}, logrus.NewEntry(log)))
+	})
+
+	attached := &compute.Disk{
+		Name:  "test-disk",
+		Users: []string{"projects/foo/zones/us-central1-a/instances/bar"},
+	}
+	t.Run("disk_ignore_attached", func(t *testing.T) {
+		assert.Equal(t, true, DiskIgnoreAttachedFilter(attached, logrus.NewEntry(log)))
+	})
+	t.Run("disk_match_detached", func(t *testing.T) {
+		assert.Equal(t, false, DiskIgnoreAttachedFilter(&compute.Disk{Name: "test-disk"}, logrus.NewEntry(log)))
+	})
+
+	t.Run("gke_ignore_provisioning", func(t *testing.T) {
+		c := &container.Cluster{Name: "test-cluster", Status: "PROVISIONING"}
+		assert.Equal(t, true, GkeIgnoreTransitioningFilter(c, logrus.NewEntry(log)))
+	})
+	t.Run("gke_match_running", func(t *testing.T) {
+		c := &container.Cluster{Name: "test-cluster", Status: "RUNNING"}
+		assert.Equal(t, false, GkeIgnoreTransitioningFilter(c, logrus.NewEntry(log)))
+	})
+}
+
+func TestExtractLabels(t *testing.T) {
+	i := &compute.Instance{
+		Name:              "test-instance",
+		Zone:              "https://www.googleapis.com/compute/v1/projects/foo/zones/us-central1-a",
+		CreationTimestamp: "2019-01-02T15:04:05.000-07:00",
+		Labels:            map[string]string{"ttl": "1d"},
+	}
+	id, labels, created, objType := ExtractLabels(i)
+	assert.Equal(t, "us-central1-a/test-instance", id)
+	assert.Equal(t, "1d", labels["ttl"])
+	assert.NotNil(t, created)
+	assert.Equal(t, "gce", objType)
+
+	zone, name := splitCandidateId(id)
+	assert.Equal(t, "us-central1-a", zone)
+	assert.Equal(t, "test-instance", name)
+}
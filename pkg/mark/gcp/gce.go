@@ -0,0 +1,32 @@
+package gcp
+
+import (
+	"google.golang.org/api/compute/v1"
+)
+
+func (gm *GcpMarker) markGce() error {
+	call := gm.compute.Instances.AggregatedList(gm.Config.Project)
+	return call.Pages(gm.Ctx, gm.processGcePages)
+}
+
+func (gm *GcpMarker) processGcePages(page *compute.InstanceAggregatedList) error {
+	for _, scoped := range page.Items {
+		for _, i := range scoped.Instances {
+			gm.FilterGcpObject(gm.newGcpFilterable(i).
+				WithIgnoreFilter(gm.IgnoreConfigFilter).
+				WithIgnoreFilter(GceIgnoreGkeNodeFilter).
+				WithTypedIgnoreFilter(GceIgnoreManagedInstanceFilter).
+				WithComplianceFilter(NoLabelFilter).
+				WithComplianceFilter(gm.NoTTLLabelFilter).
+				WithComplianceFilter(gm.TTLLabelExpiredFilter))
+		}
+	}
+	return nil
+}
+
+func (gm *GcpMarker) sweepGce() error {
+	return gm.sweepCandidates("gce", func(zone, name string) error {
+		_, err := gm.compute.Instances.Delete(gm.Config.Project, zone, name).Context(gm.Ctx).Do()
+		return err
+	})
+}
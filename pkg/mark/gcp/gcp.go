@@ -0,0 +1,302 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"github.com/armory-io/bilgepump/pkg/cache"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/armory-io/bilgepump/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/container/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+type GcpMarker struct {
+	Config    *config.Gcp
+	Logger    *logrus.Entry
+	Cache     cache.Cache
+	Ctx       context.Context
+	mux       *sync.Mutex
+	compute   *compute.Service   // this isn't exported on purpose
+	container *container.Service // this isn't exported on purpose
+	inventory *mark.Inventory
+}
+
+type GcpCandidateFuncMap map[string]func() error
+
+// NewGcpMarker builds the compute and container clients for a single project.  Extra client options
+// are appended after the configured credentials, which lets tests point the marker at a fake API.
+func NewGcpMarker(ctx context.Context, cfg *config.Gcp, logger *logrus.Logger, cache cache.Cache, opts ...option.ClientOption) (*GcpMarker, error) {
+	clientOpts := []option.ClientOption{}
+	if cfg.CredentialsFile != "" {
+		clientOpts = append(clientOpts, option.WithCredentialsFile(cfg.CredentialsFile))
+	}
+	clientOpts = append(clientOpts, opts...)
+
+	computeSvc, err := compute.NewService(ctx, clientOpts...)
+	if err != nil {
+		return nil, err
+	}
+	containerSvc, err := container.NewService(ctx, clientOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GcpMarker{
+		Config:    cfg,
+		Logger:    logger.WithFields(logrus.Fields{"class": mark.GCP, "account": cfg.Name, "project": cfg.Project}),
+		Cache:     cache,
+		Ctx:       ctx,
+		mux:       &sync.Mutex{},
+		compute:   computeSvc,
+		container: containerSvc,
+		inventory: mark.NewInventory(),
+	}, nil
+}
+
+func (gm *GcpMarker) GetMarkSchedule() string {
+	return gm.Config.MarkSchedule
+}
+
+func (gm *GcpMarker) GetSweepSchedule() string {
+	return gm.Config.SweepSchedule
+}
+
+func (gm *GcpMarker) GetNotifySchedule() string {
+	return gm.Config.NotifySchedule
+}
+
+func (gm *GcpMarker) GetName() string {
+	return gm.Config.Name
+}
+
+func (gm *GcpMarker) GetType() mark.MarkerType {
+	return mark.GCP
+}
+
+func (gm *GcpMarker) Mark() {
+	gm.Logger.Debugf("starting %s mark run for %s", mark.GCP, gm.Config.Name)
+
+	fm := GcpCandidateFuncMap{
+		"gce":  gm.markGce,
+		"disk": gm.markDisk,
+		"gke":  gm.markGke,
+	}
+
+	gm.mux.Lock()
+	defer gm.mux.Unlock()
+	done := metrics.Run(mark.GCP.String(), gm.Config.Name, metrics.PHASE_MARK)
+	failed := false
+	for _, c := range gm.Config.Candidates {
+		gm.inventory.Reset(c)
+		gm.Logger = gm.Logger.WithFields(logrus.Fields{"type": c, "phase": "mark"})
+		err := fm[c]()
+		if err != nil {
+			gm.Logger.Error(err)
+			failed = true
+		}
+	}
+	done(failed)
+}
+
+func (gm *GcpMarker) Sweep() {
+	gm.Logger.Debugf("starting %s sweep run for %s", mark.GCP, gm.Config.Name)
+
+	fm := GcpCandidateFuncMap{
+		"gce":  gm.sweepGce,
+		"disk": gm.sweepDisk,
+		"gke":  gm.sweepGke,
+	}
+
+	gm.mux.Lock()
+	defer gm.mux.Unlock()
+	done := metrics.Run(mark.GCP.String(), gm.Config.Name, metrics.PHASE_SWEEP)
+	if gm.sweepHeld() {
+		done(true)
+		return
+	}
+	failed := false
+	for _, c := range gm.Config.Candidates {
+		gm.Logger = gm.Logger.WithFields(logrus.Fields{"type": c, "phase": "sweep"})
+		err := fm[c]()
+		if err != nil {
+			gm.Logger.Error(err)
+			failed = true
+		}
+	}
+	done(failed)
+}
+
+// sweepHeld checks the project's sweep limits.  nothing may be deleted while it's true.
+func (gm *GcpMarker) sweepHeld() bool {
+	hold, err := mark.CheckSweep(gm.Cache, mark.GCP, gm.Config.Name, gm.Config.SweepLimits, gm.inventory)
+	if err != nil {
+		gm.Logger.Errorf("Couldn't check sweep limits, leaving everything for the next sweep: %v", err)
+		return true
+	}
+	if hold != nil {
+		gm.Logger.Warn(hold.Summary())
+		metrics.SweepsHalted.WithLabelValues(mark.GCP.String(), gm.Config.Name).Inc()
+		return true
+	}
+	return false
+}
+
+// candidateId joins a zone or location with a resource name.  Compute and GKE calls need both to address
+// a resource, so we keep them together in the id we store in the cache.
+func candidateId(location, name string) string {
+	return fmt.Sprintf("%s/%s", path.Base(location), name)
+}
+
+func splitCandidateId(id string) (string, string) {
+	parts := strings.SplitN(id, "/", 2)
+	if len(parts) != 2 {
+		return "", id
+	}
+	return parts[0], parts[1]
+}
+
+func isNotFound(err error) bool {
+	if gerr, ok := err.(*googleapi.Error); ok {
+		return gerr.Code == http.StatusNotFound
+	}
+	return false
+}
+
+func (gm *GcpMarker) candidateKey(id string) string {
+	return mark.CandidateKey(mark.GCP, gm.Config.Name, "", id)
+}
+
+func (gm *GcpMarker) filterableUpdate(gcpObject interface{}, canType, reason string) error {
+	err := mark.Ignore(gm.Cache, gm.newCandidate(gcpObject, canType, reason))
+	if err != nil {
+		gm.Logger.Error(err)
+	}
+	return nil
+}
+
+func (gm *GcpMarker) ttlRejected(gcpObject interface{}, canType, reason string) error {
+	written, err := mark.WriteCandidate(gm.Cache, gm.newCandidate(gcpObject, canType, reason), gm.Config.GracePeriod)
+	if err != nil {
+		return err
+	}
+	if written {
+		gm.count(metrics.CandidatesMarked, canType)
+	}
+	return nil
+}
+
+// labelKeys falls back to the default keys for markers built without a defaulted config
+func (gm *GcpMarker) labelKeys() config.TagKeys {
+	return gm.Config.TagKeys.Or(config.DefaultTagKeys())
+}
+
+func (gm *GcpMarker) newCandidate(gcpObject interface{}, canType, reason string) *mark.MarkedCandidate {
+	id, labels, created, _ := ExtractLabels(gcpObject)
+	keys := gm.labelKeys()
+	ttl, _ := mark.Lookup(labels, keys.Ttl)
+	expiresLabel, _ := mark.Lookup(labels, keys.Expires)
+	owner, _ := mark.Lookup(labels, keys.Owner)
+	purpose, _ := mark.Lookup(labels, keys.Purpose)
+	expires, _ := mark.Expiry(ttl, expiresLabel, created)
+	extraTags := map[string]string{}
+	for k, v := range labels {
+		extraTags[k] = v
+	}
+	extraTags["project"] = gm.Config.Project
+	return &mark.MarkedCandidate{
+		MarkerType:    mark.GCP,
+		CandidateType: canType,
+		Id:            id,
+		Owner:         owner,
+		Purpose:       purpose,
+		Ttl:           ttl,
+		Account:       gm.Config.Name,
+		Tags:          extraTags,
+		Reason:        reason,
+		Expires:       expires,
+	}
+}
+
+func (gm *GcpMarker) toDelete(owner, thing string) []*string {
+	toDelete := []*string{}
+	mcs, err := mark.BuildCandidates(owner, gm.Cache)
+	if err != nil {
+		return nil
+	}
+	for _, m := range mcs {
+		if m.MarkerType != mark.GCP || m.CandidateType != thing || m.Account != gm.Config.Name {
+			continue
+		}
+		if !gm.Cache.TimerExists(mark.TimerKey(m.Key())) {
+			gm.Logger.Info("Will delete ", m.Id)
+			id := m.Id
+			toDelete = append(toDelete, &id)
+		}
+	}
+	return toDelete
+}
+
+func (gm *GcpMarker) count(counter *prometheus.CounterVec, canType string) {
+	counter.WithLabelValues(mark.GCP.String(), gm.Config.Name, canType).Inc()
+}
+
+// swept counts and audits a candidate the sweep deleted, or would have deleted if this weren't a dry run
+func (gm *GcpMarker) swept(canType, id string, dryRun bool) {
+	if dryRun {
+		gm.count(metrics.CandidatesDryRun, canType)
+	} else {
+		gm.count(metrics.CandidatesDeleted, canType)
+	}
+	if err := mark.Swept(gm.Cache, gm.candidateKey(id), dryRun); err != nil {
+		gm.Logger.Error(err)
+	}
+}
+
+// sweepCandidates walks every owner's expired candidates of a single type and hands each one to del.
+// Resources that have already disappeared are dropped from the cache as if we had deleted them.
+func (gm *GcpMarker) sweepCandidates(canType string, del func(location, name string) error) error {
+	owners, err := gm.Cache.ReadOwners()
+	if err != nil {
+		return err
+	}
+
+	for _, o := range owners {
+		toDelete := gm.toDelete(o, canType)
+
+		gm.Logger.Debug("DryRun? ", !gm.Config.DeleteEnabled)
+		for _, id := range toDelete {
+			// shutting down, leave the rest for the next sweep
+			if gm.Ctx.Err() != nil {
+				return gm.Ctx.Err()
+			}
+			if !gm.Config.DeleteEnabled {
+				gm.Logger.Warnf("Would have deleted %s but we're in DryRun", *id)
+				gm.swept(canType, *id, true)
+				continue
+			}
+			location, name := splitCandidateId(*id)
+			err := del(location, name)
+			if err != nil && !isNotFound(err) {
+				gm.Logger.Error(err)
+				continue
+			}
+			if err == nil {
+				gm.swept(canType, *id, false)
+			}
+			err = mark.RemoveCandidates(gm.Cache, []string{gm.candidateKey(*id)})
+			if err != nil {
+				gm.Logger.Error(err)
+			}
+		}
+	}
+	return nil
+}
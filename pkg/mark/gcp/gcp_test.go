@@ -0,0 +1,131 @@
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/armory-io/bilgepump/pkg/cache"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/armory-io/bilgepump/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeGcp serves the handful of compute and container endpoints the marker uses
+type fakeGcp struct {
+	mux     sync.Mutex
+	deleted []string
+}
+
+func (f *fakeGcp) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	old := time.Now().Add(-30 * 24 * time.Hour).Format(time.RFC3339)
+	switch {
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/aggregated/instances"):
+		json.NewEncoder(w).Encode(&compute.InstanceAggregatedList{ //nolint
+			Items: map[string]compute.InstancesScopedList{
+				"zones/us-central1-a": {
+					Instances: []*compute.Instance{
+						{Name: "expired", Zone: "zones/us-central1-a", CreationTimestamp: old,
+							Labels: map[string]string{"ttl": "1d", "owner": "some-jerk"}},
+						{Name: "forever", Zone: "zones/us-central1-a", CreationTimestamp: old,
+							Labels: map[string]string{"ttl": "0", "owner": "some-jerk"}},
+						{Name: "node", Zone: "zones/us-central1-a", CreationTimestamp: old,
+							Labels: map[string]string{"goog-gke-node": ""}},
+					},
+				},
+			},
+		})
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/aggregated/disks"):
+		json.NewEncoder(w).Encode(&compute.DiskAggregatedList{ //nolint
+			Items: map[string]compute.DisksScopedList{
+				"zones/us-central1-b": {
+					Disks: []*compute.Disk{
+						{Name: "orphan", Zone: "zones/us-central1-b", CreationTimestamp: old},
+						{Name: "attached", Zone: "zones/us-central1-b", CreationTimestamp: old,
+							Users: []string{"zones/us-central1-b/instances/foo"}},
+					},
+				},
+			},
+		})
+	case r.Method == http.MethodDelete:
+		f.mux.Lock()
+		f.deleted = append(f.deleted, r.URL.Path)
+		f.mux.Unlock()
+		json.NewEncoder(w).Encode(&compute.Operation{Name: "op"}) //nolint
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newTestMarker(t *testing.T, candidates []string, mc *cache.MemoryCache) (*GcpMarker, *fakeGcp) {
+	fake := &fakeGcp{}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	m, err := NewGcpMarker(context.Background(), &config.Gcp{
+		Name:          "test-project",
+		Project:       "test-project",
+		Candidates:    candidates,
+		GracePeriod:   "0s",
+		DeleteEnabled: true,
+	}, log, mc, option.WithEndpoint(srv.URL+"/"), option.WithoutAuthentication(), option.WithHTTPClient(srv.Client()))
+	assert.Nil(t, err)
+	return m, fake
+}
+
+func TestGcpMarkAndSweep(t *testing.T) {
+	mc := cache.NewMemoryCache()
+	m, fake := newTestMarker(t, []string{"gce", "disk"}, mc)
+	counted := func(counter *prometheus.CounterVec, canType string) float64 {
+		return testutil.ToFloat64(counter.WithLabelValues(mark.GCP.String(), "test-project", canType))
+	}
+	marked, ignored, deleted := counted(metrics.CandidatesMarked, "gce"), counted(metrics.CandidatesIgnored, "gce"), counted(metrics.CandidatesDeleted, "disk")
+
+	m.Mark()
+	assert.Equal(t, marked+1, counted(metrics.CandidatesMarked, "gce"))
+	assert.Equal(t, ignored+1, counted(metrics.CandidatesIgnored, "gce"))
+	assert.NotZero(t, testutil.ToFloat64(metrics.LastSuccess.WithLabelValues(mark.GCP.String(), "test-project", metrics.PHASE_MARK)))
+
+	candidates, err := mark.BuildCandidates("some-jerk", mc)
+	assert.Nil(t, err)
+	assert.Len(t, candidates, 1)
+	assert.Equal(t, "us-central1-a/expired", candidates[0].Id)
+	assert.Equal(t, mark.GCP, candidates[0].MarkerType)
+
+	unowned, err := mark.BuildCandidates("", mc)
+	assert.Nil(t, err)
+	assert.Len(t, unowned, 1)
+	assert.Equal(t, "us-central1-b/orphan", unowned[0].Id)
+
+	m.Sweep()
+
+	assert.ElementsMatch(t, []string{
+		"/projects/test-project/zones/us-central1-a/instances/expired",
+		"/projects/test-project/zones/us-central1-b/disks/orphan",
+	}, fake.deleted)
+	assert.Equal(t, deleted+1, counted(metrics.CandidatesDeleted, "disk"))
+	assert.NotZero(t, testutil.ToFloat64(metrics.LastSuccess.WithLabelValues(mark.GCP.String(), "test-project", metrics.PHASE_SWEEP)))
+	assert.Empty(t, mc.ReadCandidates("some-jerk"))
+	assert.Empty(t, mc.ReadCandidates(""))
+}
+
+func TestGcpSweepDryRun(t *testing.T) {
+	mc := cache.NewMemoryCache()
+	m, fake := newTestMarker(t, []string{"gce"}, mc)
+	m.Config.DeleteEnabled = false
+
+	m.Mark()
+	m.Sweep()
+
+	assert.Empty(t, fake.deleted)
+	assert.Len(t, mc.ReadCandidates("some-jerk"), 1)
+}
@@ -0,0 +1,35 @@
+package gcp
+
+import (
+	"fmt"
+)
+
+func (gm *GcpMarker) markGke() error {
+	// "-" lists clusters in every zone and region of the project
+	parent := fmt.Sprintf("projects/%s/locations/-", gm.Config.Project)
+	result, err := gm.container.Projects.Locations.Clusters.List(parent).Context(gm.Ctx).Do()
+	if err != nil {
+		return err
+	}
+	if len(result.MissingZones) != 0 {
+		gm.Logger.Warnf("Unable to list clusters in zones: %v", result.MissingZones)
+	}
+
+	for _, c := range result.Clusters {
+		gm.FilterGcpObject(gm.newGcpFilterable(c).
+			WithIgnoreFilter(gm.IgnoreConfigFilter).
+			WithTypedIgnoreFilter(GkeIgnoreTransitioningFilter).
+			WithComplianceFilter(NoLabelFilter).
+			WithComplianceFilter(gm.NoTTLLabelFilter).
+			WithComplianceFilter(gm.TTLLabelExpiredFilter))
+	}
+	return nil
+}
+
+func (gm *GcpMarker) sweepGke() error {
+	return gm.sweepCandidates("gke", func(location, name string) error {
+		clusterName := fmt.Sprintf("projects/%s/locations/%s/clusters/%s", gm.Config.Project, location, name)
+		_, err := gm.container.Projects.Locations.Clusters.Delete(clusterName).Context(gm.Ctx).Do()
+		return err
+	})
+}
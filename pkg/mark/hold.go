@@ -0,0 +1,239 @@
+package mark
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/armory-io/bilgepump/pkg/cache"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// a pending hold stops every sweep of its marker.  an approved one lets the next sweep through and is
+// cleared by it.
+const (
+	HOLD_PENDING  = "pending"
+	HOLD_APPROVED = "approved"
+)
+
+// SweepHold is a sweep that would have deleted more than its marker's sweep limits allow.  Nothing the
+// marker has marked is deleted until someone approves it.
+type SweepHold struct {
+	Key        string    `json:"key"`
+	MarkerType string    `json:"marker_type"`
+	Account    string    `json:"account"`
+	Status     string    `json:"status"`
+	Time       time.Time `json:"time"`
+	// Reasons are the limits the sweep went over
+	Reasons   []string       `json:"reasons"`
+	Due       int            `json:"due"`
+	DueByType map[string]int `json:"due_by_type"`
+	// Inventory is how many resources the last mark run looked at, if we knew
+	Inventory  int        `json:"inventory,omitempty"`
+	ApprovedBy string     `json:"approved_by,omitempty"`
+	ApprovedAt *time.Time `json:"approved_at,omitempty"`
+}
+
+// HoldKey is the key of a marker's hold.  Each marker has at most one.
+func HoldKey(mt MarkerType, account string) string {
+	return markerKey(mt, account)
+}
+
+func (h *SweepHold) Summary() string {
+	return fmt.Sprintf("%s %s sweep halted until approved: %s", h.MarkerType, h.Account, strings.Join(h.Reasons, ", "))
+}
+
+func ReadHold(c cache.Cache, key string) (*SweepHold, bool) {
+	raw, ok := c.ReadHold(key)
+	if !ok {
+		return nil, false
+	}
+	var h *SweepHold
+	if err := json.Unmarshal([]byte(raw), &h); err != nil {
+		return nil, false
+	}
+	return h, true
+}
+
+// ReadHolds returns every hold in key order.  records we can't read are skipped.
+func ReadHolds(c cache.Cache) ([]*SweepHold, error) {
+	records, err := c.ReadHolds()
+	if err != nil {
+		return nil, err
+	}
+	holds := []*SweepHold{}
+	for _, r := range records {
+		var h *SweepHold
+		if err := json.Unmarshal([]byte(r), &h); err != nil {
+			continue
+		}
+		holds = append(holds, h)
+	}
+	sort.Slice(holds, func(i, j int) bool { return holds[i].Key < holds[j].Key })
+	return holds, nil
+}
+
+func writeHold(c cache.Cache, h *SweepHold) error {
+	hjson, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	return c.WriteHold(h.Key, string(hjson))
+}
+
+// ApproveHold lets the marker's next sweep delete everything that's due, however much that is.  actor is
+// who approved it.
+func ApproveHold(c cache.Cache, h *SweepHold, actor string) error {
+	now := time.Now().UTC()
+	h.Status = HOLD_APPROVED
+	h.ApprovedBy = actor
+	h.ApprovedAt = &now
+	if err := writeHold(c, h); err != nil {
+		return err
+	}
+	return Audit(c, &AuditEvent{Action: AUDIT_RESUME, Key: h.Key, MarkerType: h.MarkerType, Account: h.Account, Actor: actor})
+}
+
+// DueCandidates are a marker's candidates whose grace period has run out, the ones its next sweep deletes.
+// mt is the marker type's name, as a hold has it.
+func DueCandidates(c cache.Cache, mt string, account string) ([]*MarkedCandidate, error) {
+	owners, err := c.ReadOwners()
+	if err != nil {
+		return nil, err
+	}
+	due := []*MarkedCandidate{}
+	for _, o := range owners {
+		mcs, err := BuildCandidates(o, c)
+		if err != nil {
+			continue
+		}
+		for _, m := range mcs {
+			if m.MarkerType.String() == mt && m.Account == account && !c.TimerExists(TimerKey(m.Key())) {
+				due = append(due, m)
+			}
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].Key() < due[j].Key() })
+	return due, nil
+}
+
+// CheckSweep runs before a marker sweeps anything.  It returns the marker's hold when the sweep has to stop:
+// either one is already waiting on approval, or what's due now goes over limits and a new one is written.
+// An approved hold is cleared and the sweep goes ahead whatever the limits say.
+func CheckSweep(c cache.Cache, mt MarkerType, account string, limits config.SweepLimits, inv *Inventory) (*SweepHold, error) {
+	key := HoldKey(mt, account)
+	if h, ok := ReadHold(c, key); ok {
+		if h.Status != HOLD_APPROVED {
+			return h, nil
+		}
+		return nil, c.DeleteHold(key)
+	}
+
+	due, err := DueCandidates(c, mt.String(), account)
+	if err != nil {
+		return nil, err
+	}
+	h := &SweepHold{
+		Key:        key,
+		MarkerType: mt.String(),
+		Account:    account,
+		Status:     HOLD_PENDING,
+		Due:        len(due),
+		DueByType:  map[string]int{},
+	}
+	for _, m := range due {
+		h.DueByType[m.CandidateType]++
+	}
+	if limits.MaxDeletions > 0 && h.Due > limits.MaxDeletions {
+		h.Reasons = append(h.Reasons, fmt.Sprintf("%d deletions is over max_deletions %d", h.Due, limits.MaxDeletions))
+	}
+	types := []string{}
+	for t := range limits.MaxDeletionsPerType {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		if max := limits.MaxDeletionsPerType[t]; max > 0 && h.DueByType[t] > max {
+			h.Reasons = append(h.Reasons, fmt.Sprintf("%d %s deletions is over max_deletions_per_type %d", h.DueByType[t], t, max))
+		}
+	}
+	total, ok, err := inventoryTotal(c, key, inv)
+	if err != nil {
+		return nil, err
+	}
+	if ok && total > 0 {
+		h.Inventory = total
+		percent := float64(h.Due) * 100 / float64(total)
+		if limits.MaxPercent > 0 && percent > limits.MaxPercent {
+			h.Reasons = append(h.Reasons, fmt.Sprintf("%.1f%% of %d resources is over max_percent %g", percent, total, limits.MaxPercent))
+		}
+	} else if limits.MaxPercent > 0 && h.Due > 0 {
+		// without a count we can't tell how much of the account this is, so it waits like any other hold
+		h.Reasons = append(h.Reasons, fmt.Sprintf("%d deletions can't be checked against max_percent %g, inventory not counted yet", h.Due, limits.MaxPercent))
+	}
+	if len(h.Reasons) == 0 {
+		return nil, nil
+	}
+
+	h.Time = time.Now().UTC()
+	if err := writeHold(c, h); err != nil {
+		return nil, err
+	}
+	return h, Audit(c, &AuditEvent{Action: AUDIT_HALT, Key: key, MarkerType: h.MarkerType, Account: account, Reason: strings.Join(h.Reasons, ", ")})
+}
+
+// inventoryTotal is the total inv has counted, which is saved under key, or the last one saved if a mark run
+// hasn't counted anything since we started.  It's false if there's never been a count.
+func inventoryTotal(c cache.Cache, key string, inv *Inventory) (int, bool, error) {
+	if total, ok := inv.Total(); ok {
+		return total, true, c.WriteInventory(key, strconv.Itoa(total))
+	}
+	saved, ok := c.ReadInventory(key)
+	if !ok {
+		return 0, false, nil
+	}
+	total, err := strconv.Atoi(saved)
+	if err != nil {
+		return 0, false, nil
+	}
+	return total, true, nil
+}
+
+// Inventory counts the resources a marker's mark run looked at, so a sweep can tell how much of the account
+// it's about to delete.  Counts are kept per scope, eg: a candidate type, so one that's marked again on a
+// later pass replaces its count rather than adding to it.  It's safe to share between goroutines.
+type Inventory struct {
+	mux    sync.Mutex
+	counts map[string]int
+}
+
+func NewInventory() *Inventory {
+	return &Inventory{counts: map[string]int{}}
+}
+
+// Reset zeroes scope before it's counted again
+func (inv *Inventory) Reset(scope string) {
+	inv.mux.Lock()
+	defer inv.mux.Unlock()
+	inv.counts[scope] = 0
+}
+
+func (inv *Inventory) Add(scope string) {
+	inv.mux.Lock()
+	defer inv.mux.Unlock()
+	inv.counts[scope]++
+}
+
+// Total is the count across every scope.  It's false until something has been counted.
+func (inv *Inventory) Total() (int, bool) {
+	inv.mux.Lock()
+	defer inv.mux.Unlock()
+	total := 0
+	for _, n := range inv.counts {
+		total += n
+	}
+	return total, len(inv.counts) != 0
+}
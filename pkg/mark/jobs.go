@@ -0,0 +1,75 @@
+package mark
+
+import (
+	"sync"
+	"time"
+)
+
+// Jobs keeps count of the mark, sweep and notify runs in flight so shutdown can wait for them to finish.
+// Once stopped it refuses to start anything new.
+type Jobs struct {
+	mux     sync.Mutex
+	wg      sync.WaitGroup
+	stopped bool
+}
+
+func NewJobs() *Jobs {
+	return &Jobs{}
+}
+
+// Run runs job and returns true, or returns false without running it if we're shutting down
+func (j *Jobs) Run(job func()) bool {
+	j.mux.Lock()
+	if j.stopped {
+		j.mux.Unlock()
+		return false
+	}
+	j.wg.Add(1)
+	j.mux.Unlock()
+	defer j.wg.Done()
+	job()
+	return true
+}
+
+// Func wraps job for a scheduler
+func (j *Jobs) Func(job func()) func() {
+	return func() { j.Run(job) }
+}
+
+// Track wraps a marker so its mark and sweep runs are counted no matter who starts them
+func (j *Jobs) Track(m Marker) Marker {
+	return &trackedMarker{Marker: m, jobs: j}
+}
+
+// Stop refuses any new runs and waits up to timeout for the ones in flight.  It returns false if they
+// were still running when the timeout ran out.  Stop can be called again to keep waiting.
+func (j *Jobs) Stop(timeout time.Duration) bool {
+	j.mux.Lock()
+	j.stopped = true
+	j.mux.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		j.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+type trackedMarker struct {
+	Marker
+	jobs *Jobs
+}
+
+func (tm *trackedMarker) Mark() {
+	tm.jobs.Run(tm.Marker.Mark)
+}
+
+func (tm *trackedMarker) Sweep() {
+	tm.jobs.Run(tm.Marker.Sweep)
+}
@@ -2,6 +2,7 @@ package k8s
 
 import (
 	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/armory-io/bilgepump/pkg/metrics"
 	"github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
 	"regexp"
@@ -19,18 +20,22 @@ type filterable interface {
 	Compliant() bool
 	GetInterface() interface{}
 	GetType() string
+	// the filter that made the last Ignore or Compliant call return what it did
+	Reason() string
 }
 
 func (k *K8SMarker) FilterK8SObject(f filterable) {
+	k.inventory.Add(f.GetType())
 	if f.Ignore() {
-		err := k.filterableUpdate(f.GetInterface(), f.GetType())
+		k.count(metrics.CandidatesIgnored, f.GetType())
+		err := k.filterableUpdate(f.GetInterface(), f.GetType(), f.Reason())
 		if err != nil {
 			k.Logger.Error(err)
 		}
 		return
 	}
 	if !f.Compliant() {
-		err := k.ttlRejected(f.GetInterface(), f.GetType())
+		err := k.ttlRejected(f.GetInterface(), f.GetType(), f.Reason())
 		if err != nil {
 			k.Logger.Error(err)
 		}
@@ -46,6 +51,7 @@ type k8sFilterable struct {
 	log               *logrus.Entry
 	object            interface{}
 	k8sObjectType     string
+	reason            string
 }
 
 func (k *K8SMarker) newk8sFilterable(i interface{}) *k8sFilterable {
@@ -81,9 +87,14 @@ func (e *k8sFilterable) GetType() string {
 	return e.k8sObjectType
 }
 
+func (e *k8sFilterable) Reason() string {
+	return e.reason
+}
+
 func (e *k8sFilterable) Ignore() bool {
 	for _, f := range e.ignoreFilters {
 		if f(e.id, e.annotations, e.created, e.log) {
+			e.reason = mark.FilterName(f)
 			return true
 		}
 	}
@@ -93,6 +104,7 @@ func (e *k8sFilterable) Ignore() bool {
 func (e *k8sFilterable) Compliant() bool {
 	for _, f := range e.complianceFilters {
 		if f(e.id, e.annotations, e.created, e.log) {
+			e.reason = mark.FilterName(f)
 			return false
 		}
 	}
@@ -109,22 +121,33 @@ func ignoreProtectedNamespaceFilter(id string, annotations map[string]string, cr
 	return false
 }
 
-func NoTTLAnnotationFilter(id string, annotations map[string]string, created time.Time, log *logrus.Entry) bool {
-	if _, exists := annotations["armory.io/bilge.ttl"]; !exists {
-		log.Infof("Adding k8s namespace: %s.  Reason: no TTL annotation", id)
+func (k *K8SMarker) NoTTLAnnotationFilter(id string, annotations map[string]string, created time.Time, log *logrus.Entry) bool {
+	keys := k.annotationKeys()
+	_, ttlExists := mark.Lookup(annotations, keys.Ttl)
+	_, expiresExists := mark.Lookup(annotations, keys.Expires)
+	if !ttlExists && !expiresExists {
+		log.Infof("Adding k8s namespace: %s.  Reason: no TTL or expires annotation", id)
 		return true
 	}
 	return false
 }
 
-func TTLExpiredFilter(id string, annotations map[string]string, created time.Time, log *logrus.Entry) bool {
-	ttl := annotations["armory.io/bilge.ttl"]
-	if ttl == "0" {
+// TTLExpiredFilter checks the expires annotation if there is one, otherwise the ttl from the creation time
+func (k *K8SMarker) TTLExpiredFilter(id string, annotations map[string]string, created time.Time, log *logrus.Entry) bool {
+	keys := k.annotationKeys()
+	ttl, _ := mark.Lookup(annotations, keys.Ttl)
+	expires, _ := mark.Lookup(annotations, keys.Expires)
+	if expires == "" && ttl == "0" {
 		log.Debugf("Ignoring %s.  Reason: Unlimted TTL", id)
 		return false
 	}
-	if !mark.WithinTTLTime(ttl, created) {
-		log.Infof("Adding namespace: %s.  Reason: TTL expired. Created on: %v", id, created)
+	expiry, err := mark.Expiry(ttl, expires, &created)
+	if err != nil {
+		log.Infof("Adding namespace: %s.  Reason: %v. Created on: %v", id, err, created)
+		return true
+	}
+	if expiry != nil && !time.Now().Before(*expiry) {
+		log.Infof("Adding namespace: %s.  Reason: expired %v. Created on: %v", id, expiry, created)
 		return true
 	}
 	return false
@@ -2,22 +2,21 @@ package k8s
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 	"github.com/armory-io/bilgepump/pkg/cache"
 	"github.com/armory-io/bilgepump/pkg/config"
 	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/armory-io/bilgepump/pkg/metrics"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/pkg/errors"
-	"github.com/prometheus/common/model"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"sync"
-	"time"
 )
 
 type K8SMarker struct {
@@ -27,6 +26,7 @@ type K8SMarker struct {
 	Ctx       context.Context
 	mux       *sync.Mutex
 	k8sclient *kubernetes.Clientset
+	inventory *mark.Inventory
 }
 
 func NewK8SMarker(ctx context.Context, cfg *config.Kubernetes, logger *logrus.Logger, cache cache.Cache) (*K8SMarker, error) {
@@ -60,6 +60,7 @@ func NewK8SMarker(ctx context.Context, cfg *config.Kubernetes, logger *logrus.Lo
 		Ctx:       ctx,
 		mux:       &sync.Mutex{},
 		k8sclient: clientset,
+		inventory: mark.NewInventory(),
 	}, nil
 }
 
@@ -88,9 +89,12 @@ func (k *K8SMarker) Mark() {
 
 	k.mux.Lock()
 	defer k.mux.Unlock()
-	if err := k.markNamespaces(k.Ctx); err != nil {
-		k.Logger.Error(err)
+	done := metrics.Run(mark.K8S.String(), k.Config.Name, metrics.PHASE_MARK)
+	err := k.markNamespaces(k.Ctx)
+	if err != nil {
+		k.logError(err)
 	}
+	done(err != nil)
 }
 
 func (k *K8SMarker) Sweep() {
@@ -98,8 +102,53 @@ func (k *K8SMarker) Sweep() {
 
 	k.mux.Lock()
 	defer k.mux.Unlock()
+	done := metrics.Run(mark.K8S.String(), k.Config.Name, metrics.PHASE_SWEEP)
+	if k.sweepHeld() {
+		done(true)
+		return
+	}
+	err := k.sweepNamespaces(k.Ctx)
+	if err != nil {
+		k.logError(err)
+	}
+	done(err != nil)
+}
+
+// sweepHeld checks the cluster's sweep limits.  nothing may be deleted while it's true.
+func (k *K8SMarker) sweepHeld() bool {
+	hold, err := mark.CheckSweep(k.Cache, mark.K8S, k.Config.Name, k.Config.SweepLimits, k.inventory)
+	if err != nil {
+		k.Logger.Errorf("Couldn't check sweep limits, leaving everything for the next sweep: %v", err)
+		return true
+	}
+	if hold != nil {
+		k.Logger.Warn(hold.Summary())
+		metrics.SweepsHalted.WithLabelValues(mark.K8S.String(), k.Config.Name).Inc()
+		return true
+	}
+	return false
+}
+
+// logError logs err, counting it when the api server was throttling us
+func (k *K8SMarker) logError(err error) {
+	if apierrors.IsTooManyRequests(err) {
+		metrics.Throttled.WithLabelValues(mark.K8S.String(), k.Config.Name).Inc()
+	}
+	k.Logger.Error(err)
+}
+
+func (k *K8SMarker) count(counter *prometheus.CounterVec, canType string) {
+	counter.WithLabelValues(mark.K8S.String(), k.Config.Name, canType).Inc()
+}
 
-	if err := k.sweepNamespaces(k.Ctx); err != nil {
+// swept counts and audits a candidate the sweep deleted, or would have deleted if this weren't a dry run
+func (k *K8SMarker) swept(canType, id string, dryRun bool) {
+	if dryRun {
+		k.count(metrics.CandidatesDryRun, canType)
+	} else {
+		k.count(metrics.CandidatesDeleted, canType)
+	}
+	if err := mark.Swept(k.Cache, k.candidateKey(id), dryRun); err != nil {
 		k.Logger.Error(err)
 	}
 }
@@ -109,13 +158,14 @@ func (k *K8SMarker) markNamespaces(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	k.inventory.Reset("namespace")
 	for _, n := range namespaces.Items {
 		k.Logger.Debugf("processing namespace: %s", n.Name)
 		filterable := k.newk8sFilterable(n).
 			WithIgnoreFilter(ignoreProtectedNamespaceFilter).
 			WithIgnoreFilter(k.ignoreNamespaceFilter).
-			WithComplianceFilter(NoTTLAnnotationFilter).
-			WithComplianceFilter(TTLExpiredFilter)
+			WithComplianceFilter(k.NoTTLAnnotationFilter).
+			WithComplianceFilter(k.TTLExpiredFilter)
 		if filterable != nil {
 			k.FilterK8SObject(filterable)
 		}
@@ -135,16 +185,23 @@ func (k *K8SMarker) sweepNamespaces(ctx context.Context) error {
 		k.Logger.Debug("DryRun? ", !k.Config.DeleteEnabled)
 		if len(toDelete) != 0 {
 			for _, n := range toDelete {
+				// shutting down, leave the rest for the next sweep
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
 				k.Logger.Debug("will delete ", *n)
 				if k.Config.DeleteEnabled {
 					if err := k.k8sclient.CoreV1().Namespaces().Delete(ctx, *n, v1.DeleteOptions{}); err != nil {
-						k.Logger.Error(err)
+						k.logError(err)
 						continue
 					}
-					err = mark.RemoveCandidates(o, k.Cache, []*string{n})
+					k.swept("namespace", *n, false)
+					err = mark.RemoveCandidates(k.Cache, []string{k.candidateKey(*n)})
 					if err != nil {
 						k.Logger.Error(err)
 					}
+				} else {
+					k.swept("namespace", *n, true)
 				}
 			}
 		}
@@ -152,73 +209,62 @@ func (k *K8SMarker) sweepNamespaces(ctx context.Context) error {
 	return nil
 }
 
-func (k *K8SMarker) filterableUpdate(n interface{}, canType string) error {
-	var owner string
+func (k *K8SMarker) candidateKey(id string) string {
+	return mark.CandidateKey(mark.K8S, k.Config.Name, "", id)
+}
+
+func (k *K8SMarker) filterableUpdate(n interface{}, canType, reason string) error {
 	namespace, ok := n.(corev1.Namespace)
 	if !ok {
 		return errors.New("Cannot convert interface to v1.Namespace")
 	}
-	id := &namespace.Name
-	owner = namespace.ObjectMeta.Annotations["armory.io/bilge.owner"]
-	err := mark.RemoveCandidates(owner, k.Cache, []*string{id})
+	err := mark.Ignore(k.Cache, k.newCandidate(namespace, canType, reason))
 	if err != nil {
-		if _, ok := err.(*mark.NoCandidatesError); !ok {
-			k.Logger.Error(err)
-		}
+		k.Logger.Error(err)
 	}
 	return nil
 }
 
-func (k *K8SMarker) ttlRejected(n interface{}, canType string) error {
-	var (
-		owner   string
-		ttl     string
-		purpose string
-	)
+func (k *K8SMarker) ttlRejected(n interface{}, canType, reason string) error {
 	namespace, ok := n.(corev1.Namespace)
 	if !ok {
 		return errors.New("Cannot convert interface to v1.Namespace")
 	}
-	gp, _ := model.ParseDuration(k.Config.GracePeriod) // already checked this in config
-	id := namespace.Name
-	owner = namespace.ObjectMeta.Annotations["armory.io/bilge.owner"]
-	ttl = namespace.ObjectMeta.Annotations["armory.io/bilge.ttl"]
-	purpose = namespace.ObjectMeta.Annotations["armory.io/bilge.purpose"]
+	written, err := mark.WriteCandidate(k.Cache, k.newCandidate(namespace, canType, reason), k.Config.GracePeriod)
+	if err != nil {
+		return err
+	}
+	if written {
+		k.count(metrics.CandidatesMarked, canType)
+	}
+	return nil
+}
+
+// annotationKeys falls back to the prefixed default keys for markers built without a defaulted config
+func (k *K8SMarker) annotationKeys() config.TagKeys {
+	return k.Config.TagKeys.Or(config.DefaultTagKeys().WithPrefix(config.DEFAULT_ANNOTATION_PREFIX))
+}
 
-	marked := &mark.MarkedCandidate{
+func (k *K8SMarker) newCandidate(namespace corev1.Namespace, canType, reason string) *mark.MarkedCandidate {
+	annotations := namespace.ObjectMeta.Annotations
+	created := namespace.CreationTimestamp.Time
+	keys := k.annotationKeys()
+	ttl, _ := mark.Lookup(annotations, keys.Ttl)
+	expiresAnnotation, _ := mark.Lookup(annotations, keys.Expires)
+	owner, _ := mark.Lookup(annotations, keys.Owner)
+	purpose, _ := mark.Lookup(annotations, keys.Purpose)
+	expires, _ := mark.Expiry(ttl, expiresAnnotation, &created)
+	return &mark.MarkedCandidate{
 		MarkerType:    mark.K8S,
 		CandidateType: canType,
-		Id:            id,
+		Id:            namespace.Name,
 		Owner:         owner,
 		Purpose:       purpose,
 		Ttl:           ttl,
 		Account:       k.Config.Name,
+		Reason:        reason,
+		Expires:       expires,
 	}
-	mjson, err := json.Marshal(marked)
-	if err != nil {
-		return err
-	}
-	if k.Cache.CandidateExists(owner, string(mjson)) {
-		k.Logger.Debugf("Instance: %s already exists in cache, skip", id)
-		return nil
-	}
-	// owner index update
-	err = k.Cache.Write("bilge:owners", owner)
-	if err != nil {
-		return err
-	}
-	// write candidate by owner
-	err = k.Cache.Write(fmt.Sprintf("bilge:candidates:%s", owner), string(mjson))
-	if err != nil {
-		return err
-	}
-	// write an expiring key with our grace period
-	err = k.Cache.WriteTimer(fmt.Sprintf("bilge:timers:%s", id),
-		k.Config.GracePeriod, time.Now().Local().Add(time.Duration(gp)))
-	if err != nil {
-		return err
-	}
-	return nil
 }
 
 func (k *K8SMarker) toDelete(owner, thing string) []*string {
@@ -228,11 +274,12 @@ func (k *K8SMarker) toDelete(owner, thing string) []*string {
 		return nil
 	}
 	for _, m := range mcs {
-		if !k.Cache.TimerExists(fmt.Sprintf("bilge:timers:%s", m.Id)) {
-			if m.CandidateType == thing && m.Account == k.Config.Name {
-				k.Logger.Info("Will delete ", m.Id)
-				toDelete = append(toDelete, aws.String(m.Id))
-			}
+		if m.MarkerType != mark.K8S || m.CandidateType != thing || m.Account != k.Config.Name {
+			continue
+		}
+		if !k.Cache.TimerExists(mark.TimerKey(m.Key())) {
+			k.Logger.Info("Will delete ", m.Id)
+			toDelete = append(toDelete, aws.String(m.Id))
 		}
 	}
 	return toDelete
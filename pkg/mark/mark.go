@@ -6,7 +6,9 @@ import (
 	"github.com/armory-io/bilgepump/pkg/cache"
 	"github.com/nlopes/slack"
 	"github.com/prometheus/common/model"
-	"log"
+	"github.com/sirupsen/logrus"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -31,10 +33,11 @@ func (e *NoCandidatesError) Error() string {
 type MarkerType int
 
 const (
-	AWS          MarkerType = 0
-	GCP          MarkerType = 1
-	K8S          MarkerType = 2
-	REQUIRED_TAG            = "ttl"
+	AWS MarkerType = 0
+	GCP MarkerType = 1
+	K8S MarkerType = 2
+	// slack rejects section blocks with more fields than this
+	MAX_SLACK_BLOCK_FIELDS = 10
 )
 
 func (mt MarkerType) String() string {
@@ -63,7 +66,26 @@ type MarkedCandidate struct {
 	Ttl           string            `json:"ttl"`
 	Purpose       string            `json:"purpose"`
 	Account       string            `json:"account"`
+	Region        string            `json:"region,omitempty"`
 	Tags          map[string]string `json:"tags"`
+	// the filter that flagged it
+	Reason string `json:"reason,omitempty"`
+	// Expires is when the ttl or expires tag ran out, if we could tell
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// CandidateKey uniquely identifies a candidate across every configured marker
+func CandidateKey(mt MarkerType, account, region, id string) string {
+	return fmt.Sprintf("%s:%s:%s:%s", mt, account, region, id)
+}
+
+// TimerKey is the expiring key that holds a candidate's grace period
+func TimerKey(key string) string {
+	return fmt.Sprintf("bilge:timers:%s", key)
+}
+
+func (mc *MarkedCandidate) Key() string {
+	return CandidateKey(mc.MarkerType, mc.Account, mc.Region, mc.Id)
 }
 
 func (mc *MarkedCandidate) GenerateSlackAttachmentFields() []slack.AttachmentField {
@@ -100,6 +122,32 @@ func (mc *MarkedCandidate) GenerateSlackAttachmentFields() []slack.AttachmentFie
 	return afs
 }
 
+// GenerateSlackBlockFields lists the same details as the attachment fields.  section blocks only hold
+// ten fields, so the fixed fields come first and tags fill whatever room is left in key order.
+func (mc *MarkedCandidate) GenerateSlackBlockFields() []*slack.TextBlockObject {
+	field := func(k, v string) *slack.TextBlockObject {
+		return slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*%s*\n%s", k, v), false, false)
+	}
+	fields := []*slack.TextBlockObject{
+		field("owner", mc.Owner),
+		field("purpose", mc.Purpose),
+		field("type", mc.CandidateType),
+		field("account", mc.Account),
+	}
+	keys := make([]string, 0, len(mc.Tags))
+	for k := range mc.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if len(fields) == MAX_SLACK_BLOCK_FIELDS {
+			break
+		}
+		fields = append(fields, field(k, mc.Tags[k]))
+	}
+	return fields
+}
+
 func WithinTTLTime(ttl string, start time.Time) bool {
 	parsedTtl, err := model.ParseDuration(ttl)
 	if err != nil {
@@ -111,43 +159,254 @@ func WithinTTLTime(ttl string, start time.Time) bool {
 	return since < time.Duration(parsedTtl)
 }
 
+// expiryLayouts are tried in order.  the ones without a zone are read as UTC.
+var expiryLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// expiryDateLayouts only name a day.  the resource lasts through the end of it, UTC.
+var expiryDateLayouts = []string{
+	"2006-01-02",
+	"2006/01/02",
+	"01/02/2006",
+	"2-Jan-2006",
+	"2 Jan 2006",
+	"2 January 2006",
+	"Jan 2 2006",
+	"Jan 2, 2006",
+	"January 2 2006",
+	"January 2, 2006",
+}
+
+// ParseExpiry reads an expires tag: RFC3339 or one of the common date and time formats
+func ParseExpiry(expires string) (time.Time, error) {
+	expires = strings.TrimSpace(expires)
+	for _, layout := range expiryLayouts {
+		if t, err := time.Parse(layout, expires); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range expiryDateLayouts {
+		if t, err := time.Parse(layout, expires); err == nil {
+			return t.AddDate(0, 0, 1), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized expiry date %q", expires)
+}
+
+// Expiry works out when a resource expires.  An expires date wins over a ttl; otherwise the ttl counts from
+// created.  It's nil when the resource never expires (a ttl of 0), has neither, or has only a ttl and no
+// creation time to count from.
+func Expiry(ttl, expires string, created *time.Time) (*time.Time, error) {
+	if expires != "" {
+		t, err := ParseExpiry(expires)
+		if err != nil {
+			return nil, err
+		}
+		return &t, nil
+	}
+	if ttl == "" || ttl == "0" {
+		return nil, nil
+	}
+	d, err := model.ParseDuration(ttl)
+	if err != nil {
+		return nil, err
+	}
+	if created == nil {
+		return nil, nil
+	}
+	t := created.Add(time.Duration(d))
+	return &t, nil
+}
+
+// Lookup returns the value of the first of keys that's set in tags
+func Lookup(tags map[string]string, keys []string) (string, bool) {
+	for _, k := range keys {
+		if v, ok := tags[k]; ok {
+			return v, true
+		}
+	}
+	return "", false
+}
+
 func BuildCandidates(owner string, c cache.Cache) ([]*MarkedCandidate, error) {
 	cans := c.ReadCandidates(owner)
 	if len(cans) == 0 {
 		return nil, &NoCandidatesError{"no candidates to mark"}
 	}
-	mcs := make([]*MarkedCandidate, len(cans))
-	for i, mc := range cans {
+	mcs := []*MarkedCandidate{}
+	for _, mc := range cans {
 		var m *MarkedCandidate
 		err := json.Unmarshal([]byte(mc), &m)
 		if err != nil {
 			continue
 		}
-		mcs[i] = m
+		mcs = append(mcs, m)
 	}
 	return mcs, nil
 }
 
-func RemoveCandidates(owner string, c cache.Cache, ids []*string) error {
-	strCans := c.ReadCandidates(owner)
-	if len(strCans) == 0 {
-		return &NoCandidatesError{"no candidates to remove"}
+// WriteCandidate records a candidate and starts its grace period.  Writing a candidate that is already
+// known replaces its record, moving it to a new owner if it changed, but leaves the running timer alone.
+// Only the first write is audited, so a candidate that stays marked across mark runs is recorded once.
+// It returns true only for that first write, not for a candidate that was known or is exempt.
+func WriteCandidate(c cache.Cache, m *MarkedCandidate, gracePeriod string) (bool, error) {
+	if c.ExemptionExists(m.Key()) {
+		return false, c.DeleteCandidate(m.Key())
 	}
-	cans, err := BuildCandidates(owner, c)
+	gp, err := model.ParseDuration(gracePeriod)
 	if err != nil {
+		return false, err
+	}
+	mjson, err := json.Marshal(m)
+	if err != nil {
+		return false, err
+	}
+	known := c.CandidateExists(m.Key())
+	err = c.WriteCandidate(m.Key(), m.Owner, string(mjson))
+	if err != nil {
+		return false, err
+	}
+	if !known {
+		e := &AuditEvent{Action: AUDIT_MARK, Key: m.Key(), GracePeriod: gracePeriod}
+		e.fill(m)
+		if err := Audit(c, e); err != nil {
+			return false, err
+		}
+	}
+	// write an expiring key with our grace period
+	return !known, c.WriteTimer(TimerKey(m.Key()), gracePeriod, time.Now().Local().Add(time.Duration(gp)))
+}
+
+func RemoveCandidates(c cache.Cache, keys []string) error {
+	for _, k := range keys {
+		err := c.DeleteCandidate(k)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IgnoreRecorder is implemented by caches that want to hear about every resource an ignore filter
+// matches, not only the ones that were candidates.  eg: the scratch cache a plan runs against.
+type IgnoreRecorder interface {
+	RecordIgnore(m *MarkedCandidate)
+}
+
+// Ignore drops a candidate that an ignore filter now matches.  m describes the resource and m.Reason is
+// the filter.  Resources that were never candidates aren't audited, otherwise every mark run would log
+// everything it ignored again.
+func Ignore(c cache.Cache, m *MarkedCandidate) error {
+	if r, ok := c.(IgnoreRecorder); ok {
+		r.RecordIgnore(m)
+	}
+	return removeCandidate(c, AUDIT_IGNORE, m.Key(), m.Reason)
+}
+
+// Drop removes a candidate the sweep found gone or compliant
+func Drop(c cache.Cache, key, reason string) error {
+	return removeCandidate(c, AUDIT_DROP, key, reason)
+}
+
+func removeCandidate(c cache.Cache, action, key, reason string) error {
+	if !c.CandidateExists(key) {
+		return nil
+	}
+	if err := AuditCandidate(c, action, key, &AuditEvent{Reason: reason}); err != nil {
+		return err
+	}
+	return c.DeleteCandidate(key)
+}
+
+// Swept records that a sweep deleted a candidate, or would have if it weren't a dry run.  Call it before
+// the candidate is removed so its record is still there to audit.
+func Swept(c cache.Cache, key string, dryRun bool) error {
+	return AuditCandidate(c, AUDIT_DELETE, key, &AuditEvent{DryRun: dryRun})
+}
+
+// Refused records that a sweep wouldn't delete a candidate, or wouldn't have if it weren't a dry run, and
+// why.  The candidate is left as it is.
+func Refused(c cache.Cache, key, reason string, dryRun bool) error {
+	return AuditCandidate(c, AUDIT_REFUSE, key, &AuditEvent{Reason: reason, DryRun: dryRun})
+}
+
+// ExtendGracePeriod pushes a candidate's deletion back by d, counting from its current deadline or from
+// now if the grace period has already run out.  It returns the new deadline.  actor is who asked.
+func ExtendGracePeriod(c cache.Cache, key string, d time.Duration, actor string) (time.Time, error) {
+	start := time.Now()
+	if deadline, ok := c.ReadTimer(TimerKey(key)); ok {
+		start = deadline
+	}
+	deadline := start.Add(d)
+	if err := c.ResetTimer(TimerKey(key), d.String(), deadline); err != nil {
+		return deadline, err
+	}
+	return deadline, AuditCandidate(c, AUDIT_SNOOZE, key, &AuditEvent{GracePeriod: d.String(), Actor: actor})
+}
+
+// ApproveDeletion ends a candidate's grace period now so the next sweep deletes it
+func ApproveDeletion(c cache.Cache, key, actor string) error {
+	if err := c.ResetTimer(TimerKey(key), "0s", time.Now()); err != nil {
+		return err
+	}
+	return AuditCandidate(c, AUDIT_APPROVE, key, &AuditEvent{GracePeriod: "0s", Actor: actor})
+}
+
+// Exempt permanently keeps a candidate from being marked again and drops it if it is marked now
+func Exempt(c cache.Cache, key, actor string) error {
+	if err := c.WriteExemption(key); err != nil {
+		return err
+	}
+	if err := AuditCandidate(c, AUDIT_EXEMPT, key, &AuditEvent{Actor: actor}); err != nil {
 		return err
 	}
-	for ix, can := range cans {
-		for _, v := range ids {
-			value := *v
-			if value == can.Id {
-				err = c.Delete(fmt.Sprintf("bilge:candidates:%s", owner), strCans[ix])
-				if err != nil {
-					log.Printf("WARNING: Error deleting candidate.  Owner:%s, Candidate: %s, Error:%+v\n", owner, strCans[ix], err)
-				}
+	return c.DeleteCandidate(key)
+}
+
+// MigrateCandidates converts candidates stored in the old per-owner sets of marshalled candidates into
+// keyed records.  Running timers are moved to the new key so grace periods carry over.
+func MigrateCandidates(c cache.Cache, logger *logrus.Logger) error {
+	legacy, ok := c.(cache.LegacyCache)
+	if !ok {
+		return nil
+	}
+	for _, o := range legacy.ReadLegacyOwners() {
+		cans := legacy.ReadLegacyCandidates(o)
+		if len(cans) == 0 {
+			continue
+		}
+		logger.Infof("Migrating %d candidates for owner %q", len(cans), o)
+		for _, raw := range cans {
+			var m *MarkedCandidate
+			if err := json.Unmarshal([]byte(raw), &m); err != nil {
+				logger.Warnf("Dropping unreadable candidate %s: %v", raw, err)
+				continue
+			}
+			// the region used to only be recorded as a tag
+			if m.Region == "" && m.Tags != nil {
+				m.Region = m.Tags["region"]
+			}
+			mjson, err := json.Marshal(m)
+			if err != nil {
+				return err
+			}
+			if err := c.WriteCandidate(m.Key(), o, string(mjson)); err != nil {
+				return err
+			}
+			if err := legacy.RenameTimer(fmt.Sprintf("bilge:timers:%s", m.Id), TimerKey(m.Key())); err != nil {
+				return err
 			}
 		}
+		if err := legacy.DeleteLegacyCandidates(o); err != nil {
+			return err
+		}
 	}
-
 	return nil
 }
@@ -0,0 +1,399 @@
+package mark
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/armory-io/bilgepump/pkg/cache"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMigrateCandidates(t *testing.T) {
+	log := logrus.New()
+	mr := miniredis.RunT(t)
+	rc, err := cache.NewRedisCache(&config.Config{Redis: config.Redis{Mode: "standalone", Addresses: []string{mr.Addr()}}}, log)
+	assert.Nil(t, err)
+	defer rc.Close() //nolint
+
+	old := &MarkedCandidate{
+		MarkerType:    AWS,
+		CandidateType: "ec2",
+		Id:            "i-123",
+		Owner:         "some-jerk",
+		Account:       "test",
+		Tags:          map[string]string{"region": "us-west-2"},
+	}
+	oldJson, _ := json.Marshal(old)
+	// seed the layout redis used before candidates were keyed
+	_, err = mr.SAdd("bilge:owners", "some-jerk")
+	assert.Nil(t, err)
+	_, err = mr.SAdd("bilge:candidates:some-jerk", string(oldJson), "not json")
+	assert.Nil(t, err)
+	assert.Nil(t, rc.WriteTimer("bilge:timers:i-123", "24h", time.Now().Add(time.Hour)))
+
+	assert.Nil(t, MigrateCandidates(rc, log))
+
+	mcs, err := BuildCandidates("some-jerk", rc)
+	assert.Nil(t, err)
+	assert.Len(t, mcs, 1)
+	assert.Equal(t, "us-west-2", mcs[0].Region)
+	assert.Equal(t, "AWS:test:us-west-2:i-123", mcs[0].Key())
+	assert.True(t, rc.TimerExists(TimerKey(mcs[0].Key())))
+	assert.Empty(t, rc.ReadLegacyCandidates("some-jerk"))
+
+	// a second run has nothing left to do
+	assert.Nil(t, MigrateCandidates(rc, log))
+	mcs, err = BuildCandidates("some-jerk", rc)
+	assert.Nil(t, err)
+	assert.Len(t, mcs, 1)
+}
+
+func TestWriteCandidate(t *testing.T) {
+	log := logrus.New()
+	bc, err := cache.NewBoltCache(&config.Config{Cache: config.Cache{Path: filepath.Join(t.TempDir(), "bilge.db")}}, log)
+	assert.Nil(t, err)
+	defer bc.Close() //nolint
+
+	m := &MarkedCandidate{MarkerType: AWS, CandidateType: "ec2", Id: "i-123", Owner: "some-jerk", Account: "test", Region: "us-west-2"}
+	written, err := WriteCandidate(bc, m, "1h")
+	assert.Nil(t, err)
+	assert.True(t, written)
+
+	// a tag change updates the same record instead of adding another
+	m.Tags = map[string]string{"purpose": "testing"}
+	m.Owner = "someone-else"
+	written, err = WriteCandidate(bc, m, "1h")
+	assert.Nil(t, err)
+	assert.False(t, written)
+
+	_, err = BuildCandidates("some-jerk", bc)
+	assert.IsType(t, &NoCandidatesError{}, err)
+	mcs, err := BuildCandidates("someone-else", bc)
+	assert.Nil(t, err)
+	assert.Len(t, mcs, 1)
+	assert.Equal(t, "testing", mcs[0].Tags["purpose"])
+	assert.True(t, bc.TimerExists(TimerKey(m.Key())))
+
+	assert.Nil(t, RemoveCandidates(bc, []string{m.Key()}))
+	owners, err := bc.ReadOwners()
+	assert.Nil(t, err)
+	assert.Empty(t, owners)
+
+	// an exempt candidate isn't written at all
+	assert.Nil(t, bc.WriteExemption(m.Key()))
+	written, err = WriteCandidate(bc, m, "1h")
+	assert.Nil(t, err)
+	assert.False(t, written)
+	assert.False(t, bc.CandidateExists(m.Key()))
+}
+
+func TestParseExpiry(t *testing.T) {
+	endOfQuarter := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	for expires, expected := range map[string]time.Time{
+		"2024-03-31T17:00:00-07:00": time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+		"2024-03-31T12:30:00":       time.Date(2024, 3, 31, 12, 30, 0, 0, time.UTC),
+		"2024-03-31 12:30":          time.Date(2024, 3, 31, 12, 30, 0, 0, time.UTC),
+		"2024-03-31":                endOfQuarter,
+		"2024/03/31":                endOfQuarter,
+		"03/31/2024":                endOfQuarter,
+		"31-Mar-2024":               endOfQuarter,
+		"31 March 2024":             endOfQuarter,
+		"Mar 31, 2024":              endOfQuarter,
+		" March 31 2024 ":           endOfQuarter,
+	} {
+		parsed, err := ParseExpiry(expires)
+		assert.Nil(t, err, expires)
+		assert.True(t, expected.Equal(parsed), "%s parsed as %v", expires, parsed)
+	}
+	_, err := ParseExpiry("end of the quarter")
+	assert.NotNil(t, err)
+}
+
+func TestExpiry(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	expiry, err := Expiry("1w", "", &created)
+	assert.Nil(t, err)
+	assert.Equal(t, created.Add(7*24*time.Hour), *expiry)
+
+	// expires wins over the ttl, even an unlimited one
+	expiry, err = Expiry("0", "2024-03-31", &created)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), *expiry)
+
+	for _, never := range []struct {
+		ttl     string
+		created *time.Time
+	}{{"0", &created}, {"", &created}, {"1w", nil}} {
+		expiry, err = Expiry(never.ttl, "", never.created)
+		assert.Nil(t, err)
+		assert.Nil(t, expiry)
+	}
+
+	_, err = Expiry("soon", "", &created)
+	assert.NotNil(t, err)
+}
+
+func TestAudit(t *testing.T) {
+	c := cache.NewMemoryCache()
+	m := &MarkedCandidate{MarkerType: AWS, CandidateType: "ec2", Id: "i-123", Owner: "some-jerk", Account: "test",
+		Region: "us-west-2", Tags: map[string]string{"ttl": "1h"}, Reason: "TTLTagExpiredFilter"}
+	other := &MarkedCandidate{MarkerType: AWS, CandidateType: "ec2", Id: "i-456", Owner: "someone-else", Account: "test", Region: "us-west-2"}
+
+	// marking the same candidate again on the next run isn't a new decision
+	_, err := WriteCandidate(c, m, "1d")
+	assert.Nil(t, err)
+	_, err = WriteCandidate(c, m, "1d")
+	assert.Nil(t, err)
+	_, err = WriteCandidate(c, other, "1d")
+	assert.Nil(t, err)
+	_, err = ExtendGracePeriod(c, m.Key(), time.Hour, "api")
+	assert.Nil(t, err)
+	assert.Nil(t, Swept(c, m.Key(), true))
+	ignored := *other
+	ignored.Reason = "IgnoreConfigFilter"
+	assert.Nil(t, Ignore(c, &ignored))
+	// ignoring something that was never marked isn't recorded
+	assert.Nil(t, Ignore(c, &MarkedCandidate{MarkerType: AWS, CandidateType: "ec2", Id: "i-789", Account: "test",
+		Region: "us-west-2", Reason: "IgnoreConfigFilter"}))
+
+	events, err := ReadAudit(c, AuditQuery{})
+	assert.Nil(t, err)
+	actions := []string{}
+	for _, e := range events {
+		actions = append(actions, e.Action)
+	}
+	assert.Equal(t, []string{AUDIT_MARK, AUDIT_MARK, AUDIT_SNOOZE, AUDIT_DELETE, AUDIT_IGNORE}, actions)
+
+	marked := events[0]
+	assert.Equal(t, "i-123", marked.Id)
+	assert.Equal(t, "TTLTagExpiredFilter", marked.Reason)
+	assert.Equal(t, "1d", marked.GracePeriod)
+	assert.Equal(t, map[string]string{"ttl": "1h"}, marked.Tags)
+	assert.Equal(t, "api", events[2].Actor)
+	assert.Equal(t, "1h0m0s", events[2].GracePeriod)
+	assert.True(t, events[3].DryRun)
+	assert.Equal(t, "IgnoreConfigFilter", events[4].Reason)
+	assert.False(t, c.CandidateExists(other.Key()))
+
+	cases := map[string]struct {
+		query  AuditQuery
+		expect int
+	}{
+		"by id":        {AuditQuery{Id: "i-123"}, 3},
+		"by key":       {AuditQuery{Id: other.Key()}, 2},
+		"by owner":     {AuditQuery{Owner: "someone-else"}, 2},
+		"since":        {AuditQuery{Since: time.Now().Add(-time.Minute)}, 5},
+		"until":        {AuditQuery{Until: time.Now().Add(-time.Minute)}, 0},
+		"nothing else": {AuditQuery{Id: "i-789"}, 0},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			events, err := ReadAudit(c, tc.query)
+			assert.Nil(t, err)
+			assert.Len(t, events, tc.expect)
+		})
+	}
+}
+
+type namedMarker struct{}
+
+func (nm *namedMarker) ReceiverFilter() bool { return false }
+
+func PlainFilter() bool { return false }
+
+func TestFilterName(t *testing.T) {
+	nm := &namedMarker{}
+	assert.Equal(t, "PlainFilter", FilterName(PlainFilter))
+	assert.Equal(t, "ReceiverFilter", FilterName(nm.ReceiverFilter))
+}
+
+func TestJobs(t *testing.T) {
+	jobs := NewJobs()
+	started, release := make(chan bool), make(chan bool)
+	go jobs.Run(func() {
+		started <- true
+		<-release
+	})
+	<-started
+
+	// a running job holds shutdown up until it finishes
+	assert.False(t, jobs.Stop(10*time.Millisecond))
+	assert.False(t, jobs.Run(func() { t.Error("ran a job after stopping") }))
+	close(release)
+	assert.True(t, jobs.Stop(time.Second))
+}
+
+type planMarker struct {
+	name  string
+	mark  func()
+	sweep func()
+}
+
+func (pm *planMarker) Mark()                     { pm.mark() }
+func (pm *planMarker) Sweep()                    { pm.sweep() }
+func (pm *planMarker) GetMarkSchedule() string   { return "@hourly" }
+func (pm *planMarker) GetSweepSchedule() string  { return "@hourly" }
+func (pm *planMarker) GetNotifySchedule() string { return "@daily" }
+func (pm *planMarker) GetName() string           { return pm.name }
+func (pm *planMarker) GetType() MarkerType       { return AWS }
+
+func TestPlan(t *testing.T) {
+	candidate := func(account, id string) *MarkedCandidate {
+		return &MarkedCandidate{MarkerType: AWS, CandidateType: "ec2", Id: id, Owner: "some-jerk", Account: account, Region: "us-west-2"}
+	}
+	expired, waiting, fixed, other := candidate("dev", "i-1"), candidate("dev", "i-2"), candidate("dev", "i-3"), candidate("prod", "i-4")
+	c := cache.NewMemoryCache()
+	_, err := WriteCandidate(c, expired, "0s")
+	assert.Nil(t, err)
+	_, err = WriteCandidate(c, waiting, "2d")
+	assert.Nil(t, err)
+	_, err = WriteCandidate(c, fixed, "2d")
+	assert.Nil(t, err)
+	_, err = WriteCandidate(c, other, "0s")
+	assert.Nil(t, err)
+	audited, err := c.ReadAudit()
+	assert.Nil(t, err)
+
+	pc, err := NewPlanCache(c)
+	assert.Nil(t, err)
+	fresh, ignored := candidate("dev", "i-5"), candidate("dev", "i-6")
+	pm := &planMarker{
+		name: "dev",
+		mark: func() {
+			_, err := WriteCandidate(pc, expired, "1d")
+			assert.Nil(t, err)
+			_, err = WriteCandidate(pc, fresh, "1d")
+			assert.Nil(t, err)
+			for _, m := range []*MarkedCandidate{fixed, ignored} {
+				dropped := *m
+				dropped.Reason = "IgnoreConfigFilter"
+				assert.Nil(t, Ignore(pc, &dropped))
+			}
+		},
+		sweep: func() { assert.Nil(t, Swept(pc, expired.Key(), true)) },
+	}
+	start := time.Now()
+	pm.Mark()
+	pm.Sweep()
+	entries, err := pc.Plan([]Marker{pm}, start)
+	assert.Nil(t, err)
+
+	actual := []string{}
+	for _, e := range entries {
+		actual = append(actual, e.Action+" "+e.Id+" "+e.Reason)
+	}
+	assert.Equal(t, []string{"delete i-1 ", "delete i-2 ", "mark i-5 ", "drop i-3 IgnoreConfigFilter", "ignore i-6 IgnoreConfigFilter"}, actual)
+	assert.True(t, entries[0].Due)
+	assert.False(t, entries[1].Due)
+	assert.True(t, entries[1].DeleteAt.After(start.Add(48*time.Hour)))
+	assert.False(t, entries[2].Due)
+	assert.True(t, Pending(entries))
+	assert.False(t, Pending(entries[1:]))
+
+	// the real cache is left alone
+	assert.True(t, c.CandidateExists(fixed.Key()))
+	assert.False(t, c.CandidateExists(fresh.Key()))
+	after, err := c.ReadAudit()
+	assert.Nil(t, err)
+	assert.Equal(t, audited, after)
+}
+
+func TestCheckSweep(t *testing.T) {
+	c := cache.NewMemoryCache()
+	for i, canType := range []string{"ec2", "ec2", "ec2", "ebs"} {
+		m := &MarkedCandidate{MarkerType: AWS, CandidateType: canType, Id: fmt.Sprintf("%s-%d", canType, i), Owner: "some-jerk", Account: "dev"}
+		_, err := WriteCandidate(c, m, "0s")
+		assert.Nil(t, err)
+	}
+	waiting := &MarkedCandidate{MarkerType: AWS, CandidateType: "ec2", Id: "i-waiting", Owner: "some-jerk", Account: "dev"}
+	_, err := WriteCandidate(c, waiting, "2d")
+	assert.Nil(t, err)
+	inv := NewInventory()
+
+	for name, limits := range map[string]config.SweepLimits{
+		"no limits":        {},
+		"under max":        {MaxDeletions: 4},
+		"under type":       {MaxDeletionsPerType: map[string]int{"ec2": 3, "ebs": 1}},
+		"zero is no limit": {MaxDeletionsPerType: map[string]int{"ebs": 0}},
+	} {
+		h, err := CheckSweep(c, AWS, "dev", limits, inv)
+		assert.Nil(t, err, name)
+		assert.Nil(t, h, name)
+	}
+	_, ok := ReadHold(c, HoldKey(AWS, "dev"))
+	assert.False(t, ok)
+
+	inv.Reset("us-west-2/ec2")
+	for i := 0; i < 10; i++ {
+		inv.Add("us-west-2/ec2")
+	}
+	limits := config.SweepLimits{MaxDeletions: 3, MaxDeletionsPerType: map[string]int{"ec2": 2}, MaxPercent: 20}
+	h, err := CheckSweep(c, AWS, "dev", limits, inv)
+	assert.Nil(t, err)
+	assert.NotNil(t, h)
+	assert.Equal(t, HOLD_PENDING, h.Status)
+	assert.Equal(t, 4, h.Due)
+	assert.Equal(t, map[string]int{"ec2": 3, "ebs": 1}, h.DueByType)
+	assert.Equal(t, 10, h.Inventory)
+	assert.Len(t, h.Reasons, 3)
+
+	// the hold stays put until it's approved, whatever the limits
+	again, err := CheckSweep(c, AWS, "dev", config.SweepLimits{}, inv)
+	assert.Nil(t, err)
+	assert.Equal(t, h.Time, again.Time)
+	holds, err := ReadHolds(c)
+	assert.Nil(t, err)
+	assert.Len(t, holds, 1)
+
+	assert.Nil(t, ApproveHold(c, again, "cli:someone"))
+	h, err = CheckSweep(c, AWS, "dev", limits, inv)
+	assert.Nil(t, err)
+	assert.Nil(t, h)
+	_, ok = ReadHold(c, HoldKey(AWS, "dev"))
+	assert.False(t, ok)
+
+	events, err := ReadAudit(c, AuditQuery{Id: HoldKey(AWS, "dev")})
+	assert.Nil(t, err)
+	actions := []string{}
+	for _, e := range events {
+		actions = append(actions, e.Action)
+	}
+	assert.Equal(t, []string{AUDIT_HALT, AUDIT_RESUME}, actions)
+	assert.Equal(t, "cli:someone", events[1].Actor)
+}
+
+func TestCheckSweepInventory(t *testing.T) {
+	c := cache.NewMemoryCache()
+	m := &MarkedCandidate{MarkerType: AWS, CandidateType: "ec2", Id: "i-1", Owner: "some-jerk", Account: "dev"}
+	_, err := WriteCandidate(c, m, "0s")
+	assert.Nil(t, err)
+	limits := config.SweepLimits{MaxPercent: 20}
+
+	// nothing's been counted since we started and nothing was saved, so we can't tell
+	h, err := CheckSweep(c, AWS, "dev", limits, NewInventory())
+	assert.Nil(t, err)
+	assert.NotNil(t, h)
+	assert.Contains(t, h.Reasons[0], "inventory not counted yet")
+	assert.Equal(t, 0, h.Inventory)
+	assert.Nil(t, c.DeleteHold(h.Key))
+
+	// a count is saved, so a fresh inventory after a restart still has it
+	inv := NewInventory()
+	for i := 0; i < 10; i++ {
+		inv.Add("us-west-2/ec2")
+	}
+	h, err = CheckSweep(c, AWS, "dev", limits, inv)
+	assert.Nil(t, err)
+	assert.Nil(t, h)
+	h, err = CheckSweep(c, AWS, "dev", config.SweepLimits{MaxPercent: 5}, NewInventory())
+	assert.Nil(t, err)
+	assert.NotNil(t, h)
+	assert.Equal(t, 10, h.Inventory)
+	assert.Contains(t, h.Reasons[0], "over max_percent 5")
+}
@@ -0,0 +1,223 @@
+package mark
+
+import (
+	"encoding/json"
+	"github.com/armory-io/bilgepump/pkg/cache"
+	"github.com/robfig/cron"
+	"sort"
+	"sync"
+	"time"
+)
+
+// what a plan says will happen to a resource, in the order they're listed
+const (
+	PLAN_DELETE = "delete"
+	PLAN_MARK   = "mark"
+	PLAN_DROP   = "drop"
+	PLAN_IGNORE = "ignore"
+)
+
+var planOrder = map[string]int{PLAN_DELETE: 0, PLAN_MARK: 1, PLAN_DROP: 2, PLAN_IGNORE: 3}
+
+// PlanEntry is one resource in a plan.  Reason is the filter that marked, dropped or ignored it.
+type PlanEntry struct {
+	Action string `json:"action"`
+	Key    string `json:"key"`
+	*MarkedCandidate
+	// the first sweep after the grace period runs out
+	DeleteAt *time.Time `json:"delete_at,omitempty"`
+	// Due is set when the next sweep deletes it
+	Due bool `json:"due"`
+}
+
+// PlanCache is a scratch copy of a cache.  A plan runs markers against it with deletes turned off and
+// compares what's left with what it started with, so the real cache never changes.
+type PlanCache struct {
+	*cache.MemoryCache
+	mux      sync.Mutex
+	original map[string]*MarkedCandidate
+	ignored  map[string]*MarkedCandidate
+}
+
+// NewPlanCache copies c's candidates, grace period timers, exemptions and sweep holds
+func NewPlanCache(c cache.Cache) (*PlanCache, error) {
+	pc := &PlanCache{
+		MemoryCache: cache.NewMemoryCache(),
+		original:    map[string]*MarkedCandidate{},
+		ignored:     map[string]*MarkedCandidate{},
+	}
+	owners, err := c.ReadOwners()
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range owners {
+		for _, raw := range c.ReadCandidates(o) {
+			var m *MarkedCandidate
+			if err := json.Unmarshal([]byte(raw), &m); err != nil {
+				continue
+			}
+			if err := pc.MemoryCache.WriteCandidate(m.Key(), o, raw); err != nil {
+				return nil, err
+			}
+			if deadline, ok := c.ReadTimer(TimerKey(m.Key())); ok {
+				if err := pc.MemoryCache.ResetTimer(TimerKey(m.Key()), time.Until(deadline).String(), deadline); err != nil {
+					return nil, err
+				}
+			}
+			pc.original[m.Key()] = m
+		}
+	}
+	exemptions, err := c.ReadExemptions()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range exemptions {
+		if err := pc.MemoryCache.WriteExemption(e); err != nil {
+			return nil, err
+		}
+	}
+	holds, err := ReadHolds(c)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range holds {
+		if err := writeHold(pc.MemoryCache, h); err != nil {
+			return nil, err
+		}
+	}
+	return pc, nil
+}
+
+func (pc *PlanCache) RecordIgnore(m *MarkedCandidate) {
+	pc.mux.Lock()
+	defer pc.mux.Unlock()
+	pc.ignored[m.Key()] = m
+}
+
+// Plan lists what happened to the resources of markers once they've marked and swept the scratch cache.
+// Candidates that belong to other markers are left out.  now is when the markers started.
+func (pc *PlanCache) Plan(markers []Marker, now time.Time) ([]*PlanEntry, error) {
+	sweeps := map[string]cron.Schedule{}
+	for _, m := range markers {
+		s, err := cron.Parse(m.GetSweepSchedule())
+		if err != nil {
+			return nil, err
+		}
+		sweeps[markerKey(m.GetType(), m.GetName())] = s
+	}
+	events, err := ReadAudit(pc, AuditQuery{})
+	if err != nil {
+		return nil, err
+	}
+	swept := map[string]bool{}
+	reasons := map[string]string{}
+	for _, e := range events {
+		switch e.Action {
+		case AUDIT_DELETE:
+			swept[e.Key] = true
+		case AUDIT_DROP, AUDIT_IGNORE:
+			reasons[e.Key] = e.Reason
+		}
+	}
+
+	entries := []*PlanEntry{}
+	owners, err := pc.ReadOwners()
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range owners {
+		mcs, err := BuildCandidates(o, pc)
+		if err != nil {
+			continue
+		}
+		for _, m := range mcs {
+			sweep, ok := sweeps[markerKey(m.MarkerType, m.Account)]
+			if !ok {
+				continue
+			}
+			action := PLAN_DELETE
+			if _, ok := pc.original[m.Key()]; !ok {
+				action = PLAN_MARK
+			}
+			entries = append(entries, pc.deleteEntry(action, m, sweep, now, swept[m.Key()]))
+		}
+	}
+	for key, m := range pc.original {
+		sweep, ok := sweeps[markerKey(m.MarkerType, m.Account)]
+		if !ok || pc.CandidateExists(key) {
+			continue
+		}
+		// a dry run sweep can still let a candidate go after it would have deleted it
+		if swept[key] {
+			entries = append(entries, pc.deleteEntry(PLAN_DELETE, m, sweep, now, true))
+			continue
+		}
+		dropped := *m
+		dropped.Reason = reasons[key]
+		entries = append(entries, &PlanEntry{Action: PLAN_DROP, Key: key, MarkedCandidate: &dropped})
+	}
+	pc.mux.Lock()
+	for key, m := range pc.ignored {
+		if _, ok := sweeps[markerKey(m.MarkerType, m.Account)]; !ok {
+			continue
+		}
+		// ignoring a candidate drops it, and that's already listed
+		if _, ok := pc.original[key]; ok {
+			continue
+		}
+		entries = append(entries, &PlanEntry{Action: PLAN_IGNORE, Key: key, MarkedCandidate: m})
+	}
+	pc.mux.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Action != entries[j].Action {
+			return planOrder[entries[i].Action] < planOrder[entries[j].Action]
+		}
+		if entries[i].DeleteAt != nil && !entries[i].DeleteAt.Equal(*entries[j].DeleteAt) {
+			return entries[i].DeleteAt.Before(*entries[j].DeleteAt)
+		}
+		return entries[i].Key < entries[j].Key
+	})
+	return entries, nil
+}
+
+// deleteEntry works out which sweep deletes a candidate.  swept candidates go at the next one.
+func (pc *PlanCache) deleteEntry(action string, m *MarkedCandidate, sweep cron.Schedule, now time.Time, swept bool) *PlanEntry {
+	next := sweep.Next(now)
+	deleteAt := next
+	if deadline, ok := pc.ReadTimer(TimerKey(m.Key())); ok && !swept && deadline.After(now) {
+		deleteAt = sweep.Next(deadline)
+	}
+	return &PlanEntry{
+		Action:          action,
+		Key:             m.Key(),
+		MarkedCandidate: m,
+		DeleteAt:        &deleteAt,
+		Due:             !deleteAt.After(next),
+	}
+}
+
+// Holds are the sweeps of markers that halted against the scratch cache, so the next real ones would too
+func (pc *PlanCache) Holds(markers []Marker) []*SweepHold {
+	holds := []*SweepHold{}
+	for _, m := range markers {
+		if h, ok := ReadHold(pc, HoldKey(m.GetType(), m.GetName())); ok && h.Status == HOLD_PENDING {
+			holds = append(holds, h)
+		}
+	}
+	return holds
+}
+
+// Pending says whether the next sweep deletes anything in entries
+func Pending(entries []*PlanEntry) bool {
+	for _, e := range entries {
+		if e.Due {
+			return true
+		}
+	}
+	return false
+}
+
+func markerKey(mt MarkerType, name string) string {
+	return mt.String() + ":" + name
+}
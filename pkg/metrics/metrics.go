@@ -0,0 +1,157 @@
+package metrics
+
+import (
+	"github.com/armory-io/bilgepump/pkg/cache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"time"
+)
+
+const (
+	NAMESPACE     = "bilgepump"
+	PHASE_MARK    = "mark"
+	PHASE_SWEEP   = "sweep"
+	PHASE_COLLECT = "collect"
+)
+
+var (
+	// Registry holds everything we export.  it's separate from the default registry so only our metrics,
+	// plus the usual go and process ones, end up on /metrics.
+	Registry = prometheus.NewRegistry()
+
+	CandidatesMarked = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "candidates_marked_total",
+		Help:      "Resources marked as candidates for deletion.",
+	}, []string{"marker", "account", "type"})
+	CandidatesIgnored = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "candidates_ignored_total",
+		Help:      "Resources skipped by an ignore filter during a mark run.",
+	}, []string{"marker", "account", "type"})
+	CandidatesDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "candidates_deleted_total",
+		Help:      "Candidates deleted by a sweep.",
+	}, []string{"marker", "account", "type"})
+	CandidatesDryRun = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "candidates_dry_run_total",
+		Help:      "Candidates a sweep would have deleted if delete_enabled was set.",
+	}, []string{"marker", "account", "type"})
+	CandidatesRefused = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "candidates_refused_total",
+		Help:      "Candidates a sweep wouldn't delete, eg: buckets with more objects than it will empty.",
+	}, []string{"marker", "account", "type"})
+
+	RunDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "run_duration_seconds",
+		Help:      "How long mark, sweep and collect runs take.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"marker", "account", "phase"})
+	RunErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "run_errors_total",
+		Help:      "Mark, sweep and collect runs that finished with errors.",
+	}, []string{"marker", "account", "phase"})
+	LastRun = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "last_run_timestamp_seconds",
+		Help:      "When each mark, sweep and collect run last finished.",
+	}, []string{"marker", "account", "phase"})
+	LastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "last_success_timestamp_seconds",
+		Help:      "When each mark, sweep and collect run last finished without errors.",
+	}, []string{"marker", "account", "phase"})
+
+	Throttled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "throttled_requests_total",
+		Help:      "Provider api requests that were throttled.",
+	}, []string{"marker", "account"})
+
+	SweepsHalted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "sweeps_halted_total",
+		Help:      "Sweeps that deleted nothing because they went over their limits or were waiting on approval.",
+	}, []string{"marker", "account"})
+
+	Leader = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "leader",
+		Help:      "1 if this replica is the leader and schedules jobs, 0 if it's a standby.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		CandidatesMarked,
+		CandidatesIgnored,
+		CandidatesDeleted,
+		CandidatesDryRun,
+		CandidatesRefused,
+		RunDuration,
+		RunErrors,
+		LastRun,
+		LastSuccess,
+		Throttled,
+		SweepsHalted,
+		Leader,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Run starts timing a mark, sweep or collect run.  call the returned func when the run is over, saying
+// whether it failed.
+func Run(marker, account, phase string) func(failed bool) {
+	start := time.Now()
+	return func(failed bool) {
+		RunDuration.WithLabelValues(marker, account, phase).Observe(time.Since(start).Seconds())
+		LastRun.WithLabelValues(marker, account, phase).SetToCurrentTime()
+		if failed {
+			RunErrors.WithLabelValues(marker, account, phase).Inc()
+			return
+		}
+		LastSuccess.WithLabelValues(marker, account, phase).SetToCurrentTime()
+	}
+}
+
+var cacheCandidatesDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(NAMESPACE, "cache", "candidates"),
+	"Candidates in the cache per owner.",
+	[]string{"owner"}, nil,
+)
+
+// cacheCollector reads the cache on every scrape so the candidate counts are never stale
+type cacheCollector struct {
+	cache cache.Cache
+}
+
+func NewCacheCollector(c cache.Cache) prometheus.Collector {
+	return &cacheCollector{cache: c}
+}
+
+func (cc *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheCandidatesDesc
+}
+
+func (cc *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	owners, err := cc.cache.ReadOwners()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(cacheCandidatesDesc, err)
+		return
+	}
+	for _, o := range owners {
+		ch <- prometheus.MustNewConstMetric(cacheCandidatesDesc, prometheus.GaugeValue, float64(len(cc.cache.ReadCandidates(o))), o)
+	}
+}
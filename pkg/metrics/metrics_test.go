@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"github.com/armory-io/bilgepump/pkg/cache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	cases := map[string]struct {
+		failed        bool
+		expectErrors  float64
+		expectSuccess bool
+	}{
+		"ok":     {failed: false, expectErrors: 0, expectSuccess: true},
+		"failed": {failed: true, expectErrors: 1, expectSuccess: false},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			Run("AWS", name, PHASE_MARK)(c.failed)
+			assert.Equal(t, 1, testutil.CollectAndCount(RunDuration.WithLabelValues("AWS", name, PHASE_MARK).(prometheus.Histogram)))
+			assert.Equal(t, c.expectErrors, testutil.ToFloat64(RunErrors.WithLabelValues("AWS", name, PHASE_MARK)))
+			assert.True(t, testutil.ToFloat64(LastRun.WithLabelValues("AWS", name, PHASE_MARK)) > 0)
+			assert.Equal(t, c.expectSuccess, testutil.ToFloat64(LastSuccess.WithLabelValues("AWS", name, PHASE_MARK)) > 0)
+		})
+	}
+}
+
+func TestCacheCollector(t *testing.T) {
+	c := cache.NewMemoryCache()
+	assert.Nil(t, c.WriteCandidate("AWS:dev:us-west-2:i-1", "alice", "{}"))
+	assert.Nil(t, c.WriteCandidate("AWS:dev:us-west-2:i-2", "alice", "{}"))
+	assert.Nil(t, c.WriteCandidate("AWS:dev:us-west-2:i-3", "bob", "{}"))
+
+	expected := `
+# HELP bilgepump_cache_candidates Candidates in the cache per owner.
+# TYPE bilgepump_cache_candidates gauge
+bilgepump_cache_candidates{owner="alice"} 2
+bilgepump_cache_candidates{owner="bob"} 1
+`
+	assert.Nil(t, testutil.CollectAndCompare(NewCacheCollector(c), strings.NewReader(expected)))
+}
@@ -0,0 +1,181 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/armory-io/bilgepump/pkg/cache"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/sirupsen/logrus"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+)
+
+// a stuck mail server shouldn't hold up the rest of the owners for long
+const SMTP_TIMEOUT = 30 * time.Second
+
+// EmailNotifier mails each owner their digest as html with a plain text alternative
+type EmailNotifier struct {
+	config   *config.Email
+	logger   *logrus.Logger
+	ctx      context.Context
+	password string
+}
+
+// newEmailNotifier is the registry's factory.  email is on when a host is set.
+func newEmailNotifier(ctx context.Context, cfg *config.Config, logger *logrus.Logger, c cache.Cache) ([]Notifier, error) {
+	if !cfg.Email.Enabled() {
+		return nil, nil
+	}
+	en, err := NewEmailNotifier(ctx, &cfg.Email, logger)
+	if err != nil {
+		return nil, err
+	}
+	return []Notifier{en}, nil
+}
+
+func NewEmailNotifier(ctx context.Context, cfg *config.Email, logger *logrus.Logger) (*EmailNotifier, error) {
+	password, err := cfg.Password.Resolve()
+	if err != nil {
+		return nil, fmt.Errorf("(email) password: %v", err)
+	}
+	return &EmailNotifier{
+		config:   cfg,
+		logger:   logger,
+		ctx:      ctx,
+		password: password,
+	}, nil
+}
+
+func (en *EmailNotifier) Name() string {
+	return "email"
+}
+
+// Send mails the digest to the owner if it's an email address, otherwise to default_to
+func (en *EmailNotifier) Send(owner string, d *Digest) error {
+	to := en.config.DefaultTo
+	if emailCheck.MatchString(owner) {
+		to = owner
+	}
+	msg, err := en.message(to, d)
+	if err != nil {
+		return err
+	}
+	if err := en.send(to, msg); err != nil {
+		return fmt.Errorf("mailing %s: %v", to, err)
+	}
+	en.logger.Debugf("Mailed %d candidates to %s", len(d.Candidates), to)
+	return nil
+}
+
+func (en *EmailNotifier) message(to string, d *Digest) ([]byte, error) {
+	text, err := d.Text()
+	if err != nil {
+		return nil, err
+	}
+	html, err := d.HTML()
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", text},
+		{"text/html; charset=utf-8", html},
+	} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(pw)
+		if _, err := qw.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	// a halted sweep shouldn't look like the usual digest in someone's inbox
+	subject := en.config.Subject
+	if d.Hold != nil {
+		subject = d.Hold.Summary()
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", en.config.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", mw.Boundary())
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// send speaks smtp ourselves rather than using smtp.SendMail so the dial follows our context and the
+// whole conversation has a deadline
+func (en *EmailNotifier) send(to string, msg []byte) error {
+	addr := net.JoinHostPort(en.config.Host, strconv.Itoa(en.config.Port))
+	conn, err := (&net.Dialer{Timeout: SMTP_TIMEOUT}).DialContext(en.ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(SMTP_TIMEOUT)); err != nil {
+		conn.Close()
+		return err
+	}
+	c, err := smtp.NewClient(conn, en.config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		tlsConfig := &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			ServerName:         en.config.Host,
+			InsecureSkipVerify: en.config.InsecureSkipVerify, //nolint - opt in for self signed test setups
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if en.config.Username != "" {
+		// PlainAuth refuses to send the password unencrypted to anything but localhost
+		if err := c.Auth(smtp.PlainAuth("", en.config.Username, en.password, en.config.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(en.config.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,158 @@
+package notify
+
+import (
+	"context"
+	"github.com/armory-io/bilgepump/pkg/cache"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sunkMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+// smtpSink accepts whatever it's sent, just enough smtp for net/smtp
+type smtpSink struct {
+	ln       net.Listener
+	messages chan sunkMessage
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	s := &smtpSink{ln: ln, messages: make(chan sunkMessage, 10)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpSink) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 sink ESMTP") //nolint
+	msg := sunkMessage{}
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250-sink") //nolint
+			tp.PrintfLine("250 HELP") //nolint
+		case "MAIL":
+			msg.from = strings.Trim(strings.SplitN(line, ":", 2)[1], "<> ")
+			tp.PrintfLine("250 OK") //nolint
+		case "RCPT":
+			msg.to = append(msg.to, strings.Trim(strings.SplitN(line, ":", 2)[1], "<> "))
+			tp.PrintfLine("250 OK") //nolint
+		case "DATA":
+			tp.PrintfLine("354 go ahead") //nolint
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.data = string(data)
+			s.messages <- msg
+			msg = sunkMessage{}
+			tp.PrintfLine("250 OK") //nolint
+		case "QUIT":
+			tp.PrintfLine("221 bye") //nolint
+			return
+		default:
+			tp.PrintfLine("250 OK") //nolint
+		}
+	}
+}
+
+func (s *smtpSink) config() config.Email {
+	host, port, _ := net.SplitHostPort(s.ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return config.Email{Host: host, Port: p, From: "bilge@example.com", DefaultTo: "cloud-team@example.com", Subject: config.DEFAULT_EMAIL_SUBJECT}
+}
+
+func (s *smtpSink) next(t *testing.T) sunkMessage {
+	select {
+	case m := <-s.messages:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing was mailed")
+		return sunkMessage{}
+	}
+}
+
+// parts returns the body of each part of a multipart/alternative message by content type
+func parts(t *testing.T, msg *mail.Message) map[string]string {
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	assert.Nil(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+	bodies := map[string]string{}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		body, err := io.ReadAll(p)
+		assert.Nil(t, err)
+		contentType, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		bodies[contentType] = string(body)
+	}
+	return bodies
+}
+
+func TestEmailNotifier(t *testing.T) {
+	sink := newSMTPSink(t)
+	cfg := sink.config()
+	en, err := NewEmailNotifier(context.Background(), &cfg, logrus.New())
+	assert.Nil(t, err)
+
+	c := cache.NewMemoryCache()
+	mcs := []*mark.MarkedCandidate{
+		{MarkerType: mark.AWS, CandidateType: "ec2", Id: "i-123", Owner: "alice@example.com", Account: "dev", Region: "us-west-2", Purpose: "<b>load test</b>"},
+	}
+	_, err = mark.WriteCandidate(c, mcs[0], "2d")
+	assert.Nil(t, err)
+	assert.Nil(t, en.Send("alice@example.com", NewDigest(c, "alice@example.com", mcs)))
+
+	sunk := sink.next(t)
+	assert.Equal(t, "bilge@example.com", sunk.from)
+	assert.Equal(t, []string{"alice@example.com"}, sunk.to)
+	msg, err := mail.ReadMessage(strings.NewReader(sunk.data))
+	assert.Nil(t, err)
+	assert.Equal(t, "alice@example.com", msg.Header.Get("To"))
+	assert.Equal(t, config.DEFAULT_EMAIL_SUBJECT, msg.Header.Get("Subject"))
+	bodies := parts(t, msg)
+	assert.Contains(t, bodies["text/plain"], "i-123 (AWS ec2)")
+	assert.Contains(t, bodies["text/plain"], "Deletes after")
+	assert.Contains(t, bodies["text/html"], "<code>i-123</code>")
+	assert.Contains(t, bodies["text/html"], "&lt;b&gt;load test&lt;/b&gt;")
+
+	// owners that aren't addresses go to default_to
+	assert.Nil(t, en.Send("some-jerk", NewDigest(c, "some-jerk", mcs)))
+	assert.Equal(t, []string{"cloud-team@example.com"}, sink.next(t).to)
+}
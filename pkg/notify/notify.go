@@ -1,6 +1,202 @@
 package notify
 
+import (
+	"context"
+	"github.com/armory-io/bilgepump/pkg/cache"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/armory-io/bilgepump/pkg/metrics"
+	"github.com/sirupsen/logrus"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Notifier tells an owner about their candidates.  Send gets one digest per owner on every notify run;
+// owner is empty for candidates nobody claimed, and it's up to the notifier who hears about those.
 type Notifier interface {
-	Collect()
-	Send() error
+	Name() string
+	Send(owner string, d *Digest) error
+}
+
+// Factory builds a notifier's instances from config.  It returns none when it isn't configured.
+type Factory func(ctx context.Context, cfg *config.Config, logger *logrus.Logger, c cache.Cache) ([]Notifier, error)
+
+// Collector is implemented by notifiers that would rather see every digest at once than get one Send per
+// owner.  eg: a webhook posting events instead of digests.
+type Collector interface {
+	Collect(digests []*Digest) error
+}
+
+var (
+	factoriesMux sync.Mutex
+	factories    = map[string]Factory{}
+)
+
+// Register makes a notifier available to NewRegistry.  Registering the same name twice replaces it.
+func Register(name string, f Factory) {
+	factoriesMux.Lock()
+	defer factoriesMux.Unlock()
+	factories[name] = f
+}
+
+func init() {
+	Register("slack", newSlackNotifier)
+	Register("email", newEmailNotifier)
+	Register("webhook", newWebhookNotifiers)
+}
+
+// Registry holds every configured notifier and sends each of them the same digests
+type Registry struct {
+	Notifiers []Notifier
+	logger    *logrus.Logger
+	cache     cache.Cache
+}
+
+// NewRegistry builds every registered notifier that's configured, in name order
+func NewRegistry(ctx context.Context, cfg *config.Config, logger *logrus.Logger, c cache.Cache) (*Registry, error) {
+	factoriesMux.Lock()
+	names := []string{}
+	registered := map[string]Factory{}
+	for name, f := range factories {
+		names = append(names, name)
+		registered[name] = f
+	}
+	factoriesMux.Unlock()
+	sort.Strings(names)
+
+	r := &Registry{logger: logger, cache: c}
+	for _, name := range names {
+		notifiers, err := registered[name](ctx, cfg, logger, c)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range notifiers {
+			logger.Infof("Notifying with %s", n.Name())
+			r.Notifiers = append(r.Notifiers, n)
+		}
+	}
+	return r, nil
+}
+
+func (r *Registry) Len() int {
+	return len(r.Notifiers)
+}
+
+// Collect renders a digest for every owner with candidates, and one for every halted sweep, and hands
+// them to each notifier.  A notifier that fails for one owner still gets the rest.
+func (r *Registry) Collect() {
+	digests, err := Digests(r.cache)
+	failed := err != nil
+	if err != nil {
+		r.logger.Error(err)
+	}
+	holds, err := HoldDigests(r.cache)
+	if err != nil {
+		r.logger.Error(err)
+		failed = true
+	}
+	r.send(append(digests, holds...), failed)
+}
+
+// Sweep runs a marker's sweep and tells the default owner straight away if it halted, and owners if it
+// refused to delete any of their candidates, rather than on the next notify run
+func (r *Registry) Sweep(m mark.Marker) func() {
+	return func() {
+		start := time.Now().UTC()
+		m.Sweep()
+		digests, err := RefusedDigests(r.cache, m, start)
+		if err != nil {
+			r.logger.Error(err)
+		}
+		h, ok := mark.ReadHold(r.cache, mark.HoldKey(m.GetType(), m.GetName()))
+		if ok && h.Status == mark.HOLD_PENDING && !h.Time.Before(start) {
+			digests = append(digests, NewHoldDigest(r.cache, h))
+		}
+		if len(digests) != 0 {
+			r.send(digests, false)
+		}
+	}
+}
+
+func (r *Registry) send(digests []*Digest, failed bool) {
+	for _, n := range r.Notifiers {
+		done := metrics.Run(n.Name(), "", metrics.PHASE_COLLECT)
+		nFailed := failed
+		if col, ok := n.(Collector); ok {
+			if err := col.Collect(digests); err != nil {
+				r.logger.WithField("notifier", n.Name()).Error(err)
+				nFailed = true
+			}
+			done(nFailed)
+			continue
+		}
+		for _, d := range digests {
+			if err := n.Send(d.Owner, d); err != nil {
+				r.logger.WithFields(logrus.Fields{"notifier": n.Name(), "owner": d.Owner}).Error(err)
+				nFailed = true
+			}
+		}
+		done(nFailed)
+	}
+}
+
+// Digests renders the candidates of every owner, in owner order
+func Digests(c cache.Cache) ([]*Digest, error) {
+	owners, err := c.ReadOwners()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(owners)
+	digests := []*Digest{}
+	for _, o := range owners {
+		mcs, err := mark.BuildCandidates(o, c)
+		if err != nil {
+			continue
+		}
+		digests = append(digests, NewDigest(c, o, mcs))
+	}
+	return digests, nil
+}
+
+// RefusedDigests renders the candidates a marker's sweep refused to delete since it started, per owner in
+// owner order
+func RefusedDigests(c cache.Cache, m mark.Marker, since time.Time) ([]*Digest, error) {
+	events, err := mark.ReadAudit(c, mark.AuditQuery{Since: since})
+	if err != nil {
+		return nil, err
+	}
+	byOwner := map[string][]*mark.AuditEvent{}
+	for _, e := range events {
+		if e.Action == mark.AUDIT_REFUSE && e.MarkerType == m.GetType().String() && e.Account == m.GetName() {
+			byOwner[e.Owner] = append(byOwner[e.Owner], e)
+		}
+	}
+	owners := []string{}
+	for o := range byOwner {
+		owners = append(owners, o)
+	}
+	sort.Strings(owners)
+	digests := []*Digest{}
+	for _, o := range owners {
+		if d := NewRefusedDigest(c, o, byOwner[o]); len(d.Candidates) != 0 {
+			digests = append(digests, d)
+		}
+	}
+	return digests, nil
+}
+
+// HoldDigests renders every sweep that's waiting on approval, in key order
+func HoldDigests(c cache.Cache) ([]*Digest, error) {
+	holds, err := mark.ReadHolds(c)
+	if err != nil {
+		return nil, err
+	}
+	digests := []*Digest{}
+	for _, h := range holds {
+		if h.Status == mark.HOLD_PENDING {
+			digests = append(digests, NewHoldDigest(c, h))
+		}
+	}
+	return digests, nil
 }
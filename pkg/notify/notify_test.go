@@ -0,0 +1,165 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"github.com/armory-io/bilgepump/pkg/cache"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type recordingNotifier struct {
+	sent map[string][]string
+	fail string
+}
+
+func (rn *recordingNotifier) Name() string { return "recording" }
+
+func (rn *recordingNotifier) Send(owner string, d *Digest) error {
+	if rn.fail != "" && owner == rn.fail {
+		return errors.New("no")
+	}
+	for _, c := range d.Candidates {
+		rn.sent[owner] = append(rn.sent[owner], c.Id)
+	}
+	return nil
+}
+
+func TestNewDigest(t *testing.T) {
+	c := cache.NewMemoryCache()
+	later := &mark.MarkedCandidate{MarkerType: mark.AWS, CandidateType: "ec2", Id: "i-2", Account: "dev"}
+	sooner := &mark.MarkedCandidate{MarkerType: mark.AWS, CandidateType: "ec2", Id: "i-1", Account: "dev"}
+	expired := &mark.MarkedCandidate{MarkerType: mark.K8S, CandidateType: "namespace", Id: "ns-1", Account: "cluster"}
+	_, err := mark.WriteCandidate(c, later, "3d")
+	assert.Nil(t, err)
+	_, err = mark.WriteCandidate(c, sooner, "1d")
+	assert.Nil(t, err)
+	_, err = mark.WriteCandidate(c, expired, "0s")
+	assert.Nil(t, err)
+
+	d := NewDigest(c, "", []*mark.MarkedCandidate{later, sooner, expired})
+	ids := []string{}
+	for _, dc := range d.Candidates {
+		ids = append(ids, dc.Id)
+	}
+	assert.Equal(t, []string{"ns-1", "i-1", "i-2"}, ids)
+	assert.Nil(t, d.Candidates[0].DeleteAt)
+	assert.Equal(t, "Deletes on the next sweep", d.Candidates[0].Deadline)
+	assert.Equal(t, sooner.Key(), d.Candidates[1].Key)
+
+	text, err := d.Text()
+	assert.Nil(t, err)
+	assert.Contains(t, text, DIGEST_TITLE)
+	assert.Contains(t, text, "ns-1 (K8S namespace)")
+	assert.NotContains(t, text, "region:")
+}
+
+func TestRegistryCollect(t *testing.T) {
+	c := cache.NewMemoryCache()
+	for _, m := range []*mark.MarkedCandidate{
+		{MarkerType: mark.AWS, CandidateType: "ec2", Id: "i-1", Owner: "alice", Account: "dev"},
+		{MarkerType: mark.AWS, CandidateType: "ec2", Id: "i-2", Owner: "bob", Account: "dev"},
+		{MarkerType: mark.AWS, CandidateType: "ebs", Id: "vol-1", Owner: "", Account: "dev"},
+	} {
+		_, err := mark.WriteCandidate(c, m, "1d")
+		assert.Nil(t, err)
+	}
+	failing := &recordingNotifier{sent: map[string][]string{}, fail: "alice"}
+	working := &recordingNotifier{sent: map[string][]string{}}
+	r := &Registry{Notifiers: []Notifier{failing, working}, logger: logrus.New(), cache: c}
+	r.Collect()
+
+	assert.Equal(t, map[string][]string{"": {"vol-1"}, "alice": {"i-1"}, "bob": {"i-2"}}, working.sent)
+	// one owner failing doesn't stop the others
+	assert.Equal(t, map[string][]string{"": {"vol-1"}, "bob": {"i-2"}}, failing.sent)
+}
+
+func TestNewRegistry(t *testing.T) {
+	r, err := NewRegistry(context.Background(), &config.Config{}, logrus.New(), cache.NewMemoryCache())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, r.Len())
+
+	r, err = NewRegistry(context.Background(), &config.Config{Email: config.Email{Host: "localhost", Port: 25}}, logrus.New(), cache.NewMemoryCache())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, r.Len())
+	assert.Equal(t, "email", r.Notifiers[0].Name())
+}
+
+type haltingMarker struct {
+	c cache.Cache
+}
+
+func (hm *haltingMarker) Mark() {}
+func (hm *haltingMarker) Sweep() {
+	mark.CheckSweep(hm.c, mark.AWS, "dev", config.SweepLimits{MaxDeletions: 1}, mark.NewInventory()) //nolint
+}
+func (hm *haltingMarker) GetMarkSchedule() string   { return "@hourly" }
+func (hm *haltingMarker) GetSweepSchedule() string  { return "@hourly" }
+func (hm *haltingMarker) GetNotifySchedule() string { return "@daily" }
+func (hm *haltingMarker) GetName() string           { return "dev" }
+func (hm *haltingMarker) GetType() mark.MarkerType  { return mark.AWS }
+
+func TestRegistrySweepHalted(t *testing.T) {
+	c := cache.NewMemoryCache()
+	for _, m := range []*mark.MarkedCandidate{
+		{MarkerType: mark.AWS, CandidateType: "ec2", Id: "i-1", Owner: "alice", Account: "dev"},
+		{MarkerType: mark.AWS, CandidateType: "ec2", Id: "i-2", Owner: "bob", Account: "dev"},
+	} {
+		_, err := mark.WriteCandidate(c, m, "0s")
+		assert.Nil(t, err)
+	}
+	rn := &recordingNotifier{sent: map[string][]string{}}
+	r := &Registry{Notifiers: []Notifier{rn}, logger: logrus.New(), cache: c}
+
+	// the default owner hears about it straight away, then on every notify run until it's approved
+	r.Sweep(&haltingMarker{c: c})()
+	assert.Equal(t, map[string][]string{"": {"i-1", "i-2"}}, rn.sent)
+	r.Collect()
+	assert.Equal(t, []string{"i-1", "i-2", "i-1", "i-2"}, rn.sent[""])
+
+	digests, err := HoldDigests(c)
+	assert.Nil(t, err)
+	assert.Len(t, digests, 1)
+	assert.Equal(t, "", digests[0].Owner)
+	assert.Contains(t, digests[0].Title, "AWS dev sweep halted until approved")
+
+	assert.Nil(t, mark.ApproveHold(c, digests[0].Hold, "cli"))
+	digests, err = HoldDigests(c)
+	assert.Nil(t, err)
+	assert.Empty(t, digests)
+}
+
+type refusingMarker struct {
+	haltingMarker
+}
+
+func (rm *refusingMarker) Sweep() {
+	mark.Refused(rm.c, mark.CandidateKey(mark.AWS, "dev", "us-east-1", "big-bucket"), "holds more than max_objects (10)", false) //nolint
+}
+
+func TestRegistrySweepRefused(t *testing.T) {
+	c := cache.NewMemoryCache()
+	for _, m := range []*mark.MarkedCandidate{
+		{MarkerType: mark.AWS, CandidateType: "s3", Id: "big-bucket", Owner: "alice", Account: "dev", Region: "us-east-1"},
+		{MarkerType: mark.AWS, CandidateType: "s3", Id: "small-bucket", Owner: "bob", Account: "dev", Region: "us-east-1"},
+	} {
+		_, err := mark.WriteCandidate(c, m, "0s")
+		assert.Nil(t, err)
+	}
+	rn := &recordingNotifier{sent: map[string][]string{}}
+	r := &Registry{Notifiers: []Notifier{rn}, logger: logrus.New(), cache: c}
+
+	// only the owner of what was refused hears about it, straight away
+	r.Sweep(&refusingMarker{haltingMarker{c: c}})()
+	assert.Equal(t, map[string][]string{"alice": {"big-bucket"}}, rn.sent)
+
+	digests, err := RefusedDigests(c, &refusingMarker{haltingMarker{c: c}}, time.Time{})
+	assert.Nil(t, err)
+	assert.Len(t, digests, 1)
+	assert.True(t, digests[0].Refused)
+	assert.Equal(t, "Refused: holds more than max_objects (10)", digests[0].Candidates[0].Deadline)
+}
@@ -0,0 +1,134 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/armory-io/bilgepump/pkg/cache"
+	"github.com/armory-io/bilgepump/pkg/mark"
+	htmltemplate "html/template"
+	"sort"
+	"text/template"
+	"time"
+)
+
+const (
+	DIGEST_TITLE         = "Resources that have expiring ttl"
+	REFUSED_DIGEST_TITLE = "Resources the sweep wouldn't delete"
+	// a hold digest lists this many of the candidates the halted sweep would have deleted
+	HOLD_DIGEST_SAMPLE = 20
+)
+
+// Digest is one owner's candidates, ready for any notifier to send.  Hold is set when it's about a
+// halted sweep rather than an owner, in which case Owner is empty so it goes to the default owner.
+// Refused is set when it's the candidates a sweep wouldn't delete.
+type Digest struct {
+	Owner      string
+	Title      string
+	Candidates []*DigestCandidate
+	Hold       *mark.SweepHold
+	Refused    bool
+}
+
+// DigestCandidate is a candidate with its grace period deadline.  DeleteAt is nil once the grace period
+// has run out and the candidate is waiting on the next sweep.
+type DigestCandidate struct {
+	*mark.MarkedCandidate
+	Key      string
+	DeleteAt *time.Time
+	// Deadline says when it will be deleted, for people
+	Deadline string
+	// Refused is why a sweep wouldn't delete it, in a refused digest
+	Refused string
+}
+
+// NewDigest looks up each candidate's deadline and orders them soonest first
+func NewDigest(c cache.Cache, owner string, mcs []*mark.MarkedCandidate) *Digest {
+	d := &Digest{Owner: owner, Title: DIGEST_TITLE}
+	for _, m := range mcs {
+		dc := &DigestCandidate{MarkedCandidate: m, Key: m.Key(), Deadline: "Deletes on the next sweep"}
+		if deadline, ok := c.ReadTimer(mark.TimerKey(m.Key())); ok {
+			dc.DeleteAt = &deadline
+			dc.Deadline = fmt.Sprintf("Deletes after %s (in %s)", deadline.Format(time.RFC1123), time.Until(deadline).Round(time.Minute))
+		}
+		d.Candidates = append(d.Candidates, dc)
+	}
+	sort.SliceStable(d.Candidates, func(i, j int) bool {
+		a, b := d.Candidates[i].DeleteAt, d.Candidates[j].DeleteAt
+		if (a == nil) != (b == nil) {
+			return a == nil
+		}
+		if a != nil && !a.Equal(*b) {
+			return a.Before(*b)
+		}
+		return d.Candidates[i].Key < d.Candidates[j].Key
+	})
+	return d
+}
+
+// NewHoldDigest tells the default owner a marker's sweep is halted, with a sample of what it would delete
+func NewHoldDigest(c cache.Cache, h *mark.SweepHold) *Digest {
+	due, _ := mark.DueCandidates(c, h.MarkerType, h.Account)
+	if len(due) > HOLD_DIGEST_SAMPLE {
+		due = due[:HOLD_DIGEST_SAMPLE]
+	}
+	d := NewDigest(c, "", due)
+	d.Title = fmt.Sprintf("%s, approve it with 'bilgepump holds approve %s'", h.Summary(), h.Key)
+	d.Hold = h
+	return d
+}
+
+// NewRefusedDigest tells an owner which of their candidates a sweep refused to delete, and why.  events are
+// the sweep's refuse audit events for the owner.
+func NewRefusedDigest(c cache.Cache, owner string, events []*mark.AuditEvent) *Digest {
+	d := &Digest{Owner: owner, Title: REFUSED_DIGEST_TITLE, Refused: true}
+	for _, e := range events {
+		m, ok := mark.ReadCandidate(c, e.Key)
+		if !ok {
+			continue
+		}
+		deadline := "Refused: " + e.Reason
+		if e.DryRun {
+			deadline = "Would be refused: " + e.Reason
+		}
+		d.Candidates = append(d.Candidates, &DigestCandidate{MarkedCandidate: m, Key: e.Key, Deadline: deadline, Refused: e.Reason})
+	}
+	return d
+}
+
+var textDigest = template.Must(template.New("text").Parse(`{{ .Title }}
+{{ range .Candidates }}
+{{ .Id }} ({{ .MarkerType }} {{ .CandidateType }})
+  account: {{ .Account }}{{ if .Region }}
+  region:  {{ .Region }}{{ end }}
+  owner:   {{ .Owner }}
+  purpose: {{ .Purpose }}
+  {{ .Deadline }}
+{{ end }}`))
+
+var htmlDigest = htmltemplate.Must(htmltemplate.New("html").Parse(`<!DOCTYPE html>
+<html>
+<body>
+<h2>{{ .Title }}</h2>
+<table cellpadding="4" style="border-collapse: collapse">
+<tr><th align="left">Resource</th><th align="left">Type</th><th align="left">Account</th><th align="left">Region</th><th align="left">Owner</th><th align="left">Purpose</th><th align="left">Deletion</th></tr>
+{{ range .Candidates }}<tr><td><code>{{ .Id }}</code></td><td>{{ .MarkerType }} {{ .CandidateType }}</td><td>{{ .Account }}</td><td>{{ .Region }}</td><td>{{ .Owner }}</td><td>{{ .Purpose }}</td><td>{{ .Deadline }}</td></tr>
+{{ end }}</table>
+</body>
+</html>
+`))
+
+func (d *Digest) Text() (string, error) {
+	var b bytes.Buffer
+	if err := textDigest.Execute(&b, d); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func (d *Digest) HTML() (string, error) {
+	var b bytes.Buffer
+	if err := htmlDigest.Execute(&b, d); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
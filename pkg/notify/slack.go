@@ -2,9 +2,12 @@ package notify
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"github.com/armory-io/bilgepump/pkg/cache"
 	"github.com/armory-io/bilgepump/pkg/config"
-	"github.com/armory-io/bilgepump/pkg/mark"
 	"github.com/nlopes/slack"
 	"github.com/sirupsen/logrus"
 	"regexp"
@@ -13,7 +16,7 @@ import (
 
 var emailCheck = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
-const MAX_SLACK_ATTACHMENTS = 20 // the API technically supports 100 but after 20 they're "unreadable" according to Slack
+const MAX_SLACK_CANDIDATES = 12 // each candidate takes up to 4 blocks and Slack allows 50 blocks per message
 
 type SlackNotifier struct {
 	config       *config.Config
@@ -24,6 +27,18 @@ type SlackNotifier struct {
 	defaultOwner *slack.User
 }
 
+// newSlackNotifier is the registry's factory.  slack is on when a token is set.
+func newSlackNotifier(ctx context.Context, cfg *config.Config, logger *logrus.Logger, cache cache.Cache) ([]Notifier, error) {
+	if cfg.Slack.Token == "" {
+		return nil, nil
+	}
+	sn := NewSlackNotifier(ctx, cfg, logger, cache)
+	if !sn.IsValid() {
+		return nil, errors.New("Slack isn't configured with proper default account")
+	}
+	return []Notifier{sn}, nil
+}
+
 func NewSlackNotifier(ctx context.Context, cfg *config.Config, logger *logrus.Logger, cache cache.Cache) *SlackNotifier {
 
 	client := slack.New(cfg.Slack.Token)
@@ -85,85 +100,51 @@ func (sn *SlackNotifier) IsValid() bool {
 	return true
 }
 
-func (sn *SlackNotifier) Collect() {
-	// determine if we can match a slack username or email.  if we can't assets owned by that owner default to the default_owner
-	notifyTargets := map[string]*slack.User{}
-	notifyTargets[""] = sn.defaultOwner
-	owners, err := sn.cache.ReadOwners()
-	if err != nil {
-		sn.logger.Error(err)
-		return
-	}
-	for _, o := range owners {
-		if o != "" {
-			email := sn.findUserByEmail(o)
-			user := sn.findUserByName(o)
-			switch {
-			case email != nil:
-				notifyTargets[o] = email
-				continue
-			case user != nil:
-				notifyTargets[o] = user
-				continue
-			default:
-				notifyTargets[o] = sn.defaultOwner
-				continue
-			}
-		}
-	}
+func (sn *SlackNotifier) Name() string {
+	return "slack"
+}
 
-	sn.logger.Debug(notifyTargets)
-	// we've got owners, send the assets collected by owner to the person that needs to know we're going to ruin their world
-	for _, o := range owners {
-		c := sn.cache.ReadCandidates(o)
-		sn.logger.Debug(len(c))
-		// convert candidates into MarkedCandidates and pass into Send()
-		mcs, err := mark.BuildCandidates(o, sn.cache)
-		if err != nil {
-			sn.logger.Error(err)
-			return
-		}
-		err = sn.SlackSend(notifyTargets[o], mcs)
-		if err != nil {
-			sn.logger.Error(err)
+// Send posts an owner's digest to them if we can match a slack username or email, otherwise to the
+// default owner, or the channel if one is set
+func (sn *SlackNotifier) Send(owner string, d *Digest) error {
+	user := sn.defaultOwner
+	if owner != "" {
+		if u := sn.findUserByEmail(owner); u != nil {
+			user = u
+		} else if u := sn.findUserByName(owner); u != nil {
+			user = u
 		}
 	}
+	return sn.SlackSend(user, d.Title, d.Candidates)
 }
 
-func (sn *SlackNotifier) Send() error {
-	return nil
-}
-
-func (sn *SlackNotifier) SlackSend(user *slack.User, candidate []*mark.MarkedCandidate) error {
-	attachments := make([]slack.Attachment, len(candidate))
-
-	for i, c := range candidate {
-		attachment := slack.Attachment{
-			Color:  c.MarkerType.Color(),
-			Text:   c.Id,
-			Fields: c.GenerateSlackAttachmentFields(),
-		}
-		attachments[i] = attachment
-	}
+func (sn *SlackNotifier) SlackSend(user *slack.User, title string, candidate []*DigestCandidate) error {
 	// send to default channel if one exists
 	id := user.ID
 	if sn.config.Slack.Channel != "" && user == sn.defaultOwner {
 		id = sn.config.Slack.Channel
 	}
 	// chunk the sends to slack
-	attSize := len(attachments)
-	var chunkedAttachments [][]slack.Attachment
-	for i := 0; i < attSize; i += MAX_SLACK_ATTACHMENTS {
-		chunk := i + MAX_SLACK_ATTACHMENTS
-		if chunk > attSize {
-			chunk = attSize
+	canSize := len(candidate)
+	for i := 0; i < canSize; i += MAX_SLACK_CANDIDATES {
+		chunk := i + MAX_SLACK_CANDIDATES
+		if chunk > canSize {
+			chunk = canSize
+		}
+		blocks := []slack.Block{
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*%s*", title), false, false), nil, nil),
+		}
+		for _, c := range candidate[i:chunk] {
+			blocks = append(blocks, sn.candidateBlocks(c)...)
+		}
+		channelID, timestamp, err := sn.client.PostMessageContext(sn.ctx, id, slack.MsgOptionText(title, false),
+			slack.MsgOptionBlocks(blocks...), slack.MsgOptionAsUser(true))
+		// we sleep to avoid rate limiting and having Bilge become potentially banned
+		select {
+		case <-sn.ctx.Done():
+			return sn.ctx.Err()
+		case <-time.After(time.Second * 2):
 		}
-		chunkedAttachments = append(chunkedAttachments, attachments[i:chunk])
-	}
-	for _, attachmentChunk := range chunkedAttachments {
-		channelID, timestamp, err := sn.client.PostMessage(id, slack.MsgOptionText("Instances that have expiring ttl", false),
-			slack.MsgOptionAttachments(attachmentChunk...), slack.MsgOptionAsUser(true))
-		time.Sleep(time.Second * 2) // we sleep one second to avoid rate limiting and having Bilge become potentially banned
 		if err != nil {
 			sn.logger.Error(err)
 			continue
@@ -173,3 +154,48 @@ func (sn *SlackNotifier) SlackSend(user *slack.User, candidate []*mark.MarkedCan
 
 	return nil
 }
+
+// candidateBlocks renders a single candidate.  the action block id is the candidate key, which is how
+// the interaction handler knows which candidate a button press is about.
+func (sn *SlackNotifier) candidateBlocks(c *DigestCandidate) []slack.Block {
+	title := fmt.Sprintf("*%s*  `%s %s`", c.Id, c.MarkerType, c.CandidateType)
+	blocks := []slack.Block{
+		slack.NewDividerBlock(),
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, title, false, false), c.GenerateSlackBlockFields(), nil),
+		slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, c.Deadline, false, false)),
+	}
+	if sn.config.Slack.SigningSecret.IsSet() {
+		blocks = append(blocks, candidateActions(c.Key, sn.config.Slack.SnoozeDurations))
+	}
+	return blocks
+}
+
+// candidateBlockID names a candidate's action block.  slack caps block ids at 255 characters, which a key
+// can run past, so the buttons carry the key and the block id is a hash of it.
+func candidateBlockID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "candidate-" + hex.EncodeToString(sum[:16])
+}
+
+func candidateActions(key string, snoozeDurations []string) *slack.ActionBlock {
+	plain := func(text string) *slack.TextBlockObject {
+		return slack.NewTextBlockObject(slack.PlainTextType, text, false, false)
+	}
+	options := []*slack.OptionBlockObject{}
+	for _, d := range snoozeDurations {
+		options = append(options, slack.NewOptionBlockObject(d, plain(fmt.Sprintf("Snooze %s", d))))
+	}
+	snooze := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, plain("Snooze..."), SLACK_ACTION_SNOOZE, options...)
+
+	keep := slack.NewButtonBlockElement(SLACK_ACTION_KEEP, key, plain("Keep forever"))
+	keep.WithStyle(slack.StylePrimary)
+	keep.Confirm = slack.NewConfirmationBlockObject(plain("Keep forever?"),
+		plain("This resource will never be marked again unless the exemption is removed."), plain("Keep"), plain("Cancel"))
+
+	approve := slack.NewButtonBlockElement(SLACK_ACTION_APPROVE, key, plain("Delete now"))
+	approve.WithStyle(slack.StyleDanger)
+	approve.Confirm = slack.NewConfirmationBlockObject(plain("Delete now?"),
+		plain("This skips the rest of the grace period and starts a sweep."), plain("Delete"), plain("Cancel"))
+
+	return slack.NewActionBlock(candidateBlockID(key), snooze, keep, approve)
+}
@@ -0,0 +1,221 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/armory-io/bilgepump/pkg/cache"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/nlopes/slack"
+	"github.com/prometheus/common/model"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	SLACK_ACTION_SNOOZE  = "snooze"
+	SLACK_ACTION_KEEP    = "keep"
+	SLACK_ACTION_APPROVE = "approve"
+	// slack payloads are small, anything bigger than this isn't from slack
+	MAX_SLACK_PAYLOAD = 1 << 20
+)
+
+// SlackInteractionHandler receives the button presses from the messages SlackNotifier sends.  Every
+// request has to carry a valid signature made with the app's signing secret.
+type SlackInteractionHandler struct {
+	config  *config.Config
+	logger  *logrus.Logger
+	cache   cache.Cache
+	markers []mark.Marker
+	secret  string
+	client  *http.Client
+}
+
+func NewSlackInteractionHandler(cfg *config.Config, logger *logrus.Logger, cache cache.Cache, markers []mark.Marker) (*SlackInteractionHandler, error) {
+	secret, err := cfg.Slack.SigningSecret.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	return &SlackInteractionHandler{
+		config:  cfg,
+		logger:  logger,
+		cache:   cache,
+		markers: markers,
+		secret:  secret,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (sh *SlackInteractionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, MAX_SLACK_PAYLOAD))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	verifier, err := slack.NewSecretsVerifier(r.Header, sh.secret)
+	if err != nil {
+		sh.logger.Warnf("Rejected slack interaction: %v", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if _, err := verifier.Write(body); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err := verifier.Ensure(); err != nil {
+		sh.logger.Warnf("Rejected slack interaction: %v", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var callback slack.InteractionCallback
+	if err := json.Unmarshal([]byte(form.Get("payload")), &callback); err != nil {
+		sh.logger.Error(err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if callback.Type != slack.InteractionTypeBlockActions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	outcomes := map[string]string{}
+	for _, action := range callback.ActionCallback.BlockActions {
+		key, ok := actionKey(callback, action)
+		if !ok {
+			outcomes[action.BlockID] = "This resource is no longer a candidate"
+			continue
+		}
+		outcomes[action.BlockID] = sh.handleAction(key, action, callback.User.ID)
+	}
+	w.WriteHeader(http.StatusOK)
+
+	if callback.ResponseURL != "" {
+		if err := sh.updateMessage(callback, outcomes); err != nil {
+			sh.logger.Error(err)
+		}
+	}
+}
+
+// actionKey is the candidate an action is for.  the buttons carry its key, so it's the pressed button's value
+// or, for the snooze menu, the value of a button in the same block of the message.
+func actionKey(callback slack.InteractionCallback, action *slack.BlockAction) (string, bool) {
+	key := action.Value
+	if key == "" {
+		for _, b := range callback.Message.Blocks.BlockSet {
+			ab, ok := b.(*slack.ActionBlock)
+			if !ok || ab.BlockID != action.BlockID {
+				continue
+			}
+			for _, e := range ab.Elements.ElementSet {
+				if button, ok := e.(*slack.ButtonBlockElement); ok && button.Value != "" {
+					key = button.Value
+				}
+			}
+		}
+	}
+	return key, key != "" && candidateBlockID(key) == action.BlockID
+}
+
+// handleAction applies a single button press to the candidate named by key and returns what happened, which
+// replaces the buttons in the message
+func (sh *SlackInteractionHandler) handleAction(key string, action *slack.BlockAction, userID string) string {
+	log := sh.logger.WithFields(logrus.Fields{"candidate": key, "slack_user": userID, "action": action.ActionID})
+	m, ok := mark.ReadCandidate(sh.cache, key)
+	if !ok {
+		return "This resource is no longer a candidate"
+	}
+
+	switch action.ActionID {
+	case SLACK_ACTION_SNOOZE:
+		d, err := model.ParseDuration(action.SelectedOption.Value)
+		if err != nil || d <= 0 {
+			log.Warnf("invalid snooze duration %q", action.SelectedOption.Value)
+			return fmt.Sprintf("Couldn't snooze for %q", action.SelectedOption.Value)
+		}
+		deadline, err := mark.ExtendGracePeriod(sh.cache, key, time.Duration(d), slackActor(userID))
+		if err != nil {
+			log.Error(err)
+			return "Snoozing failed, try again later"
+		}
+		log.Infof("snoozed until %s", deadline)
+		return fmt.Sprintf(":zzz: Snoozed by <@%s>, deletes after %s", userID, deadline.Format(time.RFC1123))
+	case SLACK_ACTION_KEEP:
+		if err := mark.Exempt(sh.cache, key, slackActor(userID)); err != nil {
+			log.Error(err)
+			return "Keeping failed, try again later"
+		}
+		log.Info("exempted")
+		return fmt.Sprintf(":lock: Kept forever by <@%s>", userID)
+	case SLACK_ACTION_APPROVE:
+		if err := mark.ApproveDeletion(sh.cache, key, slackActor(userID)); err != nil {
+			log.Error(err)
+			return "Approving failed, try again later"
+		}
+		log.Info("deletion approved")
+		sh.sweep(m)
+		return fmt.Sprintf(":wastebasket: Deletion approved by <@%s>", userID)
+	}
+	log.Warn("unknown slack action")
+	return fmt.Sprintf("Unknown action %s", action.ActionID)
+}
+
+// slackActor is who the audit log says acted on a candidate from slack
+func slackActor(userID string) string {
+	return "slack:" + userID
+}
+
+// sweep starts a sweep on the marker that owns the candidate so an approved deletion doesn't wait on
+// the sweep schedule
+func (sh *SlackInteractionHandler) sweep(m *mark.MarkedCandidate) {
+	for _, mk := range sh.markers {
+		if mk.GetType() == m.MarkerType && mk.GetName() == m.Account {
+			go mk.Sweep()
+		}
+	}
+}
+
+// updateMessage swaps the action block of every candidate that was acted on for a note saying what
+// happened, so nobody presses a button for something that's already been dealt with
+func (sh *SlackInteractionHandler) updateMessage(callback slack.InteractionCallback, outcomes map[string]string) error {
+	blocks := []slack.Block{}
+	for _, b := range callback.Message.Blocks.BlockSet {
+		if ab, ok := b.(*slack.ActionBlock); ok {
+			if outcome, ok := outcomes[ab.BlockID]; ok {
+				b = slack.NewContextBlock(ab.BlockID, slack.NewTextBlockObject(slack.MarkdownType, outcome, false, false))
+			}
+		}
+		blocks = append(blocks, b)
+	}
+	msg := slack.Msg{
+		Text:            callback.Message.Text,
+		ReplaceOriginal: true,
+		Blocks:          slack.Blocks{BlockSet: blocks},
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	resp, err := sh.client.Post(callback.ResponseURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack response url returned %s", resp.Status)
+	}
+	return nil
+}
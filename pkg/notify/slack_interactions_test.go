@@ -0,0 +1,171 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/armory-io/bilgepump/pkg/cache"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/nlopes/slack"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSigningSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+type sweepMarker struct {
+	swept chan bool
+}
+
+func (sm *sweepMarker) Mark()                     {}
+func (sm *sweepMarker) Sweep()                    { sm.swept <- true }
+func (sm *sweepMarker) GetMarkSchedule() string   { return "" }
+func (sm *sweepMarker) GetSweepSchedule() string  { return "" }
+func (sm *sweepMarker) GetNotifySchedule() string { return "" }
+func (sm *sweepMarker) GetName() string           { return "dev" }
+func (sm *sweepMarker) GetType() mark.MarkerType  { return mark.AWS }
+
+func signedRequest(t *testing.T, secret, body string, at time.Time) *http.Request {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(fmt.Sprintf("v0:%s:%s", ts, body))) //nolint
+	req := httptest.NewRequest(http.MethodPost, "/slack/interactions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Slack-Request-Timestamp", ts)
+	req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(h.Sum(nil)))
+	return req
+}
+
+func interactionBody(t *testing.T, responseUrl, key, actionID, value string) string {
+	msg := slack.NewBlockMessage(candidateActions(key, []string{"1d", "1w"}))
+	msg.Text = "Resources that have expiring ttl"
+	action := map[string]interface{}{"action_id": actionID, "block_id": candidateBlockID(key), "type": "button", "value": key}
+	if actionID == SLACK_ACTION_SNOOZE {
+		action = map[string]interface{}{"action_id": actionID, "block_id": candidateBlockID(key), "type": "static_select",
+			"selected_option": map[string]interface{}{"value": value}}
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"type":         "block_actions",
+		"user":         map[string]string{"id": "U123"},
+		"response_url": responseUrl,
+		"message":      msg,
+		"actions":      []interface{}{action},
+	})
+	assert.Nil(t, err)
+	return url.Values{"payload": {string(payload)}}.Encode()
+}
+
+func TestSlackInteractions(t *testing.T) {
+	candidate := &mark.MarkedCandidate{MarkerType: mark.AWS, CandidateType: "ec2", Id: "i-1", Owner: "alice", Account: "dev", Region: "us-west-2"}
+	key := candidate.Key()
+
+	cases := map[string]struct {
+		action   string
+		value    string
+		outcome  string
+		validate func(t *testing.T, c *cache.MemoryCache, swept chan bool)
+	}{
+		"snooze": {SLACK_ACTION_SNOOZE, "1w", "Snoozed by <@U123>", func(t *testing.T, c *cache.MemoryCache, swept chan bool) {
+			deadline, ok := c.ReadTimer(mark.TimerKey(key))
+			assert.True(t, ok)
+			assert.WithinDuration(t, time.Now().Add(24*time.Hour+7*24*time.Hour), deadline, time.Second)
+		}},
+		"keep": {SLACK_ACTION_KEEP, "", "Kept forever by <@U123>", func(t *testing.T, c *cache.MemoryCache, swept chan bool) {
+			assert.True(t, c.ExemptionExists(key))
+			assert.False(t, c.CandidateExists(key))
+		}},
+		"approve": {SLACK_ACTION_APPROVE, "", "Deletion approved by <@U123>", func(t *testing.T, c *cache.MemoryCache, swept chan bool) {
+			assert.False(t, c.TimerExists(mark.TimerKey(key)))
+			assert.True(t, <-swept)
+		}},
+		"bad snooze": {SLACK_ACTION_SNOOZE, "forever", "Couldn't snooze", func(t *testing.T, c *cache.MemoryCache, swept chan bool) {
+			deadline, ok := c.ReadTimer(mark.TimerKey(key))
+			assert.True(t, ok)
+			assert.WithinDuration(t, time.Now().Add(24*time.Hour), deadline, time.Second)
+		}},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := cache.NewMemoryCache()
+			_, err := mark.WriteCandidate(c, candidate, "1d")
+			assert.Nil(t, err)
+			sm := &sweepMarker{swept: make(chan bool, 1)}
+			cfg := &config.Config{Slack: config.Slack{SigningSecret: config.Secret{Value: testSigningSecret}}}
+			sh, err := NewSlackInteractionHandler(cfg, logrus.New(), c, []mark.Marker{sm})
+			assert.Nil(t, err)
+
+			var updated slack.Msg
+			responses := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				assert.Nil(t, json.Unmarshal(body, &updated))
+			}))
+			defer responses.Close()
+
+			w := httptest.NewRecorder()
+			sh.ServeHTTP(w, signedRequest(t, testSigningSecret, interactionBody(t, responses.URL, key, tc.action, tc.value), time.Now()))
+			assert.Equal(t, http.StatusOK, w.Code)
+			tc.validate(t, c, sm.swept)
+
+			// the buttons are replaced with what happened
+			assert.True(t, updated.ReplaceOriginal)
+			assert.Len(t, updated.Blocks.BlockSet, 1)
+			ctx, ok := updated.Blocks.BlockSet[0].(*slack.ContextBlock)
+			assert.True(t, ok)
+			assert.Contains(t, ctx.ContextElements.Elements[0].(*slack.TextBlockObject).Text, tc.outcome)
+		})
+	}
+}
+
+func TestSlackInteractionsLongKey(t *testing.T) {
+	// log group names run to 512 characters, twice slack's limit on block ids
+	candidate := &mark.MarkedCandidate{MarkerType: mark.AWS, CandidateType: "loggroup", Id: "/app/" + strings.Repeat("x", 507), Owner: "alice", Account: "dev", Region: "us-west-2"}
+	key := candidate.Key()
+	assert.True(t, len(candidateActions(key, nil).BlockID) <= 255)
+
+	c := cache.NewMemoryCache()
+	_, err := mark.WriteCandidate(c, candidate, "1d")
+	assert.Nil(t, err)
+	cfg := &config.Config{Slack: config.Slack{SigningSecret: config.Secret{Value: testSigningSecret}}}
+	sh, err := NewSlackInteractionHandler(cfg, logrus.New(), c, nil)
+	assert.Nil(t, err)
+
+	w := httptest.NewRecorder()
+	sh.ServeHTTP(w, signedRequest(t, testSigningSecret, interactionBody(t, "", key, SLACK_ACTION_SNOOZE, "1w"), time.Now()))
+	assert.Equal(t, http.StatusOK, w.Code)
+	deadline, ok := c.ReadTimer(mark.TimerKey(key))
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour+7*24*time.Hour), deadline, time.Second)
+}
+
+func TestSlackInteractionsRejectsBadSignatures(t *testing.T) {
+	c := cache.NewMemoryCache()
+	cfg := &config.Config{Slack: config.Slack{SigningSecret: config.Secret{Value: testSigningSecret}}}
+	sh, err := NewSlackInteractionHandler(cfg, logrus.New(), c, nil)
+	assert.Nil(t, err)
+	body := interactionBody(t, "", "AWS:dev:us-west-2:i-1", SLACK_ACTION_KEEP, "")
+
+	cases := map[string]*http.Request{
+		"wrong secret": signedRequest(t, "not-the-secret", body, time.Now()),
+		"replayed":     signedRequest(t, testSigningSecret, body, time.Now().Add(-time.Hour)),
+		"unsigned":     httptest.NewRequest(http.MethodPost, "/slack/interactions", strings.NewReader(body)),
+	}
+	for name, req := range cases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			sh.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+			assert.False(t, c.ExemptionExists("AWS:dev:us-west-2:i-1"))
+		})
+	}
+}
@@ -0,0 +1,437 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/armory-io/bilgepump/pkg/cache"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/prometheus/common/model"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	WEBHOOK_EVENT_DIGEST          = "digest"
+	WEBHOOK_EVENT_MARKED          = "marked"
+	WEBHOOK_EVENT_ABOUT_TO_DELETE = "about-to-delete"
+	WEBHOOK_EVENT_DELETED         = "deleted"
+	WEBHOOK_EVENT_SWEEP_HALTED    = "sweep-halted"
+	WEBHOOK_EVENT_REFUSED         = "refused"
+	WEBHOOK_EVENT_HEADER          = "X-Bilgepump-Event"
+	WEBHOOK_TIMESTAMP_HEADER      = "X-Bilgepump-Timestamp"
+	WEBHOOK_SIGNATURE_HEADER      = "X-Bilgepump-Signature"
+	// marked and deleted events older than this aren't posted, eg: on the first run
+	WEBHOOK_EVENT_LOOKBACK = 24 * time.Hour
+	WEBHOOK_MAX_BACKOFF    = time.Minute
+)
+
+// WebhookCandidate is a candidate as it's posted.  Marker is the configured account, project or cluster
+// that marked it and DeleteAt is null once it's only waiting on the next sweep.
+type WebhookCandidate struct {
+	Key           string            `json:"key"`
+	Marker        string            `json:"marker"`
+	MarkerType    string            `json:"marker_type"`
+	CandidateType string            `json:"candidate_type"`
+	Id            string            `json:"id"`
+	Owner         string            `json:"owner"`
+	Ttl           string            `json:"ttl,omitempty"`
+	Purpose       string            `json:"purpose,omitempty"`
+	Account       string            `json:"account"`
+	Region        string            `json:"region,omitempty"`
+	Tags          map[string]string `json:"tags,omitempty"`
+	Reason        string            `json:"reason,omitempty"`
+	GracePeriod   string            `json:"grace_period,omitempty"`
+	Expires       *time.Time        `json:"expires,omitempty"`
+	DeleteAt      *time.Time        `json:"delete_at"`
+	// Refused is why the sweep wouldn't delete it, in a refused event
+	Refused string `json:"refused,omitempty"`
+}
+
+// WebhookPayload is the document posted, and what a body template is run against.  Event is digest in
+// owner mode, otherwise the event that happened to its one candidate.  A sweep-halted event has the hold
+// and a sample of the candidates the sweep would have deleted, in either mode, and a refused event has an
+// owner's candidates the sweep wouldn't delete.
+type WebhookPayload struct {
+	Event      string              `json:"event"`
+	Time       time.Time           `json:"time"`
+	Owner      string              `json:"owner"`
+	Candidates []*WebhookCandidate `json:"candidates"`
+	Hold       *mark.SweepHold     `json:"hold,omitempty"`
+}
+
+// WebhookNotifier posts to one configured url
+type WebhookNotifier struct {
+	config     *config.Webhook
+	logger     *logrus.Logger
+	ctx        context.Context
+	cache      cache.Cache
+	client     *http.Client
+	secret     string
+	headers    map[string]string
+	body       *template.Template
+	events     map[string]bool
+	warnBefore time.Duration
+	backoff    time.Duration
+}
+
+var webhookFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// newWebhookNotifiers is the registry's factory, one notifier per configured webhook
+func newWebhookNotifiers(ctx context.Context, cfg *config.Config, logger *logrus.Logger, c cache.Cache) ([]Notifier, error) {
+	notifiers := []Notifier{}
+	for i := range cfg.Webhooks {
+		wn, err := NewWebhookNotifier(ctx, &cfg.Webhooks[i], logger, c)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, wn)
+	}
+	return notifiers, nil
+}
+
+func NewWebhookNotifier(ctx context.Context, cfg *config.Webhook, logger *logrus.Logger, c cache.Cache) (*WebhookNotifier, error) {
+	secret, err := cfg.Secret.Resolve()
+	if err != nil {
+		return nil, fmt.Errorf("(webhook %s) secret: %v", cfg.Name, err)
+	}
+	headers := map[string]string{}
+	for name, h := range cfg.Headers {
+		v, err := h.Resolve()
+		if err != nil {
+			return nil, fmt.Errorf("(webhook %s) header %s: %v", cfg.Name, name, err)
+		}
+		headers[name] = v
+	}
+	var body *template.Template
+	if cfg.Body != "" {
+		body, err = template.New(cfg.Name).Funcs(webhookFuncs).Parse(cfg.Body)
+		if err != nil {
+			return nil, fmt.Errorf("(webhook %s) body: %v", cfg.Name, err)
+		}
+	}
+	durations := map[string]time.Duration{}
+	for name, d := range map[string]string{"warn_before": cfg.WarnBefore, "retry_backoff": cfg.RetryBackoff, "timeout": cfg.Timeout} {
+		parsed, err := model.ParseDuration(d)
+		if err != nil {
+			return nil, fmt.Errorf("(webhook %s) %s: %v", cfg.Name, name, err)
+		}
+		durations[name] = time.Duration(parsed)
+	}
+	events := map[string]bool{}
+	for _, e := range cfg.Events {
+		events[e] = true
+	}
+	return &WebhookNotifier{
+		config:     cfg,
+		logger:     logger,
+		ctx:        ctx,
+		cache:      c,
+		client:     &http.Client{Timeout: durations["timeout"]},
+		secret:     secret,
+		headers:    headers,
+		body:       body,
+		events:     events,
+		warnBefore: durations["warn_before"],
+		backoff:    durations["retry_backoff"],
+	}, nil
+}
+
+func (wn *WebhookNotifier) Name() string {
+	return "webhook:" + wn.config.Name
+}
+
+// Send posts an owner's digest, the candidates a sweep refused to delete, or a halted sweep
+func (wn *WebhookNotifier) Send(owner string, d *Digest) error {
+	p := &WebhookPayload{Event: WEBHOOK_EVENT_DIGEST, Time: time.Now().UTC(), Owner: owner, Candidates: []*WebhookCandidate{}}
+	if d.Refused {
+		p.Event = WEBHOOK_EVENT_REFUSED
+	}
+	if d.Hold != nil {
+		p.Event = WEBHOOK_EVENT_SWEEP_HALTED
+		p.Hold = d.Hold
+	}
+	for _, dc := range d.Candidates {
+		wc := webhookCandidate(dc.MarkedCandidate, dc.DeleteAt)
+		wc.Refused = dc.Refused
+		p.Candidates = append(p.Candidates, wc)
+	}
+	return wn.post(p)
+}
+
+// Collect posts a digest per owner in owner mode.  In event mode it posts whatever was marked or deleted
+// since it last ran, any refused candidates or halted sweep it was handed, then a warning for each
+// candidate inside warn_before of its deadline.  What's been
+// posted is remembered in the cache, so restarts and other replicas don't post it again.
+func (wn *WebhookNotifier) Collect(digests []*Digest) error {
+	failed := 0
+	if wn.config.Mode != "event" {
+		for _, d := range digests {
+			if err := wn.Send(d.Owner, d); err != nil {
+				wn.logger.WithFields(logrus.Fields{"notifier": wn.Name(), "owner": d.Owner}).Error(err)
+				failed++
+			}
+		}
+		return wn.failures(failed)
+	}
+
+	if wn.events[WEBHOOK_EVENT_MARKED] || wn.events[WEBHOOK_EVENT_DELETED] {
+		events, err := mark.ReadAudit(wn.cache, mark.AuditQuery{Since: time.Now().Add(-WEBHOOK_EVENT_LOOKBACK)})
+		if err != nil {
+			return err
+		}
+		for _, e := range events {
+			if err := wn.auditEvent(e); err != nil {
+				wn.logger.WithFields(logrus.Fields{"notifier": wn.Name(), "candidate": e.Key}).Error(err)
+				failed++
+			}
+		}
+	}
+	for _, d := range digests {
+		if !d.Refused || !wn.events[WEBHOOK_EVENT_REFUSED] {
+			continue
+		}
+		if err := wn.Send(d.Owner, d); err != nil {
+			wn.logger.WithFields(logrus.Fields{"notifier": wn.Name(), "owner": d.Owner}).Error(err)
+			failed++
+		}
+	}
+	for _, d := range digests {
+		if d.Hold == nil || !wn.events[WEBHOOK_EVENT_SWEEP_HALTED] {
+			continue
+		}
+		if err := wn.sweepHalted(d); err != nil {
+			wn.logger.WithFields(logrus.Fields{"notifier": wn.Name(), "hold": d.Hold.Key}).Error(err)
+			failed++
+		}
+	}
+	if wn.events[WEBHOOK_EVENT_ABOUT_TO_DELETE] {
+		for _, d := range digests {
+			if d.Hold != nil || d.Refused {
+				continue
+			}
+			for _, dc := range d.Candidates {
+				if err := wn.aboutToDelete(dc); err != nil {
+					wn.logger.WithFields(logrus.Fields{"notifier": wn.Name(), "candidate": dc.Key}).Error(err)
+					failed++
+				}
+			}
+		}
+	}
+	return wn.failures(failed)
+}
+
+func (wn *WebhookNotifier) failures(failed int) error {
+	if failed == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d posts to %s failed", failed, wn.Name())
+}
+
+// auditEvent posts mark and delete audit events we haven't posted yet.  dry run deletes didn't delete anything.
+func (wn *WebhookNotifier) auditEvent(e *mark.AuditEvent) error {
+	event := ""
+	switch {
+	case e.Action == mark.AUDIT_MARK:
+		event = WEBHOOK_EVENT_MARKED
+	case e.Action == mark.AUDIT_DELETE && !e.DryRun:
+		event = WEBHOOK_EVENT_DELETED
+	}
+	if !wn.events[event] {
+		return nil
+	}
+	sent := wn.sentKey(event, fmt.Sprintf("%s:%d", e.Key, e.Time.UnixNano()))
+	if wn.cache.TimerExists(sent) {
+		return nil
+	}
+
+	wc := &WebhookCandidate{
+		Key:           e.Key,
+		Marker:        e.Account,
+		MarkerType:    e.MarkerType,
+		CandidateType: e.CandidateType,
+		Id:            e.Id,
+		Owner:         e.Owner,
+		Account:       e.Account,
+		Region:        e.Region,
+		Tags:          e.Tags,
+		Reason:        e.Reason,
+		GracePeriod:   e.GracePeriod,
+	}
+	// a candidate that's still marked has more to say than its audit event
+	if m, ok := mark.ReadCandidate(wn.cache, e.Key); ok && event == WEBHOOK_EVENT_MARKED {
+		var deleteAt *time.Time
+		if deadline, ok := wn.cache.ReadTimer(mark.TimerKey(e.Key)); ok {
+			deleteAt = &deadline
+		}
+		wc = webhookCandidate(m, deleteAt)
+		wc.GracePeriod = e.GracePeriod
+	}
+	if err := wn.post(&WebhookPayload{Event: event, Time: e.Time, Owner: e.Owner, Candidates: []*WebhookCandidate{wc}}); err != nil {
+		return err
+	}
+	return wn.cache.WriteTimer(sent, event, e.Time.Add(WEBHOOK_EVENT_LOOKBACK))
+}
+
+// sweepHalted posts each hold once.  the sent key lasts a lookback, by when someone has either approved it
+// or there's a new hold.
+func (wn *WebhookNotifier) sweepHalted(d *Digest) error {
+	sent := wn.sentKey(WEBHOOK_EVENT_SWEEP_HALTED, fmt.Sprintf("%s:%d", d.Hold.Key, d.Hold.Time.UnixNano()))
+	if wn.cache.TimerExists(sent) {
+		return nil
+	}
+	if err := wn.Send(d.Owner, d); err != nil {
+		return err
+	}
+	return wn.cache.WriteTimer(sent, WEBHOOK_EVENT_SWEEP_HALTED, time.Now().Add(WEBHOOK_EVENT_LOOKBACK))
+}
+
+// aboutToDelete warns once per deadline.  the warning's key expires a lookback after the deadline it
+// warned about, which is how we tell a snoozed candidate's new deadline needs a warning of its own.
+func (wn *WebhookNotifier) aboutToDelete(dc *DigestCandidate) error {
+	if dc.DeleteAt != nil && time.Until(*dc.DeleteAt) > wn.warnBefore {
+		return nil
+	}
+	sent := wn.sentKey(WEBHOOK_EVENT_ABOUT_TO_DELETE, dc.Key)
+	if expires, ok := wn.cache.ReadTimer(sent); ok {
+		if dc.DeleteAt == nil {
+			return nil
+		}
+		if warned := expires.Add(-WEBHOOK_EVENT_LOOKBACK); warned.Sub(*dc.DeleteAt).Abs() < time.Minute {
+			return nil
+		}
+	}
+	p := &WebhookPayload{
+		Event:      WEBHOOK_EVENT_ABOUT_TO_DELETE,
+		Time:       time.Now().UTC(),
+		Owner:      dc.Owner,
+		Candidates: []*WebhookCandidate{webhookCandidate(dc.MarkedCandidate, dc.DeleteAt)},
+	}
+	if err := wn.post(p); err != nil {
+		return err
+	}
+	deadline := time.Now()
+	if dc.DeleteAt != nil {
+		deadline = *dc.DeleteAt
+	}
+	return wn.cache.ResetTimer(sent, WEBHOOK_EVENT_ABOUT_TO_DELETE, deadline.Add(WEBHOOK_EVENT_LOOKBACK))
+}
+
+func (wn *WebhookNotifier) sentKey(event, id string) string {
+	return fmt.Sprintf("bilge:webhooks:%s:%s:%s", wn.config.Name, event, id)
+}
+
+func webhookCandidate(m *mark.MarkedCandidate, deleteAt *time.Time) *WebhookCandidate {
+	return &WebhookCandidate{
+		Key:           m.Key(),
+		Marker:        m.Account,
+		MarkerType:    m.MarkerType.String(),
+		CandidateType: m.CandidateType,
+		Id:            m.Id,
+		Owner:         m.Owner,
+		Ttl:           m.Ttl,
+		Purpose:       m.Purpose,
+		Account:       m.Account,
+		Region:        m.Region,
+		Tags:          m.Tags,
+		Reason:        m.Reason,
+		Expires:       m.Expires,
+		DeleteAt:      deleteAt,
+	}
+}
+
+func (wn *WebhookNotifier) render(p *WebhookPayload) ([]byte, error) {
+	if wn.body == nil {
+		return json.Marshal(p)
+	}
+	var b bytes.Buffer
+	if err := wn.body.Execute(&b, p); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// post retries connection errors, 429s and 5xxs with exponential backoff.  other responses are final.
+func (wn *WebhookNotifier) post(p *WebhookPayload) error {
+	body, err := wn.render(p)
+	if err != nil {
+		return err
+	}
+	backoff := wn.backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := wn.do(p.Event, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= wn.config.MaxRetries {
+			return err
+		}
+		wn.logger.WithField("notifier", wn.Name()).Debugf("retrying in %s: %v", backoff, err)
+		select {
+		case <-wn.ctx.Done():
+			return wn.ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > WEBHOOK_MAX_BACKOFF {
+			backoff = WEBHOOK_MAX_BACKOFF
+		}
+	}
+}
+
+// do makes one attempt and says whether it's worth another
+func (wn *WebhookNotifier) do(event string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(wn.ctx, http.MethodPost, wn.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", wn.config.ContentType)
+	req.Header.Set("User-Agent", "bilgepump")
+	for name, v := range wn.headers {
+		req.Header.Set(name, v)
+	}
+	req.Header.Set(WEBHOOK_EVENT_HEADER, event)
+	if wn.secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(WEBHOOK_TIMESTAMP_HEADER, timestamp)
+		req.Header.Set(WEBHOOK_SIGNATURE_HEADER, WebhookSignature(wn.secret, timestamp, body))
+	}
+
+	resp, err := wn.client.Do(req)
+	if err != nil {
+		return !errors.Is(err, context.Canceled), err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
+
+// WebhookSignature is what receivers should compare X-Bilgepump-Signature to: sha256= and the hex hmac-sha256
+// of the timestamp header, a period, and the raw body
+func WebhookSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,218 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/armory-io/bilgepump/pkg/cache"
+	"github.com/armory-io/bilgepump/pkg/config"
+	"github.com/armory-io/bilgepump/pkg/mark"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type webhookReceiver struct {
+	mux      sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+	// statuses are returned in order, then 200s
+	statuses []int
+}
+
+func (wr *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	wr.mux.Lock()
+	defer wr.mux.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	wr.requests = append(wr.requests, r)
+	wr.bodies = append(wr.bodies, body)
+	if len(wr.statuses) != 0 {
+		w.WriteHeader(wr.statuses[0])
+		wr.statuses = wr.statuses[1:]
+	}
+}
+
+func (wr *webhookReceiver) payloads(t *testing.T) []*WebhookPayload {
+	wr.mux.Lock()
+	defer wr.mux.Unlock()
+	payloads := []*WebhookPayload{}
+	for _, b := range wr.bodies {
+		var p *WebhookPayload
+		assert.Nil(t, json.Unmarshal(b, &p))
+		payloads = append(payloads, p)
+	}
+	return payloads
+}
+
+func newTestWebhook(t *testing.T, url string, c cache.Cache, mutate func(w *config.Webhook)) *WebhookNotifier {
+	cfg := &config.Webhook{Name: "tickets", URL: url, Mode: "owner", WarnBefore: "24h", ContentType: "application/json", MaxRetries: 2, RetryBackoff: "1ms", Timeout: "5s"}
+	if mutate != nil {
+		mutate(cfg)
+	}
+	wn, err := NewWebhookNotifier(context.Background(), cfg, logrus.New(), c)
+	assert.Nil(t, err)
+	return wn
+}
+
+func TestWebhookDigest(t *testing.T) {
+	wr := &webhookReceiver{statuses: []int{http.StatusBadGateway}}
+	srv := httptest.NewServer(wr)
+	defer srv.Close()
+
+	c := cache.NewMemoryCache()
+	m := &mark.MarkedCandidate{MarkerType: mark.AWS, CandidateType: "ec2", Id: "i-1", Owner: "alice", Account: "dev", Region: "us-west-2", Ttl: "1d"}
+	_, err := mark.WriteCandidate(c, m, "2d")
+	assert.Nil(t, err)
+	wn := newTestWebhook(t, srv.URL, c, func(w *config.Webhook) {
+		w.Secret = config.Secret{Value: "shh"}
+		w.Headers = map[string]config.Secret{"Authorization": {Value: "Bearer t0ken"}}
+	})
+	digests, err := Digests(c)
+	assert.Nil(t, err)
+	assert.Nil(t, wn.Collect(digests))
+
+	// the 502 was retried
+	assert.Len(t, wr.requests, 2)
+	r := wr.requests[1]
+	assert.Equal(t, "Bearer t0ken", r.Header.Get("Authorization"))
+	assert.Equal(t, WEBHOOK_EVENT_DIGEST, r.Header.Get(WEBHOOK_EVENT_HEADER))
+	assert.Equal(t, WebhookSignature("shh", r.Header.Get(WEBHOOK_TIMESTAMP_HEADER), wr.bodies[1]), r.Header.Get(WEBHOOK_SIGNATURE_HEADER))
+
+	p := wr.payloads(t)[1]
+	assert.Equal(t, "alice", p.Owner)
+	assert.Len(t, p.Candidates, 1)
+	assert.Equal(t, m.Key(), p.Candidates[0].Key)
+	assert.Equal(t, "dev", p.Candidates[0].Marker)
+	assert.Equal(t, "AWS", p.Candidates[0].MarkerType)
+	assert.NotNil(t, p.Candidates[0].DeleteAt)
+}
+
+func TestWebhookRetries(t *testing.T) {
+	wr := &webhookReceiver{statuses: []int{http.StatusBadRequest}}
+	srv := httptest.NewServer(wr)
+	defer srv.Close()
+	wn := newTestWebhook(t, srv.URL, cache.NewMemoryCache(), nil)
+
+	// 4xx aren't retried
+	assert.NotNil(t, wn.post(&WebhookPayload{Event: WEBHOOK_EVENT_DIGEST}))
+	assert.Len(t, wr.requests, 1)
+
+	// 5xx are, up to max_retries
+	wr.statuses = []int{500, 500, 500}
+	assert.NotNil(t, wn.post(&WebhookPayload{Event: WEBHOOK_EVENT_DIGEST}))
+	assert.Len(t, wr.requests, 4)
+	wr.statuses = []int{429, 500}
+	assert.Nil(t, wn.post(&WebhookPayload{Event: WEBHOOK_EVENT_DIGEST}))
+	assert.Len(t, wr.requests, 7)
+}
+
+func TestWebhookBodyTemplate(t *testing.T) {
+	wr := &webhookReceiver{}
+	srv := httptest.NewServer(wr)
+	defer srv.Close()
+	wn := newTestWebhook(t, srv.URL, cache.NewMemoryCache(), func(w *config.Webhook) {
+		w.ContentType = "text/plain"
+		w.Body = `{{ .Event }} for {{ .Owner }}:{{ range .Candidates }} {{ .Id }}{{ end }} {{ json .Owner }}`
+	})
+	assert.Nil(t, wn.post(&WebhookPayload{Event: WEBHOOK_EVENT_DIGEST, Owner: "bob", Candidates: []*WebhookCandidate{{Id: "i-1"}, {Id: "i-2"}}}))
+	assert.Equal(t, `digest for bob: i-1 i-2 "bob"`, string(wr.bodies[0]))
+	assert.Equal(t, "text/plain", wr.requests[0].Header.Get("Content-Type"))
+
+	_, err := NewWebhookNotifier(context.Background(), &config.Webhook{Name: "bad", Body: "{{ .Nope"}, logrus.New(), cache.NewMemoryCache())
+	assert.NotNil(t, err)
+}
+
+func TestWebhookEvents(t *testing.T) {
+	wr := &webhookReceiver{}
+	srv := httptest.NewServer(wr)
+	defer srv.Close()
+
+	c := cache.NewMemoryCache()
+	soon := &mark.MarkedCandidate{MarkerType: mark.AWS, CandidateType: "ec2", Id: "i-soon", Owner: "alice", Account: "dev"}
+	later := &mark.MarkedCandidate{MarkerType: mark.AWS, CandidateType: "ec2", Id: "i-later", Owner: "alice", Account: "dev"}
+	gone := &mark.MarkedCandidate{MarkerType: mark.K8S, CandidateType: "namespace", Id: "ns-1", Owner: "bob", Account: "eks"}
+	_, err := mark.WriteCandidate(c, soon, "1h")
+	assert.Nil(t, err)
+	_, err = mark.WriteCandidate(c, later, "1w")
+	assert.Nil(t, err)
+	_, err = mark.WriteCandidate(c, gone, "1h")
+	assert.Nil(t, err)
+	assert.Nil(t, mark.Swept(c, gone.Key(), false))
+	assert.Nil(t, c.DeleteCandidate(gone.Key()))
+
+	wn := newTestWebhook(t, srv.URL, c, func(w *config.Webhook) {
+		w.Mode = "event"
+		w.Events = []string{WEBHOOK_EVENT_MARKED, WEBHOOK_EVENT_ABOUT_TO_DELETE, WEBHOOK_EVENT_DELETED}
+	})
+	collect := func() {
+		digests, err := Digests(c)
+		assert.Nil(t, err)
+		assert.Nil(t, wn.Collect(digests))
+	}
+	collect()
+
+	events := map[string][]string{}
+	for _, p := range wr.payloads(t) {
+		assert.Len(t, p.Candidates, 1)
+		events[p.Event] = append(events[p.Event], p.Candidates[0].Id)
+	}
+	assert.ElementsMatch(t, []string{"i-soon", "i-later", "ns-1"}, events[WEBHOOK_EVENT_MARKED])
+	assert.Equal(t, []string{"ns-1"}, events[WEBHOOK_EVENT_DELETED])
+	assert.Equal(t, []string{"i-soon"}, events[WEBHOOK_EVENT_ABOUT_TO_DELETE])
+
+	// nothing new, nothing posted
+	collect()
+	assert.Len(t, wr.requests, 5)
+
+	// a snooze gets its own warning once it's close again
+	assert.Nil(t, c.ResetTimer(mark.TimerKey(soon.Key()), "1h", time.Now().Add(2*time.Hour)))
+	collect()
+	assert.Len(t, wr.requests, 6)
+	assert.Equal(t, WEBHOOK_EVENT_ABOUT_TO_DELETE, wr.payloads(t)[5].Event)
+}
+
+func TestWebhookSweepHalted(t *testing.T) {
+	wr := &webhookReceiver{}
+	srv := httptest.NewServer(wr)
+	defer srv.Close()
+
+	c := cache.NewMemoryCache()
+	m := &mark.MarkedCandidate{MarkerType: mark.AWS, CandidateType: "ec2", Id: "i-1", Owner: "alice", Account: "dev"}
+	_, err := mark.WriteCandidate(c, m, "0s")
+	assert.Nil(t, err)
+	h, err := mark.CheckSweep(c, mark.AWS, "dev", config.SweepLimits{MaxDeletionsPerType: map[string]int{"ec2": 1, "ebs": 1}}, mark.NewInventory())
+	assert.Nil(t, err)
+	assert.Nil(t, h)
+	_, err = mark.CheckSweep(c, mark.AWS, "dev", config.SweepLimits{MaxPercent: 20}, inventoryOf(4))
+	assert.Nil(t, err)
+
+	wn := newTestWebhook(t, srv.URL, c, func(w *config.Webhook) {
+		w.Mode = "event"
+		w.Events = []string{WEBHOOK_EVENT_SWEEP_HALTED, WEBHOOK_EVENT_ABOUT_TO_DELETE}
+	})
+	for i := 0; i < 2; i++ {
+		digests, err := HoldDigests(c)
+		assert.Nil(t, err)
+		assert.Nil(t, wn.Collect(digests))
+	}
+
+	// posted once, and the candidates it holds up aren't about-to-delete events
+	payloads := wr.payloads(t)
+	assert.Len(t, payloads, 1)
+	assert.Equal(t, WEBHOOK_EVENT_SWEEP_HALTED, payloads[0].Event)
+	assert.Equal(t, "AWS:dev", payloads[0].Hold.Key)
+	assert.Equal(t, 25, int(100*payloads[0].Hold.Due/payloads[0].Hold.Inventory))
+	assert.Equal(t, "i-1", payloads[0].Candidates[0].Id)
+}
+
+func inventoryOf(n int) *mark.Inventory {
+	inv := mark.NewInventory()
+	for i := 0; i < n; i++ {
+		inv.Add("us-west-2/ec2")
+	}
+	return inv
+}